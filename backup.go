@@ -0,0 +1,286 @@
+//  Copyright (c) 2024 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bleve
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/blevesearch/bleve/v2/index/scorch"
+)
+
+// BackupIndex is an Index able to take a consistent copy of itself
+// while it stays open for reads and writes.
+type BackupIndex interface {
+	Index
+
+	// Backup writes a copy of the index to path, which must not exist
+	// yet.  The copy can be opened with Open.
+	Backup(path string) error
+	// BackupTo streams a copy of the index to w as a tar archive, which
+	// Restore turns back into an index.
+	BackupTo(w io.Writer) error
+	// BackupIncremental adds the contents of the index last persisted
+	// to the incremental backup set in dir as a new epoch, copying only
+	// what the set does not hold yet, and returns that epoch.
+	BackupIncremental(dir string) (uint64, error)
+}
+
+// backupable is implemented by the index types supporting online
+// backups, such as scorch.
+type backupable interface {
+	Backup(dir string) error
+	BackupFiles(visitor func(name string, size int64, r io.Reader) error) error
+	BackupIncremental(dir string) (uint64, error)
+}
+
+func (i *indexImpl) Backup(path string) error {
+	i.mutex.RLock()
+	defer i.mutex.RUnlock()
+
+	if !i.open {
+		return ErrorIndexClosed
+	}
+
+	b, ok := i.i.(backupable)
+	if !ok {
+		return ErrorBackupNotSupported
+	}
+
+	if _, err := os.Stat(path); err == nil {
+		return ErrorIndexPathExists
+	}
+	err := i.meta.Save(path)
+	if err != nil {
+		return err
+	}
+	err = b.Backup(indexStorePath(path))
+	if err != nil {
+		_ = os.RemoveAll(path)
+		return err
+	}
+	return nil
+}
+
+func (i *indexImpl) BackupTo(w io.Writer) error {
+	i.mutex.RLock()
+	defer i.mutex.RUnlock()
+
+	if !i.open {
+		return ErrorIndexClosed
+	}
+
+	b, ok := i.i.(backupable)
+	if !ok {
+		return ErrorBackupNotSupported
+	}
+
+	metaBytes, err := json.Marshal(i.meta)
+	if err != nil {
+		return err
+	}
+
+	// the files of the index are streamed into the archive as they are
+	// visited, the root.bolt of the store last
+	now := time.Now()
+	tw := tar.NewWriter(w)
+	err = tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     metaFilename,
+		Size:     int64(len(metaBytes)),
+		Mode:     0600,
+		ModTime:  now,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = tw.Write(metaBytes)
+	if err != nil {
+		return err
+	}
+	err = tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeDir,
+		Name:     storePath + "/",
+		Mode:     0700,
+		ModTime:  now,
+	})
+	if err != nil {
+		return err
+	}
+	err = b.BackupFiles(func(name string, size int64, r io.Reader) error {
+		err := tw.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     path.Join(storePath, name),
+			Size:     size,
+			Mode:     0600,
+			ModTime:  now,
+		})
+		if err != nil {
+			return err
+		}
+		_, err = io.CopyN(tw, r, size)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+func (i *indexImpl) BackupIncremental(dir string) (uint64, error) {
+	i.mutex.RLock()
+	defer i.mutex.RUnlock()
+
+	if !i.open {
+		return 0, ErrorIndexClosed
+	}
+
+	b, ok := i.i.(backupable)
+	if !ok {
+		return 0, ErrorBackupNotSupported
+	}
+
+	// the metadata is the same for every epoch of the set
+	err := i.meta.Save(dir)
+	if err != nil && err != ErrorIndexPathExists {
+		return 0, err
+	}
+	return b.BackupIncremental(indexStorePath(dir))
+}
+
+// BackupEpochs returns the epochs held by the incremental backup set in
+// dir, oldest first.
+func BackupEpochs(dir string) ([]uint64, error) {
+	manifest, err := scorch.ReadBackupManifest(indexStorePath(dir))
+	if err != nil {
+		return nil, err
+	}
+	rv := make([]uint64, 0, len(manifest.Epochs))
+	for _, e := range manifest.Epochs {
+		rv = append(rv, e.Epoch)
+	}
+	return rv, nil
+}
+
+// RestoreIncremental rebuilds the given epoch of the incremental backup
+// set in dir as an index in indexPath, which must not exist yet.  An
+// epoch of 0 restores the latest one.  The restored index can then be
+// opened with Open.
+func RestoreIncremental(dir string, epoch uint64, indexPath string) (err error) {
+	if _, err = os.Stat(indexPath); err == nil {
+		return ErrorIndexPathExists
+	}
+	im, err := openIndexMeta(dir)
+	if err != nil {
+		return err
+	}
+	err = im.Save(indexPath)
+	if err != nil {
+		return err
+	}
+	err = scorch.RestoreIncrementalBackup(indexStorePath(dir), epoch,
+		indexStorePath(indexPath))
+	if err != nil {
+		_ = os.RemoveAll(indexPath)
+		return err
+	}
+	return nil
+}
+
+// Restore extracts a backup archive written by BackupTo into indexPath,
+// which must not exist yet.  The restored index can then be opened
+// with Open.
+func Restore(r io.Reader, indexPath string) (err error) {
+	if _, err = os.Stat(indexPath); err == nil {
+		return ErrorIndexPathExists
+	}
+	err = os.MkdirAll(indexPath, 0700)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = os.RemoveAll(indexPath)
+		}
+	}()
+
+	tr := tar.NewReader(r)
+	for {
+		var hdr *tar.Header
+		hdr, err = tr.Next()
+		if err == io.EOF {
+			err = nil
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		name := path.Clean(hdr.Name)
+		if path.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../") {
+			return fmt.Errorf("restore: invalid archive entry %q", hdr.Name)
+		}
+		target := filepath.Join(indexPath, filepath.FromSlash(name))
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(target, 0700)
+			if err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			err = os.MkdirAll(filepath.Dir(target), 0700)
+			if err != nil {
+				return err
+			}
+			err = restoreFile(tr, target)
+			if err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("restore: unsupported archive entry %q", hdr.Name)
+		}
+	}
+
+	if _, err = os.Stat(indexMetaPath(indexPath)); err != nil {
+		return ErrorIndexMetaMissing
+	}
+	return nil
+}
+
+func restoreFile(r io.Reader, target string) (err error) {
+	f, err := os.OpenFile(target, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}()
+
+	_, err = io.Copy(f, r)
+	if err != nil {
+		return err
+	}
+	return f.Sync()
+}
@@ -0,0 +1,71 @@
+//  Copyright (c) 2024 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bleve
+
+import (
+	"github.com/blevesearch/bleve/v2/index/scorch"
+)
+
+// ChangeStreamIndex is an Index recording the mutations applied by each
+// batch in a durable, ordered change stream, for scorch indexes created
+// with "changeStream" set to true in their config.
+type ChangeStreamIndex interface {
+	Index
+
+	// SubscribeChanges returns a subscription delivering the change
+	// records in order, starting at the sequence number from, or at the
+	// oldest record kept when from is 0.
+	SubscribeChanges(from uint64) (*scorch.ChangeSubscription, error)
+	// TrimChanges removes the change records numbered before the
+	// sequence number before.
+	TrimChanges(before uint64) error
+}
+
+// changeStream is implemented by the index types supporting change
+// streams, such as scorch.
+type changeStream interface {
+	SubscribeChanges(from uint64) (*scorch.ChangeSubscription, error)
+	TrimChanges(before uint64) error
+}
+
+func (i *indexImpl) changeStream() (changeStream, error) {
+	i.mutex.RLock()
+	defer i.mutex.RUnlock()
+
+	if !i.open {
+		return nil, ErrorIndexClosed
+	}
+	cs, ok := i.i.(changeStream)
+	if !ok {
+		return nil, ErrorChangeStreamNotSupported
+	}
+	return cs, nil
+}
+
+func (i *indexImpl) SubscribeChanges(from uint64) (*scorch.ChangeSubscription, error) {
+	cs, err := i.changeStream()
+	if err != nil {
+		return nil, err
+	}
+	return cs.SubscribeChanges(from)
+}
+
+func (i *indexImpl) TrimChanges(before uint64) error {
+	cs, err := i.changeStream()
+	if err != nil {
+		return err
+	}
+	return cs.TrimChanges(before)
+}
@@ -24,16 +24,47 @@ import (
 
 var checkFieldName string
 var checkCount int
+var checkRepair bool
 
 // checkCmd represents the check command
 var checkCmd = &cobra.Command{
 	Use:   "check [index path]",
 	Short: "checks the contents of the index",
-	Long:  `The check command will perform consistency checks on the index.`,
+	Long:  `The check command will perform consistency checks on the index. Scorch indexes are first verified offline, each segment file against its checksum and its postings, doc values and stored fields against each other, reporting the corrupt segments. With --repair these are dropped, and their documents indexed again from their stored fields where possible.`,
+	Annotations: map[string]string{
+		canMutateBleveIndex: "true",
+	},
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) < 1 {
+			return fmt.Errorf("must specify path to index")
+		}
+		return nil
+	},
+	PersistentPostRunE: func(cmd *cobra.Command, args []string) error {
+		if idx == nil {
+			return nil
+		}
+		err := idx.Close()
+		if err != nil {
+			return fmt.Errorf("error closing bleve index: %v", err)
+		}
+		return nil
+	},
 	RunE: func(cmd *cobra.Command, args []string) error {
+		err := verifyIndex(args[0])
+		if err != nil {
+			return err
+		}
+
+		runtimeConfig := map[string]interface{}{
+			"read_only": DefaultOpenReadOnly,
+		}
+		idx, err = bleve.OpenUsing(args[0], runtimeConfig)
+		if err != nil {
+			return fmt.Errorf("error opening bleve index: %v", err)
+		}
 
 		var fieldNames []string
-		var err error
 		if checkFieldName == "" {
 			fieldNames, err = idx.Fields()
 			if err != nil {
@@ -62,6 +93,46 @@ var checkCmd = &cobra.Command{
 	},
 }
 
+// verifyIndex verifies the index at path while it is not open, repairing
+// it if asked, as searching a corrupt index would panic.
+func verifyIndex(path string) error {
+	report, err := bleve.Verify(path, nil)
+	if err == bleve.ErrorVerifyNotSupported {
+		fmt.Printf("index type does not support verification, skipping\n")
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error verifying bleve index: %v", err)
+	}
+	fmt.Printf("verified %d snapshots, %d segments\n",
+		len(report.Snapshots), len(report.Segments))
+	for _, problem := range report.Problems {
+		fmt.Printf("%s\n", problem)
+	}
+	corrupt := report.CorruptSegments()
+	if len(report.Problems) == 0 {
+		return nil
+	}
+	if !checkRepair {
+		return fmt.Errorf("found %d problems, corrupt segments: %v, run with"+
+			" --repair to drop them\n", len(report.Problems), corrupt)
+	}
+	if len(corrupt) == 0 {
+		return fmt.Errorf("found %d problems, none repairable\n",
+			len(report.Problems))
+	}
+
+	repair, err := bleve.Repair(path, nil, report)
+	if err != nil {
+		return fmt.Errorf("error repairing bleve index: %v", err)
+	}
+	fmt.Printf("dropped segments %v in new snapshot epoch %d\n",
+		repair.Dropped, repair.Epoch)
+	fmt.Printf("recovered %d documents from stored fields, lost %d, segments"+
+		" unreadable: %v\n", len(repair.Recovered), repair.Lost, repair.Unreadable)
+	return nil
+}
+
 func checkField(index bleve.Index, fieldName string) (int, error) {
 	termDictionary, err := getDictionary(index, fieldName)
 	if err != nil {
@@ -128,4 +199,5 @@ func init() {
 	RootCmd.AddCommand(checkCmd)
 	checkCmd.Flags().StringVarP(&checkFieldName, "field", "f", "", "Restrict check to the specified field name.")
 	checkCmd.Flags().IntVarP(&checkCount, "count", "c", 100, "Check this many terms.")
+	checkCmd.Flags().BoolVar(&checkRepair, "repair", false, "Drop the corrupt segments found, indexing their documents again from their stored fields.")
 }
@@ -0,0 +1,70 @@
+// Copyright © 2024 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/blevesearch/bleve/v2"
+	"github.com/spf13/cobra"
+)
+
+// migrateCmd represents the migrate command
+var migrateCmd = &cobra.Command{
+	Use:   "migrate [index path] [new index path]",
+	Short: "migrates an upsidedown index to scorch",
+	Long:  `The migrate command rebuilds an upsidedown index as a scorch index, from the stored fields of its documents. Without a new index path the index is migrated in place, the upsidedown index being kept alongside it with the .upsidedown suffix. The fields which were not stored cannot be rebuilt and are reported.`,
+	Annotations: map[string]string{
+		canMutateBleveIndex: "true",
+	},
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		// override RootCmd version which opens existing index
+		if len(args) < 1 {
+			return fmt.Errorf("must specify path to index")
+		}
+		return nil
+	},
+	PersistentPostRunE: func(cmd *cobra.Command, args []string) error {
+		return nil
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var newPath string
+		if len(args) > 1 {
+			newPath = args[1]
+		}
+		report, err := bleve.MigrateToScorch(args[0], newPath, nil)
+		if err != nil {
+			return fmt.Errorf("error migrating index: %v", err)
+		}
+		fmt.Printf("migrated %d documents, %d internal keys\n",
+			report.Documents, report.InternalKeys)
+		if len(report.UnstoredFields) > 0 {
+			fmt.Printf("fields not stored, missing from the documents: %v\n",
+				report.UnstoredFields)
+		}
+		for field, n := range report.PartlyStoredFields {
+			fmt.Printf("field %s not stored by %d documents, missing from them\n",
+				field, n)
+		}
+		if report.Backup != "" {
+			fmt.Printf("upsidedown index kept at %s\n", report.Backup)
+		}
+		return nil
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(migrateCmd)
+}
@@ -0,0 +1,56 @@
+//  Copyright (c) 2024 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scorch
+
+import (
+	"fmt"
+
+	"github.com/blevesearch/bleve/v2/index/scorch"
+	"github.com/spf13/cobra"
+)
+
+var rollbackEpoch uint64
+
+// rollbackCmd represents the rollback command
+var rollbackCmd = &cobra.Command{
+	Use:               "rollback [path] [tag]",
+	Short:             "rollback brings the index back to a tagged snapshot",
+	Long:              `The rollback command brings the index back to the snapshot of a tag, or of the epoch given by the --epoch flag, discarding the younger snapshots.  The index must not be open.`,
+	PersistentPreRunE: offlinePreRun,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if rollbackEpoch != 0 {
+			rollbackPoints, err := scorch.RollbackPoints(args[0])
+			if err != nil {
+				return err
+			}
+			for _, rollbackPoint := range rollbackPoints {
+				if rollbackPoint.Epoch() == rollbackEpoch {
+					return scorch.Rollback(args[0], rollbackPoint)
+				}
+			}
+			return fmt.Errorf("snapshot epoch %d not found", rollbackEpoch)
+		}
+
+		if len(args) < 2 {
+			return fmt.Errorf("tag name or --epoch required")
+		}
+		return scorch.RollbackToTag(args[0], args[1])
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(rollbackCmd)
+	rollbackCmd.Flags().Uint64VarP(&rollbackEpoch, "epoch", "e", 0, "roll back to this snapshot epoch instead of a tag")
+}
@@ -17,7 +17,9 @@ package scorch
 import (
 	"fmt"
 	"strconv"
+	"strings"
 
+	"github.com/blevesearch/bleve/v2/index/scorch"
 	seg "github.com/blevesearch/scorch_segment_api/v2"
 	"github.com/spf13/cobra"
 )
@@ -34,8 +36,21 @@ var snapshotCmd = &cobra.Command{
 			if err != nil {
 				return err
 			}
+			tags, err := index.SnapshotTags()
+			if err != nil {
+				return err
+			}
+			tagsByEpoch := map[uint64][]string{}
+			for _, tag := range tags {
+				tagsByEpoch[tag.Epoch] = append(tagsByEpoch[tag.Epoch], tag.Name)
+			}
 			for _, snapshotEpoch := range snapshotEpochs {
-				fmt.Printf("snapshot epoch: %d\n", snapshotEpoch)
+				if names, ok := tagsByEpoch[snapshotEpoch]; ok {
+					fmt.Printf("snapshot epoch: %d tags: %s\n", snapshotEpoch,
+						strings.Join(names, ", "))
+				} else {
+					fmt.Printf("snapshot epoch: %d\n", snapshotEpoch)
+				}
 			}
 		} else if len(args) < 3 {
 			snapshotEpoch, err := strconv.ParseUint(args[1], 10, 64)
@@ -59,6 +74,58 @@ var snapshotCmd = &cobra.Command{
 	},
 }
 
+// offlinePreRun replaces the opening of the index by RootCmd for the
+// commands writing to it, which need it closed
+func offlinePreRun(cmd *cobra.Command, args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("must specify path to scorch index")
+	}
+	return nil
+}
+
+// snapshotTagCmd represents the snapshot tag command
+var snapshotTagCmd = &cobra.Command{
+	Use:               "tag [path] [name] [epoch]",
+	Short:             "tag names a snapshot, keeping it from cleanup",
+	Long:              `The tag command names the snapshot of the given epoch, or the latest one, keeping it from cleanup so the index can be rolled back to it.`,
+	PersistentPreRunE: offlinePreRun,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) < 2 {
+			return fmt.Errorf("tag name required")
+		}
+		var epoch uint64
+		if len(args) > 2 {
+			var err error
+			epoch, err = strconv.ParseUint(args[2], 10, 64)
+			if err != nil {
+				return err
+			}
+		}
+		epoch, err := scorch.TagSnapshot(args[0], args[1], epoch)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("tagged snapshot epoch %d as %s\n", epoch, args[1])
+		return nil
+	},
+}
+
+// snapshotUntagCmd represents the snapshot untag command
+var snapshotUntagCmd = &cobra.Command{
+	Use:               "untag [path] [name]",
+	Short:             "untag deletes a snapshot tag",
+	Long:              `The untag command deletes a snapshot tag, the snapshot becoming subject to cleanup again.`,
+	PersistentPreRunE: offlinePreRun,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) < 2 {
+			return fmt.Errorf("tag name required")
+		}
+		return scorch.DeleteSnapshotTag(args[0], args[1])
+	},
+}
+
 func init() {
 	RootCmd.AddCommand(snapshotCmd)
+	snapshotCmd.AddCommand(snapshotTagCmd)
+	snapshotCmd.AddCommand(snapshotUntagCmd)
 }
@@ -30,6 +30,10 @@ import (
 	_ "github.com/blevesearch/bleve/v2/search/highlight/highlighter/html"
 	_ "github.com/blevesearch/bleve/v2/search/highlight/highlighter/simple"
 
+	// ltr models
+	_ "github.com/blevesearch/bleve/v2/search/ltr/model/linear"
+	_ "github.com/blevesearch/bleve/v2/search/ltr/model/tree"
+
 	// char filters
 	_ "github.com/blevesearch/bleve/v2/analysis/char/asciifolding"
 	_ "github.com/blevesearch/bleve/v2/analysis/char/html"
@@ -106,6 +110,7 @@ import (
 
 	// kv stores
 	_ "github.com/blevesearch/bleve/v2/index/upsidedown/store/boltdb"
+	_ "github.com/blevesearch/bleve/v2/index/upsidedown/store/encrypted"
 	_ "github.com/blevesearch/bleve/v2/index/upsidedown/store/goleveldb"
 	_ "github.com/blevesearch/bleve/v2/index/upsidedown/store/gtreap"
 	_ "github.com/blevesearch/bleve/v2/index/upsidedown/store/moss"
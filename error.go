@@ -26,6 +26,15 @@ const (
 	ErrorUnknownIndexType
 	ErrorEmptyID
 	ErrorIndexReadInconsistency
+	ErrorPointInTimeNotFound
+	ErrorAliasPointInTime
+	ErrorBackupNotSupported
+	ErrorChangeStreamNotSupported
+	ErrorSnapshotTagsNotSupported
+	ErrorSnapshotTagNotFound
+	ErrorVerifyNotSupported
+	ErrorMigrateNotSupported
+	ErrorMigrateTypeNotStored
 )
 
 // Error represents a more strongly typed bleve error for detecting
@@ -37,14 +46,23 @@ func (e Error) Error() string {
 }
 
 var errorMessages = map[Error]string{
-	ErrorIndexPathExists:        "cannot create new index, path already exists",
-	ErrorIndexPathDoesNotExist:  "cannot open index, path does not exist",
-	ErrorIndexMetaMissing:       "cannot open index, metadata missing",
-	ErrorIndexMetaCorrupt:       "cannot open index, metadata corrupt",
-	ErrorIndexClosed:            "index is closed",
-	ErrorAliasMulti:             "cannot perform single index operation on multiple index alias",
-	ErrorAliasEmpty:             "cannot perform operation on empty alias",
-	ErrorUnknownIndexType:       "unknown index type",
-	ErrorEmptyID:                "document ID cannot be empty",
-	ErrorIndexReadInconsistency: "index read inconsistency detected",
+	ErrorIndexPathExists:          "cannot create new index, path already exists",
+	ErrorIndexPathDoesNotExist:    "cannot open index, path does not exist",
+	ErrorIndexMetaMissing:         "cannot open index, metadata missing",
+	ErrorIndexMetaCorrupt:         "cannot open index, metadata corrupt",
+	ErrorIndexClosed:              "index is closed",
+	ErrorAliasMulti:               "cannot perform single index operation on multiple index alias",
+	ErrorAliasEmpty:               "cannot perform operation on empty alias",
+	ErrorUnknownIndexType:         "unknown index type",
+	ErrorEmptyID:                  "document ID cannot be empty",
+	ErrorIndexReadInconsistency:   "index read inconsistency detected",
+	ErrorPointInTimeNotFound:      "point in time not found, it may have expired",
+	ErrorAliasPointInTime:         "cannot use a point in time across multiple indexes, it belongs to a single index",
+	ErrorBackupNotSupported:       "index type does not support online backups",
+	ErrorChangeStreamNotSupported: "index type does not support change streams",
+	ErrorSnapshotTagsNotSupported: "index type does not support snapshot tags",
+	ErrorSnapshotTagNotFound:      "snapshot tag not found",
+	ErrorVerifyNotSupported:       "index type does not support verification",
+	ErrorMigrateNotSupported:      "index type cannot be migrated to scorch",
+	ErrorMigrateTypeNotStored:     "cannot migrate index, the type field of its documents is not stored",
 }
@@ -0,0 +1,322 @@
+//  Copyright (c) 2021 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bleve
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/blevesearch/bleve/v2/search"
+	"github.com/blevesearch/bleve/v2/search/query"
+)
+
+const (
+	FusionMethodRRF    = "rrf"
+	FusionMethodMinMax = "min_max"
+	FusionMethodZScore = "z_score"
+)
+
+// DefaultFusionRankConstant is the rank constant used by
+// reciprocal rank fusion when none is specified.
+var DefaultFusionRankConstant = 60
+
+// A FusionRequest describes how the ranked results of
+// several queries, or of several indexes, are merged.
+// The lists being fused are the results of the search
+// request's Query and of each of Queries, once for each
+// index searched.  Each list holds the top WindowSize
+// hits, or the top Size+From hits if that is larger.
+//
+// With the "rrf" Method, a hit scores the sum over all
+// lists of 1/(RankConstant+rank), rank starting at 1.
+// With "min_max" and "z_score", the scores of each list
+// are normalized with the respective method before
+// being summed.
+type FusionRequest struct {
+	Method       string        `json:"method,omitempty"`
+	Queries      []query.Query `json:"queries,omitempty"`
+	RankConstant int           `json:"rank_constant,omitempty"`
+	WindowSize   int           `json:"window_size,omitempty"`
+}
+
+// NewFusionRequest creates a FusionRequest using the
+// specified method, fusing the results of the search
+// request's query with those of the additional queries.
+func NewFusionRequest(method string, queries ...query.Query) *FusionRequest {
+	return &FusionRequest{
+		Method:  method,
+		Queries: queries,
+	}
+}
+
+func (fr *FusionRequest) Validate() error {
+	switch fr.Method {
+	case "", FusionMethodRRF, FusionMethodMinMax, FusionMethodZScore:
+	default:
+		return fmt.Errorf("unknown fusion method '%s'", fr.Method)
+	}
+	if fr.RankConstant < 0 {
+		return fmt.Errorf("fusion rank constant must not be negative")
+	}
+	if fr.WindowSize < 0 {
+		return fmt.Errorf("fusion window size must not be negative")
+	}
+	for _, q := range fr.Queries {
+		if q == nil {
+			return fmt.Errorf("fusion queries must not be empty")
+		}
+		if srq, ok := q.(query.ValidatableQuery); ok {
+			err := srq.Validate()
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// UnmarshalJSON deserializes a JSON representation of
+// a FusionRequest
+func (fr *FusionRequest) UnmarshalJSON(input []byte) error {
+	var temp struct {
+		Method       string            `json:"method"`
+		Queries      []json.RawMessage `json:"queries"`
+		RankConstant int               `json:"rank_constant"`
+		WindowSize   int               `json:"window_size"`
+	}
+
+	err := json.Unmarshal(input, &temp)
+	if err != nil {
+		return err
+	}
+
+	fr.Method = temp.Method
+	fr.RankConstant = temp.RankConstant
+	fr.WindowSize = temp.WindowSize
+	fr.Queries = nil
+	for _, q := range temp.Queries {
+		pq, err := query.ParseQuery(q)
+		if err != nil {
+			return err
+		}
+		fr.Queries = append(fr.Queries, pq)
+	}
+
+	return nil
+}
+
+func (fr *FusionRequest) method() string {
+	if fr.Method == "" {
+		return FusionMethodRRF
+	}
+	return fr.Method
+}
+
+func (fr *FusionRequest) rankConstant() int {
+	if fr.RankConstant == 0 {
+		return DefaultFusionRankConstant
+	}
+	return fr.RankConstant
+}
+
+// normalize returns the contribution of each hit of a ranked list to
+// the fused score of the hit.
+func (fr *FusionRequest) normalize(hits search.DocumentMatchCollection) []float64 {
+	rv := make([]float64, len(hits))
+	switch fr.method() {
+	case FusionMethodMinMax:
+		min, max := math.Inf(1), math.Inf(-1)
+		for _, hit := range hits {
+			min = math.Min(min, hit.Score)
+			max = math.Max(max, hit.Score)
+		}
+		for i, hit := range hits {
+			if max > min {
+				rv[i] = (hit.Score - min) / (max - min)
+			} else {
+				rv[i] = 1
+			}
+		}
+	case FusionMethodZScore:
+		var sum, sumSquares float64
+		for _, hit := range hits {
+			sum += hit.Score
+			sumSquares += hit.Score * hit.Score
+		}
+		n := float64(len(hits))
+		mean := sum / n
+		stddev := math.Sqrt(math.Max(sumSquares/n-mean*mean, 0))
+		for i, hit := range hits {
+			if stddev > 0 {
+				rv[i] = (hit.Score - mean) / stddev
+			}
+		}
+	default:
+		k := float64(fr.rankConstant())
+		for i := range hits {
+			rv[i] = 1 / (k + float64(i+1))
+		}
+	}
+	return rv
+}
+
+// fuseHits merges the ranked lists into a single list ordered by
+// descending fused score.  A hit present in several lists is only
+// returned once, keeping the first occurrence.
+func (fr *FusionRequest) fuseHits(lists []search.DocumentMatchCollection,
+	explain bool) search.DocumentMatchCollection {
+	type fusedHit struct {
+		hit      *search.DocumentMatch
+		score    float64
+		children []*search.Explanation
+	}
+	fused := make(map[string]*fusedHit)
+	var rv search.DocumentMatchCollection
+	for _, list := range lists {
+		for i, contribution := range fr.normalize(list) {
+			hit := list[i]
+			key := hit.Index + "\x00" + hit.ID
+			fh, ok := fused[key]
+			if !ok {
+				fh = &fusedHit{hit: hit}
+				fused[key] = fh
+				rv = append(rv, hit)
+			}
+			fh.score += contribution
+			if explain {
+				fh.children = append(fh.children, &search.Explanation{
+					Value:    contribution,
+					Message:  fmt.Sprintf("%s contribution of rank %d", fr.method(), i+1),
+					Children: []*search.Explanation{hit.Expl},
+				})
+			}
+		}
+	}
+
+	for _, hit := range rv {
+		fh := fused[hit.Index+"\x00"+hit.ID]
+		hit.Score = fh.score
+		if explain {
+			hit.Expl = &search.Explanation{
+				Value:    fh.score,
+				Message:  fmt.Sprintf("sum of %s contributions", fr.method()),
+				Children: fh.children,
+			}
+		}
+	}
+	sort.SliceStable(rv, func(i, j int) bool {
+		return rv[i].Score > rv[j].Score
+	})
+
+	return rv
+}
+
+// fusionSearch executes a SearchRequest with a FusionRequest across
+// the indexes.  The total and the facets are those of the disjunction
+// of all the queries, while the hits are the fused ranked lists of
+// each query on each index.
+func fusionSearch(ctx context.Context, req *SearchRequest, indexes ...Index) (*SearchResult, error) {
+	searchStart := time.Now()
+
+	queries := append([]query.Query{req.Query}, req.Fusion.Queries...)
+	windowSize := req.Size + req.From
+	if req.Fusion.WindowSize > windowSize {
+		windowSize = req.Fusion.WindowSize
+	}
+
+	countReq := &SearchRequest{
+		Query:       NewDisjunctionQuery(queries...),
+		Size:        0,
+		Facets:      req.Facets,
+		Sort:        req.Sort.Copy(),
+		Score:       "none",
+		PointInTime: req.PointInTime,
+	}
+	var sr *SearchResult
+	var err error
+	if len(indexes) == 1 {
+		sr, err = indexes[0].SearchInContext(ctx, countReq)
+	} else {
+		sr, err = MultiSearch(ctx, countReq, indexes...)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	lists := make([]search.DocumentMatchCollection, len(queries)*len(indexes))
+	listErrs := make([]error, len(lists))
+	var waitGroup sync.WaitGroup
+	for qi, q := range queries {
+		for ii, in := range indexes {
+			childReq := createChildSearchRequest(req)
+			childReq.Query = q
+			childReq.Size = windowSize
+			childReq.Fusion = nil
+			waitGroup.Add(1)
+			go func(slot int, in Index, childReq *SearchRequest) {
+				defer waitGroup.Done()
+				res, err := in.SearchInContext(ctx, childReq)
+				if err != nil {
+					listErrs[slot] = err
+					return
+				}
+				lists[slot] = res.Hits
+			}(qi*len(indexes)+ii, in, childReq)
+		}
+	}
+	waitGroup.Wait()
+
+	for slot, err := range listErrs {
+		if err == nil {
+			continue
+		}
+		if len(indexes) == 1 {
+			return nil, err
+		}
+		name := indexes[slot%len(indexes)].Name()
+		if _, ok := sr.Status.Errors[name]; !ok {
+			if sr.Status.Errors == nil {
+				sr.Status.Errors = make(map[string]error)
+			}
+			sr.Status.Errors[name] = err
+			sr.Status.Failed++
+			sr.Status.Successful--
+		}
+	}
+
+	hits := req.Fusion.fuseHits(lists, req.Explain)
+	sr.MaxScore = 0
+	if len(hits) > 0 {
+		sr.MaxScore = hits[0].Score
+	}
+	if len(hits) > req.From {
+		hits = hits[req.From:]
+	} else {
+		hits = search.DocumentMatchCollection{}
+	}
+	if len(hits) > req.Size {
+		hits = hits[:req.Size]
+	}
+
+	sr.Hits = hits
+	sr.Request = req
+	sr.Took = time.Since(searchStart)
+	return sr, nil
+}
@@ -16,13 +16,20 @@ package http
 
 import (
 	"bytes"
+	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"os"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/blevesearch/bleve/v2"
 )
 
 func docIDLookup(req *http.Request) string {
@@ -700,3 +707,329 @@ func TestHandlers(t *testing.T) {
 		}
 	}
 }
+
+func TestPointInTimeHandlers(t *testing.T) {
+	idx, err := bleve.NewMemOnly(bleve.NewIndexMapping())
+	if err != nil {
+		t.Fatal(err)
+	}
+	RegisterIndexName("pit", idx)
+	defer func() {
+		UnregisterIndexByName("pit")
+		err = idx.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+	err = idx.Index("a", map[string]interface{}{"body": "hello"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	openHandler := NewPointInTimeOpenHandler("pit")
+	openHandler.KeepAliveLookup = func(req *http.Request) string {
+		return req.FormValue("keepAlive")
+	}
+	closeHandler := NewPointInTimeCloseHandler("pit")
+	closeHandler.PointInTimeIDLookup = func(req *http.Request) string {
+		return req.FormValue("id")
+	}
+	searchHandler := NewSearchHandler("pit")
+
+	serve := func(handler http.Handler, params url.Values, body string) *httptest.ResponseRecorder {
+		record := httptest.NewRecorder()
+		req := &http.Request{
+			Method: "POST",
+			URL:    &url.URL{Path: "/pit"},
+			Form:   params,
+			Body:   ioutil.NopCloser(bytes.NewBufferString(body)),
+		}
+		handler.ServeHTTP(record, req)
+		return record
+	}
+
+	record := serve(openHandler, url.Values{"keepAlive": []string{"bad"}}, "")
+	if record.Code != http.StatusBadRequest {
+		t.Errorf("expected bad keep alive rejected, got %d", record.Code)
+	}
+
+	record = serve(openHandler, url.Values{"keepAlive": []string{"1m"}}, "")
+	if record.Code != http.StatusOK {
+		t.Fatalf("expected point in time opened, got %d: %s", record.Code, record.Body)
+	}
+	var opened struct {
+		ID string `json:"id"`
+	}
+	err = json.Unmarshal(record.Body.Bytes(), &opened)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = idx.Index("b", map[string]interface{}{"body": "hello"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	search := fmt.Sprintf(`{"query":{"match":"hello"},"pit":{"id":%q}}`, opened.ID)
+	record = serve(searchHandler, nil, search)
+	if record.Code != http.StatusOK ||
+		!bytes.Contains(record.Body.Bytes(), []byte(`"total_hits":1`)) {
+		t.Errorf("expected the pinned hit, got %d: %s", record.Code, record.Body)
+	}
+
+	params := url.Values{"id": []string{opened.ID}}
+	record = serve(closeHandler, params, "")
+	if record.Code != http.StatusOK {
+		t.Errorf("expected point in time closed, got %d: %s", record.Code, record.Body)
+	}
+	record = serve(closeHandler, params, "")
+	if record.Code != http.StatusNotFound {
+		t.Errorf("expected closed point in time not found, got %d", record.Code)
+	}
+	record = serve(searchHandler, nil, search)
+	if record.Code != http.StatusNotFound {
+		t.Errorf("expected closed point in time not found, got %d", record.Code)
+	}
+}
+
+func TestScanHandler(t *testing.T) {
+	idx, err := bleve.NewMemOnly(bleve.NewIndexMapping())
+	if err != nil {
+		t.Fatal(err)
+	}
+	RegisterIndexName("scan", idx)
+	defer func() {
+		UnregisterIndexByName("scan")
+		err = idx.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+	for n := 0; n < 5; n++ {
+		err = idx.Index(fmt.Sprintf("doc%d", n), map[string]interface{}{
+			"body": "hello",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	scanHandler := NewScanHandler("scan")
+	record := httptest.NewRecorder()
+	req := &http.Request{
+		Method: "POST",
+		URL:    &url.URL{Path: "/scan"},
+		Body:   ioutil.NopCloser(bytes.NewBufferString(`{"query":{"match":"hello"},"fields":["body"]}`)),
+	}
+	scanHandler.ServeHTTP(record, req)
+	if record.Code != http.StatusOK {
+		t.Fatalf("expected documents scanned, got %d: %s", record.Code, record.Body)
+	}
+	if got := record.Header().Get("Content-type"); got != "application/x-ndjson" {
+		t.Errorf("expected newline delimited json, got %s", got)
+	}
+	lines := bytes.Split(bytes.TrimRight(record.Body.Bytes(), "\n"), []byte("\n"))
+	if len(lines) != 5 {
+		t.Fatalf("expected 5 documents, got %d", len(lines))
+	}
+	for n, line := range lines {
+		var doc struct {
+			ID     string                 `json:"id"`
+			Fields map[string]interface{} `json:"fields"`
+		}
+		err = json.Unmarshal(line, &doc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if doc.ID != fmt.Sprintf("doc%d", n) || doc.Fields["body"] != "hello" {
+			t.Errorf("unexpected document %s", line)
+		}
+	}
+
+	record = httptest.NewRecorder()
+	req.Body = ioutil.NopCloser(bytes.NewBufferString(`{"fields":["body"]}`))
+	scanHandler.ServeHTTP(record, req)
+	if record.Code != http.StatusBadRequest {
+		t.Errorf("expected scan without query rejected, got %d", record.Code)
+	}
+}
+
+func TestReplicationHandlers(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "bleve-replication")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := os.RemoveAll(tmpDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	idx, err := bleve.New(filepath.Join(tmpDir, "leader"), bleve.NewIndexMapping())
+	if err != nil {
+		t.Fatal(err)
+	}
+	RegisterIndexName("leader", idx)
+	defer func() {
+		UnregisterIndexByName("leader")
+		err = idx.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+	for n := 0; n < 5; n++ {
+		err = idx.Index(fmt.Sprintf("doc%d", n), map[string]interface{}{
+			"body": "hello",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	segmentHandler := NewReplicationSegmentHandler("leader")
+	segmentHandler.SegmentNameLookup = func(req *http.Request) string {
+		return strings.TrimPrefix(req.URL.Path, "/segment/")
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/snapshot", NewReplicationSnapshotHandler("leader"))
+	mux.Handle("/segment/", segmentHandler)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := &ReplicationClient{
+		SnapshotURL: server.URL + "/snapshot",
+		SegmentURL:  server.URL + "/segment/",
+	}
+	_, err = client.OpenSegment("missing.zap")
+	if err == nil {
+		t.Error("expected error opening a missing segment")
+	}
+	_, err = client.OpenSegment("../root.bolt")
+	if err == nil {
+		t.Error("expected error opening a file outside the index")
+	}
+
+	follower, err := bleve.NewFollower(filepath.Join(tmpDir, "follower"), client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := follower.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	// the leader persists in the background
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		err = follower.Sync()
+		if err != nil {
+			t.Fatal(err)
+		}
+		count, err := follower.Index().DocCount()
+		if err == nil && count == 5 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("follower did not catch up, got %d docs (%v)", count, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestSnapshotTagHandlers(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "bleve-snapshot-tags")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := os.RemoveAll(tmpDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	idx, err := bleve.New(filepath.Join(tmpDir, "tags"), bleve.NewIndexMapping())
+	if err != nil {
+		t.Fatal(err)
+	}
+	RegisterIndexName("tags", idx)
+	defer func() {
+		UnregisterIndexByName("tags")
+		err = idx.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+	err = idx.Index("a", map[string]interface{}{"body": "hello"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tagNameLookup := func(req *http.Request) string {
+		return req.FormValue("tag")
+	}
+	createHandler := NewSnapshotTagCreateHandler("tags")
+	createHandler.TagNameLookup = tagNameLookup
+	deleteHandler := NewSnapshotTagDeleteHandler("tags")
+	deleteHandler.TagNameLookup = tagNameLookup
+	rollbackHandler := NewSnapshotRollbackHandler("tags")
+	rollbackHandler.TagNameLookup = tagNameLookup
+	listHandler := NewSnapshotTagListHandler("tags")
+
+	serve := func(handler http.Handler, tag string) *httptest.ResponseRecorder {
+		req := &http.Request{
+			Method: "POST",
+			URL:    &url.URL{Path: "/snapshot", RawQuery: "tag=" + tag},
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := serve(createHandler, "")
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an empty tag name, got %d", rr.Code)
+	}
+	rr = serve(createHandler, "v1")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 tagging a snapshot, got %d: %s", rr.Code, rr.Body)
+	}
+
+	err = idx.Index("b", map[string]interface{}{"body": "hello"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr = serve(listHandler, "")
+	if rr.Code != http.StatusOK ||
+		!strings.Contains(rr.Body.String(), `"name":"v1"`) {
+		t.Errorf("expected tag v1 listed, got %d: %s", rr.Code, rr.Body)
+	}
+
+	rr = serve(rollbackHandler, "missing")
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 rolling back to a missing tag, got %d", rr.Code)
+	}
+	rr = serve(rollbackHandler, "v1")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 rolling back, got %d: %s", rr.Code, rr.Body)
+	}
+	count, err := idx.DocCount()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("expected 1 document after the rollback, got %d", count)
+	}
+
+	rr = serve(deleteHandler, "v1")
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected 200 deleting a tag, got %d: %s", rr.Code, rr.Body)
+	}
+	rr = serve(deleteHandler, "v1")
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 deleting a missing tag, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,84 @@
+//  Copyright (c) 2014 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/blevesearch/bleve/v2"
+)
+
+// PointInTimeCloseHandler can close points in time of indexes over HTTP.
+type PointInTimeCloseHandler struct {
+	defaultIndexName    string
+	IndexNameLookup     varLookupFunc
+	PointInTimeIDLookup varLookupFunc
+}
+
+func NewPointInTimeCloseHandler(defaultIndexName string) *PointInTimeCloseHandler {
+	return &PointInTimeCloseHandler{
+		defaultIndexName: defaultIndexName,
+	}
+}
+
+func (h *PointInTimeCloseHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+
+	// find the index to operate on
+	var indexName string
+	if h.IndexNameLookup != nil {
+		indexName = h.IndexNameLookup(req)
+	}
+	if indexName == "" {
+		indexName = h.defaultIndexName
+	}
+	index := IndexByName(indexName)
+	if index == nil {
+		showError(w, req, fmt.Sprintf("no such index '%s'", indexName), 404)
+		return
+	}
+	pitIndex, ok := index.(bleve.PointInTimeIndex)
+	if !ok {
+		showError(w, req, fmt.Sprintf("index '%s' does not support points in time", indexName), 400)
+		return
+	}
+
+	// find the point in time id
+	var id string
+	if h.PointInTimeIDLookup != nil {
+		id = h.PointInTimeIDLookup(req)
+	}
+	if id == "" {
+		showError(w, req, "point in time id cannot be empty", 400)
+		return
+	}
+
+	err := pitIndex.ClosePointInTime(id)
+	if err == bleve.ErrorPointInTimeNotFound {
+		showError(w, req, fmt.Sprintf("no such point in time '%s'", id), 404)
+		return
+	}
+	if err != nil {
+		showError(w, req, fmt.Sprintf("error closing point in time '%s': %v", id, err), 500)
+		return
+	}
+
+	rv := struct {
+		Status string `json:"status"`
+	}{
+		Status: "ok",
+	}
+	mustEncode(w, rv)
+}
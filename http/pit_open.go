@@ -0,0 +1,90 @@
+//  Copyright (c) 2014 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/blevesearch/bleve/v2"
+)
+
+// PointInTimeOpenHandler can open points in time of indexes, whose
+// IDs can then be referenced by search requests, over HTTP.  The keep
+// alive of the point in time is a duration, such as "1m".
+type PointInTimeOpenHandler struct {
+	defaultIndexName string
+	IndexNameLookup  varLookupFunc
+	KeepAliveLookup  varLookupFunc
+}
+
+func NewPointInTimeOpenHandler(defaultIndexName string) *PointInTimeOpenHandler {
+	return &PointInTimeOpenHandler{
+		defaultIndexName: defaultIndexName,
+	}
+}
+
+func (h *PointInTimeOpenHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+
+	// find the index to operate on
+	var indexName string
+	if h.IndexNameLookup != nil {
+		indexName = h.IndexNameLookup(req)
+	}
+	if indexName == "" {
+		indexName = h.defaultIndexName
+	}
+	index := IndexByName(indexName)
+	if index == nil {
+		showError(w, req, fmt.Sprintf("no such index '%s'", indexName), 404)
+		return
+	}
+	pitIndex, ok := index.(bleve.PointInTimeIndex)
+	if !ok {
+		showError(w, req, fmt.Sprintf("index '%s' does not support points in time", indexName), 400)
+		return
+	}
+
+	// find the keep alive
+	var keepAliveStr string
+	if h.KeepAliveLookup != nil {
+		keepAliveStr = h.KeepAliveLookup(req)
+	}
+	if keepAliveStr == "" {
+		showError(w, req, "keep alive is required", 400)
+		return
+	}
+	keepAlive, err := time.ParseDuration(keepAliveStr)
+	if err != nil {
+		showError(w, req, fmt.Sprintf("error parsing keep alive: %v", err), 400)
+		return
+	}
+
+	id, err := pitIndex.OpenPointInTime(keepAlive)
+	if err != nil {
+		showError(w, req, fmt.Sprintf("error opening point in time: %v", err), 500)
+		return
+	}
+
+	rv := struct {
+		Status string `json:"status"`
+		ID     string `json:"id"`
+	}{
+		Status: "ok",
+		ID:     id,
+	}
+	mustEncode(w, rv)
+}
@@ -0,0 +1,197 @@
+//  Copyright (c) 2024 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/index/scorch"
+)
+
+// ReplicationSnapshotHandler serves the latest snapshot persisted by an
+// index to its followers on other hosts, see ReplicationClient.  It
+// responds with 204 No Content until the index has persisted a snapshot.
+type ReplicationSnapshotHandler struct {
+	defaultIndexName string
+	IndexNameLookup  varLookupFunc
+}
+
+func NewReplicationSnapshotHandler(defaultIndexName string) *ReplicationSnapshotHandler {
+	return &ReplicationSnapshotHandler{
+		defaultIndexName: defaultIndexName,
+	}
+}
+
+func (h *ReplicationSnapshotHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	source, ok := replicationSource(w, req, h.defaultIndexName, h.IndexNameLookup)
+	if !ok {
+		return
+	}
+
+	snapshot, err := source.LatestSnapshot()
+	if err != nil {
+		showError(w, req, fmt.Sprintf("error reading snapshot: %v", err), 500)
+		return
+	}
+	if snapshot == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	mustEncode(w, snapshot)
+}
+
+// ReplicationSegmentHandler serves the segment files of an index to its
+// followers on other hosts, see ReplicationClient.
+type ReplicationSegmentHandler struct {
+	defaultIndexName  string
+	IndexNameLookup   varLookupFunc
+	SegmentNameLookup varLookupFunc
+}
+
+func NewReplicationSegmentHandler(defaultIndexName string) *ReplicationSegmentHandler {
+	return &ReplicationSegmentHandler{
+		defaultIndexName: defaultIndexName,
+	}
+}
+
+func (h *ReplicationSegmentHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	source, ok := replicationSource(w, req, h.defaultIndexName, h.IndexNameLookup)
+	if !ok {
+		return
+	}
+
+	// find the segment name
+	var name string
+	if h.SegmentNameLookup != nil {
+		name = h.SegmentNameLookup(req)
+	}
+	if name == "" {
+		showError(w, req, "segment name cannot be empty", 400)
+		return
+	}
+
+	r, err := source.OpenSegment(name)
+	if os.IsNotExist(err) {
+		showError(w, req, fmt.Sprintf("no such segment '%s'", name), 404)
+		return
+	}
+	if err != nil {
+		showError(w, req, fmt.Sprintf("error opening segment '%s': %v", name, err), 500)
+		return
+	}
+	defer func() {
+		_ = r.Close()
+	}()
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	_, _ = io.Copy(w, r)
+}
+
+func replicationSource(w http.ResponseWriter, req *http.Request,
+	defaultIndexName string, indexNameLookup varLookupFunc) (
+	scorch.ReplicationSource, bool) {
+
+	// find the index to operate on
+	var indexName string
+	if indexNameLookup != nil {
+		indexName = indexNameLookup(req)
+	}
+	if indexName == "" {
+		indexName = defaultIndexName
+	}
+	index := IndexByName(indexName)
+	if index == nil {
+		showError(w, req, fmt.Sprintf("no such index '%s'", indexName), 404)
+		return nil, false
+	}
+	source, err := bleve.ReplicationSource(index)
+	if err != nil {
+		showError(w, req, fmt.Sprintf("index '%s' does not support replication", indexName), 400)
+		return nil, false
+	}
+	return source, true
+}
+
+// ReplicationClient is a replication source reaching a leader index on
+// another host through its ReplicationSnapshotHandler, at SnapshotURL,
+// and its ReplicationSegmentHandler, at SegmentURL with the segment name
+// appended, so a Follower can tail it.
+type ReplicationClient struct {
+	SnapshotURL string
+	SegmentURL  string
+	Client      *http.Client
+}
+
+func (c *ReplicationClient) client() *http.Client {
+	if c.Client != nil {
+		return c.Client
+	}
+	return http.DefaultClient
+}
+
+func (c *ReplicationClient) LatestSnapshot() (*scorch.PersistedSnapshot, error) {
+	resp, err := c.client().Get(c.SnapshotURL)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNoContent:
+		return nil, nil
+	default:
+		return nil, replicationError(resp)
+	}
+
+	var rv scorch.PersistedSnapshot
+	err = json.NewDecoder(resp.Body).Decode(&rv)
+	if err != nil {
+		return nil, fmt.Errorf("replication: error parsing snapshot: %v", err)
+	}
+	return &rv, nil
+}
+
+func (c *ReplicationClient) OpenSegment(name string) (io.ReadCloser, error) {
+	resp, err := c.client().Get(c.SegmentURL + url.PathEscape(name))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		_ = resp.Body.Close()
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer func() {
+			_ = resp.Body.Close()
+		}()
+		return nil, replicationError(resp)
+	}
+	return resp.Body, nil
+}
+
+func replicationError(resp *http.Response) error {
+	msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Errorf("replication: %s %s: %s", resp.Request.URL, resp.Status, msg)
+}
@@ -0,0 +1,131 @@
+//  Copyright (c) 2014 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/blevesearch/bleve/v2"
+)
+
+// ScanFlushEvery is the number of documents written by the ScanHandler
+// between two flushes of the response.
+var ScanFlushEvery = 100
+
+// ScanHandler can handle scan requests sent over HTTP.  The documents
+// are streamed as newline delimited JSON, one document per line.  An
+// error happening once documents were streamed is reported by a last
+// line holding an "error" member.
+type ScanHandler struct {
+	defaultIndexName string
+	IndexNameLookup  varLookupFunc
+}
+
+func NewScanHandler(defaultIndexName string) *ScanHandler {
+	return &ScanHandler{
+		defaultIndexName: defaultIndexName,
+	}
+}
+
+func (h *ScanHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+
+	// find the index to operate on
+	var indexName string
+	if h.IndexNameLookup != nil {
+		indexName = h.IndexNameLookup(req)
+	}
+	if indexName == "" {
+		indexName = h.defaultIndexName
+	}
+	index := IndexByName(indexName)
+	if index == nil {
+		showError(w, req, fmt.Sprintf("no such index '%s'", indexName), 404)
+		return
+	}
+	scanIndex, ok := index.(bleve.ScanIndex)
+	if !ok {
+		showError(w, req, fmt.Sprintf("index '%s' does not support scans", indexName), 400)
+		return
+	}
+
+	// read the request body
+	requestBody, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		showError(w, req, fmt.Sprintf("error reading request body: %v", err), 400)
+		return
+	}
+
+	logger.Printf("request body: %s", requestBody)
+
+	// parse the request
+	var scanRequest bleve.ScanRequest
+	err = json.Unmarshal(requestBody, &scanRequest)
+	if err != nil {
+		showError(w, req, fmt.Sprintf("error parsing query: %v", err), 400)
+		return
+	}
+
+	// validate the request
+	err = scanRequest.Validate()
+	if err != nil {
+		showError(w, req, fmt.Sprintf("error validating query: %v", err), 400)
+		return
+	}
+
+	// execute the scan
+	it, err := scanIndex.Scan(req.Context(), &scanRequest)
+	if err == bleve.ErrorPointInTimeNotFound {
+		showError(w, req, fmt.Sprintf("error executing scan: %v", err), 404)
+		return
+	}
+	if err != nil {
+		showError(w, req, fmt.Sprintf("error executing scan: %v", err), 500)
+		return
+	}
+	defer func() {
+		_ = it.Close()
+	}()
+
+	// stream the documents
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Content-type", "application/x-ndjson")
+	flusher, _ := w.(http.Flusher)
+	e := json.NewEncoder(w)
+	for n := 1; ; n++ {
+		doc, err := it.Next()
+		if err != nil {
+			logger.Printf("error scanning: %v", err)
+			_ = e.Encode(struct {
+				Error string `json:"error"`
+			}{
+				Error: err.Error(),
+			})
+			return
+		}
+		if doc == nil {
+			return
+		}
+		if err = e.Encode(doc); err != nil {
+			logger.Printf("error writing scanned document: %v", err)
+			return
+		}
+		if flusher != nil && n%ScanFlushEvery == 0 {
+			flusher.Flush()
+		}
+	}
+}
@@ -82,6 +82,10 @@ func (h *SearchHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 
 	// execute the query
 	searchResponse, err := index.Search(&searchRequest)
+	if err == bleve.ErrorPointInTimeNotFound {
+		showError(w, req, fmt.Sprintf("error executing query: %v", err), 404)
+		return
+	}
 	if err != nil {
 		showError(w, req, fmt.Sprintf("error executing query: %v", err), 500)
 		return
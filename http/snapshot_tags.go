@@ -0,0 +1,221 @@
+//  Copyright (c) 2024 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/index/scorch"
+)
+
+// SnapshotTagCreateHandler tags the latest persisted snapshot of an
+// index over HTTP, keeping it as a restore point.
+type SnapshotTagCreateHandler struct {
+	defaultIndexName string
+	IndexNameLookup  varLookupFunc
+	TagNameLookup    varLookupFunc
+}
+
+func NewSnapshotTagCreateHandler(defaultIndexName string) *SnapshotTagCreateHandler {
+	return &SnapshotTagCreateHandler{
+		defaultIndexName: defaultIndexName,
+	}
+}
+
+func (h *SnapshotTagCreateHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	tagIndex, ok := snapshotTagIndex(w, req, h.defaultIndexName, h.IndexNameLookup)
+	if !ok {
+		return
+	}
+	name, ok := snapshotTagName(w, req, h.TagNameLookup)
+	if !ok {
+		return
+	}
+
+	epoch, err := tagIndex.TagSnapshot(name)
+	if err != nil {
+		showError(w, req, fmt.Sprintf("error tagging snapshot: %v", err), 500)
+		return
+	}
+
+	rv := struct {
+		Status string `json:"status"`
+		Name   string `json:"name"`
+		Epoch  uint64 `json:"epoch"`
+	}{
+		Status: "ok",
+		Name:   name,
+		Epoch:  epoch,
+	}
+	mustEncode(w, rv)
+}
+
+// SnapshotTagListHandler lists the snapshot tags of an index over HTTP.
+type SnapshotTagListHandler struct {
+	defaultIndexName string
+	IndexNameLookup  varLookupFunc
+}
+
+func NewSnapshotTagListHandler(defaultIndexName string) *SnapshotTagListHandler {
+	return &SnapshotTagListHandler{
+		defaultIndexName: defaultIndexName,
+	}
+}
+
+func (h *SnapshotTagListHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	tagIndex, ok := snapshotTagIndex(w, req, h.defaultIndexName, h.IndexNameLookup)
+	if !ok {
+		return
+	}
+
+	tags, err := tagIndex.SnapshotTags()
+	if err != nil {
+		showError(w, req, fmt.Sprintf("error listing snapshot tags: %v", err), 500)
+		return
+	}
+
+	rv := struct {
+		Status string                `json:"status"`
+		Tags   []*scorch.SnapshotTag `json:"tags"`
+	}{
+		Status: "ok",
+		Tags:   tags,
+	}
+	mustEncode(w, rv)
+}
+
+// SnapshotTagDeleteHandler deletes a snapshot tag of an index over HTTP.
+type SnapshotTagDeleteHandler struct {
+	defaultIndexName string
+	IndexNameLookup  varLookupFunc
+	TagNameLookup    varLookupFunc
+}
+
+func NewSnapshotTagDeleteHandler(defaultIndexName string) *SnapshotTagDeleteHandler {
+	return &SnapshotTagDeleteHandler{
+		defaultIndexName: defaultIndexName,
+	}
+}
+
+func (h *SnapshotTagDeleteHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	tagIndex, ok := snapshotTagIndex(w, req, h.defaultIndexName, h.IndexNameLookup)
+	if !ok {
+		return
+	}
+	name, ok := snapshotTagName(w, req, h.TagNameLookup)
+	if !ok {
+		return
+	}
+
+	err := tagIndex.DeleteSnapshotTag(name)
+	if err == bleve.ErrorSnapshotTagNotFound {
+		showError(w, req, fmt.Sprintf("no such snapshot tag '%s'", name), 404)
+		return
+	}
+	if err != nil {
+		showError(w, req, fmt.Sprintf("error deleting snapshot tag '%s': %v", name, err), 500)
+		return
+	}
+
+	rv := struct {
+		Status string `json:"status"`
+	}{
+		Status: "ok",
+	}
+	mustEncode(w, rv)
+}
+
+// SnapshotRollbackHandler rolls an index back to a tagged snapshot over
+// HTTP.  The index is closed and reopened by the rollback, failing the
+// requests in progress.
+type SnapshotRollbackHandler struct {
+	defaultIndexName string
+	IndexNameLookup  varLookupFunc
+	TagNameLookup    varLookupFunc
+}
+
+func NewSnapshotRollbackHandler(defaultIndexName string) *SnapshotRollbackHandler {
+	return &SnapshotRollbackHandler{
+		defaultIndexName: defaultIndexName,
+	}
+}
+
+func (h *SnapshotRollbackHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	tagIndex, ok := snapshotTagIndex(w, req, h.defaultIndexName, h.IndexNameLookup)
+	if !ok {
+		return
+	}
+	name, ok := snapshotTagName(w, req, h.TagNameLookup)
+	if !ok {
+		return
+	}
+
+	err := tagIndex.RollbackToSnapshotTag(name)
+	if err == bleve.ErrorSnapshotTagNotFound {
+		showError(w, req, fmt.Sprintf("no such snapshot tag '%s'", name), 404)
+		return
+	}
+	if err != nil {
+		showError(w, req, fmt.Sprintf("error rolling back to snapshot tag '%s': %v", name, err), 500)
+		return
+	}
+
+	rv := struct {
+		Status string `json:"status"`
+	}{
+		Status: "ok",
+	}
+	mustEncode(w, rv)
+}
+
+func snapshotTagIndex(w http.ResponseWriter, req *http.Request,
+	defaultIndexName string, indexNameLookup varLookupFunc) (
+	bleve.SnapshotTagIndex, bool) {
+
+	// find the index to operate on
+	var indexName string
+	if indexNameLookup != nil {
+		indexName = indexNameLookup(req)
+	}
+	if indexName == "" {
+		indexName = defaultIndexName
+	}
+	index := IndexByName(indexName)
+	if index == nil {
+		showError(w, req, fmt.Sprintf("no such index '%s'", indexName), 404)
+		return nil, false
+	}
+	tagIndex, ok := index.(bleve.SnapshotTagIndex)
+	if !ok {
+		showError(w, req, fmt.Sprintf("index '%s' does not support snapshot tags", indexName), 400)
+		return nil, false
+	}
+	return tagIndex, true
+}
+
+func snapshotTagName(w http.ResponseWriter, req *http.Request,
+	tagNameLookup varLookupFunc) (string, bool) {
+	var name string
+	if tagNameLookup != nil {
+		name = tagNameLookup(req)
+	}
+	if name == "" {
+		showError(w, req, "snapshot tag name cannot be empty", 400)
+		return "", false
+	}
+	return name, true
+}
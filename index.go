@@ -16,6 +16,7 @@ package bleve
 
 import (
 	"context"
+	"fmt"
 	"github.com/blevesearch/bleve/v2/index/upsidedown"
 
 	"github.com/blevesearch/bleve/v2/document"
@@ -36,6 +37,8 @@ type Batch struct {
 
 	lastDocSize uint64
 	totalSize   uint64
+
+	durability Durability
 }
 
 // Index adds the specified index operation to the
@@ -119,6 +122,7 @@ func (b *Batch) Reset() {
 	b.internal.Reset()
 	b.lastDocSize = 0
 	b.totalSize = 0
+	b.durability = DurabilityDefault
 }
 
 func (b *Batch) Merge(o *Batch) {
@@ -139,6 +143,49 @@ func (b *Batch) PersistedCallback() index.BatchCallback {
 	return b.internal.PersistedCallback()
 }
 
+// Durability is how durable a batch is once executed, for the index
+// types supporting durability levels, such as scorch.
+type Durability int
+
+const (
+	// DurabilityDefault makes the batch as durable as configured for
+	// the index.
+	DurabilityDefault Durability = iota
+	// DurabilityMemory returns once the batch is searchable, it is
+	// written to disk in the background.
+	DurabilityMemory
+	// DurabilityPersisted returns once the batch is written to disk.
+	DurabilityPersisted
+	// DurabilityFsync returns once the batch is synced to stable
+	// storage.
+	DurabilityFsync
+)
+
+func (d Durability) String() string {
+	switch d {
+	case DurabilityDefault:
+		return "default"
+	case DurabilityMemory:
+		return "memory"
+	case DurabilityPersisted:
+		return "persisted"
+	case DurabilityFsync:
+		return "fsync"
+	}
+	return fmt.Sprintf("Durability(%d)", int(d))
+}
+
+// SetDurability sets how durable the batch is once executed, for the
+// index types supporting durability levels, such as scorch.  By default
+// the batch is as durable as configured for the index.
+func (b *Batch) SetDurability(durability Durability) {
+	b.durability = durability
+}
+
+func (b *Batch) Durability() Durability {
+	return b.durability
+}
+
 // An Index implements all the indexing and searching
 // capabilities of bleve.  An Index can be created
 // using the New() and Open() methods.
@@ -282,7 +329,7 @@ func NewUsing(path string, mapping mapping.IndexMapping, indexType string, kvsto
 // Open index at the specified path, must exist.
 // The mapping used when it was created will be used for all Index/Search operations.
 func Open(path string) (Index, error) {
-	return openIndexUsing(path, nil)
+	return OpenUsing(path, nil)
 }
 
 // OpenUsing opens index at the specified path, must exist.
@@ -290,6 +337,10 @@ func Open(path string) (Index, error) {
 // The provided runtimeConfig can override settings
 // persisted when the kvstore was created.
 func OpenUsing(path string, runtimeConfig map[string]interface{}) (Index, error) {
+	if meta, err := openIndexMeta(path); err == nil &&
+		meta.IndexType == TimePartitionedIndexType {
+		return openTimePartitioned(path, runtimeConfig)
+	}
 	return openIndexUsing(path, runtimeConfig)
 }
 
@@ -0,0 +1,264 @@
+//  Copyright (c) 2024 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package encryption encrypts index data at rest with AES-GCM, using keys
+// from a pluggable KeyProvider.
+//
+// Encrypted data starts with a header naming the key it is encrypted
+// with, so keys can be rotated: new data is encrypted with the current
+// key, while data encrypted with a key since rotated out can still be
+// decrypted, as long as the provider keeps that key.
+package encryption
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// ErrDecrypt is returned, wrapped, when data cannot be decrypted: its key
+// is not available, or the data is not authentic.
+var ErrDecrypt = errors.New("unable to decrypt")
+
+// KeyProvider provides the keys to encrypt and decrypt data with.  Keys
+// are 16, 24 or 32 bytes long, selecting AES-128, AES-192 or AES-256.
+type KeyProvider interface {
+	// CurrentKey returns the ID and the value of the key to encrypt new
+	// data with.
+	CurrentKey() (id string, key []byte, err error)
+
+	// Key returns the value of the key with the given ID, to decrypt
+	// data with.  The value of a key must never change.
+	Key(id string) ([]byte, error)
+}
+
+var keyProvidersLock sync.RWMutex
+var keyProviders = map[string]KeyProvider{}
+
+// RegisterKeyProvider registers the key provider indexes refer to by name,
+// in the "encryptionKeyProvider" of their config.
+func RegisterKeyProvider(name string, kp KeyProvider) {
+	keyProvidersLock.Lock()
+	keyProviders[name] = kp
+	keyProvidersLock.Unlock()
+}
+
+// KeyProviderByName returns the key provider registered with the name, or
+// nil.
+func KeyProviderByName(name string) KeyProvider {
+	keyProvidersLock.RLock()
+	defer keyProvidersLock.RUnlock()
+	return keyProviders[name]
+}
+
+// header is the start of encrypted data: the magic, the format version,
+// the length of the key ID and the key ID, followed by the nonce and the
+// sealed data.  The header is authenticated along with the data.
+var magic = []byte{0xbf, 'E', 'N', 'C'}
+
+const formatVersion = 1
+
+const nonceSize = 12
+
+// IsEncrypted returns whether data starts like data encrypted by a Cipher.
+func IsEncrypted(data []byte) bool {
+	return len(data) > len(magic)+2 && bytes.Equal(data[:len(magic)], magic) &&
+		data[len(magic)] == formatVersion
+}
+
+// KeyID returns the ID of the key data is encrypted with.
+func KeyID(data []byte) (string, error) {
+	id, _, err := parseHeader(data)
+	return id, err
+}
+
+func parseHeader(data []byte) (string, int, error) {
+	if !IsEncrypted(data) {
+		return "", 0, fmt.Errorf("%w: data not encrypted", ErrDecrypt)
+	}
+	idLen := int(data[len(magic)+1])
+	n := len(magic) + 2 + idLen
+	if len(data) < n+nonceSize {
+		return "", 0, fmt.Errorf("%w: data truncated", ErrDecrypt)
+	}
+	return string(data[len(magic)+2 : n]), n, nil
+}
+
+// Cipher encrypts and decrypts data with the keys of a KeyProvider.
+type Cipher struct {
+	kp KeyProvider
+
+	m     sync.RWMutex           // Protects the fields that follow.
+	aeads map[string]cipher.AEAD // Keyed by key ID.
+}
+
+// NewCipher returns a Cipher using the keys of kp.
+func NewCipher(kp KeyProvider) *Cipher {
+	return &Cipher{
+		kp:    kp,
+		aeads: map[string]cipher.AEAD{},
+	}
+}
+
+// CurrentKeyID returns the ID of the key new data is encrypted with.
+func (c *Cipher) CurrentKeyID() (string, error) {
+	id, _, err := c.kp.CurrentKey()
+	return id, err
+}
+
+func (c *Cipher) aead(id string, key []byte) (cipher.AEAD, error) {
+	c.m.RLock()
+	aead, ok := c.aeads[id]
+	c.m.RUnlock()
+	if ok {
+		return aead, nil
+	}
+
+	if key == nil {
+		var err error
+		key, err = c.kp.Key(id)
+		if err != nil {
+			return nil, err
+		}
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err = cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	c.m.Lock()
+	c.aeads[id] = aead
+	c.m.Unlock()
+	return aead, nil
+}
+
+// Encrypt returns plaintext encrypted with the current key.
+func (c *Cipher) Encrypt(plaintext []byte) ([]byte, error) {
+	id, key, err := c.kp.CurrentKey()
+	if err != nil {
+		return nil, err
+	}
+	if len(id) > 255 {
+		return nil, fmt.Errorf("key ID too long: %d bytes", len(id))
+	}
+	aead, err := c.aead(id, key)
+	if err != nil {
+		return nil, fmt.Errorf("key %q: %v", id, err)
+	}
+
+	headerLen := len(magic) + 2 + len(id)
+	rv := make([]byte, headerLen+nonceSize,
+		headerLen+nonceSize+len(plaintext)+aead.Overhead())
+	copy(rv, magic)
+	rv[len(magic)] = formatVersion
+	rv[len(magic)+1] = byte(len(id))
+	copy(rv[len(magic)+2:], id)
+	nonce := rv[headerLen : headerLen+nonceSize]
+	_, err = io.ReadFull(rand.Reader, nonce)
+	if err != nil {
+		return nil, err
+	}
+	return aead.Seal(rv, nonce, plaintext, rv[:headerLen]), nil
+}
+
+// Decrypt returns the plaintext of data, encrypted by Encrypt with any key
+// of the provider.
+func (c *Cipher) Decrypt(data []byte) ([]byte, error) {
+	id, headerLen, err := parseHeader(data)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := c.aead(id, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: key %q: %v", ErrDecrypt, id, err)
+	}
+	nonce := data[headerLen : headerLen+nonceSize]
+	rv, err := aead.Open(nil, nonce, data[headerLen+nonceSize:], data[:headerLen])
+	if err != nil {
+		return nil, fmt.Errorf("%w: key %q: %v", ErrDecrypt, id, err)
+	}
+	return rv, nil
+}
+
+// Keyring is a KeyProvider holding its keys in memory.
+type Keyring struct {
+	m       sync.RWMutex // Protects the fields that follow.
+	keys    map[string][]byte
+	current string
+}
+
+// NewKeyring returns an empty Keyring.
+func NewKeyring() *Keyring {
+	return &Keyring{keys: map[string][]byte{}}
+}
+
+// AddKey adds a key to the keyring, making it the current key if current
+// is set, which rotates the keys.
+func (k *Keyring) AddKey(id string, key []byte, current bool) error {
+	switch len(key) {
+	case 16, 24, 32:
+	default:
+		return fmt.Errorf("invalid key length %d, must be 16, 24 or 32", len(key))
+	}
+	k.m.Lock()
+	defer k.m.Unlock()
+	if old, ok := k.keys[id]; ok && !bytes.Equal(old, key) {
+		return fmt.Errorf("key %q already exists", id)
+	}
+	k.keys[id] = append([]byte(nil), key...)
+	if current {
+		k.current = id
+	}
+	return nil
+}
+
+// RemoveKey removes a key rotated out from the keyring, once no data is
+// encrypted with it anymore.
+func (k *Keyring) RemoveKey(id string) error {
+	k.m.Lock()
+	defer k.m.Unlock()
+	if id == k.current {
+		return fmt.Errorf("cannot remove the current key %q", id)
+	}
+	delete(k.keys, id)
+	return nil
+}
+
+func (k *Keyring) CurrentKey() (string, []byte, error) {
+	k.m.RLock()
+	defer k.m.RUnlock()
+	if k.current == "" {
+		return "", nil, fmt.Errorf("no current key")
+	}
+	return k.current, k.keys[k.current], nil
+}
+
+func (k *Keyring) Key(id string) ([]byte, error) {
+	k.m.RLock()
+	defer k.m.RUnlock()
+	key, ok := k.keys[id]
+	if !ok {
+		return nil, fmt.Errorf("no key %q", id)
+	}
+	return key, nil
+}
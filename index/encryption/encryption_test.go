@@ -0,0 +1,120 @@
+//  Copyright (c) 2024 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package encryption
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestCipherKeyRotation(t *testing.T) {
+	keyring := NewKeyring()
+	err := keyring.AddKey("k1", bytes.Repeat([]byte{1}, 32), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewCipher(keyring)
+
+	plaintext := []byte("regulated data")
+	data1, err := c.Encrypt(plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsEncrypted(data1) || bytes.Contains(data1, plaintext) {
+		t.Fatalf("expected data encrypted, got %q", data1)
+	}
+	if id, err := KeyID(data1); err != nil || id != "k1" {
+		t.Errorf("expected key k1, got %q (%v)", id, err)
+	}
+
+	err = keyring.AddKey("k2", bytes.Repeat([]byte{2}, 16), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data2, err := c.Encrypt(plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id, err := KeyID(data2); err != nil || id != "k2" {
+		t.Errorf("expected key k2, got %q (%v)", id, err)
+	}
+
+	// data encrypted with a key rotated out is still decrypted
+	for _, data := range [][]byte{data1, data2} {
+		got, err := c.Decrypt(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, plaintext) {
+			t.Errorf("expected %q, got %q", plaintext, got)
+		}
+	}
+
+	err = keyring.RemoveKey("k2")
+	if err == nil {
+		t.Errorf("expected error removing the current key")
+	}
+	err = keyring.RemoveKey("k1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = NewCipher(keyring).Decrypt(data1)
+	if !errors.Is(err, ErrDecrypt) {
+		t.Errorf("expected ErrDecrypt without the key, got %v", err)
+	}
+}
+
+func TestCipherTampering(t *testing.T) {
+	keyring := NewKeyring()
+	err := keyring.AddKey("k1", bytes.Repeat([]byte{1}, 32), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = keyring.AddKey("k2", bytes.Repeat([]byte{2}, 32), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewCipher(keyring)
+	data, err := c.Encrypt([]byte("regulated data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tampered := append([]byte(nil), data...)
+	tampered[len(tampered)-1] ^= 1
+	_, err = c.Decrypt(tampered)
+	if !errors.Is(err, ErrDecrypt) {
+		t.Errorf("expected ErrDecrypt for tampered data, got %v", err)
+	}
+
+	// the key ID is authenticated along with the data
+	swapped := append([]byte(nil), data...)
+	swapped[len(magic)+3] = '2'
+	_, err = c.Decrypt(swapped)
+	if !errors.Is(err, ErrDecrypt) {
+		t.Errorf("expected ErrDecrypt for a swapped key ID, got %v", err)
+	}
+
+	_, err = c.Decrypt([]byte("plain"))
+	if !errors.Is(err, ErrDecrypt) {
+		t.Errorf("expected ErrDecrypt for plain data, got %v", err)
+	}
+
+	err = keyring.AddKey("short", []byte("short"), false)
+	if err == nil {
+		t.Errorf("expected error adding a short key")
+	}
+}
@@ -0,0 +1,571 @@
+//  Copyright (c) 2024 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scorch
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"time"
+
+	segment "github.com/blevesearch/scorch_segment_api/v2"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Backup writes a consistent copy of the index into dir while the
+// index stays open for reads and writes.  The current root snapshot
+// is pinned for the duration of the copy: its segment files are
+// copied as-is, segments that are still only in memory are persisted
+// straight into dir, and a root.bolt holding just that snapshot is
+// written last.  The resulting directory can be opened as a scorch
+// index.  dir must not already contain an index.
+func (s *Scorch) Backup(dir string) (err error) {
+	if dir == "" {
+		return fmt.Errorf("backup: must specify a destination directory")
+	}
+	rootBoltPath := dir + string(os.PathSeparator) + "root.bolt"
+	if _, err = os.Stat(rootBoltPath); err == nil {
+		return fmt.Errorf("backup: destination %s already contains an index", dir)
+	}
+	err = os.MkdirAll(dir, 0700)
+	if err != nil {
+		return err
+	}
+
+	snapshot, files, err := s.pinSnapshot()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		for _, f := range files {
+			_ = f.Close()
+		}
+		if cerr := snapshot.DecRef(); err == nil {
+			err = cerr
+		}
+	}()
+
+	for _, f := range files {
+		err = copyFile(f, dir+string(os.PathSeparator)+filepath.Base(f.Name()))
+		if err != nil {
+			return fmt.Errorf("backup: error copying segment: %v", err)
+		}
+	}
+
+	// the root bolt is written only once every segment it refers to is
+	// in place, any in-memory segments are persisted into dir as part of
+	// preparing the snapshot
+	rootBolt, err := bolt.Open(rootBoltPath, 0600, bolt.DefaultOptions)
+	if err != nil {
+		return err
+	}
+	err = rootBolt.Update(func(tx *bolt.Tx) error {
+		_, _, err := prepareBoltSnapshot(snapshot, tx, dir, s.segPlugin, s.cipher)
+		return err
+	})
+	if cerr := rootBolt.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// BackupFiles passes a consistent copy of the index to visitor one file
+// at a time, by name along with its size and contents, while the index
+// stays open for reads and writes.  The segment files of the pinned root
+// snapshot are read in place, segments that are still only in memory are
+// persisted into a temporary directory, and root.bolt comes last, so the
+// files can be streamed out as they are visited, such as into an archive.
+func (s *Scorch) BackupFiles(visitor func(name string, size int64, r io.Reader) error) (err error) {
+	snapshot, files, err := s.pinSnapshot()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		for _, f := range files {
+			_ = f.Close()
+		}
+		if cerr := snapshot.DecRef(); err == nil {
+			err = cerr
+		}
+	}()
+
+	stagingDir, err := ioutil.TempDir("", "scorch-backup")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = os.RemoveAll(stagingDir)
+	}()
+
+	var filenames []string
+	rootBoltPath := filepath.Join(stagingDir, "root.bolt")
+	rootBolt, err := bolt.Open(rootBoltPath, 0600, bolt.DefaultOptions)
+	if err != nil {
+		return err
+	}
+	err = rootBolt.Update(func(tx *bolt.Tx) error {
+		var err error
+		filenames, _, err = prepareBoltSnapshot(snapshot, tx, stagingDir, s.segPlugin,
+			s.cipher)
+		return err
+	})
+	if cerr := rootBolt.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+
+	visitFile := func(f *os.File) error {
+		finfo, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		return visitor(filepath.Base(f.Name()), finfo.Size(), f)
+	}
+	for _, f := range files {
+		err = visitFile(f)
+		if err != nil {
+			return err
+		}
+	}
+	for _, filename := range append(filenames, "root.bolt") {
+		f, oerr := os.Open(filepath.Join(stagingDir, filename))
+		if os.IsNotExist(oerr) {
+			continue // visited from the index directory above
+		}
+		if oerr != nil {
+			return oerr
+		}
+		err = visitFile(f)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pinSnapshot returns the current root snapshot with an extra reference
+// held, along with its segment files opened for reading.  Both happen
+// under the root lock, so no file of the snapshot can be removed before
+// it has been opened, and an open file remains readable even if the
+// persister removes it afterwards.
+func (s *Scorch) pinSnapshot() (*IndexSnapshot, []*os.File, error) {
+	s.rootLock.Lock()
+	defer s.rootLock.Unlock()
+
+	var files []*os.File
+	for _, segmentSnapshot := range s.root.segment {
+		if seg, ok := segmentSnapshot.segment.(segment.PersistedSegment); ok {
+			f, err := os.Open(seg.Path())
+			if err != nil {
+				for _, f := range files {
+					_ = f.Close()
+				}
+				return nil, nil, err
+			}
+			files = append(files, f)
+		}
+	}
+
+	rv := s.root
+	rv.AddRef()
+
+	return rv, files, nil
+}
+
+func copyFile(in *os.File, dst string) (err error) {
+	out, err := os.OpenFile(dst, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := out.Close(); err == nil {
+			err = cerr
+		}
+	}()
+
+	_, err = io.Copy(out, in)
+	if err != nil {
+		return err
+	}
+
+	return out.Sync()
+}
+
+const (
+	backupManifestName = "manifest.json"
+	backupSegmentsDir  = "segments"
+	backupEpochsDir    = "epochs"
+)
+
+// BackupManifest describes an incremental backup set, the epochs it
+// holds and the segment files making up each of them.  Segment files
+// are immutable and named by their ID, so successive epochs share the
+// files they have in common, which are stored once.
+type BackupManifest struct {
+	Epochs []*BackupEpoch `json:"epochs"`
+}
+
+// BackupEpoch is a snapshot of the index recorded in a backup set.
+type BackupEpoch struct {
+	Epoch    uint64    `json:"epoch"`
+	Time     time.Time `json:"time"`
+	Segments []string  `json:"segments"`
+}
+
+func (m *BackupManifest) epoch(epoch uint64) *BackupEpoch {
+	for _, e := range m.Epochs {
+		if e.Epoch == epoch {
+			return e
+		}
+	}
+	return nil
+}
+
+// ReadBackupManifest returns the manifest of the incremental backup set
+// in dir, which is empty when no backup was taken there yet.
+func ReadBackupManifest(dir string) (*BackupManifest, error) {
+	rv := &BackupManifest{}
+	buf, err := ioutil.ReadFile(filepath.Join(dir, backupManifestName))
+	if os.IsNotExist(err) {
+		return rv, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(buf, rv)
+	if err != nil {
+		return nil, fmt.Errorf("backup: error parsing manifest: %v", err)
+	}
+	return rv, nil
+}
+
+func writeBackupManifest(dir string, m *BackupManifest) error {
+	buf, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	tmpPath := filepath.Join(dir, backupManifestName+".tmp")
+	err = ioutil.WriteFile(tmpPath, buf, 0600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, filepath.Join(dir, backupManifestName))
+}
+
+// PersistedSnapshot is the latest snapshot persisted by an index, as
+// backed up incrementally or shipped to replication followers.
+type PersistedSnapshot struct {
+	Epoch    uint64   `json:"epoch"`
+	Segments []string `json:"segments"`
+	// Root is a root.bolt holding just this snapshot.
+	Root []byte `json:"root"`
+}
+
+// LatestSnapshot returns the latest snapshot persisted by the index, or
+// nil if it has not persisted any yet.
+func (s *Scorch) LatestSnapshot() (rv *PersistedSnapshot, err error) {
+	if s.rootBolt == nil {
+		return nil, fmt.Errorf("snapshot: index is not persisted")
+	}
+
+	f, err := ioutil.TempFile("", "bleve-snapshot")
+	if err != nil {
+		return nil, err
+	}
+	rootBoltPath := f.Name()
+	_ = f.Close()
+	defer func() {
+		_ = os.Remove(rootBoltPath)
+	}()
+
+	rootBolt, err := bolt.Open(rootBoltPath, 0600, bolt.DefaultOptions)
+	if err != nil {
+		return nil, err
+	}
+	err = s.rootBolt.View(func(tx *bolt.Tx) error {
+		snapshots := tx.Bucket(boltSnapshotsBucket)
+		if snapshots == nil {
+			return nil
+		}
+		k, _ := snapshots.Cursor().Last()
+		if k == nil {
+			return nil
+		}
+		_, epoch, err := decodeUvarintAscending(k)
+		if err != nil {
+			return fmt.Errorf("snapshot: unable to parse segment epoch %x: %v", k, err)
+		}
+		snapshot := snapshots.Bucket(k)
+		if snapshot == nil {
+			return fmt.Errorf("snapshot: snapshot %d is not a bucket", epoch)
+		}
+
+		rv = &PersistedSnapshot{Epoch: epoch}
+		c := snapshot.Cursor()
+		for sk, _ := c.First(); sk != nil; sk, _ = c.Next() {
+			if sk[0] == boltInternalKey[0] || sk[0] == boltMetaDataKey[0] {
+				continue
+			}
+			segmentBucket := snapshot.Bucket(sk)
+			if segmentBucket == nil {
+				return fmt.Errorf("snapshot: segment key, but bucket missing %x", sk)
+			}
+			rv.Segments = append(rv.Segments, string(segmentBucket.Get(boltPathKey)))
+		}
+
+		return rootBolt.Update(func(dtx *bolt.Tx) error {
+			dstSnapshots, err := dtx.CreateBucket(boltSnapshotsBucket)
+			if err != nil {
+				return err
+			}
+			dstSnapshot, err := dstSnapshots.CreateBucket(k)
+			if err != nil {
+				return err
+			}
+			return copyBoltBucket(snapshot, dstSnapshot)
+		})
+	})
+	if cerr := rootBolt.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil || rv == nil {
+		return nil, err
+	}
+
+	rv.Root, err = ioutil.ReadFile(rootBoltPath)
+	if err != nil {
+		return nil, err
+	}
+	return rv, nil
+}
+
+// copyBoltBucket copies the keys and nested buckets of src into dst.
+func copyBoltBucket(src, dst *bolt.Bucket) error {
+	return src.ForEach(func(k, v []byte) error {
+		if v != nil {
+			return dst.Put(k, v)
+		}
+		nested, err := dst.CreateBucket(k)
+		if err != nil {
+			return err
+		}
+		return copyBoltBucket(src.Bucket(k), nested)
+	})
+}
+
+// backupRetries is the number of times an incremental backup moves on
+// to a later persisted snapshot when the segment files of the snapshot
+// it was copying are removed under it.
+const backupRetries = 10
+
+// BackupIncremental adds the latest snapshot persisted by the index to
+// the incremental backup set in dir, creating it if needed, and returns
+// the epoch it was recorded under.  Only persisted snapshots are backed
+// up, as the epochs and segment IDs of the snapshots lost in a crash are
+// handed out again once the index is reopened, so changes not persisted
+// yet go into a later backup.  Only the segment files not already in the
+// set are copied.  The segment files go first, then the root.bolt of the
+// epoch, and the manifest is updated last, so an interrupted backup
+// leaves the epochs already recorded intact.
+func (s *Scorch) BackupIncremental(dir string) (epoch uint64, err error) {
+	if dir == "" {
+		return 0, fmt.Errorf("backup: must specify a destination directory")
+	}
+	segmentsDir := filepath.Join(dir, backupSegmentsDir)
+	epochsDir := filepath.Join(dir, backupEpochsDir)
+	for _, d := range []string{segmentsDir, epochsDir} {
+		err = os.MkdirAll(d, 0700)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	manifest, err := ReadBackupManifest(dir)
+	if err != nil {
+		return 0, err
+	}
+
+	for attempt := 0; ; attempt++ {
+		var snapshot *PersistedSnapshot
+		snapshot, err = s.LatestSnapshot()
+		if err != nil {
+			return 0, err
+		}
+		if snapshot == nil {
+			return 0, fmt.Errorf("backup: index has not persisted any snapshot yet")
+		}
+
+		if e := manifest.epoch(snapshot.Epoch); e != nil {
+			if !reflect.DeepEqual(e.Segments, snapshot.Segments) {
+				return 0, fmt.Errorf("backup: epoch %d is already recorded with"+
+					" different segments, backup set belongs to another index?",
+					snapshot.Epoch)
+			}
+			return snapshot.Epoch, nil
+		}
+
+		err = s.backupSegments(segmentsDir, snapshot.Segments)
+		if os.IsNotExist(err) && attempt < backupRetries {
+			// removed once a later snapshot was persisted, back that up
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		rootBoltPath := filepath.Join(epochsDir, backupEpochFileName(snapshot.Epoch))
+		err = ioutil.WriteFile(rootBoltPath+".tmp", snapshot.Root, 0600)
+		if err != nil {
+			return 0, err
+		}
+		err = os.Rename(rootBoltPath+".tmp", rootBoltPath)
+		if err != nil {
+			return 0, err
+		}
+
+		manifest.Epochs = append(manifest.Epochs, &BackupEpoch{
+			Epoch:    snapshot.Epoch,
+			Time:     time.Now(),
+			Segments: snapshot.Segments,
+		})
+		err = writeBackupManifest(dir, manifest)
+		if err != nil {
+			return 0, err
+		}
+
+		return snapshot.Epoch, nil
+	}
+}
+
+// backupSegments adds the named segment files of the index to the set
+// in segmentsDir.  The error satisfies os.IsNotExist when one of them
+// has been removed from the index.
+func (s *Scorch) backupSegments(segmentsDir string, filenames []string) error {
+	for _, filename := range filenames {
+		f, err := os.Open(filepath.Join(s.path, filename))
+		if err != nil {
+			return err
+		}
+		finfo, err := f.Stat()
+		if err == nil {
+			err = addBackupSegment(segmentsDir, filename, finfo.Size(),
+				func(dst string) error { return copyFile(f, dst) })
+		}
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addBackupSegment adds the segment file filename, of the given size,
+// to the set in segmentsDir using add, unless the set already holds it.
+// As the same ID always names the same immutable segment of an index,
+// an existing file of a different size means the set belongs to another
+// index.
+func addBackupSegment(segmentsDir, filename string, size int64,
+	add func(dst string) error) error {
+	dst := filepath.Join(segmentsDir, filename)
+	existing, err := os.Stat(dst)
+	if err == nil {
+		if existing.Size() != size {
+			return fmt.Errorf("backup: segment %s differs from the one in the"+
+				" backup set, backup set belongs to another index?", filename)
+		}
+		return nil
+	}
+	if !os.IsNotExist(err) {
+		return err
+	}
+
+	// the file only gets its final name once complete, so that an
+	// interrupted copy is not mistaken for the segment later
+	tmp := dst + ".tmp"
+	_ = os.Remove(tmp)
+	err = add(tmp)
+	if err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("backup: error adding segment %s: %v", filename, err)
+	}
+	return os.Rename(tmp, dst)
+}
+
+func backupEpochFileName(epoch uint64) string {
+	return fmt.Sprintf("%016x.bolt", epoch)
+}
+
+// RestoreIncrementalBackup rebuilds the given epoch of the incremental
+// backup set in dir as a scorch index in dst, which must not already
+// contain an index.  An epoch of 0 restores the latest one.
+func RestoreIncrementalBackup(dir string, epoch uint64, dst string) (err error) {
+	manifest, err := ReadBackupManifest(dir)
+	if err != nil {
+		return err
+	}
+	if len(manifest.Epochs) == 0 {
+		return fmt.Errorf("restore: no backup found in %s", dir)
+	}
+	e := manifest.Epochs[len(manifest.Epochs)-1]
+	if epoch != 0 {
+		e = manifest.epoch(epoch)
+		if e == nil {
+			return fmt.Errorf("restore: epoch %d not found in backup set", epoch)
+		}
+	}
+
+	rootBoltPath := filepath.Join(dst, "root.bolt")
+	if _, err = os.Stat(rootBoltPath); err == nil {
+		return fmt.Errorf("restore: destination %s already contains an index", dst)
+	}
+	err = os.MkdirAll(dst, 0700)
+	if err != nil {
+		return err
+	}
+
+	for _, filename := range e.Segments {
+		err = copyFilePath(filepath.Join(dir, backupSegmentsDir, filename),
+			filepath.Join(dst, filename))
+		if err != nil {
+			return fmt.Errorf("restore: error copying segment: %v", err)
+		}
+	}
+
+	// the root.bolt goes last, as it is what makes dst an index
+	return copyFilePath(filepath.Join(dir, backupEpochsDir,
+		backupEpochFileName(e.Epoch)), rootBoltPath)
+}
+
+func copyFilePath(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = in.Close()
+	}()
+	return copyFile(in, dst)
+}
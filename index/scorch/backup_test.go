@@ -0,0 +1,283 @@
+//  Copyright (c) 2024 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scorch
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/blevesearch/bleve/v2/document"
+	index "github.com/blevesearch/bleve_index_api"
+)
+
+func TestIndexBackup(t *testing.T) {
+	cfg := CreateConfig("TestIndexBackup")
+	backupCfg := CreateConfig("TestIndexBackup-backup")
+	for _, c := range []map[string]interface{}{cfg, backupCfg} {
+		err := InitTest(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	defer func() {
+		for _, c := range []map[string]interface{}{cfg, backupCfg} {
+			err := DestroyTest(c)
+			if err != nil {
+				t.Log(err)
+			}
+		}
+	}()
+
+	analysisQueue := index.NewAnalysisQueue(1)
+	idx, err := NewScorch(Name, cfg, analysisQueue)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = idx.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := idx.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	newBatch := func(start, n int) *index.Batch {
+		batch := index.NewBatch()
+		for i := start; i < start+n; i++ {
+			doc := document.NewDocument(strconv.Itoa(i))
+			doc.AddField(document.NewTextField("name", []uint64{}, []byte("test")))
+			batch.Update(doc)
+		}
+		return batch
+	}
+
+	err = idx.Batch(newBatch(0, 100))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = idx.SetInternal([]byte("k"), []byte("v"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// keep writing while the backup is taken
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 1; i <= 10; i++ {
+			if err := idx.Batch(newBatch(i*100, 100)); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+
+	backupPath := backupCfg["path"].(string)
+	err = idx.(*Scorch).Backup(backupPath)
+	wg.Wait()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = idx.(*Scorch).Backup(backupPath)
+	if err == nil {
+		t.Fatal("expected error backing up into an existing index")
+	}
+
+	backup, err := NewScorch(Name, backupCfg, analysisQueue)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = backup.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := backup.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	reader, err := backup.Reader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := reader.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	count, err := reader.DocCount()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count < 100 || count > 1100 || count%100 != 0 {
+		t.Errorf("expected a whole number of batches in the backup, got %d docs", count)
+	}
+	v, err := reader.GetInternal([]byte("k"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(v) != "v" {
+		t.Errorf("expected internal value v, got %q", v)
+	}
+}
+
+func TestIndexBackupIncremental(t *testing.T) {
+	cfg := CreateConfig("TestIndexBackupIncremental")
+	backupCfg := CreateConfig("TestIndexBackupIncremental-backup")
+	for _, c := range []map[string]interface{}{cfg, backupCfg} {
+		err := InitTest(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	defer func() {
+		for _, c := range []map[string]interface{}{cfg, backupCfg} {
+			err := DestroyTest(c)
+			if err != nil {
+				t.Log(err)
+			}
+		}
+	}()
+
+	analysisQueue := index.NewAnalysisQueue(1)
+	idx, err := NewScorch(Name, cfg, analysisQueue)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = idx.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := idx.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	backupDir := backupCfg["path"].(string)
+	var epochs []uint64
+	for i := 0; i < 3; i++ {
+		batch := index.NewBatch()
+		for j := i * 10; j < (i+1)*10; j++ {
+			doc := document.NewDocument(strconv.Itoa(j))
+			doc.AddField(document.NewTextField("name", []uint64{}, []byte("test")))
+			batch.Update(doc)
+		}
+		err = idx.Batch(batch)
+		if err != nil {
+			t.Fatal(err)
+		}
+		epoch, err := idx.(*Scorch).BackupIncremental(backupDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// only persisted epochs are backed up
+		if epoch > atomic.LoadUint64(&idx.(*Scorch).stats.LastPersistedEpoch) {
+			t.Errorf("expected a persisted epoch, got %d", epoch)
+		}
+		epochs = append(epochs, epoch)
+	}
+
+	manifest, err := ReadBackupManifest(backupDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(manifest.Epochs) != 3 {
+		t.Fatalf("expected 3 epochs in manifest, got %d", len(manifest.Epochs))
+	}
+
+	// segments shared by epochs are stored once
+	segments := map[string]struct{}{}
+	for _, e := range manifest.Epochs {
+		for _, filename := range e.Segments {
+			segments[filename] = struct{}{}
+		}
+	}
+	finfos, err := ioutil.ReadDir(filepath.Join(backupDir, backupSegmentsDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(finfos) != len(segments) {
+		t.Errorf("expected %d segment files in backup set, got %d",
+			len(segments), len(finfos))
+	}
+
+	for i, epoch := range append(epochs, 0) {
+		expected := uint64(i+1) * 10
+		if epoch == 0 {
+			expected = 30
+		}
+		restoreCfg := CreateConfig("TestIndexBackupIncremental-restore")
+		err = InitTest(restoreCfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = RestoreIncrementalBackup(backupDir, epoch, restoreCfg["path"].(string))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		restored, err := NewScorch(Name, restoreCfg, analysisQueue)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = restored.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader, err := restored.Reader()
+		if err != nil {
+			t.Fatal(err)
+		}
+		count, err := reader.DocCount()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if count != expected {
+			t.Errorf("epoch %d: expected %d docs, got %d", epoch, expected, count)
+		}
+		err = reader.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = restored.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = DestroyTest(restoreCfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = RestoreIncrementalBackup(backupDir, epochs[2]+1000, filepath.Join(backupDir, "x"))
+	if err == nil {
+		t.Error("expected error restoring an unknown epoch")
+	}
+}
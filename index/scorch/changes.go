@@ -0,0 +1,314 @@
+//  Copyright (c) 2024 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scorch
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/blevesearch/bleve/v2/index/encryption"
+	index "github.com/blevesearch/bleve_index_api"
+	bolt "go.etcd.io/bbolt"
+)
+
+// ErrChangesTrimmed is returned when reading the change stream from a
+// sequence number whose records were already trimmed.
+var ErrChangesTrimmed = fmt.Errorf("change stream records were trimmed")
+
+// ErrChangeStreamDisabled is returned when reading the change stream of
+// an index not configured with "changeStream" set to true.
+var ErrChangeStreamDisabled = fmt.Errorf("change stream is not enabled")
+
+var boltChangesBucket = []byte{'c'}
+
+// boltChangeSeqBucket holds the sequence number of the next change
+// record, so that numbering carries on once every record was trimmed.
+var boltChangeSeqBucket = []byte{'q'}
+var boltNextChangeSeqKey = []byte{'n'}
+
+// ChangeRecord describes the mutations applied by one batch, recorded in
+// the change stream of an index configured with "changeStream" set to
+// true.  Records are numbered by Seq, starting at 1 without gaps, in the
+// order the batches were applied, and only become visible once the
+// snapshot of Epoch, which includes the batch, is persisted.
+type ChangeRecord struct {
+	Seq   uint64 `json:"seq"`
+	Epoch uint64 `json:"epoch"`
+
+	Indexed         []string          `json:"indexed,omitempty"`
+	Deleted         []string          `json:"deleted,omitempty"`
+	InternalSet     map[string][]byte `json:"internal_set,omitempty"`
+	InternalDeleted []string          `json:"internal_deleted,omitempty"`
+}
+
+func newChangeRecord(batch *index.Batch) *ChangeRecord {
+	rv := &ChangeRecord{}
+	for docID, doc := range batch.IndexOps {
+		if doc != nil {
+			rv.Indexed = append(rv.Indexed, docID)
+		} else {
+			rv.Deleted = append(rv.Deleted, docID)
+		}
+	}
+	for key, val := range batch.InternalOps {
+		if val != nil {
+			if rv.InternalSet == nil {
+				rv.InternalSet = make(map[string][]byte)
+			}
+			rv.InternalSet[key] = val
+		} else {
+			rv.InternalDeleted = append(rv.InternalDeleted, key)
+		}
+	}
+	if len(rv.Indexed) == 0 && len(rv.Deleted) == 0 &&
+		len(rv.InternalSet) == 0 && len(rv.InternalDeleted) == 0 {
+		return nil
+	}
+	sort.Strings(rv.Indexed)
+	sort.Strings(rv.Deleted)
+	sort.Strings(rv.InternalDeleted)
+	return rv
+}
+
+func encodeChangeSeq(seq uint64) []byte {
+	rv := make([]byte, 8)
+	binary.BigEndian.PutUint64(rv, seq)
+	return rv
+}
+
+// loadChangeSeq sets the sequence number of the next change record past
+// the last one persisted, even if it was trimmed since.
+func (s *Scorch) loadChangeSeq() error {
+	return s.rootBolt.View(func(tx *bolt.Tx) error {
+		s.nextChangeSeq = persistedChangeSeq(tx)
+		changes := tx.Bucket(boltChangesBucket)
+		if changes == nil {
+			return nil
+		}
+		k, _ := changes.Cursor().Last()
+		if k != nil && binary.BigEndian.Uint64(k) >= s.nextChangeSeq {
+			s.nextChangeSeq = binary.BigEndian.Uint64(k) + 1
+		}
+		return nil
+	})
+}
+
+// pendingChangesUpTo returns the change records which are not persisted
+// yet and are included in the snapshot of the given epoch.
+func (s *Scorch) pendingChangesUpTo(epoch uint64) []*ChangeRecord {
+	s.rootLock.RLock()
+	defer s.rootLock.RUnlock()
+
+	n := 0
+	for n < len(s.pendingChanges) && s.pendingChanges[n].Epoch <= epoch {
+		n++
+	}
+	return s.pendingChanges[:n:n]
+}
+
+func prepareBoltChanges(tx *bolt.Tx, changes []*ChangeRecord,
+	cipher *encryption.Cipher) error {
+	if len(changes) == 0 {
+		return nil
+	}
+	changesBucket, err := tx.CreateBucketIfNotExists(boltChangesBucket)
+	if err != nil {
+		return err
+	}
+	for _, change := range changes {
+		buf, err := json.Marshal(change)
+		if err != nil {
+			return err
+		}
+		buf, err = encryptValue(cipher, buf)
+		if err != nil {
+			return err
+		}
+		err = changesBucket.Put(encodeChangeSeq(change.Seq), buf)
+		if err != nil {
+			return err
+		}
+	}
+	seqBucket, err := tx.CreateBucketIfNotExists(boltChangeSeqBucket)
+	if err != nil {
+		return err
+	}
+	return seqBucket.Put(boltNextChangeSeqKey,
+		encodeChangeSeq(changes[len(changes)-1].Seq+1))
+}
+
+// changesPersisted drops the first n pending change records, now
+// persisted, and wakes up the subscriptions waiting for them.
+func (s *Scorch) changesPersisted(n int) {
+	if n == 0 {
+		return
+	}
+	s.rootLock.Lock()
+	s.pendingChanges = s.pendingChanges[n:]
+	close(s.changesCh)
+	s.changesCh = make(chan struct{})
+	s.rootLock.Unlock()
+}
+
+// persistedChangeSeq returns the sequence number of the next change
+// record past the last one persisted, even if it was trimmed since.
+func persistedChangeSeq(tx *bolt.Tx) uint64 {
+	if seqBucket := tx.Bucket(boltChangeSeqBucket); seqBucket != nil {
+		if v := seqBucket.Get(boltNextChangeSeqKey); len(v) == 8 {
+			return binary.BigEndian.Uint64(v)
+		}
+	}
+	return 1
+}
+
+// Changes returns up to limit persisted change records, starting at the
+// sequence number from, or at the oldest record kept when from is 0.
+func (s *Scorch) Changes(from uint64, limit int) ([]*ChangeRecord, error) {
+	if !s.changeStream || s.rootBolt == nil {
+		return nil, ErrChangeStreamDisabled
+	}
+
+	var rv []*ChangeRecord
+	err := s.rootBolt.View(func(tx *bolt.Tx) error {
+		var k, v []byte
+		var c *bolt.Cursor
+		if changes := tx.Bucket(boltChangesBucket); changes != nil {
+			c = changes.Cursor()
+			k, v = c.Seek(encodeChangeSeq(from))
+		}
+		if k == nil {
+			// with no record at or after from, the records from on were
+			// trimmed unless none was persisted yet
+			if from > 0 && from < persistedChangeSeq(tx) {
+				return ErrChangesTrimmed
+			}
+			return nil
+		}
+		for ; k != nil && len(rv) < limit; k, v = c.Next() {
+			v, err := decryptValue(s.cipher, v)
+			if err != nil {
+				return fmt.Errorf("error reading change record %d: %w",
+					binary.BigEndian.Uint64(k), err)
+			}
+			var change ChangeRecord
+			err = json.Unmarshal(v, &change)
+			if err != nil {
+				return fmt.Errorf("error parsing change record %d: %v",
+					binary.BigEndian.Uint64(k), err)
+			}
+			if len(rv) == 0 && from > 0 && change.Seq > from {
+				return ErrChangesTrimmed
+			}
+			rv = append(rv, &change)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rv, nil
+}
+
+// TrimChanges removes the persisted change records numbered before the
+// sequence number before, once every consumer is past them.
+func (s *Scorch) TrimChanges(before uint64) error {
+	if !s.changeStream || s.rootBolt == nil {
+		return ErrChangeStreamDisabled
+	}
+
+	return s.rootBolt.Update(func(tx *bolt.Tx) error {
+		changes := tx.Bucket(boltChangesBucket)
+		if changes == nil {
+			return nil
+		}
+		c := changes.Cursor()
+		for k, _ := c.First(); k != nil &&
+			binary.BigEndian.Uint64(k) < before; k, _ = c.First() {
+			err := c.Delete()
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// SubscribeChanges returns a subscription to the change stream, which
+// delivers the change records in order starting at the sequence number
+// from, or at the oldest record kept when from is 0.  A consumer resumes
+// after a restart by subscribing from the Offset it last saw.
+func (s *Scorch) SubscribeChanges(from uint64) (*ChangeSubscription, error) {
+	if !s.changeStream || s.rootBolt == nil {
+		return nil, ErrChangeStreamDisabled
+	}
+	return &ChangeSubscription{s: s, next: from}, nil
+}
+
+// ChangeSubscription delivers the records of a change stream in order.
+type ChangeSubscription struct {
+	s    *Scorch
+	next uint64
+	buf  []*ChangeRecord
+}
+
+// changeSubscriptionBatchSize is the number of change records read at
+// once by a subscription.
+var changeSubscriptionBatchSize = 100
+
+// Next returns the next change record, waiting for it to be persisted
+// if needed, until ctx is done or the index is closed.
+func (c *ChangeSubscription) Next(ctx context.Context) (*ChangeRecord, error) {
+	for {
+		if len(c.buf) > 0 {
+			rv := c.buf[0]
+			c.buf = c.buf[1:]
+			c.next = rv.Seq + 1
+			return rv, nil
+		}
+
+		// grab the notification channel before reading, so that no
+		// record persisted in between is missed
+		c.s.rootLock.RLock()
+		changesCh := c.s.changesCh
+		closeCh := c.s.closeCh
+		c.s.rootLock.RUnlock()
+
+		changes, err := c.s.Changes(c.next, changeSubscriptionBatchSize)
+		if err != nil {
+			return nil, err
+		}
+		if len(changes) > 0 {
+			c.buf = changes
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-closeCh:
+			return nil, ErrClosed
+		case <-changesCh:
+		}
+	}
+}
+
+// Offset returns the sequence number of the record the subscription
+// delivers next, from which a new subscription resumes.
+func (c *ChangeSubscription) Offset() uint64 {
+	return c.next
+}
@@ -0,0 +1,206 @@
+//  Copyright (c) 2024 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scorch
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/blevesearch/bleve/v2/document"
+	index "github.com/blevesearch/bleve_index_api"
+)
+
+func TestIndexChangeStream(t *testing.T) {
+	cfg := CreateConfig("TestIndexChangeStream")
+	cfg["changeStream"] = true
+	err := InitTest(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := DestroyTest(cfg)
+		if err != nil {
+			t.Log(err)
+		}
+	}()
+
+	analysisQueue := index.NewAnalysisQueue(1)
+	open := func() *Scorch {
+		idx, err := NewScorch(Name, cfg, analysisQueue)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = idx.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return idx.(*Scorch)
+	}
+	idx := open()
+
+	batch := index.NewBatch()
+	for _, id := range []string{"b", "a"} {
+		doc := document.NewDocument(id)
+		doc.AddField(document.NewTextField("name", []uint64{}, []byte("test")))
+		batch.Update(doc)
+	}
+	err = idx.Batch(batch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	batch = index.NewBatch()
+	batch.Delete("a")
+	batch.SetInternal([]byte("k"), []byte("v"))
+	batch.DeleteInternal([]byte("old"))
+	err = idx.Batch(batch)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	sub, err := idx.SubscribeChanges(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := sub.Next(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Seq != 1 || !reflect.DeepEqual(first.Indexed, []string{"a", "b"}) ||
+		first.Deleted != nil {
+		t.Errorf("unexpected first change record %+v", first)
+	}
+	second, err := sub.Next(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.Seq != 2 || second.Epoch <= first.Epoch ||
+		!reflect.DeepEqual(second.Deleted, []string{"a"}) ||
+		!reflect.DeepEqual(second.InternalSet, map[string][]byte{"k": []byte("v")}) ||
+		!reflect.DeepEqual(second.InternalDeleted, []string{"old"}) {
+		t.Errorf("unexpected second change record %+v", second)
+	}
+	if sub.Offset() != 3 {
+		t.Errorf("expected offset 3, got %d", sub.Offset())
+	}
+
+	// the subscription waits for the next batch to be persisted
+	nextCh := make(chan *ChangeRecord)
+	go func() {
+		next, err := sub.Next(ctx)
+		if err != nil {
+			t.Error(err)
+		}
+		nextCh <- next
+	}()
+	err = idx.Delete("b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next := <-nextCh; next == nil || next.Seq != 3 ||
+		!reflect.DeepEqual(next.Deleted, []string{"b"}) {
+		t.Errorf("unexpected third change record %+v", next)
+	}
+
+	// the stream survives a restart, and is resumed from an offset
+	err = idx.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx = open()
+	defer func() {
+		err := idx.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	sub, err = idx.SubscribeChanges(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resumed, err := sub.Next(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(resumed, second) {
+		t.Errorf("expected resumed record %+v, got %+v", second, resumed)
+	}
+	err = idx.SetInternal([]byte("k"), []byte("w"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	changes, err := idx.Changes(4, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 1 || changes[0].Seq != 4 {
+		t.Errorf("expected the fourth change record, got %+v", changes)
+	}
+
+	err = idx.TrimChanges(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = idx.Changes(2, 10)
+	if err != ErrChangesTrimmed {
+		t.Errorf("expected ErrChangesTrimmed, got %v", err)
+	}
+	changes, err = idx.Changes(0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 2 || changes[0].Seq != 3 {
+		t.Errorf("expected the change records from 3 on, got %+v", changes)
+	}
+
+	// numbering carries on after every record was trimmed and a restart
+	err = idx.TrimChanges(5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = idx.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx = open()
+	_, err = idx.Changes(4, 10)
+	if err != ErrChangesTrimmed {
+		t.Errorf("expected ErrChangesTrimmed with no record left, got %v", err)
+	}
+	changes, err = idx.Changes(5, 10)
+	if err != nil || len(changes) != 0 {
+		t.Errorf("expected no change record yet, got %+v, %v", changes, err)
+	}
+	sub, err = idx.SubscribeChanges(5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = idx.Delete("c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	next, err := sub.Next(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next.Seq != 5 || !reflect.DeepEqual(next.Deleted, []string{"c"}) {
+		t.Errorf("expected the fifth change record, got %+v", next)
+	}
+}
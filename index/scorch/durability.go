@@ -0,0 +1,188 @@
+//  Copyright (c) 2024 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scorch
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	index "github.com/blevesearch/bleve_index_api"
+)
+
+// Durability is how durable a batch is when applying it returns.
+type Durability int
+
+const (
+	// DurabilityDefault uses the durability configured for the index by
+	// "durability", or DurabilityFsync.
+	DurabilityDefault Durability = iota
+	// DurabilityMemory returns once the batch is searchable, the
+	// persister writes it out in the background.  With a write-ahead
+	// log, the batch is also written to the log without being synced,
+	// surviving a crash of the process but not of the host.
+	DurabilityMemory
+	// DurabilityPersisted returns once the batch is written to disk:
+	// to the write-ahead log when enabled, else by the persister, which
+	// always syncs what it writes.
+	DurabilityPersisted
+	// DurabilityFsync returns once the batch is synced to stable
+	// storage: the write-ahead log when enabled, else by the persister.
+	DurabilityFsync
+)
+
+func (d Durability) String() string {
+	switch d {
+	case DurabilityDefault:
+		return "default"
+	case DurabilityMemory:
+		return "memory"
+	case DurabilityPersisted:
+		return "persisted"
+	case DurabilityFsync:
+		return "fsync"
+	}
+	return fmt.Sprintf("Durability(%d)", int(d))
+}
+
+// ParseDurability returns the durability named by s, as found in the
+// "durability" config of an index.
+func ParseDurability(s string) (Durability, error) {
+	for _, d := range []Durability{DurabilityDefault, DurabilityMemory,
+		DurabilityPersisted, DurabilityFsync} {
+		if d.String() == s {
+			return d, nil
+		}
+	}
+	return DurabilityDefault, fmt.Errorf("unknown durability %q", s)
+}
+
+// batchCommit is the work of committing analyzed batches, as a single
+// segment introduction.
+type batchCommit struct {
+	results    []index.Document
+	ids        []string
+	internal   map[string][]byte
+	changes    []*ChangeRecord
+	callbacks  []index.BatchCallback
+	durability Durability
+	walSeq     uint64 // Set when replaying the write-ahead log.
+}
+
+// merge folds o, applied after c, into c: the operations of o on
+// documents and internal values replace those of c.  c is then as
+// durable as the most durable of both.
+func (c *batchCommit) merge(o *batchCommit) {
+	replaced := make(map[string]struct{}, len(o.ids))
+	for _, id := range o.ids {
+		replaced[id] = struct{}{}
+	}
+	results := c.results[:0]
+	for _, doc := range c.results {
+		if _, ok := replaced[doc.ID()]; !ok {
+			results = append(results, doc)
+		}
+	}
+	c.results = append(results, o.results...)
+
+	for _, id := range c.ids {
+		delete(replaced, id)
+	}
+	for _, id := range o.ids {
+		if _, ok := replaced[id]; ok {
+			c.ids = append(c.ids, id)
+		}
+	}
+
+	// the internal ops of a batch belong to the caller, never update them
+	if len(o.internal) > 0 {
+		internal := make(map[string][]byte, len(c.internal)+len(o.internal))
+		for k, v := range c.internal {
+			internal[k] = v
+		}
+		for k, v := range o.internal {
+			internal[k] = v
+		}
+		c.internal = internal
+	}
+
+	c.changes = append(c.changes, o.changes...)
+	c.callbacks = append(c.callbacks, o.callbacks...)
+	if o.durability > c.durability {
+		c.durability = o.durability
+	}
+}
+
+func (c *batchCommit) persistedCallback() index.BatchCallback {
+	switch len(c.callbacks) {
+	case 0:
+		return nil
+	case 1:
+		return c.callbacks[0]
+	}
+	callbacks := c.callbacks
+	return func(err error) {
+		for _, cb := range callbacks {
+			cb(err)
+		}
+	}
+}
+
+// batchGroup is a group commit, collecting the batches applied while
+// the previous group is being introduced.
+type batchGroup struct {
+	commit     *batchCommit
+	prev       chan struct{} // Closed once the previous group is introduced.
+	introduced chan struct{}
+	done       chan struct{}
+	err        error
+}
+
+// commitGroup commits c along with the batches applied concurrently, as
+// a single segment, write-ahead log record and sync.  Every batch of the
+// group returns once the group is as durable as its most durable batch.
+func (s *Scorch) commitGroup(c *batchCommit) error {
+	s.groupLock.Lock()
+	g := s.group
+	if g != nil {
+		g.commit.merge(c)
+		s.groupLock.Unlock()
+		atomic.AddUint64(&s.stats.TotBatchesGrouped, 1)
+		<-g.done
+		return g.err
+	}
+	g = &batchGroup{
+		commit:     c,
+		prev:       s.groupIntroduced,
+		introduced: make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+	s.group = g
+	s.groupIntroduced = g.introduced
+	s.groupLock.Unlock()
+
+	// the batches applied until the previous group is introduced join
+	// this one, keeping the groups in order
+	<-g.prev
+
+	s.groupLock.Lock()
+	s.group = nil
+	s.groupLock.Unlock()
+
+	g.err = s.commit(g.commit, func() {
+		close(g.introduced)
+	})
+	close(g.done)
+	return g.err
+}
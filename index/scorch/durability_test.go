@@ -0,0 +1,157 @@
+//  Copyright (c) 2024 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scorch
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/blevesearch/bleve/v2/document"
+	index "github.com/blevesearch/bleve_index_api"
+)
+
+func TestBatchCommitMerge(t *testing.T) {
+	newDoc := func(id string) index.Document {
+		return document.NewDocument(id)
+	}
+	internal := map[string][]byte{"k": []byte("v1")}
+	c := &batchCommit{
+		results:    []index.Document{newDoc("a"), newDoc("b")},
+		ids:        []string{"a", "b", "c"},
+		internal:   internal,
+		durability: DurabilityMemory,
+	}
+	c.merge(&batchCommit{
+		results:    []index.Document{newDoc("b"), newDoc("d")},
+		ids:        []string{"a", "b", "d"},
+		internal:   map[string][]byte{"k": []byte("v2"), "old": nil},
+		durability: DurabilityFsync,
+	})
+
+	var results []string
+	for _, doc := range c.results {
+		results = append(results, doc.ID())
+	}
+	if !reflect.DeepEqual(results, []string{"b", "d"}) {
+		t.Errorf("expected documents b and d, got %v", results)
+	}
+	if !reflect.DeepEqual(c.ids, []string{"a", "b", "c", "d"}) {
+		t.Errorf("expected ids a to d, got %v", c.ids)
+	}
+	if string(c.internal["k"]) != "v2" || c.internal["old"] != nil {
+		t.Errorf("unexpected internal values %v", c.internal)
+	}
+	if string(internal["k"]) != "v1" {
+		t.Errorf("expected the batch internal values unchanged, got %v", internal)
+	}
+	if c.durability != DurabilityFsync {
+		t.Errorf("expected fsync durability, got %v", c.durability)
+	}
+}
+
+func TestIndexGroupCommit(t *testing.T) {
+	cfg := CreateConfig("TestIndexGroupCommit")
+	cfg["groupCommit"] = true
+	err := InitTest(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := DestroyTest(cfg)
+		if err != nil {
+			t.Log(err)
+		}
+	}()
+
+	analysisQueue := index.NewAnalysisQueue(1)
+	idx, err := NewScorch(Name, cfg, analysisQueue)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = idx.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := idx.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	durabilities := []Durability{DurabilityMemory, DurabilityPersisted,
+		DurabilityFsync}
+	var wg sync.WaitGroup
+	for i := 0; i < 30; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			batch := index.NewBatch()
+			doc := document.NewDocument(fmt.Sprintf("doc%d", i))
+			doc.AddField(document.NewTextFieldWithAnalyzer("name", []uint64{},
+				[]byte("grouped"), testAnalyzer))
+			batch.Update(doc)
+			batch.SetInternal([]byte(fmt.Sprintf("k%d", i)), []byte("v"))
+			err := idx.(*Scorch).BatchWithDurability(batch, durabilities[i%3])
+			if err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	reader, err := idx.Reader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := reader.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+	count, err := reader.DocCount()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 30 {
+		t.Errorf("expected 30 documents, got %d", count)
+	}
+	for i := 0; i < 30; i++ {
+		val, err := reader.GetInternal([]byte(fmt.Sprintf("k%d", i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(val) != "v" {
+			t.Errorf("expected internal value k%d set, got %q", i, val)
+		}
+	}
+}
+
+func TestParseDurability(t *testing.T) {
+	for _, d := range []Durability{DurabilityMemory, DurabilityPersisted,
+		DurabilityFsync} {
+		parsed, err := ParseDurability(d.String())
+		if err != nil || parsed != d {
+			t.Errorf("expected %v, got %v (%v)", d, parsed, err)
+		}
+	}
+	_, err := ParseDurability("eventually")
+	if err == nil {
+		t.Errorf("expected error parsing an unknown durability")
+	}
+}
@@ -0,0 +1,346 @@
+//  Copyright (c) 2024 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scorch
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"sync/atomic"
+
+	"github.com/RoaringBitmap/roaring"
+	"github.com/blevesearch/bleve/v2/index/encryption"
+	"github.com/blevesearch/bleve/v2/index/scorch/mergeplan"
+	index "github.com/blevesearch/bleve_index_api"
+	segment "github.com/blevesearch/scorch_segment_api/v2"
+	zapv15 "github.com/blevesearch/zapx/v15"
+)
+
+// boltMetaDataEncryptionKey marks the snapshots whose internal values and
+// sort ranges are encrypted.
+var boltMetaDataEncryptionKey = []byte("encryption")
+
+const encryptionAlgorithm = "aes-gcm"
+
+func parseEncryptionConfig(config map[string]interface{}) (
+	*encryption.Cipher, error) {
+	name, ok := config["encryptionKeyProvider"].(string)
+	if !ok || name == "" {
+		return nil, nil
+	}
+	kp := encryption.KeyProviderByName(name)
+	if kp == nil {
+		return nil, fmt.Errorf("no encryption key provider %q registered", name)
+	}
+	return encryption.NewCipher(kp), nil
+}
+
+func encryptValue(c *encryption.Cipher, v []byte) ([]byte, error) {
+	if c == nil {
+		return v, nil
+	}
+	return c.Encrypt(v)
+}
+
+// decryptValue decrypts v when it is encrypted, values written before
+// encryption was enabled being read as they are.
+func decryptValue(c *encryption.Cipher, v []byte) ([]byte, error) {
+	if !encryption.IsEncrypted(v) {
+		return v, nil
+	}
+	if c == nil {
+		return nil, fmt.Errorf("%w: no encryptionKeyProvider configured",
+			encryption.ErrDecrypt)
+	}
+	return c.Decrypt(v)
+}
+
+// encryptedSegmentPlugin wraps the zap plugin to encrypt the segment
+// files it writes.  Encrypted segments are decrypted into memory when
+// opened, rather than mapped, so they take as much memory as their size
+// on disk.  Segment files written before encryption was enabled are
+// opened as they are, and rewritten encrypted when merged.
+type encryptedSegmentPlugin struct {
+	zap    *zapv15.ZapPlugin
+	cipher *encryption.Cipher
+}
+
+func newEncryptedSegmentPlugin(plugin SegmentPlugin,
+	c *encryption.Cipher) (SegmentPlugin, error) {
+	if p, ok := plugin.(*encryptedSegmentPlugin); ok {
+		plugin = p.zap
+	}
+	zap, ok := plugin.(*zapv15.ZapPlugin)
+	if !ok {
+		return nil, fmt.Errorf("encryption unsupported for segment type %s"+
+			" version %d", plugin.Type(), plugin.Version())
+	}
+	return &encryptedSegmentPlugin{zap: zap, cipher: c}, nil
+}
+
+func (p *encryptedSegmentPlugin) Type() string {
+	return p.zap.Type()
+}
+
+func (p *encryptedSegmentPlugin) Version() uint32 {
+	return p.zap.Version()
+}
+
+func (p *encryptedSegmentPlugin) New(results []index.Document) (
+	segment.Segment, uint64, error) {
+	seg, size, err := p.zap.New(results)
+	if err != nil {
+		return nil, 0, err
+	}
+	return &encryptedMemSegment{
+		SegmentBase: seg.(*zapv15.SegmentBase),
+		plugin:      p,
+	}, size, nil
+}
+
+func (p *encryptedSegmentPlugin) Open(path string) (segment.Segment, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if !encryption.IsEncrypted(data) {
+		return p.zap.Open(path)
+	}
+	keyID, err := encryption.KeyID(data)
+	if err != nil {
+		return nil, err
+	}
+	data, err = p.cipher.Decrypt(data)
+	if err != nil {
+		return nil, fmt.Errorf("segment %s: %w", path, err)
+	}
+	sb, err := loadSegmentBase(data)
+	if err != nil {
+		return nil, fmt.Errorf("segment %s: %v", path, err)
+	}
+	return &encryptedFileSegment{
+		SegmentBase: sb,
+		path:        path,
+		keyID:       keyID,
+	}, nil
+}
+
+func (p *encryptedSegmentPlugin) Merge(segments []segment.Segment,
+	drops []*roaring.Bitmap, path string, closeCh chan struct{},
+	s segment.StatsReporter) ([][]uint64, uint64, error) {
+	sbs := make([]*zapv15.SegmentBase, len(segments))
+	for i, seg := range segments {
+		switch seg := seg.(type) {
+		case *encryptedMemSegment:
+			sbs[i] = seg.SegmentBase
+		case *encryptedFileSegment:
+			sbs[i] = seg.SegmentBase
+		case *zapv15.Segment:
+			sbs[i] = &seg.SegmentBase
+		case *zapv15.SegmentBase:
+			sbs[i] = seg
+		default:
+			return nil, 0, fmt.Errorf("unexpected segment type: %T", seg)
+		}
+	}
+	return p.write(sbs, drops, path, closeCh, s)
+}
+
+// write merges the segments in memory, as a zap segment encrypted with
+// the current key at path.
+func (p *encryptedSegmentPlugin) write(sbs []*zapv15.SegmentBase,
+	drops []*roaring.Bitmap, path string, closeCh chan struct{},
+	s segment.StatsReporter) ([][]uint64, uint64, error) {
+	var buf bytes.Buffer
+	cr := zapv15.NewCountHashWriterWithStatsReporter(&buf, s)
+	newDocNums, numDocs, storedIndexOffset, fieldsIndexOffset, docValueOffset,
+		_, _, _, err := zapv15.MergeToWriter(sbs, drops,
+		zapv15.DefaultChunkMode, cr, closeCh)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// the footer, as written by zap
+	for _, v := range []interface{}{numDocs, storedIndexOffset,
+		fieldsIndexOffset, docValueOffset, zapv15.DefaultChunkMode,
+		zapv15.Version} {
+		err = binary.Write(cr, binary.BigEndian, v)
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+	err = binary.Write(&buf, binary.BigEndian, cr.Sum32())
+	if err != nil {
+		return nil, 0, err
+	}
+
+	data, err := p.cipher.Encrypt(buf.Bytes())
+	if err != nil {
+		return nil, 0, err
+	}
+	err = writeFileSync(path, data)
+	if err != nil {
+		return nil, 0, err
+	}
+	return newDocNums, uint64(len(data)), nil
+}
+
+func writeFileSync(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if err != nil {
+		_ = f.Close()
+		_ = os.Remove(path)
+		return err
+	}
+	return f.Close()
+}
+
+// loadSegmentBase loads a zap segment from its decrypted file content.
+func loadSegmentBase(data []byte) (*zapv15.SegmentBase, error) {
+	if len(data) < zapv15.FooterSize {
+		return nil, fmt.Errorf("segment too short: %d bytes", len(data))
+	}
+	footer := data[len(data)-zapv15.FooterSize:]
+	numDocs := binary.BigEndian.Uint64(footer[0:8])
+	storedIndexOffset := binary.BigEndian.Uint64(footer[8:16])
+	fieldsIndexOffset := binary.BigEndian.Uint64(footer[16:24])
+	docValueOffset := binary.BigEndian.Uint64(footer[24:32])
+	chunkMode := binary.BigEndian.Uint32(footer[32:36])
+	version := binary.BigEndian.Uint32(footer[36:40])
+	if version != zapv15.Version {
+		return nil, fmt.Errorf("unsupported version %d != %d",
+			version, zapv15.Version)
+	}
+
+	// the fields index immediately precedes the footer
+	mem := data[:len(data)-zapv15.FooterSize]
+	end := uint64(len(mem))
+	var dictLocs []uint64
+	var fieldsInv []string
+	fieldsMap := map[string]uint16{}
+	for offset := fieldsIndexOffset; offset+8 <= end; offset += 8 {
+		addr := binary.BigEndian.Uint64(mem[offset : offset+8])
+		if addr >= end {
+			return nil, fmt.Errorf("invalid field address %d", addr)
+		}
+		dictLoc, n := binary.Uvarint(mem[addr:end])
+		if n <= 0 {
+			return nil, fmt.Errorf("invalid field at %d", addr)
+		}
+		nameLen, m := binary.Uvarint(mem[addr+uint64(n) : end])
+		start := addr + uint64(n) + uint64(m)
+		if m <= 0 || start+nameLen > end {
+			return nil, fmt.Errorf("invalid field at %d", addr)
+		}
+		name := string(mem[start : start+nameLen])
+		dictLocs = append(dictLocs, dictLoc)
+		fieldsInv = append(fieldsInv, name)
+		fieldsMap[name] = uint16(len(fieldsInv))
+	}
+
+	return zapv15.InitSegmentBase(mem, crc32.ChecksumIEEE(mem), chunkMode,
+		fieldsMap, fieldsInv, numDocs, storedIndexOffset, fieldsIndexOffset,
+		docValueOffset, dictLocs)
+}
+
+// encryptedMemSegment is a new, in-memory segment of an encrypted index.
+type encryptedMemSegment struct {
+	*zapv15.SegmentBase
+	plugin *encryptedSegmentPlugin
+}
+
+// Persist writes the segment encrypted, never in plain.
+func (s *encryptedMemSegment) Persist(path string) error {
+	_, _, err := s.plugin.write([]*zapv15.SegmentBase{s.SegmentBase},
+		[]*roaring.Bitmap{nil}, path, nil, nil)
+	return err
+}
+
+// encryptedFileSegment is a segment of an encrypted index, decrypted from
+// its file.
+type encryptedFileSegment struct {
+	*zapv15.SegmentBase
+	path  string
+	keyID string
+}
+
+func (s *encryptedFileSegment) Path() string {
+	return s.path
+}
+
+// Persist copies the segment file, as it is encrypted.
+func (s *encryptedFileSegment) Persist(path string) error {
+	data, err := ioutil.ReadFile(s.path)
+	if err != nil {
+		return err
+	}
+	return writeFileSync(path, data)
+}
+
+// planKeyRotation adds a task to the merge plan for each persisted segment
+// not encrypted with the current key, rewriting it with that key, so key
+// rotation completes as the index is merged.  ForceMerge rewrites every
+// segment at once.
+func (s *Scorch) planKeyRotation(segments []mergeplan.Segment,
+	plan *mergeplan.MergePlan) *mergeplan.MergePlan {
+	if s.cipher == nil {
+		return plan
+	}
+	currentKeyID, err := s.cipher.CurrentKeyID()
+	if err != nil {
+		s.fireAsyncError(fmt.Errorf("encryption key rotation: %v", err))
+		return plan
+	}
+
+	planned := map[uint64]struct{}{}
+	if plan != nil {
+		for _, task := range plan.Tasks {
+			for _, seg := range task.Segments {
+				planned[seg.Id()] = struct{}{}
+			}
+		}
+	}
+	for _, seg := range segments {
+		if _, ok := planned[seg.Id()]; ok {
+			continue
+		}
+		segSnapshot, ok := seg.(*SegmentSnapshot)
+		if !ok {
+			continue
+		}
+		if encSeg, ok := segSnapshot.segment.(*encryptedFileSegment); ok &&
+			encSeg.keyID == currentKeyID {
+			continue
+		}
+		if plan == nil {
+			plan = &mergeplan.MergePlan{}
+		}
+		plan.Tasks = append(plan.Tasks, &mergeplan.MergeTask{
+			Segments: []mergeplan.Segment{seg},
+		})
+		atomic.AddUint64(&s.stats.TotFileMergeSegmentsRekeyed, 1)
+	}
+	return plan
+}
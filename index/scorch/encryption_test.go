@@ -0,0 +1,231 @@
+//  Copyright (c) 2024 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scorch
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/blevesearch/bleve/v2/document"
+	"github.com/blevesearch/bleve/v2/index/encryption"
+	index "github.com/blevesearch/bleve_index_api"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestIndexEncryption(t *testing.T) {
+	cfg := CreateConfig("TestIndexEncryption")
+	err := InitTest(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := DestroyTest(cfg)
+		if err != nil {
+			t.Log(err)
+		}
+	}()
+
+	keyring := encryption.NewKeyring()
+	err = keyring.AddKey("k1", bytes.Repeat([]byte{1}, 32), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encryption.RegisterKeyProvider("TestIndexEncryption", keyring)
+	cfg["encryptionKeyProvider"] = "TestIndexEncryption"
+	cfg["changeStream"] = true
+	// keep the segments apart, so that the deleted bitmap is persisted
+	defer func(min int) {
+		DefaultMinSegmentsForInMemoryMerge = min
+	}(DefaultMinSegmentsForInMemoryMerge)
+	DefaultMinSegmentsForInMemoryMerge = 100
+	cfg["scorchMergePlanOptions"] = map[string]interface{}{
+		"maxSegmentsPerTier": 100,
+		"floorSegmentSize":   1,
+	}
+
+	analysisQueue := index.NewAnalysisQueue(1)
+	open := func(cfg map[string]interface{}) (*Scorch, error) {
+		idx, err := NewScorch(Name, cfg, analysisQueue)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return idx.(*Scorch), idx.Open()
+	}
+	check := func(idx *Scorch) {
+		reader, err := idx.Reader()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() {
+			err := reader.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+		}()
+		count, err := reader.DocCount()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if count != 2 {
+			t.Errorf("expected 2 documents, got %d", count)
+		}
+		tfr, err := reader.TermFieldReader([]byte("confidential"), "name",
+			true, true, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tfr.Count() != 2 {
+			t.Errorf("expected 2 documents with the term confidential, got %d",
+				tfr.Count())
+		}
+		err = tfr.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		val, err := reader.GetInternal([]byte("k"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(val) != "classified" {
+			t.Errorf("expected internal value classified, got %q", val)
+		}
+		changes, err := idx.Changes(0, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(changes) != 2 {
+			t.Errorf("expected 2 change records, got %d", len(changes))
+		}
+	}
+
+	idx, err := open(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a is indexed again, leaving a deleted bitmap
+	for _, ids := range [][]string{{"a", "b"}, {"a"}} {
+		batch := index.NewBatch()
+		for _, id := range ids {
+			doc := document.NewDocument(id)
+			doc.AddField(document.NewTextFieldWithAnalyzer("name", []uint64{},
+				[]byte("confidential"), testAnalyzer))
+			batch.Update(doc)
+		}
+		batch.SetInternal([]byte("k"), []byte("classified"))
+		err = idx.Batch(batch)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	check(idx)
+	err = idx.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// neither the segments nor the root bolt hold the data in plain
+	finfos, err := ioutil.ReadDir(cfg["path"].(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, finfo := range finfos {
+		buf, err := ioutil.ReadFile(filepath.Join(cfg["path"].(string), finfo.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, plain := range []string{"confidential", "classified"} {
+			if bytes.Contains(buf, []byte(plain)) {
+				t.Errorf("expected %s encrypted, found %s in plain", finfo.Name(), plain)
+			}
+		}
+	}
+
+	// the deleted bitmaps are encrypted too
+	rootBolt, err := openRootBolt(cfg["path"].(string), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var deleted int
+	err = rootBolt.View(func(tx *bolt.Tx) error {
+		snapshots := tx.Bucket(boltSnapshotsBucket)
+		k, _ := snapshots.Cursor().Last()
+		snapshot := snapshots.Bucket(k)
+		c := snapshot.Cursor()
+		for k, _ := c.First(); k != nil; k, _ = c.Next() {
+			segmentBucket := snapshot.Bucket(k)
+			if segmentBucket == nil {
+				continue
+			}
+			if v := segmentBucket.Get(boltDeletedKey); v != nil {
+				deleted++
+				if !encryption.IsEncrypted(v) {
+					t.Errorf("expected deleted bitmap encrypted, got % x", v)
+				}
+			}
+		}
+		return nil
+	})
+	if cerr := rootBolt.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deleted == 0 {
+		t.Errorf("expected a deleted bitmap")
+	}
+
+	// the index cannot be opened without its keys
+	delete(cfg, "encryptionKeyProvider")
+	_, err = open(cfg)
+	if !errors.Is(err, encryption.ErrDecrypt) {
+		t.Fatalf("expected ErrDecrypt opening without keys, got %v", err)
+	}
+
+	cfg["encryptionKeyProvider"] = "TestIndexEncryption"
+	idx, err = open(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(idx)
+
+	// once the key is rotated, merges rewrite the segments with it
+	err = keyring.AddKey("k2", bytes.Repeat([]byte{2}, 32), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = idx.ForceMerge(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx.rootLock.RLock()
+	for _, segSnapshot := range idx.root.segment {
+		seg, ok := segSnapshot.segment.(*encryptedFileSegment)
+		if !ok || seg.keyID != "k2" {
+			t.Errorf("expected segment %d encrypted with k2, got %T %+v",
+				segSnapshot.id, segSnapshot.segment, seg)
+		}
+	}
+	idx.rootLock.RUnlock()
+	check(idx)
+	err = idx.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,221 @@
+//  Copyright (c) 2021 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scorch
+
+import (
+	"container/list"
+	"sync"
+	"sync/atomic"
+
+	"github.com/RoaringBitmap/roaring"
+	"github.com/blevesearch/bleve/v2/search"
+	index "github.com/blevesearch/bleve_index_api"
+)
+
+// DefaultFilterCacheBytes is the default memory budget of the filter
+// cache, which can be configured with the "filterCacheBytes" option.
+// A budget of 0 disables the cache.
+var DefaultFilterCacheBytes = 32 * 1024 * 1024
+
+// filterCache caches the doc numbers matched by non-scoring clauses,
+// such as term filters and ranges, for each immutable segment.  The
+// least recently used bitmaps are evicted beyond the memory budget,
+// and the bitmaps of a segment are dropped once it is merged away.
+type filterCache struct {
+	budget uint64
+	stats  *Stats
+
+	m       sync.Mutex // Protects the fields that follow.
+	size    uint64
+	lru     *list.List // of *filterCacheEntry, most recently used first
+	entries map[filterCacheKey]*list.Element
+}
+
+type filterCacheKey struct {
+	segmentID uint64
+	filter    string
+}
+
+type filterCacheEntry struct {
+	key  filterCacheKey
+	docs *roaring.Bitmap
+	// the number of deleted docs of the segment when the docs were
+	// matched, as deletions grow the snapshots which have at least as
+	// many deletions can use the docs, once the deleted docs removed
+	deleted uint64
+	size    uint64
+}
+
+func newFilterCache(config map[string]interface{}, stats *Stats) *filterCache {
+	budget := DefaultFilterCacheBytes
+	if v, err := parseToInteger(config["filterCacheBytes"]); err == nil {
+		budget = v
+	}
+	if budget <= 0 {
+		return nil
+	}
+	return &filterCache{
+		budget:  uint64(budget),
+		stats:   stats,
+		lru:     list.New(),
+		entries: make(map[filterCacheKey]*list.Element),
+	}
+}
+
+func (fc *filterCache) get(segmentID uint64, filter string,
+	deleted uint64) *roaring.Bitmap {
+	fc.m.Lock()
+	defer fc.m.Unlock()
+	if e, ok := fc.entries[filterCacheKey{segmentID, filter}]; ok {
+		entry := e.Value.(*filterCacheEntry)
+		if entry.deleted <= deleted {
+			fc.lru.MoveToFront(e)
+			atomic.AddUint64(&fc.stats.TotFilterCacheHits, 1)
+			return entry.docs
+		}
+	}
+	atomic.AddUint64(&fc.stats.TotFilterCacheMisses, 1)
+	return nil
+}
+
+func (fc *filterCache) put(segmentID uint64, filter string,
+	docs *roaring.Bitmap, deleted uint64) {
+	key := filterCacheKey{segmentID, filter}
+	entry := &filterCacheEntry{
+		key:     key,
+		docs:    docs,
+		deleted: deleted,
+		size:    docs.GetSizeInBytes() + uint64(len(filter)),
+	}
+	if entry.size > fc.budget {
+		return
+	}
+
+	fc.m.Lock()
+	defer fc.m.Unlock()
+	if e, ok := fc.entries[key]; ok {
+		fc.remove(e)
+	}
+	fc.entries[key] = fc.lru.PushFront(entry)
+	fc.size += entry.size
+	for fc.size > fc.budget {
+		fc.remove(fc.lru.Back())
+		atomic.AddUint64(&fc.stats.TotFilterCacheEvictions, 1)
+	}
+	atomic.StoreUint64(&fc.stats.CurFilterCacheBytes, fc.size)
+}
+
+// invalidate drops the bitmaps of the segments.
+func (fc *filterCache) invalidate(segmentIDs map[uint64]struct{}) {
+	fc.m.Lock()
+	defer fc.m.Unlock()
+	for key, e := range fc.entries {
+		if _, ok := segmentIDs[key.segmentID]; ok {
+			fc.remove(e)
+		}
+	}
+	atomic.StoreUint64(&fc.stats.CurFilterCacheBytes, fc.size)
+}
+
+func (fc *filterCache) remove(e *list.Element) {
+	entry := fc.lru.Remove(e).(*filterCacheEntry)
+	delete(fc.entries, entry.key)
+	fc.size -= entry.size
+}
+
+func (i *IndexSnapshot) FilterCacheEnabled() bool {
+	return i.parent != nil && i.parent.filterCache != nil
+}
+
+// FilterDocIDReader returns a reader of the documents matching the
+// clause identified by the key, and their number.  The doc numbers of
+// the segments which are not cached yet are matched by the searcher
+// built by newSearcher, then cached.
+func (i *IndexSnapshot) FilterDocIDReader(key string,
+	newSearcher func() (search.Searcher, error)) (
+	rv index.DocIDReader, count uint64, err error) {
+	fc := i.parent.filterCache
+	var s search.Searcher
+	var ctx *search.SearchContext
+	var next *search.DocumentMatch
+	defer func() {
+		if s != nil {
+			if cerr := s.Close(); err == nil && cerr != nil {
+				err = cerr
+			}
+		}
+	}()
+
+	reader := &IndexSnapshotDocIDReader{
+		snapshot:  i,
+		iterators: make([]roaring.IntIterable, len(i.segment)),
+	}
+	for x, ss := range i.segment {
+		var deleted uint64
+		if ss.deleted != nil {
+			deleted = ss.deleted.GetCardinality()
+		}
+
+		docs := fc.get(ss.id, key, deleted)
+		if docs == nil {
+			start := docNumberToBytes(nil, i.offsets[x])
+			if s == nil {
+				s, err = newSearcher()
+				if err != nil {
+					return nil, 0, err
+				}
+				ctx = &search.SearchContext{
+					DocumentMatchPool: search.NewDocumentMatchPool(s.DocumentMatchPoolSize()+1, 0),
+					IndexReader:       i,
+				}
+				next, err = s.Advance(ctx, start)
+			} else if next != nil && next.IndexInternalID.Compare(start) < 0 {
+				ctx.DocumentMatchPool.Put(next)
+				next, err = s.Advance(ctx, start)
+			}
+			if err != nil {
+				return nil, 0, err
+			}
+
+			docs = roaring.NewBitmap()
+			end := i.offsets[x] + ss.segment.Count()
+			for next != nil {
+				docNum, err := docInternalToNumber(next.IndexInternalID)
+				if err != nil {
+					return nil, 0, err
+				}
+				if docNum >= end {
+					break
+				}
+				docs.Add(uint32(docNum - i.offsets[x]))
+				ctx.DocumentMatchPool.Put(next)
+				next, err = s.Next(ctx)
+				if err != nil {
+					return nil, 0, err
+				}
+			}
+			docs.RunOptimize()
+			fc.put(ss.id, key, docs, deleted)
+		}
+
+		if ss.deleted != nil && !ss.deleted.IsEmpty() {
+			docs = roaring.AndNot(docs, ss.deleted)
+		}
+		count += docs.GetCardinality()
+		reader.iterators[x] = docs.Iterator()
+	}
+
+	return reader, count, nil
+}
@@ -0,0 +1,68 @@
+//  Copyright (c) 2021 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scorch
+
+import (
+	"testing"
+
+	"github.com/RoaringBitmap/roaring"
+)
+
+func TestFilterCacheEviction(t *testing.T) {
+	var stats Stats
+	docs := roaring.BitmapOf(1, 2, 3)
+	entrySize := docs.GetSizeInBytes() + uint64(len("f"))
+	fc := newFilterCache(map[string]interface{}{
+		"filterCacheBytes": float64(2 * entrySize),
+	}, &stats)
+
+	fc.put(1, "f", docs, 0)
+	fc.put(2, "f", docs, 0)
+	if fc.get(1, "f", 0) == nil {
+		t.Fatalf("expected segment 1 to be cached")
+	}
+
+	// segment 2 is the least recently used
+	fc.put(3, "f", docs, 0)
+	if fc.get(2, "f", 0) != nil {
+		t.Errorf("expected segment 2 to be evicted")
+	}
+	if fc.get(1, "f", 0) == nil || fc.get(3, "f", 0) == nil {
+		t.Errorf("expected segments 1 and 3 to be cached")
+	}
+	if stats.TotFilterCacheEvictions != 1 || stats.CurFilterCacheBytes != 2*entrySize {
+		t.Errorf("expected 1 eviction and %d bytes, got %d and %d", 2*entrySize,
+			stats.TotFilterCacheEvictions, stats.CurFilterCacheBytes)
+	}
+
+	// docs matched with more deletions cannot serve older snapshots
+	fc.put(4, "f", docs, 5)
+	if fc.get(4, "f", 4) != nil || fc.get(4, "f", 6) == nil {
+		t.Errorf("expected the docs only for snapshots with more deletions")
+	}
+
+	fc.invalidate(map[uint64]struct{}{1: {}, 4: {}})
+	if fc.get(1, "f", 0) != nil || fc.get(4, "f", 6) != nil {
+		t.Errorf("expected merged segments to be invalidated")
+	}
+	if len(fc.entries) != 1 || fc.size != entrySize {
+		t.Errorf("expected 1 entry of %d bytes, got %d of %d", entrySize,
+			len(fc.entries), fc.size)
+	}
+
+	if newFilterCache(map[string]interface{}{"filterCacheBytes": 0}, &stats) != nil {
+		t.Errorf("expected a budget of 0 to disable the cache")
+	}
+}
@@ -26,9 +26,12 @@ import (
 type segmentIntroduction struct {
 	id        uint64
 	data      segment.Segment
+	sortRange *segmentSortRange
 	obsoletes map[uint64]*roaring.Bitmap
 	ids       []string
 	internal  map[string][]byte
+	changes   []*ChangeRecord
+	walSeq    uint64
 
 	applied           chan error
 	persisted         chan error
@@ -137,6 +140,7 @@ func (s *Scorch) introduceSegment(next *segmentIntroduction) error {
 			segment:    root.segment[i].segment,
 			cachedDocs: root.segment[i].cachedDocs,
 			creator:    root.segment[i].creator,
+			sortRange:  root.segment[i].sortRange,
 		}
 
 		// apply new obsoletions
@@ -176,6 +180,7 @@ func (s *Scorch) introduceSegment(next *segmentIntroduction) error {
 			segment:    next.data, // take ownership of next.data's ref-count
 			cachedDocs: &cachedDocs{cache: nil},
 			creator:    "introduceSegment",
+			sortRange:  next.sortRange,
 		}
 		newSnapshot.segment = append(newSnapshot.segment, newSegmentSnapshot)
 		newSnapshot.offsets = append(newSnapshot.offsets, running)
@@ -209,6 +214,18 @@ func (s *Scorch) introduceSegment(next *segmentIntroduction) error {
 	// swap in new index snapshot
 	newSnapshot.epoch = s.nextSnapshotEpoch
 	s.nextSnapshotEpoch++
+	for _, changes := range next.changes {
+		changes.Seq = s.nextChangeSeq
+		changes.Epoch = newSnapshot.epoch
+		s.nextChangeSeq++
+		s.pendingChanges = append(s.pendingChanges, changes)
+	}
+	if next.walSeq > 0 {
+		s.walMarks = append(s.walMarks, walMark{
+			epoch: newSnapshot.epoch,
+			seq:   next.walSeq,
+		})
+	}
 	rootPrev := s.root
 	s.root = newSnapshot
 	atomic.StoreUint64(&s.stats.CurRootEpoch, s.root.epoch)
@@ -257,6 +274,7 @@ func (s *Scorch) introducePersist(persist *persistIntroduction) {
 				deleted:    segmentSnapshot.deleted,
 				cachedDocs: segmentSnapshot.cachedDocs,
 				creator:    "introducePersist",
+				sortRange:  segmentSnapshot.sortRange,
 			}
 			newIndexSnapshot.segment[i] = newSegmentSnapshot
 			delete(persist.persisted, segmentSnapshot.id)
@@ -320,6 +338,11 @@ func (s *Scorch) introduceMerge(nextMerge *segmentMerge) {
 		creator:  "introduceMerge",
 	}
 
+	mergedSegmentIDs := make(map[uint64]struct{}, len(nextMerge.old))
+	for segmentID := range nextMerge.old {
+		mergedSegmentIDs[segmentID] = struct{}{}
+	}
+
 	// iterate through current segments
 	newSegmentDeleted := roaring.NewBitmap()
 	var running, docsToPersistCount, memSegments, fileSegments uint64
@@ -354,6 +377,7 @@ func (s *Scorch) introduceMerge(nextMerge *segmentMerge) {
 				deleted:    root.segment[i].deleted,
 				cachedDocs: root.segment[i].cachedDocs,
 				creator:    root.segment[i].creator,
+				sortRange:  root.segment[i].sortRange,
 			})
 			root.segment[i].segment.AddRef()
 			newSnapshot.offsets = append(newSnapshot.offsets, running)
@@ -395,6 +419,7 @@ func (s *Scorch) introduceMerge(nextMerge *segmentMerge) {
 			deleted:    newSegmentDeleted,
 			cachedDocs: &cachedDocs{cache: nil},
 			creator:    "introduceMerge",
+			sortRange:  nextMerge.sortRange,
 		})
 		newSnapshot.offsets = append(newSnapshot.offsets, running)
 		atomic.AddUint64(&s.stats.TotIntroducedSegmentsMerge, 1)
@@ -432,6 +457,11 @@ func (s *Scorch) introduceMerge(nextMerge *segmentMerge) {
 		_ = rootPrev.DecRef()
 	}
 
+	// the filters cached for the merged segments are no longer used
+	if s.filterCache != nil {
+		s.filterCache.invalidate(mergedSegmentIDs)
+	}
+
 	// notify requester that we incorporated this
 	nextMerge.notifyCh <- &mergeTaskIntroStatus{
 		indexSnapshot: newSnapshot,
@@ -257,6 +257,7 @@ func (s *Scorch) planMergeAtSnapshot(ctx context.Context,
 		atomic.AddUint64(&s.stats.TotFileMergePlanErr, 1)
 		return fmt.Errorf("merge planning err: %v", err)
 	}
+	resultMergePlan = s.planKeyRotation(onlyPersistedSnapshots, resultMergePlan)
 	if resultMergePlan == nil {
 		// nothing to do
 		atomic.AddUint64(&s.stats.TotFileMergePlanNone, 1)
@@ -284,8 +285,7 @@ func (s *Scorch) planMergeAtSnapshot(ctx context.Context,
 
 		oldMap := make(map[uint64]*SegmentSnapshot)
 		newSegmentID := atomic.AddUint64(&s.nextSegmentID, 1)
-		segmentsToMerge := make([]segment.Segment, 0, len(task.Segments))
-		docsToDrop := make([]*roaring.Bitmap, 0, len(task.Segments))
+		snapshotsToMerge := make([]*SegmentSnapshot, 0, len(task.Segments))
 
 		for _, planSegment := range task.Segments {
 			if segSnapshot, ok := planSegment.(*SegmentSnapshot); ok {
@@ -295,8 +295,7 @@ func (s *Scorch) planMergeAtSnapshot(ctx context.Context,
 						atomic.AddUint64(&s.stats.TotFileMergeSegmentsEmpty, 1)
 						oldMap[segSnapshot.id] = nil
 					} else {
-						segmentsToMerge = append(segmentsToMerge, segSnapshot.segment)
-						docsToDrop = append(docsToDrop, segSnapshot.deleted)
+						snapshotsToMerge = append(snapshotsToMerge, segSnapshot)
 					}
 					// track the files getting merged for unsetting the
 					// removal ineligibility. This helps to unflip files
@@ -308,6 +307,18 @@ func (s *Scorch) planMergeAtSnapshot(ctx context.Context,
 			}
 		}
 
+		// merge the segments in the order keeping the index sort, if any
+		order, sortRange := s.indexSort.mergeOrder(snapshotsToMerge)
+		if s.indexSort != nil && sortRange == nil && len(order) > 0 {
+			atomic.AddUint64(&s.stats.TotFileMergeSegmentsUnsorted, 1)
+		}
+		segmentsToMerge := make([]segment.Segment, 0, len(order))
+		docsToDrop := make([]*roaring.Bitmap, 0, len(order))
+		for _, x := range order {
+			segmentsToMerge = append(segmentsToMerge, snapshotsToMerge[x].segment)
+			docsToDrop = append(docsToDrop, snapshotsToMerge[x].deleted)
+		}
+
 		var oldNewDocNums map[uint64][]uint64
 		var seg segment.Segment
 		var filename string
@@ -346,7 +357,7 @@ func (s *Scorch) planMergeAtSnapshot(ctx context.Context,
 			}
 			oldNewDocNums = make(map[uint64][]uint64)
 			for i, segNewDocNums := range newDocNums {
-				oldNewDocNums[task.Segments[i].Id()] = segNewDocNums
+				oldNewDocNums[snapshotsToMerge[order[i]].id] = segNewDocNums
 			}
 
 			atomic.AddUint64(&s.stats.TotFileMergeSegments, uint64(len(segmentsToMerge)))
@@ -357,6 +368,7 @@ func (s *Scorch) planMergeAtSnapshot(ctx context.Context,
 			old:           oldMap,
 			oldNewDocNums: oldNewDocNums,
 			new:           seg,
+			sortRange:     sortRange,
 			notifyCh:      make(chan *mergeTaskIntroStatus),
 		}
 
@@ -415,6 +427,7 @@ type segmentMerge struct {
 	old           map[uint64]*SegmentSnapshot
 	oldNewDocNums map[uint64][]uint64
 	new           segment.Segment
+	sortRange     *segmentSortRange
 	notifyCh      chan *mergeTaskIntroStatus
 }
 
@@ -434,8 +447,24 @@ func (s *Scorch) mergeSegmentBases(snapshot *IndexSnapshot,
 	filename := zapFileName(newSegmentID)
 	path := s.path + string(os.PathSeparator) + filename
 
+	// merge the segments in the order keeping the index sort, if any
+	snapshotsToMerge := make([]*SegmentSnapshot, len(sbsIndexes))
+	for i, idx := range sbsIndexes {
+		snapshotsToMerge[i] = snapshot.segment[idx]
+	}
+	order, sortRange := s.indexSort.mergeOrder(snapshotsToMerge)
+	if s.indexSort != nil && sortRange == nil {
+		atomic.AddUint64(&s.stats.TotMemMergeUnsorted, 1)
+	}
+	orderedSbs := make([]segment.Segment, len(order))
+	orderedSbsDrops := make([]*roaring.Bitmap, len(order))
+	for i, x := range order {
+		orderedSbs[i] = sbs[x]
+		orderedSbsDrops[i] = sbsDrops[x]
+	}
+
 	newDocNums, _, err :=
-		s.segPlugin.Merge(sbs, sbsDrops, path, s.closeCh, s)
+		s.segPlugin.Merge(orderedSbs, orderedSbsDrops, path, s.closeCh, s)
 
 	atomic.AddUint64(&s.stats.TotMemMergeZapEnd, 1)
 
@@ -465,11 +494,12 @@ func (s *Scorch) mergeSegmentBases(snapshot *IndexSnapshot,
 		old:           make(map[uint64]*SegmentSnapshot),
 		oldNewDocNums: make(map[uint64][]uint64),
 		new:           seg,
+		sortRange:     sortRange,
 		notifyCh:      make(chan *mergeTaskIntroStatus),
 	}
 
-	for i, idx := range sbsIndexes {
-		ss := snapshot.segment[idx]
+	for i, x := range order {
+		ss := snapshotsToMerge[x]
 		sm.old[ss.id] = ss
 		sm.oldNewDocNums[ss.id] = newDocNums[i]
 	}
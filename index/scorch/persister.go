@@ -18,6 +18,7 @@ import (
 	"bytes"
 	"encoding/binary"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
@@ -30,6 +31,7 @@ import (
 	"time"
 
 	"github.com/RoaringBitmap/roaring"
+	"github.com/blevesearch/bleve/v2/index/encryption"
 	index "github.com/blevesearch/bleve_index_api"
 	segment "github.com/blevesearch/scorch_segment_api/v2"
 	bolt "go.etcd.io/bbolt"
@@ -411,9 +413,10 @@ func (s *Scorch) persistSnapshotMaybeMerge(snapshot *IndexSnapshot) (
 	for _, segment := range newSnapshot.segment {
 		if segment.id == newSegmentID {
 			equiv.segment = append(equiv.segment, &SegmentSnapshot{
-				id:      newSegmentID,
-				segment: segment.segment,
-				deleted: nil, // nil since merging handled deletions
+				id:        newSegmentID,
+				segment:   segment.segment,
+				deleted:   nil, // nil since merging handled deletions
+				sortRange: segment.sortRange,
 			})
 			break
 		}
@@ -428,7 +431,7 @@ func (s *Scorch) persistSnapshotMaybeMerge(snapshot *IndexSnapshot) (
 }
 
 func prepareBoltSnapshot(snapshot *IndexSnapshot, tx *bolt.Tx, path string,
-	segPlugin SegmentPlugin) ([]string, map[uint64]string, error) {
+	segPlugin SegmentPlugin, cipher *encryption.Cipher) ([]string, map[uint64]string, error) {
 	snapshotsBucket, err := tx.CreateBucketIfNotExists(boltSnapshotsBucket)
 	if err != nil {
 		return nil, nil, err
@@ -454,6 +457,12 @@ func prepareBoltSnapshot(snapshot *IndexSnapshot, tx *bolt.Tx, path string,
 	if err != nil {
 		return nil, nil, err
 	}
+	if cipher != nil {
+		err = metaBucket.Put(boltMetaDataEncryptionKey, []byte(encryptionAlgorithm))
+		if err != nil {
+			return nil, nil, err
+		}
+	}
 
 	// persist internal values
 	internalBucket, err := snapshotBucket.CreateBucketIfNotExists(boltInternalKey)
@@ -462,6 +471,10 @@ func prepareBoltSnapshot(snapshot *IndexSnapshot, tx *bolt.Tx, path string,
 	}
 	// TODO optimize writing these in order?
 	for k, v := range snapshot.internal {
+		v, err = encryptValue(cipher, v)
+		if err != nil {
+			return nil, nil, err
+		}
 		err = internalBucket.Put([]byte(k), v)
 		if err != nil {
 			return nil, nil, err
@@ -480,8 +493,9 @@ func prepareBoltSnapshot(snapshot *IndexSnapshot, tx *bolt.Tx, path string,
 		}
 		switch seg := segmentSnapshot.segment.(type) {
 		case segment.PersistedSegment:
-			segPath := seg.Path()
-			filename := strings.TrimPrefix(segPath, path+string(os.PathSeparator))
+			// segment files always live directly in the index directory,
+			// so the base name is valid wherever this snapshot is written
+			filename := filepath.Base(seg.Path())
 			err = snapshotSegmentBucket.Put(boltPathKey, []byte(filename))
 			if err != nil {
 				return nil, nil, err
@@ -504,6 +518,21 @@ func prepareBoltSnapshot(snapshot *IndexSnapshot, tx *bolt.Tx, path string,
 		default:
 			return nil, nil, fmt.Errorf("unknown segment type: %T", seg)
 		}
+		// store the sort range of sorted segments
+		if segmentSnapshot.sortRange != nil {
+			sortRangeBytes, err := json.Marshal(segmentSnapshot.sortRange)
+			if err != nil {
+				return nil, nil, err
+			}
+			sortRangeBytes, err = encryptValue(cipher, sortRangeBytes)
+			if err != nil {
+				return nil, nil, err
+			}
+			err = snapshotSegmentBucket.Put(boltSortRangeKey, sortRangeBytes)
+			if err != nil {
+				return nil, nil, err
+			}
+		}
 		// store current deleted bits
 		var roaringBuf bytes.Buffer
 		if segmentSnapshot.deleted != nil {
@@ -511,7 +540,11 @@ func prepareBoltSnapshot(snapshot *IndexSnapshot, tx *bolt.Tx, path string,
 			if err != nil {
 				return nil, nil, fmt.Errorf("error persisting roaring bytes: %v", err)
 			}
-			err = snapshotSegmentBucket.Put(boltDeletedKey, roaringBuf.Bytes())
+			deletedBytes, err := encryptValue(cipher, roaringBuf.Bytes())
+			if err != nil {
+				return nil, nil, err
+			}
+			err = snapshotSegmentBucket.Put(boltDeletedKey, deletedBytes)
 			if err != nil {
 				return nil, nil, err
 			}
@@ -534,11 +567,29 @@ func (s *Scorch) persistSnapshotDirect(snapshot *IndexSnapshot) (err error) {
 		}
 	}()
 
-	filenames, newSegmentPaths, err := prepareBoltSnapshot(snapshot, tx, s.path, s.segPlugin)
+	filenames, newSegmentPaths, err := prepareBoltSnapshot(snapshot, tx, s.path, s.segPlugin,
+		s.cipher)
 	if err != nil {
 		return err
 	}
 
+	// the change records of the batches included in this snapshot are
+	// made durable along with it
+	changes := s.pendingChangesUpTo(snapshot.epoch)
+	err = prepareBoltChanges(tx, changes, s.cipher)
+	if err != nil {
+		return err
+	}
+
+	// so do the write-ahead log records, which can then be dropped
+	walSeq := s.walSeqUpTo(snapshot.epoch)
+	if walSeq > 0 {
+		err = prepareBoltWALSeq(tx, snapshot.epoch, walSeq)
+		if err != nil {
+			return err
+		}
+	}
+
 	// we need to swap in a new root only when we've persisted 1 or
 	// more segments -- whereby the new root would have 1-for-1
 	// replacements of in-memory segments with file-based segments
@@ -593,6 +644,12 @@ func (s *Scorch) persistSnapshotDirect(snapshot *IndexSnapshot) (err error) {
 		return err
 	}
 
+	s.changesPersisted(len(changes))
+
+	if walSeq > 0 {
+		s.walPersisted(walSeq)
+	}
+
 	// allow files to become eligible for removal after commit, such
 	// as file segments from snapshots that came from the merger
 	s.rootLock.Lock()
@@ -613,6 +670,7 @@ func zapFileName(epoch uint64) string {
 var boltSnapshotsBucket = []byte{'s'}
 var boltPathKey = []byte{'p'}
 var boltDeletedKey = []byte{'d'}
+var boltSortRangeKey = []byte{'s'}
 var boltInternalKey = []byte{'i'}
 var boltMetaDataKey = []byte{'m'}
 var boltMetaDataSegmentTypeKey = []byte("type")
@@ -643,12 +701,18 @@ func (s *Scorch) loadFromBolt() error {
 				continue
 			}
 			indexSnapshot, err := s.loadSnapshot(snapshot)
+			if errors.Is(err, encryption.ErrDecrypt) {
+				// every snapshot fails alike without the encryption
+				// keys, never drop them all
+				return err
+			}
 			if err != nil {
 				log.Printf("unable to load snapshot, %v, continuing", err)
 				s.AddEligibleForRemoval(snapshotEpoch)
 				continue
 			}
 			indexSnapshot.epoch = snapshotEpoch
+			s.walPersistedSeq = loadBoltWALSeq(snapshot)
 			// set the nextSegmentID
 			s.nextSegmentID, err = s.maxSegmentIDOnDisk()
 			if err != nil {
@@ -718,6 +782,12 @@ func (s *Scorch) loadSnapshot(snapshot *bolt.Bucket) (*IndexSnapshot, error) {
 		return nil, fmt.Errorf(
 			"unable to load correct segment wrapper: %v", err)
 	}
+	encrypted := metaBucket.Get(boltMetaDataEncryptionKey) != nil
+	if encrypted && s.cipher == nil {
+		_ = rv.DecRef()
+		return nil, fmt.Errorf("%w: index encrypted, no encryptionKeyProvider"+
+			" configured", encryption.ErrDecrypt)
+	}
 	var running uint64
 	c := snapshot.Cursor()
 	for k, _ := c.First(); k != nil; k, _ = c.Next() {
@@ -725,6 +795,13 @@ func (s *Scorch) loadSnapshot(snapshot *bolt.Bucket) (*IndexSnapshot, error) {
 			internalBucket := snapshot.Bucket(k)
 			err := internalBucket.ForEach(func(key []byte, val []byte) error {
 				copiedVal := append([]byte(nil), val...)
+				if encrypted {
+					var err error
+					copiedVal, err = s.cipher.Decrypt(copiedVal)
+					if err != nil {
+						return fmt.Errorf("internal value %q: %w", key, err)
+					}
+				}
 				rv.internal[string(key)] = copiedVal
 				return nil
 			})
@@ -738,10 +815,10 @@ func (s *Scorch) loadSnapshot(snapshot *bolt.Bucket) (*IndexSnapshot, error) {
 				_ = rv.DecRef()
 				return nil, fmt.Errorf("segment key, but bucket missing % x", k)
 			}
-			segmentSnapshot, err := s.loadSegment(segmentBucket)
+			segmentSnapshot, err := s.loadSegment(segmentBucket, encrypted)
 			if err != nil {
 				_ = rv.DecRef()
-				return nil, fmt.Errorf("failed to load segment: %v", err)
+				return nil, fmt.Errorf("failed to load segment: %w", err)
 			}
 			_, segmentSnapshot.id, err = decodeUvarintAscending(k)
 			if err != nil {
@@ -756,7 +833,8 @@ func (s *Scorch) loadSnapshot(snapshot *bolt.Bucket) (*IndexSnapshot, error) {
 	return rv, nil
 }
 
-func (s *Scorch) loadSegment(segmentBucket *bolt.Bucket) (*SegmentSnapshot, error) {
+func (s *Scorch) loadSegment(segmentBucket *bolt.Bucket,
+	encrypted bool) (*SegmentSnapshot, error) {
 	pathBytes := segmentBucket.Get(boltPathKey)
 	if pathBytes == nil {
 		return nil, fmt.Errorf("segment path missing")
@@ -764,15 +842,38 @@ func (s *Scorch) loadSegment(segmentBucket *bolt.Bucket) (*SegmentSnapshot, erro
 	segmentPath := s.path + string(os.PathSeparator) + string(pathBytes)
 	segment, err := s.segPlugin.Open(segmentPath)
 	if err != nil {
-		return nil, fmt.Errorf("error opening bolt segment: %v", err)
+		return nil, fmt.Errorf("error opening bolt segment: %w", err)
 	}
 
 	rv := &SegmentSnapshot{
 		segment:    segment,
 		cachedDocs: &cachedDocs{cache: nil},
 	}
+	sortRangeBytes := segmentBucket.Get(boltSortRangeKey)
+	if sortRangeBytes != nil {
+		if encrypted {
+			sortRangeBytes, err = s.cipher.Decrypt(sortRangeBytes)
+			if err != nil {
+				_ = segment.Close()
+				return nil, fmt.Errorf("error reading sort range: %w", err)
+			}
+		}
+		rv.sortRange = &segmentSortRange{}
+		err = json.Unmarshal(sortRangeBytes, rv.sortRange)
+		if err != nil {
+			_ = segment.Close()
+			return nil, fmt.Errorf("error reading sort range: %v", err)
+		}
+	}
 	deletedBytes := segmentBucket.Get(boltDeletedKey)
 	if deletedBytes != nil {
+		if encrypted {
+			deletedBytes, err = s.cipher.Decrypt(deletedBytes)
+			if err != nil {
+				_ = segment.Close()
+				return nil, fmt.Errorf("error reading deleted bytes: %w", err)
+			}
+		}
 		deletedBitmap := roaring.NewBitmap()
 		r := bytes.NewReader(deletedBytes)
 		_, err := deletedBitmap.ReadFrom(r)
@@ -819,8 +920,16 @@ func (s *Scorch) removeOldBoltSnapshots() (numRemoved int, err error) {
 		return 0, nil
 	}
 
-	// make a map of epochs to protect from deletion
-	protectedEpochs := make(map[uint64]struct{}, s.numSnapshotsToKeep)
+	// make a map of epochs to protect from deletion, the tagged ones
+	// included
+	var protectedEpochs map[uint64]struct{}
+	err = s.rootBolt.View(func(tx *bolt.Tx) error {
+		protectedEpochs, err = taggedEpochs(tx)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
 	for _, epoch := range persistedEpochs[0:s.numSnapshotsToKeep] {
 		protectedEpochs[epoch] = struct{}{}
 	}
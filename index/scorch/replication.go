@@ -0,0 +1,169 @@
+//  Copyright (c) 2024 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scorch
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// ReplicationSource is a leader index tailed by followers.  A Scorch
+// index is a ReplicationSource, remote ones can be reached through any
+// transport implementing it.
+type ReplicationSource interface {
+	// LatestSnapshot returns the latest snapshot persisted by the
+	// leader, or nil if it has not persisted any yet.
+	LatestSnapshot() (*PersistedSnapshot, error)
+	// OpenSegment opens the named segment file of the leader.  As the
+	// leader removes the segment files it no longer needs, a segment
+	// of a snapshot may be gone by the time it is opened, in which case
+	// an error satisfying os.IsNotExist is returned, and the follower
+	// retries with a later snapshot.
+	OpenSegment(name string) (io.ReadCloser, error)
+}
+
+func (s *Scorch) OpenSegment(name string) (io.ReadCloser, error) {
+	if !validSegmentFileName(name) {
+		return nil, fmt.Errorf("replication: invalid segment file name %q", name)
+	}
+	return os.Open(filepath.Join(s.path, name))
+}
+
+func validSegmentFileName(name string) bool {
+	return name != "" && filepath.Base(name) == name && filepath.Ext(name) == ".zap"
+}
+
+// replicateAttempts is the number of snapshots Replicate tries to apply
+// when the leader removes segment files while they are copied.
+var replicateAttempts = 3
+
+// Replicate brings the index directory dir up to date with the latest
+// snapshot persisted by source, when it is newer than epoch: the segment
+// files dir misses are copied first, then the root.bolt of the snapshot
+// atomically replaces the one of dir.  It returns the snapshot applied,
+// or nil when there was nothing newer to apply.  Indexes opened on dir
+// read-only keep serving the previous root until they are reopened, and
+// the segment files it no longer needs are left for PruneReplica.
+func Replicate(source ReplicationSource, dir string, epoch uint64) (
+	rv *PersistedSnapshot, err error) {
+	for attempt := 0; attempt < replicateAttempts; attempt++ {
+		rv, err = replicate(source, dir, epoch)
+		if !os.IsNotExist(err) {
+			break
+		}
+		// the leader has moved on since, retry with its new snapshot
+	}
+	if err != nil {
+		return nil, fmt.Errorf("replication: %v", err)
+	}
+	return rv, nil
+}
+
+func replicate(source ReplicationSource, dir string, epoch uint64) (
+	*PersistedSnapshot, error) {
+	snapshot, err := source.LatestSnapshot()
+	if err != nil || snapshot == nil || snapshot.Epoch <= epoch {
+		return nil, err
+	}
+
+	err = os.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range snapshot.Segments {
+		if !validSegmentFileName(name) {
+			return nil, fmt.Errorf("invalid segment file name %q", name)
+		}
+		dst := filepath.Join(dir, name)
+		if _, err = os.Stat(dst); err == nil {
+			continue // segment files are immutable
+		}
+		err = replicateSegment(source, name, dst)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	rootBoltPath := filepath.Join(dir, "root.bolt")
+	err = ioutil.WriteFile(rootBoltPath+".tmp", snapshot.Root, 0600)
+	if err != nil {
+		return nil, err
+	}
+	err = os.Rename(rootBoltPath+".tmp", rootBoltPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return snapshot, nil
+}
+
+func replicateSegment(source ReplicationSource, name, dst string) (err error) {
+	r, err := source.OpenSegment(name)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = r.Close()
+	}()
+
+	// the file only gets its final name once complete, so that an
+	// interrupted copy is not mistaken for the segment later
+	tmp := dst + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, r)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, dst)
+}
+
+// PruneReplica removes the segment files of the replica in dir which
+// are not used by snapshot, the last one applied by Replicate.  It must
+// only be called once no index opened on a previous root of dir remains.
+func PruneReplica(dir string, snapshot *PersistedSnapshot) error {
+	live := make(map[string]struct{}, len(snapshot.Segments))
+	for _, name := range snapshot.Segments {
+		live[name] = struct{}{}
+	}
+
+	finfos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, finfo := range finfos {
+		name := finfo.Name()
+		if _, ok := live[name]; !ok && filepath.Ext(name) == ".zap" {
+			err = os.Remove(filepath.Join(dir, name))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
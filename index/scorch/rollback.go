@@ -18,6 +18,8 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"path/filepath"
+	"time"
 
 	bolt "go.etcd.io/bbolt"
 )
@@ -31,6 +33,11 @@ func (r *RollbackPoint) GetInternal(key []byte) []byte {
 	return r.meta[string(key)]
 }
 
+// Epoch returns the epoch of the snapshot of the rollback point.
+func (r *RollbackPoint) Epoch() uint64 {
+	return r.epoch
+}
+
 // RollbackPoints returns an array of rollback points available for
 // the application to rollback to, with more recent rollback points
 // (higher epochs) coming first.
@@ -187,12 +194,21 @@ func Rollback(path string, to *RollbackPoint) error {
 		if err == nil {
 			err = rootBolt.Sync()
 		}
+		if err == nil {
+			// the write-ahead log holds batches younger than the
+			// snapshot rolled back to
+			err = os.RemoveAll(filepath.Join(path, walDirName))
+		}
 	}()
 
 	snapshots := tx.Bucket(boltSnapshotsBucket)
 	if snapshots == nil {
 		return nil
 	}
+	err = deleteTagsAfter(tx, to.epoch)
+	if err != nil {
+		return err
+	}
 	for _, epoch := range eligibleEpochs {
 		k := encodeUvarintAscending(nil, epoch)
 		if err != nil {
@@ -210,3 +226,243 @@ func Rollback(path string, to *RollbackPoint) error {
 
 	return err
 }
+
+var boltTagsBucket = []byte{'t'}
+
+// ErrSnapshotTagNotFound is returned when a snapshot tag does not exist.
+var ErrSnapshotTagNotFound = fmt.Errorf("snapshot tag not found")
+
+// SnapshotTag names a persisted snapshot, which is kept from cleanup,
+// whatever NumSnapshotsToKeep, until the tag is deleted, so that the
+// index can always be rolled back to it.
+type SnapshotTag struct {
+	Name  string `json:"name"`
+	Epoch uint64 `json:"epoch"`
+}
+
+// TagSnapshot tags the latest snapshot persisted by the index with
+// name, replacing any previous tag of that name, and returns its epoch.
+func (s *Scorch) TagSnapshot(name string) (uint64, error) {
+	if s.rootBolt == nil {
+		return 0, fmt.Errorf("TagSnapshot: index is not persisted")
+	}
+	// the latest persisted snapshot is always kept by the persister,
+	// so it cannot be removed before the tag protects it
+	return tagSnapshot(s.rootBolt, name, 0)
+}
+
+// SnapshotTags returns the snapshot tags of the index, by name.
+func (s *Scorch) SnapshotTags() ([]*SnapshotTag, error) {
+	if s.rootBolt == nil {
+		return nil, nil
+	}
+	return snapshotTags(s.rootBolt)
+}
+
+// DeleteSnapshotTag deletes the named snapshot tag, the snapshot then
+// becomes subject to cleanup again.
+func (s *Scorch) DeleteSnapshotTag(name string) error {
+	if s.rootBolt == nil {
+		return ErrSnapshotTagNotFound
+	}
+	return deleteSnapshotTag(s.rootBolt, name)
+}
+
+// TagSnapshot tags the persisted snapshot of the given epoch, or the
+// latest one when epoch is 0, of the closed index at path with name.
+func TagSnapshot(path string, name string, epoch uint64) (uint64, error) {
+	rootBolt, err := openRootBolt(path, false)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		_ = rootBolt.Close()
+	}()
+	return tagSnapshot(rootBolt, name, epoch)
+}
+
+// SnapshotTags returns the snapshot tags of the closed index at path.
+func SnapshotTags(path string) ([]*SnapshotTag, error) {
+	rootBolt, err := openRootBolt(path, true)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rootBolt.Close()
+	}()
+	return snapshotTags(rootBolt)
+}
+
+// DeleteSnapshotTag deletes the named snapshot tag of the closed index
+// at path.
+func DeleteSnapshotTag(path string, name string) error {
+	rootBolt, err := openRootBolt(path, false)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = rootBolt.Close()
+	}()
+	return deleteSnapshotTag(rootBolt, name)
+}
+
+// RollbackToTag atomically and durably brings the closed index at path
+// back to the snapshot of the named tag.  The tags of the snapshots
+// rolled back are deleted.
+func RollbackToTag(path string, name string) error {
+	tags, err := SnapshotTags(path)
+	if err != nil {
+		return err
+	}
+	for _, tag := range tags {
+		if tag.Name == name {
+			return Rollback(path, &RollbackPoint{epoch: tag.Epoch})
+		}
+	}
+	return ErrSnapshotTagNotFound
+}
+
+// ErrIndexOpen is returned by the operations on a closed index, such as
+// tagging or verifying it, when the index is still open, as the root.bolt
+// of an open index stays locked.
+var ErrIndexOpen = fmt.Errorf("index is open, it must be closed first")
+
+// openRootBoltTimeout is how long opening the root.bolt of a closed index
+// waits for its lock, before giving up with ErrIndexOpen.
+var openRootBoltTimeout = time.Second
+
+func openRootBolt(path string, readOnly bool) (*bolt.DB, error) {
+	if len(path) == 0 {
+		return nil, fmt.Errorf("invalid path")
+	}
+	rootBoltPath := path + string(os.PathSeparator) + "root.bolt"
+	if _, err := os.Stat(rootBoltPath); err != nil {
+		return nil, err
+	}
+	rv, err := bolt.Open(rootBoltPath, 0600, &bolt.Options{
+		ReadOnly: readOnly,
+		Timeout:  openRootBoltTimeout,
+	})
+	if err == bolt.ErrTimeout {
+		return nil, ErrIndexOpen
+	}
+	return rv, err
+}
+
+func tagSnapshot(rootBolt *bolt.DB, name string, epoch uint64) (uint64, error) {
+	if name == "" {
+		return 0, fmt.Errorf("TagSnapshot: tag name cannot be empty")
+	}
+	err := rootBolt.Update(func(tx *bolt.Tx) error {
+		snapshots := tx.Bucket(boltSnapshotsBucket)
+		if snapshots == nil {
+			return fmt.Errorf("TagSnapshot: no persisted snapshot found")
+		}
+		var k []byte
+		if epoch == 0 {
+			k, _ = snapshots.Cursor().Last()
+			if k == nil {
+				return fmt.Errorf("TagSnapshot: no persisted snapshot found")
+			}
+			var err error
+			_, epoch, err = decodeUvarintAscending(k)
+			if err != nil {
+				return err
+			}
+		} else {
+			k = encodeUvarintAscending(nil, epoch)
+			if snapshots.Bucket(k) == nil {
+				return fmt.Errorf("TagSnapshot: snapshot epoch %d not found", epoch)
+			}
+		}
+		tags, err := tx.CreateBucketIfNotExists(boltTagsBucket)
+		if err != nil {
+			return err
+		}
+		return tags.Put([]byte(name), k)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return epoch, rootBolt.Sync()
+}
+
+func snapshotTags(rootBolt *bolt.DB) ([]*SnapshotTag, error) {
+	var rv []*SnapshotTag
+	err := rootBolt.View(func(tx *bolt.Tx) error {
+		tags := tx.Bucket(boltTagsBucket)
+		if tags == nil {
+			return nil
+		}
+		return tags.ForEach(func(k, v []byte) error {
+			_, epoch, err := decodeUvarintAscending(v)
+			if err != nil {
+				return err
+			}
+			rv = append(rv, &SnapshotTag{Name: string(k), Epoch: epoch})
+			return nil
+		})
+	})
+	return rv, err
+}
+
+func deleteSnapshotTag(rootBolt *bolt.DB, name string) error {
+	err := rootBolt.Update(func(tx *bolt.Tx) error {
+		tags := tx.Bucket(boltTagsBucket)
+		if tags == nil || tags.Get([]byte(name)) == nil {
+			return ErrSnapshotTagNotFound
+		}
+		return tags.Delete([]byte(name))
+	})
+	if err != nil {
+		return err
+	}
+	return rootBolt.Sync()
+}
+
+// taggedEpochs returns the epochs of the tagged snapshots.
+func taggedEpochs(tx *bolt.Tx) (map[uint64]struct{}, error) {
+	rv := map[uint64]struct{}{}
+	tags := tx.Bucket(boltTagsBucket)
+	if tags == nil {
+		return rv, nil
+	}
+	err := tags.ForEach(func(k, v []byte) error {
+		_, epoch, err := decodeUvarintAscending(v)
+		if err != nil {
+			return err
+		}
+		rv[epoch] = struct{}{}
+		return nil
+	})
+	return rv, err
+}
+
+// deleteTagsAfter deletes the tags of the snapshots younger than epoch.
+func deleteTagsAfter(tx *bolt.Tx, epoch uint64) error {
+	tags := tx.Bucket(boltTagsBucket)
+	if tags == nil {
+		return nil
+	}
+	var names [][]byte
+	err := tags.ForEach(func(k, v []byte) error {
+		_, tagEpoch, err := decodeUvarintAscending(v)
+		if err != nil {
+			return err
+		}
+		if tagEpoch > epoch {
+			names = append(names, append([]byte(nil), k...))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		err = tags.Delete(name)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -15,7 +15,9 @@
 package scorch
 
 import (
+	"strconv"
 	"testing"
+	"time"
 
 	"github.com/blevesearch/bleve/v2/document"
 	index "github.com/blevesearch/bleve_index_api"
@@ -246,3 +248,140 @@ func TestIndexRollback(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestIndexSnapshotTags(t *testing.T) {
+	cfg := CreateConfig("TestIndexSnapshotTags")
+	err := InitTest(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := DestroyTest(cfg)
+		if err != nil {
+			t.Log(err)
+		}
+	}()
+
+	analysisQueue := index.NewAnalysisQueue(1)
+	open := func() *Scorch {
+		idx, err := NewScorch(Name, cfg, analysisQueue)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = idx.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return idx.(*Scorch)
+	}
+	docCount := func(idx *Scorch) uint64 {
+		reader, err := idx.Reader()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() {
+			_ = reader.Close()
+		}()
+		count, err := reader.DocCount()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return count
+	}
+	insert := func(idx *Scorch, id string) {
+		doc := document.NewDocument(id)
+		doc.AddField(document.NewTextField("name", []uint64{}, []byte("test")))
+		err := idx.Update(doc)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	idx := open()
+	insert(idx, "1")
+	insert(idx, "2")
+
+	before, err := idx.TagSnapshot("before")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = idx.TagSnapshot("other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = idx.DeleteSnapshotTag("other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = idx.DeleteSnapshotTag("other")
+	if err != ErrSnapshotTagNotFound {
+		t.Errorf("expected ErrSnapshotTagNotFound, got %v", err)
+	}
+
+	// the tagged snapshot outlives NumSnapshotsToKeep
+	for i := 3; i <= 20; i++ {
+		insert(idx, strconv.Itoa(i))
+	}
+
+	// the operations on a closed index fail on an open one
+	defer func(timeout time.Duration) {
+		openRootBoltTimeout = timeout
+	}(openRootBoltTimeout)
+	openRootBoltTimeout = 10 * time.Millisecond
+	path := cfg["path"].(string)
+	_, err = TagSnapshot(path, "open", 0)
+	if err != ErrIndexOpen {
+		t.Errorf("expected ErrIndexOpen tagging an open index, got %v", err)
+	}
+	_, err = Verify(path, nil)
+	if err != ErrIndexOpen {
+		t.Errorf("expected ErrIndexOpen verifying an open index, got %v", err)
+	}
+
+	err = idx.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = TagSnapshot(path, "after", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tags, err := SnapshotTags(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tags) != 2 || tags[0].Name != "after" || tags[1].Name != "before" ||
+		tags[1].Epoch != before || tags[0].Epoch <= before {
+		t.Fatalf("unexpected tags %+v", tags)
+	}
+
+	err = RollbackToTag(path, "missing")
+	if err != ErrSnapshotTagNotFound {
+		t.Errorf("expected ErrSnapshotTagNotFound, got %v", err)
+	}
+	err = RollbackToTag(path, "before")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the tags of the snapshots rolled back are gone
+	tags, err = SnapshotTags(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tags) != 1 || tags[0].Name != "before" {
+		t.Errorf("unexpected tags after rollback %+v", tags)
+	}
+
+	idx = open()
+	defer func() {
+		err := idx.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+	if count := docCount(idx); count != 2 {
+		t.Errorf("expected 2 docs after rollback, got %d", count)
+	}
+}
@@ -24,6 +24,7 @@ import (
 	"time"
 
 	"github.com/RoaringBitmap/roaring"
+	"github.com/blevesearch/bleve/v2/index/encryption"
 	"github.com/blevesearch/bleve/v2/registry"
 	index "github.com/blevesearch/bleve_index_api"
 	segment "github.com/blevesearch/scorch_segment_api/v2"
@@ -47,7 +48,9 @@ type Scorch struct {
 	analysisQueue *index.AnalysisQueue
 	path          string
 
-	unsafeBatch bool
+	durability    Durability
+	groupCommit   bool
+	writeAheadLog bool
 
 	rootLock             sync.RWMutex
 	root                 *IndexSnapshot // holds 1 ref-count on the root
@@ -73,6 +76,24 @@ type Scorch struct {
 	forceMergeRequestCh chan *mergerCtrl
 
 	segPlugin SegmentPlugin
+	cipher    *encryption.Cipher // Encrypts the index at rest, if set.
+
+	indexSort   *indexSort
+	filterCache *filterCache
+
+	changeStream   bool
+	nextChangeSeq  uint64          // Protected by rootLock.
+	pendingChanges []*ChangeRecord // Introduced, not yet persisted.
+	changesCh      chan struct{}   // Closed when changes are persisted.
+
+	groupLock       sync.Mutex
+	group           *batchGroup   // Collecting the batches to commit next.
+	groupIntroduced chan struct{} // Closed when the last group is introduced.
+
+	wal             *writeAheadLog // Set under rootLock.
+	walLock         sync.Mutex     // Orders the log records like the introductions.
+	walMarks        []walMark      // Protected by rootLock.
+	walPersistedSeq uint64         // Protected by rootLock.
 }
 
 type internalStats struct {
@@ -98,6 +119,16 @@ func NewScorch(storeName string,
 		ineligibleForRemoval: map[string]bool{},
 		forceMergeRequestCh:  make(chan *mergerCtrl, 1),
 		segPlugin:            defaultSegmentPlugin,
+		changesCh:            make(chan struct{}),
+		groupIntroduced:      make(chan struct{}),
+	}
+	close(rv.groupIntroduced)
+
+	var err error
+
+	rv.cipher, err = parseEncryptionConfig(config)
+	if err != nil {
+		return nil, err
 	}
 
 	forcedSegmentType, forcedSegmentVersion, err := configForceSegmentTypeVersion(config)
@@ -110,16 +141,50 @@ func NewScorch(storeName string,
 		if err != nil {
 			return nil, err
 		}
+	} else if rv.cipher != nil {
+		rv.segPlugin, err = newEncryptedSegmentPlugin(rv.segPlugin, rv.cipher)
+		if err != nil {
+			return nil, err
+		}
 	}
 
+	rv.indexSort, err = parseIndexSort(config)
+	if err != nil {
+		return nil, err
+	}
+
+	rv.filterCache = newFilterCache(config, &rv.stats)
+
 	rv.root = &IndexSnapshot{parent: rv, refs: 1, creator: "NewScorch"}
 	ro, ok := config["read_only"].(bool)
 	if ok {
 		rv.readOnly = ro
 	}
+	rv.durability = DurabilityFsync
 	ub, ok := config["unsafe_batch"].(bool)
+	if ok && ub {
+		rv.durability = DurabilityMemory
+	}
+	if ds, ok := config["durability"].(string); ok {
+		d, err := ParseDurability(ds)
+		if err != nil {
+			return nil, err
+		}
+		if d != DurabilityDefault {
+			rv.durability = d
+		}
+	}
+	gc, ok := config["groupCommit"].(bool)
+	if ok {
+		rv.groupCommit = gc
+	}
+	wal, ok := config["writeAheadLog"].(bool)
 	if ok {
-		rv.unsafeBatch = ub
+		rv.writeAheadLog = wal
+	}
+	cs, ok := config["changeStream"].(bool)
+	if ok {
+		rv.changeStream = cs
 	}
 	ecbName, ok := config["eventCallbackName"].(string)
 	if ok {
@@ -184,6 +249,12 @@ func (s *Scorch) Open() error {
 		go s.persisterLoop()
 		s.asyncTasks.Add(1)
 		go s.mergerLoop()
+
+		err = s.openWAL()
+		if err != nil {
+			_ = s.Close()
+			return err
+		}
 	}
 
 	return nil
@@ -196,7 +267,13 @@ func (s *Scorch) openBolt() error {
 		return fmt.Errorf("must specify path")
 	}
 	if s.path == "" {
-		s.unsafeBatch = true
+		if s.changeStream {
+			return fmt.Errorf("changeStream requires a path")
+		}
+		if s.writeAheadLog {
+			return fmt.Errorf("writeAheadLog requires a path")
+		}
+		s.durability = DurabilityMemory
 	}
 
 	var rootBoltOpt = *bolt.DefaultOptions
@@ -234,6 +311,14 @@ func (s *Scorch) openBolt() error {
 			_ = s.Close()
 			return err
 		}
+
+		if s.changeStream {
+			err = s.loadChangeSeq()
+			if err != nil {
+				_ = s.Close()
+				return err
+			}
+		}
 	}
 
 	atomic.StoreUint64(&s.stats.TotFileSegmentsAtRoot, uint64(len(s.root.segment)))
@@ -280,12 +365,18 @@ func (s *Scorch) Close() (err error) {
 	close(s.closeCh)
 	// wait for them to close
 	s.asyncTasks.Wait()
+	if s.wal != nil {
+		err = s.wal.close()
+	}
 	// now close the root bolt
 	if s.rootBolt != nil {
-		err = s.rootBolt.Close()
+		err2 := s.rootBolt.Close()
+		if err == nil {
+			err = err2
+		}
 		s.rootLock.Lock()
 		if s.root != nil {
-			err2 := s.root.DecRef()
+			err2 = s.root.DecRef()
 			if err == nil {
 				err = err2
 			}
@@ -309,8 +400,24 @@ func (s *Scorch) Delete(id string) error {
 	return s.Batch(b)
 }
 
-// Batch applices a batch of changes to the index atomically
-func (s *Scorch) Batch(batch *index.Batch) (err error) {
+// Batch applices a batch of changes to the index atomically, as durable
+// as configured for the index when it returns.
+func (s *Scorch) Batch(batch *index.Batch) error {
+	return s.BatchWithDurability(batch, DurabilityDefault)
+}
+
+// BatchWithDurability applies a batch of changes to the index atomically,
+// as durable as requested when it returns.
+func (s *Scorch) BatchWithDurability(batch *index.Batch,
+	durability Durability) (err error) {
+	if s.readOnly {
+		// nothing would ever persist the batch
+		return fmt.Errorf("cannot apply batch, index is read only")
+	}
+	if durability == DurabilityDefault {
+		durability = s.durability
+	}
+
 	start := time.Now()
 
 	defer func() {
@@ -371,14 +478,62 @@ func (s *Scorch) Batch(batch *index.Batch) (err error) {
 
 	indexStart := time.Now()
 
+	c := &batchCommit{
+		results:    analysisResults,
+		ids:        ids,
+		internal:   batch.InternalOps,
+		durability: durability,
+	}
+	if cb := batch.PersistedCallback(); cb != nil {
+		c.callbacks = append(c.callbacks, cb)
+	}
+	if s.changeStream {
+		if changes := newChangeRecord(batch); changes != nil {
+			c.changes = append(c.changes, changes)
+		}
+	}
+
+	if s.groupCommit {
+		err = s.commitGroup(c)
+	} else {
+		err = s.commit(c, nil)
+	}
+	if err != nil {
+		atomic.AddUint64(&s.stats.TotOnErrors, 1)
+	} else {
+		atomic.AddUint64(&s.stats.TotUpdates, numUpdates)
+		atomic.AddUint64(&s.stats.TotDeletes, numDeletes)
+		atomic.AddUint64(&s.stats.TotBatches, 1)
+		atomic.AddUint64(&s.stats.TotIndexedPlainTextBytes, numPlainTextBytes)
+	}
+
+	atomic.AddUint64(&s.stats.TotIndexTime, uint64(time.Since(indexStart)))
+
+	return err
+}
+
+// commit introduces the analyzed batches of c as a new segment, and
+// waits until they are as durable as requested.  introduced, if any, is
+// called once they are introduced, or failed to be.
+func (s *Scorch) commit(c *batchCommit, introduced func()) error {
 	// notify handlers that we're about to introduce a segment
 	s.fireEvent(EventKindBatchIntroductionStart, 0)
 
+	// write the documents in the order of the index sort
+	var sortRange *segmentSortRange
+	if s.indexSort != nil {
+		sortRange = s.indexSort.sortDocuments(c.results)
+	}
+
 	var newSegment segment.Segment
 	var bufBytes uint64
-	if len(analysisResults) > 0 {
-		newSegment, bufBytes, err = s.segPlugin.New(analysisResults)
+	var err error
+	if len(c.results) > 0 {
+		newSegment, bufBytes, err = s.segPlugin.New(c.results)
 		if err != nil {
+			if introduced != nil {
+				introduced()
+			}
 			return err
 		}
 		atomic.AddUint64(&s.iStats.newSegBufBytesAdded, bufBytes)
@@ -386,40 +541,44 @@ func (s *Scorch) Batch(batch *index.Batch) (err error) {
 		atomic.AddUint64(&s.stats.TotBatchesEmpty, 1)
 	}
 
-	err = s.prepareSegment(newSegment, ids, batch.InternalOps, batch.PersistedCallback())
-	if err != nil {
-		if newSegment != nil {
-			_ = newSegment.Close()
-		}
-		atomic.AddUint64(&s.stats.TotOnErrors, 1)
-	} else {
-		atomic.AddUint64(&s.stats.TotUpdates, numUpdates)
-		atomic.AddUint64(&s.stats.TotDeletes, numDeletes)
-		atomic.AddUint64(&s.stats.TotBatches, 1)
-		atomic.AddUint64(&s.stats.TotIndexedPlainTextBytes, numPlainTextBytes)
+	err = s.prepareSegment(newSegment, sortRange, c, introduced)
+	if err != nil && newSegment != nil {
+		_ = newSegment.Close()
 	}
 
 	atomic.AddUint64(&s.iStats.newSegBufBytesRemoved, bufBytes)
-	atomic.AddUint64(&s.stats.TotIndexTime, uint64(time.Since(indexStart)))
 
 	return err
 }
 
-func (s *Scorch) prepareSegment(newSegment segment.Segment, ids []string,
-	internalOps map[string][]byte, persistedCallback index.BatchCallback) error {
+func (s *Scorch) prepareSegment(newSegment segment.Segment,
+	sortRange *segmentSortRange, c *batchCommit,
+	introduced func()) (err error) {
+	defer func() {
+		if introduced != nil {
+			introduced()
+		}
+	}()
 
 	// new introduction
 	introduction := &segmentIntroduction{
 		id:                atomic.AddUint64(&s.nextSegmentID, 1),
 		data:              newSegment,
-		ids:               ids,
+		sortRange:         sortRange,
+		ids:               c.ids,
 		obsoletes:         make(map[uint64]*roaring.Bitmap),
-		internal:          internalOps,
+		internal:          c.internal,
+		changes:           c.changes,
+		walSeq:            c.walSeq,
 		applied:           make(chan error),
-		persistedCallback: persistedCallback,
+		persistedCallback: c.persistedCallback(),
 	}
 
-	if !s.unsafeBatch {
+	durability := c.durability
+	if s.path == "" {
+		durability = DurabilityMemory
+	}
+	if durability != DurabilityMemory && s.wal == nil {
 		introduction.persisted = make(chan error, 1)
 	}
 
@@ -432,25 +591,63 @@ func (s *Scorch) prepareSegment(newSegment segment.Segment, ids []string,
 	defer func() { _ = root.DecRef() }()
 
 	for _, seg := range root.segment {
-		delta, err := seg.segment.DocNumbers(ids)
+		delta, err := seg.segment.DocNumbers(c.ids)
 		if err != nil {
 			return err
 		}
 		introduction.obsoletes[seg.id] = delta
 	}
 
+	var record []byte
+	if s.wal != nil && introduction.walSeq == 0 {
+		record, err = encodeWALRecord(c, s.cipher)
+		if err != nil {
+			return err
+		}
+	}
+
 	introStartTime := time.Now()
 
-	s.introductions <- introduction
+	if record != nil {
+		// the log must hold the records in the order of introduction
+		s.walLock.Lock()
+		introduction.walSeq, err = s.wal.append(record)
+		if err == nil {
+			s.introductions <- introduction
+		}
+		s.walLock.Unlock()
+		if err != nil {
+			return err
+		}
+		atomic.AddUint64(&s.stats.TotWALAppend, 1)
+	} else {
+		s.introductions <- introduction
+	}
 
 	// block until this segment is applied
-	err := <-introduction.applied
+	err = <-introduction.applied
+	if introduced != nil {
+		introduced()
+		introduced = nil
+	}
 	if err != nil {
+		if record != nil {
+			// the batch failed, it must not be replayed
+			if aerr := s.wal.abort(introduction.walSeq); aerr != nil {
+				return fmt.Errorf("%v, and aborting its write-ahead log record failed: %v",
+					err, aerr)
+			}
+			atomic.AddUint64(&s.stats.TotWALAborted, 1)
+		}
 		return err
 	}
 
-	if introduction.persisted != nil {
+	switch {
+	case introduction.persisted != nil:
 		err = <-introduction.persisted
+	case durability == DurabilityFsync && s.wal != nil:
+		err = s.wal.sync(introduction.walSeq)
+		atomic.AddUint64(&s.stats.TotWALSync, 1)
 	}
 
 	introTime := uint64(time.Since(introStartTime))
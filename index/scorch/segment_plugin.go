@@ -128,6 +128,12 @@ func (s *Scorch) loadSegmentPlugin(forcedSegmentType string,
 	if err != nil {
 		return err
 	}
+	if s.cipher != nil {
+		segPlugin, err = newEncryptedSegmentPlugin(segPlugin, s.cipher)
+		if err != nil {
+			return err
+		}
+	}
 	s.segPlugin = segPlugin
 	return nil
 }
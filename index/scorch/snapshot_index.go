@@ -413,27 +413,7 @@ func (i *IndexSnapshot) Document(id string) (rv index.Document, err error) {
 
 	rvd := document.NewDocument(id)
 	err = i.segment[segmentIndex].VisitDocument(localDocNum, func(name string, typ byte, val []byte, pos []uint64) bool {
-		if name == "_id" {
-			return true
-		}
-
-		// copy value, array positions to preserve them beyond the scope of this callback
-		value := append([]byte(nil), val...)
-		arrayPos := append([]uint64(nil), pos...)
-
-		switch typ {
-		case 't':
-			rvd.AddField(document.NewTextField(name, arrayPos, value))
-		case 'n':
-			rvd.AddField(document.NewNumericFieldFromBytes(name, arrayPos, value))
-		case 'd':
-			rvd.AddField(document.NewDateTimeFieldFromBytes(name, arrayPos, value))
-		case 'b':
-			rvd.AddField(document.NewBooleanFieldFromBytes(name, arrayPos, value))
-		case 'g':
-			rvd.AddField(document.NewGeoPointFieldFromBytes(name, arrayPos, value))
-		}
-
+		addStoredField(rvd, name, typ, val, pos)
 		return true
 	})
 	if err != nil {
@@ -443,6 +423,31 @@ func (i *IndexSnapshot) Document(id string) (rv index.Document, err error) {
 	return rvd, nil
 }
 
+// addStoredField adds a stored field value visited to doc.
+func addStoredField(doc *document.Document, name string, typ byte,
+	val []byte, pos []uint64) {
+	if name == "_id" {
+		return
+	}
+
+	// copy value, array positions to preserve them beyond the scope of this callback
+	value := append([]byte(nil), val...)
+	arrayPos := append([]uint64(nil), pos...)
+
+	switch typ {
+	case 't':
+		doc.AddField(document.NewTextField(name, arrayPos, value))
+	case 'n':
+		doc.AddField(document.NewNumericFieldFromBytes(name, arrayPos, value))
+	case 'd':
+		doc.AddField(document.NewDateTimeFieldFromBytes(name, arrayPos, value))
+	case 'b':
+		doc.AddField(document.NewBooleanFieldFromBytes(name, arrayPos, value))
+	case 'g':
+		doc.AddField(document.NewGeoPointFieldFromBytes(name, arrayPos, value))
+	}
+}
+
 func (i *IndexSnapshot) segmentIndexAndLocalDocNumFromGlobal(docNum uint64) (int, uint64) {
 	segmentIndex := sort.Search(len(i.offsets),
 		func(x int) bool {
@@ -762,3 +767,31 @@ OUTER:
 	}
 	return rv
 }
+
+// SegmentGroups splits the segments into at most n groups of contiguous
+// segments holding about as many live documents, and returns the
+// internal ID of the first document of each group.
+func (i *IndexSnapshot) SegmentGroups(n int) []index.IndexInternalID {
+	var total uint64
+	for _, ss := range i.segment {
+		total += ss.Count()
+	}
+	if n < 1 || total == 0 {
+		return nil
+	}
+
+	// a group starts at the first segment past its share of the documents
+	var rv []index.IndexInternalID
+	var seen uint64
+	for x, ss := range i.segment {
+		count := ss.Count()
+		if count == 0 {
+			continue
+		}
+		if len(rv) == 0 || (len(rv) < n && seen*uint64(n) >= uint64(len(rv))*total) {
+			rv = append(rv, docNumberToBytes(nil, i.offsets[x]))
+		}
+		seen += count
+	}
+	return rv
+}
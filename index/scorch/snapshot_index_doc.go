@@ -55,7 +55,14 @@ func (i *IndexSnapshotDocIDReader) Next() (index.IndexInternalID, error) {
 }
 
 func (i *IndexSnapshotDocIDReader) Advance(ID index.IndexInternalID) (index.IndexInternalID, error) {
-	// FIXME do something better
+	// skip the segments before the one holding the ID
+	if docNum, err := docInternalToNumber(ID); err == nil {
+		segmentIndex, _ := i.snapshot.segmentIndexAndLocalDocNumFromGlobal(docNum)
+		if segmentIndex > i.segmentOffset && segmentIndex < len(i.iterators) {
+			i.segmentOffset = segmentIndex
+		}
+	}
+	// FIXME do something better within the segment
 	next, err := i.Next()
 	if err != nil {
 		return nil, err
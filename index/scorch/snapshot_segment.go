@@ -35,6 +35,10 @@ type SegmentSnapshot struct {
 	deleted *roaring.Bitmap
 	creator string
 
+	// sortRange is set when the documents of the segment are
+	// ordered by an index sort
+	sortRange *segmentSortRange
+
 	cachedDocs *cachedDocs
 }
 
@@ -0,0 +1,217 @@
+//  Copyright (c) 2021 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scorch
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/blevesearch/bleve/v2/search"
+	index "github.com/blevesearch/bleve_index_api"
+)
+
+// indexSort is the order in which documents are written to segments,
+// configured with the "indexSort" option as a sort string, such as
+// "-timestamp", or as a sort object.  Only sorting on a single field
+// with doc values is supported.  Merged segments only stay sorted when
+// their documents do not overlap in the sort order, see mergeOrder.
+type indexSort struct {
+	spec  string
+	field *search.SortField
+}
+
+func parseIndexSort(config map[string]interface{}) (*indexSort, error) {
+	var ss search.SearchSort
+	switch v := config["indexSort"].(type) {
+	case nil:
+		return nil, nil
+	case string:
+		ss = search.ParseSearchSortString(v)
+	case map[string]interface{}:
+		var err error
+		ss, err = search.ParseSearchSortObj(v)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("indexSort must be a sort string or object")
+	}
+
+	sf, ok := ss.(*search.SortField)
+	if !ok {
+		return nil, fmt.Errorf("indexSort must sort by a field")
+	}
+	spec, err := json.Marshal(sf)
+	if err != nil {
+		return nil, err
+	}
+	return &indexSort{
+		spec:  string(spec),
+		field: sf,
+	}, nil
+}
+
+// matches returns true if the sort order orders documents exactly
+// as the index sort does.
+func (is *indexSort) matches(so search.SortOrder) bool {
+	if len(so) != 1 {
+		return false
+	}
+	sf, ok := so[0].(*search.SortField)
+	return ok && sf.Field == is.field.Field && sf.Desc == is.field.Desc &&
+		sf.Type == is.field.Type && sf.Mode == is.field.Mode &&
+		sf.Missing == is.field.Missing
+}
+
+// key returns the sort value of the document, computed from the terms
+// of its field as they are visited in the doc values when searching.
+func (is *indexSort) key(sf *search.SortField, doc index.Document) string {
+	var terms []string
+	doc.VisitFields(func(field index.Field) {
+		if field.Name() == sf.Field && field.Options().IncludeDocValues() {
+			for term := range field.AnalyzedTokenFrequencies() {
+				terms = append(terms, term)
+			}
+		}
+	})
+	sort.Strings(terms)
+	for _, term := range terms {
+		sf.UpdateVisitor(sf.Field, []byte(term))
+	}
+	return sf.Value(nil)
+}
+
+// less returns true if the key a sorts before the key b.
+func (is *indexSort) less(a, b string) bool {
+	if is.field.Desc {
+		return a > b
+	}
+	return a < b
+}
+
+// sortDocuments orders the documents by the index sort, returning the
+// sort range of the segment they will make up.
+func (is *indexSort) sortDocuments(docs []index.Document) *segmentSortRange {
+	if len(docs) == 0 {
+		return nil
+	}
+	sf := is.field.Copy().(*search.SortField)
+	keys := make([]string, len(docs))
+	for i, doc := range docs {
+		keys[i] = is.key(sf, doc)
+	}
+	sort.Stable(&documentsByKey{docs: docs, keys: keys, is: is})
+	return &segmentSortRange{
+		Spec:  is.spec,
+		First: keys[0],
+		Last:  keys[len(keys)-1],
+	}
+}
+
+type documentsByKey struct {
+	docs []index.Document
+	keys []string
+	is   *indexSort
+}
+
+func (d *documentsByKey) Len() int { return len(d.docs) }
+
+func (d *documentsByKey) Less(i, j int) bool { return d.is.less(d.keys[i], d.keys[j]) }
+
+func (d *documentsByKey) Swap(i, j int) {
+	d.docs[i], d.docs[j] = d.docs[j], d.docs[i]
+	d.keys[i], d.keys[j] = d.keys[j], d.keys[i]
+}
+
+// segmentSortRange records that the documents of a segment are ordered
+// by the index sort described by Spec, from the key First to the key
+// Last.  Deleted documents do not change the range.
+type segmentSortRange struct {
+	Spec  string `json:"spec"`
+	First string `json:"first"`
+	Last  string `json:"last"`
+}
+
+// sortedRange returns the sort range of the segment snapshot, if it is
+// ordered by the current index sort.
+func (is *indexSort) sortedRange(ss *SegmentSnapshot) *segmentSortRange {
+	if is == nil || ss.sortRange == nil || ss.sortRange.Spec != is.spec {
+		return nil
+	}
+	return ss.sortRange
+}
+
+// mergeOrder returns the order in which to merge the segment snapshots
+// so that the merged segment is sorted, along with its sort range.  This
+// is only possible when the sort ranges of the segments do not overlap,
+// as is the case when documents are indexed in about the sort order.
+// Otherwise the segments keep their order, and the range is nil.
+//
+// Segment merges concatenate the documents of their segments, so there
+// is no sorted k-way merge of overlapping segments.  Their merged
+// segment is not sorted, and queries fall back to collecting all of its
+// matches; indexes with documents arriving far out of the sort order
+// lose the early termination as their segments are merged.
+func (is *indexSort) mergeOrder(segs []*SegmentSnapshot) ([]int, *segmentSortRange) {
+	order := make([]int, len(segs))
+	for i := range order {
+		order[i] = i
+	}
+	if is == nil || len(segs) == 0 {
+		return order, nil
+	}
+	for _, ss := range segs {
+		if is.sortedRange(ss) == nil {
+			return order, nil
+		}
+	}
+
+	sorted := make([]int, len(order))
+	copy(sorted, order)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return is.less(segs[sorted[i]].sortRange.First, segs[sorted[j]].sortRange.First)
+	})
+	for i := 1; i < len(sorted); i++ {
+		if is.less(segs[sorted[i]].sortRange.First, segs[sorted[i-1]].sortRange.Last) {
+			return order, nil
+		}
+	}
+
+	return sorted, &segmentSortRange{
+		Spec:  is.spec,
+		First: segs[sorted[0]].sortRange.First,
+		Last:  segs[sorted[len(sorted)-1]].sortRange.Last,
+	}
+}
+
+// SortedSegments returns the internal ID of the first document of
+// each segment, and whether the segment holds its documents in the
+// provided sort order, thanks to the index sort.
+func (i *IndexSnapshot) SortedSegments(so search.SortOrder) (
+	[]index.IndexInternalID, []bool) {
+	starts := make([]index.IndexInternalID, len(i.segment))
+	sorted := make([]bool, len(i.segment))
+	var is *indexSort
+	if i.parent != nil {
+		is = i.parent.indexSort
+	}
+	matches := is != nil && is.matches(so)
+	for x, ss := range i.segment {
+		starts[x] = docNumberToBytes(nil, i.offsets[x])
+		sorted[x] = matches && is.sortedRange(ss) != nil
+	}
+	return starts, sorted
+}
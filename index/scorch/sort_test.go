@@ -0,0 +1,79 @@
+//  Copyright (c) 2021 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scorch
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestIndexSortMergeOrder(t *testing.T) {
+	is, err := parseIndexSort(map[string]interface{}{"indexSort": "-ts"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ranged := func(first, last string) *SegmentSnapshot {
+		return &SegmentSnapshot{sortRange: &segmentSortRange{
+			Spec:  is.spec,
+			First: first,
+			Last:  last,
+		}}
+	}
+
+	tests := []struct {
+		segs          []*SegmentSnapshot
+		expectedOrder []int
+		expectedRange *segmentSortRange
+	}{
+		// disjoint ranges are merged from the highest down
+		{
+			segs:          []*SegmentSnapshot{ranged("c", "a"), ranged("f", "d"), ranged("d", "c")},
+			expectedOrder: []int{1, 2, 0},
+			expectedRange: &segmentSortRange{Spec: is.spec, First: "f", Last: "a"},
+		},
+		// overlapping ranges cannot make up a sorted segment
+		{
+			segs:          []*SegmentSnapshot{ranged("c", "a"), ranged("d", "b")},
+			expectedOrder: []int{0, 1},
+		},
+		// nor can unsorted segments
+		{
+			segs:          []*SegmentSnapshot{ranged("c", "a"), {}},
+			expectedOrder: []int{0, 1},
+		},
+		// nor segments sorted differently
+		{
+			segs: []*SegmentSnapshot{ranged("c", "a"), {sortRange: &segmentSortRange{
+				Spec: `"ts"`, First: "d", Last: "f"}}},
+			expectedOrder: []int{0, 1},
+		},
+	}
+
+	for i, test := range tests {
+		order, sortRange := is.mergeOrder(test.segs)
+		if !reflect.DeepEqual(order, test.expectedOrder) {
+			t.Errorf("test %d: expected order %v, got %v", i, test.expectedOrder, order)
+		}
+		if !reflect.DeepEqual(sortRange, test.expectedRange) {
+			t.Errorf("test %d: expected range %v, got %v", i, test.expectedRange, sortRange)
+		}
+	}
+
+	_, err = parseIndexSort(map[string]interface{}{"indexSort": "_score"})
+	if err == nil {
+		t.Errorf("expected error sorting the index by score")
+	}
+}
@@ -30,6 +30,7 @@ type Stats struct {
 
 	TotBatches        uint64
 	TotBatchesEmpty   uint64
+	TotBatchesGrouped uint64
 	TotBatchIntroTime uint64
 	MaxBatchIntroTime uint64
 
@@ -39,6 +40,11 @@ type Stats struct {
 
 	TotOnErrors uint64
 
+	TotWALAppend   uint64
+	TotWALSync     uint64
+	TotWALReplayed uint64
+	TotWALAborted  uint64
+
 	TotAnalysisTime uint64
 	TotIndexTime    uint64
 
@@ -47,6 +53,11 @@ type Stats struct {
 	TotTermSearchersStarted  uint64
 	TotTermSearchersFinished uint64
 
+	TotFilterCacheHits      uint64
+	TotFilterCacheMisses    uint64
+	TotFilterCacheEvictions uint64
+	CurFilterCacheBytes     uint64
+
 	TotEventTriggerStarted   uint64
 	TotEventTriggerCompleted uint64
 
@@ -99,10 +110,12 @@ type Stats struct {
 	TotFileMergePlanTasksSegments      uint64
 	TotFileMergePlanTasksSegmentsEmpty uint64
 
-	TotFileMergeSegmentsEmpty uint64
-	TotFileMergeSegments      uint64
-	TotFileSegmentsAtRoot     uint64
-	TotFileMergeWrittenBytes  uint64
+	TotFileMergeSegmentsEmpty    uint64
+	TotFileMergeSegments         uint64
+	TotFileMergeSegmentsRekeyed  uint64 // Rewritten with the current encryption key.
+	TotFileMergeSegmentsUnsorted uint64 // Merged out of the index sort order.
+	TotFileSegmentsAtRoot        uint64
+	TotFileMergeWrittenBytes     uint64
 
 	TotFileMergeZapBeg              uint64
 	TotFileMergeZapEnd              uint64
@@ -127,6 +140,7 @@ type Stats struct {
 	TotMemMergeZapTime      uint64
 	MaxMemMergeZapTime      uint64
 	TotMemMergeSegments     uint64
+	TotMemMergeUnsorted     uint64 // Merged out of the index sort order.
 	TotMemorySegmentsAtRoot uint64
 }
 
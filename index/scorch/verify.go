@@ -0,0 +1,801 @@
+//  Copyright (c) 2024 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scorch
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/RoaringBitmap/roaring"
+	"github.com/blevesearch/bleve/v2/document"
+	"github.com/blevesearch/bleve/v2/index/encryption"
+	segment "github.com/blevesearch/scorch_segment_api/v2"
+	zapv15 "github.com/blevesearch/zapx/v15"
+	bolt "go.etcd.io/bbolt"
+)
+
+// VerifyProblem is an inconsistency found verifying an index.
+type VerifyProblem struct {
+	// Epoch is the snapshot the problem is found in, or 0 for a
+	// problem of a segment file itself.
+	Epoch uint64 `json:"epoch,omitempty"`
+	// Segment is the segment file the problem is found with, if any.
+	Segment string `json:"segment,omitempty"`
+	Problem string `json:"problem"`
+}
+
+func (p *VerifyProblem) String() string {
+	rv := p.Problem
+	if p.Segment != "" {
+		rv = fmt.Sprintf("segment %s: %s", p.Segment, rv)
+	}
+	if p.Epoch != 0 {
+		rv = fmt.Sprintf("snapshot %d: %s", p.Epoch, rv)
+	}
+	return rv
+}
+
+// VerifyReport is the outcome of verifying an index.
+type VerifyReport struct {
+	Snapshots []uint64         `json:"snapshots"`
+	Segments  []string         `json:"segments"`
+	Problems  []*VerifyProblem `json:"problems,omitempty"`
+}
+
+func (r *VerifyReport) problem(epoch uint64, segment string,
+	format string, args ...interface{}) {
+	r.Problems = append(r.Problems, &VerifyProblem{
+		Epoch:   epoch,
+		Segment: segment,
+		Problem: fmt.Sprintf(format, args...),
+	})
+}
+
+// CorruptSegments returns the segment files with problems, of their own
+// or in the way a snapshot refers to them.
+func (r *VerifyReport) CorruptSegments() []string {
+	var rv []string
+	seen := map[string]struct{}{}
+	for _, p := range r.Problems {
+		if _, ok := seen[p.Segment]; ok || p.Segment == "" {
+			continue
+		}
+		seen[p.Segment] = struct{}{}
+		rv = append(rv, p.Segment)
+	}
+	sort.Strings(rv)
+	return rv
+}
+
+// newOfflineScorch returns a Scorch for the index at path, configured but
+// not opened, to work on its files while it is not open.
+func newOfflineScorch(path string, config map[string]interface{}) (
+	*Scorch, error) {
+	cfg := map[string]interface{}{}
+	for k, v := range config {
+		cfg[k] = v
+	}
+	cfg["path"] = path
+	cfg["read_only"] = true
+	idx, err := NewScorch(Name, cfg, nil)
+	if err != nil {
+		return nil, err
+	}
+	rv := idx.(*Scorch)
+	rv.path = path
+	return rv, nil
+}
+
+// snapshotSegmentPlugin returns the segment plugin of a snapshot, as
+// recorded in its meta-data bucket, and whether its values are encrypted.
+func (s *Scorch) snapshotSegmentPlugin(snapshot *bolt.Bucket) (
+	SegmentPlugin, bool, error) {
+	metaBucket := snapshot.Bucket(boltMetaDataKey)
+	if metaBucket == nil {
+		return nil, false, fmt.Errorf("meta-data bucket missing")
+	}
+	versionBytes := metaBucket.Get(boltMetaDataSegmentVersionKey)
+	if len(versionBytes) < 4 {
+		return nil, false, fmt.Errorf("segment version missing")
+	}
+	plugin, err := chooseSegmentPlugin(
+		string(metaBucket.Get(boltMetaDataSegmentTypeKey)),
+		binary.BigEndian.Uint32(versionBytes))
+	if err != nil {
+		return nil, false, err
+	}
+	if s.cipher != nil {
+		plugin, err = newEncryptedSegmentPlugin(plugin, s.cipher)
+		if err != nil {
+			return nil, false, err
+		}
+	}
+	return plugin, metaBucket.Get(boltMetaDataEncryptionKey) != nil, nil
+}
+
+// Verify checks the index at path, which must not be open, for
+// corruption.  It walks the snapshots of the root bolt, then checks each
+// segment file they refer to against its checksum, or authenticates it
+// when encrypted, and checks that the stored fields, the postings and the
+// doc values of its documents agree.  The config provides the settings
+// needed to read the index, such as its "encryptionKeyProvider".
+func Verify(path string, config map[string]interface{}) (*VerifyReport, error) {
+	s, err := newOfflineScorch(path, config)
+	if err != nil {
+		return nil, err
+	}
+	rootBolt, err := openRootBolt(path, true)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rootBolt.Close()
+	}()
+
+	rv := &VerifyReport{}
+	plugins := map[string]SegmentPlugin{}
+	err = rootBolt.View(func(tx *bolt.Tx) error {
+		snapshots := tx.Bucket(boltSnapshotsBucket)
+		if snapshots == nil {
+			return nil
+		}
+		c := snapshots.Cursor()
+		for k, _ := c.First(); k != nil; k, _ = c.Next() {
+			_, epoch, err := decodeUvarintAscending(k)
+			if err != nil {
+				rv.problem(0, "", "invalid snapshot key %x", k)
+				continue
+			}
+			rv.Snapshots = append(rv.Snapshots, epoch)
+			snapshot := snapshots.Bucket(k)
+			if snapshot == nil {
+				rv.problem(epoch, "", "snapshot key, but bucket missing")
+				continue
+			}
+			err = s.verifySnapshot(snapshot, epoch, rv, plugins)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for name := range plugins {
+		rv.Segments = append(rv.Segments, name)
+	}
+	sort.Strings(rv.Segments)
+	for _, name := range rv.Segments {
+		s.verifySegmentFile(name, plugins[name], rv)
+	}
+	return rv, nil
+}
+
+// verifySnapshot checks the root bolt bucket of a snapshot, and collects
+// the segment files it refers to along with their plugin.
+func (s *Scorch) verifySnapshot(snapshot *bolt.Bucket, epoch uint64,
+	rv *VerifyReport, plugins map[string]SegmentPlugin) error {
+	plugin, encrypted, err := s.snapshotSegmentPlugin(snapshot)
+	if err != nil {
+		rv.problem(epoch, "", "%v", err)
+		return nil
+	}
+	if encrypted && s.cipher == nil {
+		return fmt.Errorf("%w: index encrypted, no encryptionKeyProvider"+
+			" configured", encryption.ErrDecrypt)
+	}
+
+	c := snapshot.Cursor()
+	for k, _ := c.First(); k != nil; k, _ = c.Next() {
+		if k[0] == boltMetaDataKey[0] {
+			continue
+		}
+		if k[0] == boltInternalKey[0] {
+			if !encrypted {
+				continue
+			}
+			err = snapshot.Bucket(k).ForEach(func(key, val []byte) error {
+				_, err := s.cipher.Decrypt(val)
+				if err != nil {
+					rv.problem(epoch, "", "internal value %q: %v", key, err)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		segmentBucket := snapshot.Bucket(k)
+		if segmentBucket == nil {
+			rv.problem(epoch, "", "segment key, but bucket missing % x", k)
+			continue
+		}
+		pathBytes := segmentBucket.Get(boltPathKey)
+		if pathBytes == nil {
+			rv.problem(epoch, "", "segment path missing % x", k)
+			continue
+		}
+		name := string(pathBytes)
+		plugins[name] = plugin
+
+		if sortRangeBytes := segmentBucket.Get(boltSortRangeKey); sortRangeBytes != nil {
+			if encrypted {
+				sortRangeBytes, err = s.cipher.Decrypt(sortRangeBytes)
+			}
+			if err == nil {
+				err = json.Unmarshal(sortRangeBytes, &segmentSortRange{})
+			}
+			if err != nil {
+				rv.problem(epoch, name, "invalid sort range: %v", err)
+			}
+		}
+		if deletedBytes := segmentBucket.Get(boltDeletedKey); deletedBytes != nil {
+			var err error
+			if encrypted {
+				deletedBytes, err = s.cipher.Decrypt(deletedBytes)
+			}
+			if err == nil {
+				_, err = roaring.NewBitmap().ReadFrom(bytes.NewReader(deletedBytes))
+			}
+			if err != nil {
+				rv.problem(epoch, name, "invalid deleted bitmap: %v", err)
+			}
+		}
+	}
+	return nil
+}
+
+// verifySegmentFile checks a segment file against its checksum, then its
+// structure.
+func (s *Scorch) verifySegmentFile(name string, plugin SegmentPlugin,
+	rv *VerifyReport) {
+	data, err := ioutil.ReadFile(filepath.Join(s.path, name))
+	if err != nil {
+		rv.problem(0, name, "%v", err)
+		return
+	}
+	if encryption.IsEncrypted(data) {
+		if s.cipher == nil {
+			rv.problem(0, name, "encrypted, no encryptionKeyProvider configured")
+			return
+		}
+		data, err = s.cipher.Decrypt(data)
+		if err != nil {
+			rv.problem(0, name, "%v", err)
+			return
+		}
+	}
+
+	// every zap version ends its files with the same footer, closed by
+	// the checksum of everything before it
+	if plugin.Type() == zapv15.Type {
+		if len(data) < zapv15.FooterSize {
+			rv.problem(0, name, "too short: %d bytes", len(data))
+			return
+		}
+		crc := binary.BigEndian.Uint32(data[len(data)-4:])
+		if actual := crc32.ChecksumIEEE(data[:len(data)-4]); actual != crc {
+			rv.problem(0, name, "checksum mismatch: expected %08x, got %08x",
+				crc, actual)
+			return
+		}
+		version := binary.BigEndian.Uint32(data[len(data)-8 : len(data)-4])
+		if version != plugin.Version() {
+			rv.problem(0, name, "version %d, expected %d",
+				version, plugin.Version())
+			return
+		}
+	}
+
+	seg, err := openSegmentSafely(plugin, filepath.Join(s.path, name))
+	if err != nil {
+		rv.problem(0, name, "error opening: %v", err)
+		return
+	}
+	defer func() {
+		_ = seg.Close()
+	}()
+	for _, check := range []func(segment.Segment) error{
+		verifyStoredFields, verifyPostings, verifyDocValues} {
+		err = checkSafely(check, seg)
+		if err != nil {
+			rv.problem(0, name, "%v", err)
+		}
+	}
+}
+
+// openSegmentSafely opens a segment, a corrupt one making zap panic.
+func openSegmentSafely(plugin SegmentPlugin, path string) (
+	seg segment.Segment, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return plugin.Open(path)
+}
+
+func checkSafely(check func(segment.Segment) error,
+	seg segment.Segment) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return check(seg)
+}
+
+// verifyStoredFields checks each document has its stored fields, starting
+// with its _id.
+func verifyStoredFields(seg segment.Segment) error {
+	for docNum := uint64(0); docNum < seg.Count(); docNum++ {
+		var id []byte
+		err := seg.VisitStoredFields(docNum, func(field string, typ byte,
+			value []byte, pos []uint64) bool {
+			if field == "_id" {
+				id = append([]byte(nil), value...)
+			}
+			return true
+		})
+		if err != nil {
+			return fmt.Errorf("document %d: stored fields: %v", docNum, err)
+		}
+		if len(id) == 0 {
+			return fmt.Errorf("document %d: no stored _id", docNum)
+		}
+	}
+	return nil
+}
+
+// verifyPostings checks the postings of each term of each field refer to
+// documents of the segment, as many as the postings list counts, and
+// that each _id term refers to the one document stored with it.  The
+// count of the dictionary entries is not used, zap reports a stale one
+// for a term following a term with a single posting.
+func verifyPostings(seg segment.Segment) error {
+	count := seg.Count()
+	for _, field := range seg.Fields() {
+		dict, err := seg.Dictionary(field)
+		if err != nil {
+			return fmt.Errorf("field %s: dictionary: %v", field, err)
+		}
+		var numTerms uint64
+		itr := dict.AutomatonIterator(nil, nil, nil)
+		entry, err := itr.Next()
+		for err == nil && entry != nil {
+			numTerms++
+			// err is left to the dictionary iterator, so that its
+			// errors end the loop over the terms
+			pl, perr := dict.PostingsList([]byte(entry.Term), nil, nil)
+			if perr != nil {
+				return fmt.Errorf("field %s term %q: postings: %v",
+					field, entry.Term, perr)
+			}
+			var numPostings uint64
+			postings := pl.Iterator(false, false, false, nil)
+			posting, perr := postings.Next()
+			for perr == nil && posting != nil {
+				docNum := posting.Number()
+				if docNum >= count {
+					return fmt.Errorf("field %s term %q: posting for document"+
+						" %d, of %d", field, entry.Term, docNum, count)
+				}
+				if field == "_id" {
+					id, err := seg.DocID(docNum)
+					if err != nil || string(id) != entry.Term {
+						return fmt.Errorf("_id %q: posting for document %d,"+
+							" stored with _id %q (%v)", entry.Term, docNum, id, err)
+					}
+				}
+				numPostings++
+				posting, perr = postings.Next()
+			}
+			if perr != nil {
+				return fmt.Errorf("field %s term %q: postings: %v",
+					field, entry.Term, perr)
+			}
+			if numPostings != pl.Count() {
+				return fmt.Errorf("field %s term %q: %d postings, postings"+
+					" list counts %d", field, entry.Term, numPostings, pl.Count())
+			}
+			entry, err = itr.Next()
+		}
+		if err != nil {
+			return fmt.Errorf("field %s: dictionary: %v", field, err)
+		}
+		if field == "_id" && numTerms != count {
+			return fmt.Errorf("%d _id terms for %d documents", numTerms, count)
+		}
+	}
+	return nil
+}
+
+// verifyDocValues checks the doc values of each document are terms of the
+// dictionary of their field.
+func verifyDocValues(seg segment.Segment) error {
+	dvs, ok := seg.(segment.DocValueVisitable)
+	if !ok {
+		return nil
+	}
+	fields, err := dvs.VisitableDocValueFields()
+	if err != nil {
+		return fmt.Errorf("doc value fields: %v", err)
+	}
+	dicts := make(map[string]segment.TermDictionary, len(fields))
+	for _, field := range fields {
+		dicts[field], err = seg.Dictionary(field)
+		if err != nil {
+			return fmt.Errorf("field %s: dictionary: %v", field, err)
+		}
+	}
+
+	var state segment.DocVisitState
+	for docNum := uint64(0); docNum < seg.Count(); docNum++ {
+		var problem error
+		state, err = dvs.VisitDocValues(docNum, fields,
+			func(field string, term []byte) {
+				if problem != nil {
+					return
+				}
+				ok, err := dicts[field].Contains(term)
+				if err != nil || !ok {
+					problem = fmt.Errorf("document %d: doc value %q of field %s"+
+						" not in its dictionary (%v)", docNum, term, field, err)
+				}
+			}, state)
+		if err != nil {
+			return fmt.Errorf("document %d: doc values: %v", docNum, err)
+		}
+		if problem != nil {
+			return problem
+		}
+	}
+	return nil
+}
+
+// RepairReport is the outcome of repairing an index.
+type RepairReport struct {
+	// Epoch is the snapshot written without the corrupt segments, or 0
+	// when the latest snapshot refers to none.
+	Epoch   uint64   `json:"epoch,omitempty"`
+	Dropped []string `json:"dropped,omitempty"`
+	// Deleted are the snapshots deleted for referring to corrupt
+	// segments, along with their tags.
+	Deleted []uint64 `json:"deleted,omitempty"`
+	// Recovered are the live documents of the dropped segments, rebuilt
+	// from their stored fields, to be indexed again.
+	Recovered []*document.Document `json:"-"`
+	// Lost counts the live documents of the dropped segments whose
+	// stored fields could not be read, and all the documents of those
+	// whose deleted bitmap could not be read.
+	Lost int `json:"lost"`
+	// Unreadable are the dropped segments whose documents could not be
+	// read at all.
+	Unreadable []string `json:"unreadable,omitempty"`
+}
+
+// droppedSegmentExt is appended to the names of the files of the
+// segments dropped by Repair, kept aside until their documents are
+// indexed again.
+const droppedSegmentExt = ".dropped"
+
+// Repair drops the corrupt segments of report, as found by Verify, from
+// the latest snapshot of the index at path, which must not be open, by
+// writing a new snapshot without them, and deletes the snapshots still
+// referring to them.  The live documents of the
+// dropped segments are rebuilt from their stored fields where these can
+// still be read, holding those fields only, to be indexed again once the
+// index is opened.  The files of the dropped segments are kept aside
+// until RemoveDroppedSegments is called, once that is done.
+func Repair(path string, config map[string]interface{},
+	report *VerifyReport) (*RepairReport, error) {
+	rv := &RepairReport{}
+	corrupt := map[string]struct{}{}
+	for _, name := range report.CorruptSegments() {
+		corrupt[name] = struct{}{}
+	}
+	if len(corrupt) == 0 {
+		return rv, nil
+	}
+
+	s, err := newOfflineScorch(path, config)
+	if err != nil {
+		return nil, err
+	}
+	rootBolt, err := openRootBolt(path, false)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rootBolt.Close()
+	}()
+
+	// the files are moved aside before the snapshots no longer refer
+	// to them, so that opening the index does not remove them
+	var moved []string
+	err = rootBolt.Update(func(tx *bolt.Tx) error {
+		err := s.repairLatestSnapshot(tx, corrupt, rv)
+		if err != nil {
+			return err
+		}
+		err = deleteCorruptSnapshots(tx, corrupt, rv)
+		if err != nil {
+			return err
+		}
+		for _, name := range rv.Dropped {
+			err = os.Rename(filepath.Join(path, name),
+				filepath.Join(path, name+droppedSegmentExt))
+			if os.IsNotExist(err) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			moved = append(moved, name)
+		}
+		return nil
+	})
+	if err == nil {
+		err = rootBolt.Sync()
+	}
+	if err != nil {
+		for _, name := range moved {
+			_ = os.Rename(filepath.Join(path, name+droppedSegmentExt),
+				filepath.Join(path, name))
+		}
+		return nil, err
+	}
+	return rv, nil
+}
+
+// RemoveDroppedSegments removes the files of the segments dropped by
+// Repair from the index at path, kept aside until the documents
+// recovered from them are indexed again.
+func RemoveDroppedSegments(path string, report *RepairReport) error {
+	for _, name := range report.Dropped {
+		err := os.Remove(filepath.Join(path, name+droppedSegmentExt))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// repairLatestSnapshot writes a snapshot younger than the latest one,
+// without its corrupt segments, recovering their documents.
+func (s *Scorch) repairLatestSnapshot(tx *bolt.Tx,
+	corrupt map[string]struct{}, rv *RepairReport) error {
+	snapshots := tx.Bucket(boltSnapshotsBucket)
+	if snapshots == nil {
+		return nil
+	}
+	k, _ := snapshots.Cursor().Last()
+	if k == nil {
+		return nil
+	}
+	_, epoch, err := decodeUvarintAscending(k)
+	if err != nil {
+		return err
+	}
+	latest := snapshots.Bucket(k)
+	if latest == nil {
+		return fmt.Errorf("snapshot key, but bucket missing %x", k)
+	}
+	plugin, encrypted, err := s.snapshotSegmentPlugin(latest)
+	if err != nil {
+		return err
+	}
+	if encrypted && s.cipher == nil {
+		return fmt.Errorf("%w: index encrypted, no encryptionKeyProvider"+
+			" configured", encryption.ErrDecrypt)
+	}
+
+	dropped := map[string]struct{}{}
+	c := latest.Cursor()
+	for k, _ := c.First(); k != nil; k, _ = c.Next() {
+		if k[0] == boltMetaDataKey[0] || k[0] == boltInternalKey[0] {
+			continue
+		}
+		segmentBucket := latest.Bucket(k)
+		if segmentBucket == nil {
+			continue
+		}
+		name := string(segmentBucket.Get(boltPathKey))
+		if _, ok := corrupt[name]; !ok {
+			continue
+		}
+		dropped[string(k)] = struct{}{}
+		rv.Dropped = append(rv.Dropped, name)
+		s.recoverSegment(plugin, name, segmentBucket, encrypted, rv)
+	}
+	if len(dropped) == 0 {
+		return nil
+	}
+
+	rv.Epoch = epoch + 1
+	snapshot, err := snapshots.CreateBucket(encodeUvarintAscending(nil, rv.Epoch))
+	if err != nil {
+		return err
+	}
+	return latest.ForEach(func(k, v []byte) error {
+		if v != nil {
+			return snapshot.Put(k, v)
+		}
+		if _, ok := dropped[string(k)]; ok {
+			return nil
+		}
+		nested, err := snapshot.CreateBucket(k)
+		if err != nil {
+			return err
+		}
+		return copyBoltBucket(latest.Bucket(k), nested)
+	})
+}
+
+// deleteCorruptSnapshots deletes the snapshots referring to corrupt
+// segments, and their tags, so the index is never rolled back to them.
+func deleteCorruptSnapshots(tx *bolt.Tx, corrupt map[string]struct{},
+	rv *RepairReport) error {
+	snapshots := tx.Bucket(boltSnapshotsBucket)
+	if snapshots == nil {
+		return nil
+	}
+	var keys [][]byte
+	deleted := map[string]struct{}{}
+	c := snapshots.Cursor()
+	for k, _ := c.First(); k != nil; k, _ = c.Next() {
+		snapshot := snapshots.Bucket(k)
+		if snapshot == nil || !refersToSegments(snapshot, corrupt) {
+			continue
+		}
+		_, epoch, err := decodeUvarintAscending(k)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, append([]byte(nil), k...))
+		deleted[string(k)] = struct{}{}
+		rv.Deleted = append(rv.Deleted, epoch)
+	}
+	for _, k := range keys {
+		err := snapshots.DeleteBucket(k)
+		if err != nil {
+			return err
+		}
+	}
+
+	tags := tx.Bucket(boltTagsBucket)
+	if tags == nil {
+		return nil
+	}
+	var names [][]byte
+	err := tags.ForEach(func(k, v []byte) error {
+		if _, ok := deleted[string(v)]; ok {
+			names = append(names, append([]byte(nil), k...))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		err = tags.Delete(name)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func refersToSegments(snapshot *bolt.Bucket, names map[string]struct{}) bool {
+	c := snapshot.Cursor()
+	for k, _ := c.First(); k != nil; k, _ = c.Next() {
+		if k[0] == boltMetaDataKey[0] || k[0] == boltInternalKey[0] {
+			continue
+		}
+		if segmentBucket := snapshot.Bucket(k); segmentBucket != nil {
+			if _, ok := names[string(segmentBucket.Get(boltPathKey))]; ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// recoverSegment rebuilds the live documents of a dropped segment from
+// their stored fields.
+func (s *Scorch) recoverSegment(plugin SegmentPlugin, name string,
+	segmentBucket *bolt.Bucket, encrypted bool, rv *RepairReport) {
+	var deleted *roaring.Bitmap
+	var deletedErr error
+	if deletedBytes := segmentBucket.Get(boltDeletedKey); deletedBytes != nil {
+		if encrypted {
+			deletedBytes, deletedErr = s.cipher.Decrypt(deletedBytes)
+		}
+		if deletedErr == nil {
+			deleted = roaring.NewBitmap()
+			_, deletedErr = deleted.ReadFrom(bytes.NewReader(deletedBytes))
+		}
+	}
+
+	seg, err := openSegmentSafely(plugin, filepath.Join(s.path, name))
+	if err != nil {
+		rv.Unreadable = append(rv.Unreadable, name)
+		return
+	}
+	defer func() {
+		_ = seg.Close()
+	}()
+	if deletedErr != nil {
+		// which documents were deleted is unknown, recovering them
+		// could bring deleted documents back
+		rv.Lost += int(seg.Count())
+		return
+	}
+
+	err = checkSafely(func(seg segment.Segment) error {
+		for docNum := uint64(0); docNum < seg.Count(); docNum++ {
+			if deleted != nil && deleted.Contains(uint32(docNum)) {
+				continue
+			}
+			doc, err := recoverDocument(seg, docNum)
+			if err != nil {
+				rv.Lost++
+				continue
+			}
+			rv.Recovered = append(rv.Recovered, doc)
+		}
+		return nil
+	}, seg)
+	if err != nil {
+		rv.Unreadable = append(rv.Unreadable, name)
+	}
+}
+
+func recoverDocument(seg segment.Segment, docNum uint64) (
+	rv *document.Document, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	id, err := seg.DocID(docNum)
+	if err != nil {
+		return nil, err
+	}
+	if len(id) == 0 {
+		return nil, fmt.Errorf("document %d: no _id", docNum)
+	}
+	rv = document.NewDocument(string(id))
+	err = seg.VisitStoredFields(docNum, func(name string, typ byte,
+		value []byte, pos []uint64) bool {
+		addStoredField(rv, name, typ, value, pos)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rv, nil
+}
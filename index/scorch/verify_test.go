@@ -0,0 +1,300 @@
+//  Copyright (c) 2024 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scorch
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/blevesearch/bleve/v2/document"
+	index "github.com/blevesearch/bleve_index_api"
+	segment "github.com/blevesearch/scorch_segment_api/v2"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestVerifyAndRepair(t *testing.T) {
+	cfg := CreateConfig("TestVerifyAndRepair")
+	err := InitTest(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := DestroyTest(cfg)
+		if err != nil {
+			t.Log(err)
+		}
+	}()
+	path := cfg["path"].(string)
+
+	analysisQueue := index.NewAnalysisQueue(1)
+	idx, err := NewScorch(Name, cfg, analysisQueue)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = idx.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ids := range [][]string{{"a", "b"}, {"c"}} {
+		batch := index.NewBatch()
+		for _, id := range ids {
+			doc := document.NewDocument(id)
+			doc.AddField(document.NewTextFieldCustom("name", []uint64{},
+				[]byte("name "+id), index.IndexField|index.StoreField|
+					index.DocValues, testAnalyzer))
+			batch.Update(doc)
+		}
+		err = idx.Batch(batch)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = idx.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := Verify(path, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Snapshots) == 0 || len(report.Segments) == 0 {
+		t.Fatalf("expected snapshots and segments verified, got %+v", report)
+	}
+	if len(report.Problems) != 0 {
+		t.Fatalf("expected no problems, got %v", report.Problems)
+	}
+
+	// the documents of a segment whose deleted bitmap is unreadable are
+	// lost, rather than maybe deleted ones recovered
+	boltDir, err := ioutil.TempDir("", "TestVerifyAndRepairDeleted")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.RemoveAll(boltDir)
+	}()
+	rootBolt, err := bolt.Open(filepath.Join(boltDir, "root.bolt"), 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = rootBolt.Update(func(tx *bolt.Tx) error {
+		segmentBucket, err := tx.CreateBucket([]byte("s"))
+		if err != nil {
+			return err
+		}
+		return segmentBucket.Put(boltDeletedKey, []byte("garbage"))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lost := &RepairReport{}
+	err = rootBolt.View(func(tx *bolt.Tx) error {
+		s := &Scorch{path: path}
+		s.recoverSegment(defaultSegmentPlugin, report.Segments[0],
+			tx.Bucket([]byte("s")), false, lost)
+		return nil
+	})
+	if cerr := rootBolt.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lost.Recovered) != 0 || lost.Lost == 0 {
+		t.Errorf("expected the documents lost, got %+v", lost)
+	}
+
+	// corrupt a byte in the middle of a segment
+	corrupt := report.Segments[len(report.Segments)-1]
+	segPath := filepath.Join(path, corrupt)
+	buf, err := ioutil.ReadFile(segPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf[len(buf)/2] ^= 0xff
+	err = ioutil.WriteFile(segPath, buf, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err = Verify(path, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := report.CorruptSegments(); !reflect.DeepEqual(got, []string{corrupt}) {
+		t.Fatalf("expected segment %s corrupt, got %v: %v",
+			corrupt, got, report.Problems)
+	}
+
+	repair, err := Repair(path, cfg, report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(repair.Dropped, []string{corrupt}) {
+		t.Errorf("expected segment %s dropped, got %v", corrupt, repair.Dropped)
+	}
+	if repair.Epoch == 0 || len(repair.Deleted) == 0 {
+		t.Errorf("expected a snapshot written and others deleted, got %+v", repair)
+	}
+	// the file of the dropped segment is kept aside until removed
+	if _, err := os.Stat(segPath + droppedSegmentExt); err != nil {
+		t.Errorf("expected segment %s kept aside, got %v", corrupt, err)
+	}
+
+	// the bytes of the documents are intact, the corruption being in
+	// another part of the segment, or they are lost
+	var recovered []string
+	for _, doc := range repair.Recovered {
+		recovered = append(recovered, doc.ID())
+		if len(doc.Fields) != 1 || doc.Fields[0].Name() != "name" ||
+			string(doc.Fields[0].Value()) != "name "+doc.ID() {
+			t.Errorf("expected document %s recovered with its name, got %v",
+				doc.ID(), doc)
+		}
+	}
+	if len(repair.Unreadable) != 0 || len(recovered)+repair.Lost == 0 {
+		t.Errorf("expected the documents recovered or lost, got %+v", repair)
+	}
+
+	report, err = Verify(path, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Problems) != 0 {
+		t.Fatalf("expected no problems after repair, got %v", report.Problems)
+	}
+
+	idx, err = NewScorch(Name, cfg, analysisQueue)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = idx.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader, err := idx.Reader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, id := range []string{"a", "b", "c"} {
+		doc, err := reader.Document(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if doc != nil {
+			ids = append(ids, id)
+		}
+	}
+	ids = append(ids, recovered...)
+	sort.Strings(ids)
+	if repair.Lost == 0 && !reflect.DeepEqual(ids, []string{"a", "b", "c"}) {
+		t.Errorf("expected the documents kept or recovered, got %v", ids)
+	}
+	err = reader.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = idx.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(segPath + droppedSegmentExt); err != nil {
+		t.Errorf("expected segment %s still kept aside once opened, got %v",
+			corrupt, err)
+	}
+	err = RemoveDroppedSegments(path, repair)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(segPath + droppedSegmentExt); !os.IsNotExist(err) {
+		t.Errorf("expected segment %s removed, got %v", corrupt, err)
+	}
+}
+
+// truncatedDictSegment is a segment whose dictionaries fail once their
+// first term has been read, as if they were truncated.
+type truncatedDictSegment struct {
+	segment.Segment
+}
+
+func (s *truncatedDictSegment) Dictionary(field string) (segment.TermDictionary, error) {
+	dict, err := s.Segment.Dictionary(field)
+	if err != nil {
+		return nil, err
+	}
+	return &truncatedDict{TermDictionary: dict}, nil
+}
+
+type truncatedDict struct {
+	segment.TermDictionary
+}
+
+func (d *truncatedDict) AutomatonIterator(a segment.Automaton,
+	startKeyInclusive, endKeyExclusive []byte) segment.DictionaryIterator {
+	return &truncatedDictIterator{
+		DictionaryIterator: d.TermDictionary.AutomatonIterator(a,
+			startKeyInclusive, endKeyExclusive),
+	}
+}
+
+type truncatedDictIterator struct {
+	segment.DictionaryIterator
+	read bool
+}
+
+func (i *truncatedDictIterator) Next() (*index.DictEntry, error) {
+	if i.read {
+		return nil, fmt.Errorf("unexpected end of dictionary")
+	}
+	i.read = true
+	return i.DictionaryIterator.Next()
+}
+
+func TestVerifyPostingsTruncatedDictionary(t *testing.T) {
+	var docs []index.Document
+	for _, id := range []string{"a", "b"} {
+		doc := document.NewDocument(id)
+		doc.AddField(document.NewTextFieldCustom("name", []uint64{},
+			[]byte("name "+id), index.IndexField|index.StoreField, testAnalyzer))
+		doc.AddIDField()
+		analyze(doc)
+		docs = append(docs, doc)
+	}
+	seg, _, err := defaultSegmentPlugin.New(docs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = seg.Close()
+	}()
+
+	err = verifyPostings(seg)
+	if err != nil {
+		t.Fatalf("expected postings verified, got %v", err)
+	}
+	err = verifyPostings(&truncatedDictSegment{Segment: seg})
+	if err == nil || !strings.Contains(err.Error(), "unexpected end of dictionary") {
+		t.Errorf("expected truncated dictionary error, got %v", err)
+	}
+}
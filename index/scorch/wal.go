@@ -0,0 +1,691 @@
+//  Copyright (c) 2024 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scorch
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/blevesearch/bleve/v2/index/encryption"
+	index "github.com/blevesearch/bleve_index_api"
+	bolt "go.etcd.io/bbolt"
+)
+
+// The write-ahead log of an index configured with "writeAheadLog" set to
+// true records each batch commit before it is introduced, so the batches
+// not persisted yet are replayed when the index is opened after a crash.
+// It lives in the wal directory of the index, in files named by the
+// sequence number of their first record, each record framed as:
+//
+//	length uint32 | crc32 uint32 | seq uint64 | JSON walRecord
+//
+// where the crc covers the sequence number and the record.  A batch whose
+// introduction failed after its record was appended is followed by an
+// abort record, flagged in the high bit of its length, which holds the
+// sequence number of that record so that it is not replayed.  The
+// sequence number of the last record included in a persisted snapshot is
+// stored in its metadata, the files holding only older records are
+// removed.
+
+const walDirName = "wal"
+
+const walFileExt = ".wal"
+
+const walHeaderLen = 16
+
+const walAbortFlag = 1 << 31
+
+// WALFileSize is the size past which a new write-ahead log file is
+// started, so the older ones can be removed once persisted.
+var WALFileSize int64 = 16 << 20
+
+var boltMetaDataWALSeqKey = []byte("walSeq")
+
+type walRecord struct {
+	Docs     []*walDocument    `json:"docs,omitempty"`
+	IDs      []string          `json:"ids,omitempty"`
+	Internal map[string][]byte `json:"internal,omitempty"`
+	Changes  []*ChangeRecord   `json:"changes,omitempty"`
+}
+
+// encodeWALRecord encodes c, encrypted when cipher is set, as the
+// record holds the documents in plain.
+func encodeWALRecord(c *batchCommit, cipher *encryption.Cipher) ([]byte, error) {
+	rec := &walRecord{
+		Docs:     make([]*walDocument, 0, len(c.results)),
+		IDs:      c.ids,
+		Internal: c.internal,
+		Changes:  c.changes,
+	}
+	for _, doc := range c.results {
+		rec.Docs = append(rec.Docs, newWALDocument(doc))
+	}
+	buf, err := json.Marshal(rec)
+	if err != nil {
+		return nil, err
+	}
+	return encryptValue(cipher, buf)
+}
+
+func decodeWALRecord(buf []byte, cipher *encryption.Cipher) (*batchCommit, error) {
+	buf, err := decryptValue(cipher, buf)
+	if err != nil {
+		return nil, err
+	}
+	var rec walRecord
+	err = json.Unmarshal(buf, &rec)
+	if err != nil {
+		return nil, err
+	}
+	rv := &batchCommit{
+		results:  make([]index.Document, 0, len(rec.Docs)),
+		ids:      rec.IDs,
+		internal: rec.Internal,
+		changes:  rec.Changes,
+	}
+	for _, doc := range rec.Docs {
+		rv.results = append(rv.results, doc)
+	}
+	return rv, nil
+}
+
+// walDocument is an analyzed document as recorded in the write-ahead
+// log, ready to be written to a segment again.
+type walDocument struct {
+	DocID      string      `json:"id"`
+	Fields     []*walField `json:"fields,omitempty"`
+	Composites []*walField `json:"composites,omitempty"`
+}
+
+func newWALDocument(doc index.Document) *walDocument {
+	rv := &walDocument{
+		DocID: doc.ID(),
+	}
+	doc.VisitFields(func(field index.Field) {
+		rv.Fields = append(rv.Fields, newWALField(field))
+	})
+	doc.VisitComposite(func(field index.CompositeField) {
+		rv.Composites = append(rv.Composites, newWALField(field))
+	})
+	return rv
+}
+
+func (d *walDocument) ID() string {
+	return d.DocID
+}
+
+func (d *walDocument) Size() int {
+	rv := len(d.DocID)
+	for _, f := range d.Fields {
+		rv += f.size()
+	}
+	for _, f := range d.Composites {
+		rv += f.size()
+	}
+	return rv
+}
+
+func (d *walDocument) VisitFields(visitor index.FieldVisitor) {
+	for _, f := range d.Fields {
+		visitor(f)
+	}
+}
+
+func (d *walDocument) VisitComposite(visitor index.CompositeFieldVisitor) {
+	for _, f := range d.Composites {
+		visitor(f)
+	}
+}
+
+func (d *walDocument) HasComposite() bool {
+	return len(d.Composites) > 0
+}
+
+func (d *walDocument) NumPlainTextBytes() uint64 {
+	var rv uint64
+	for _, f := range d.Fields {
+		rv += f.NumPlainText
+	}
+	return rv
+}
+
+// AddIDField does nothing, the _id field was recorded with the others.
+func (d *walDocument) AddIDField() {}
+
+// walField is an analyzed field as recorded in the write-ahead log.  It
+// is already analyzed, and composed for a composite field.
+type walField struct {
+	FieldName    string                     `json:"name"`
+	FieldValue   []byte                     `json:"value,omitempty"`
+	Positions    []uint64                   `json:"array_positions,omitempty"`
+	Type         byte                       `json:"type"`
+	FieldOptions index.FieldIndexingOptions `json:"options"`
+	Length       int                        `json:"length"`
+	Freqs        []*walTokenFreq            `json:"freqs,omitempty"`
+	NumPlainText uint64                     `json:"num_plain_text_bytes"`
+
+	tfs index.TokenFrequencies
+}
+
+type walTokenFreq struct {
+	Term      []byte                 `json:"term"`
+	Frequency int                    `json:"freq"`
+	Locations []*index.TokenLocation `json:"locations,omitempty"`
+}
+
+func newWALField(field index.Field) *walField {
+	rv := &walField{
+		FieldName:    field.Name(),
+		FieldValue:   field.Value(),
+		Positions:    field.ArrayPositions(),
+		Type:         field.EncodedFieldType(),
+		FieldOptions: field.Options(),
+		Length:       field.AnalyzedLength(),
+		NumPlainText: field.NumPlainTextBytes(),
+	}
+	for _, tf := range field.AnalyzedTokenFrequencies() {
+		rv.Freqs = append(rv.Freqs, &walTokenFreq{
+			Term:      tf.Term,
+			Frequency: tf.Frequency(),
+			Locations: tf.Locations,
+		})
+	}
+	return rv
+}
+
+func (f *walField) Name() string { return f.FieldName }
+
+func (f *walField) Value() []byte { return f.FieldValue }
+
+func (f *walField) ArrayPositions() []uint64 { return f.Positions }
+
+func (f *walField) EncodedFieldType() byte { return f.Type }
+
+func (f *walField) Analyze() {}
+
+func (f *walField) Options() index.FieldIndexingOptions { return f.FieldOptions }
+
+func (f *walField) AnalyzedLength() int { return f.Length }
+
+func (f *walField) AnalyzedTokenFrequencies() index.TokenFrequencies {
+	if f.tfs == nil && len(f.Freqs) > 0 {
+		f.tfs = make(index.TokenFrequencies, len(f.Freqs))
+		for _, freq := range f.Freqs {
+			tf := &index.TokenFreq{
+				Term:      freq.Term,
+				Locations: freq.Locations,
+			}
+			tf.SetFrequency(freq.Frequency)
+			f.tfs[string(freq.Term)] = tf
+		}
+	}
+	return f.tfs
+}
+
+func (f *walField) NumPlainTextBytes() uint64 { return f.NumPlainText }
+
+// Compose does nothing, the field was recorded once composed.
+func (f *walField) Compose(field string, length int, freq index.TokenFrequencies) {}
+
+func (f *walField) size() int {
+	rv := len(f.FieldName) + len(f.FieldValue) + 8*len(f.Positions)
+	for _, freq := range f.Freqs {
+		rv += len(freq.Term) + 8
+		for _, loc := range freq.Locations {
+			rv += loc.Size()
+		}
+	}
+	return rv
+}
+
+// writeAheadLog appends the records of the batch commits to the files of
+// a write-ahead log directory.
+type writeAheadLog struct {
+	synced uint64 // Sequence number of the last synced record.
+
+	path     string
+	syncLock sync.Mutex // Serializes the syncs, merging concurrent ones.
+
+	m        sync.Mutex // Protects the fields below.
+	f        *os.File
+	fileSeqs []uint64 // First sequence numbers of the files, ascending.
+	size     int64    // Size of f.
+	seq      uint64   // Sequence number of the last record.
+}
+
+func walFileName(seq uint64) string {
+	return fmt.Sprintf("%016x%s", seq, walFileExt)
+}
+
+// openWriteAheadLog opens the write-ahead log in the directory path,
+// calling replay with the records past persistedSeq, in order.  A
+// record torn by a crash ends its file.
+func openWriteAheadLog(path string, persistedSeq uint64,
+	replay func(seq uint64, buf []byte) error) (*writeAheadLog, error) {
+	err := os.MkdirAll(path, 0700)
+	if err != nil {
+		return nil, err
+	}
+	finfos, err := ioutil.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+
+	rv := &writeAheadLog{
+		path: path,
+		seq:  persistedSeq,
+	}
+	aborted := make(map[uint64]struct{})
+	for _, finfo := range finfos {
+		name := finfo.Name()
+		if filepath.Ext(name) != walFileExt {
+			continue
+		}
+		fileSeq, err := strconv.ParseUint(strings.TrimSuffix(name, walFileExt), 16, 64)
+		if err != nil {
+			continue
+		}
+		rv.fileSeqs = append(rv.fileSeqs, fileSeq)
+	}
+	sort.Slice(rv.fileSeqs, func(i, j int) bool {
+		return rv.fileSeqs[i] < rv.fileSeqs[j]
+	})
+
+	// the abort records follow the records they abort, so they are all
+	// read before replaying any
+	for _, fileSeq := range rv.fileSeqs {
+		err = readWALFile(filepath.Join(path, walFileName(fileSeq)),
+			func(seq uint64, buf []byte, abort bool) error {
+				if abort && len(buf) == 8 {
+					aborted[binary.BigEndian.Uint64(buf)] = struct{}{}
+				}
+				return nil
+			})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, fileSeq := range rv.fileSeqs {
+		err = readWALFile(filepath.Join(path, walFileName(fileSeq)),
+			func(seq uint64, buf []byte, abort bool) error {
+				if seq <= persistedSeq {
+					return nil
+				}
+				if seq != rv.seq+1 {
+					return fmt.Errorf("write-ahead log record %d follows %d", seq, rv.seq)
+				}
+				rv.seq = seq
+				if _, ok := aborted[seq]; abort || ok {
+					return nil
+				}
+				return replay(seq, buf)
+			})
+		if err != nil {
+			return nil, err
+		}
+	}
+	rv.synced = rv.seq
+
+	// records are appended to a new file, past a possibly torn record
+	err = rv.startFile()
+	if err != nil {
+		return nil, err
+	}
+	return rv, nil
+}
+
+func readWALFile(path string, cb func(seq uint64, buf []byte, abort bool) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	r := bufio.NewReader(f)
+	header := make([]byte, walHeaderLen)
+	for {
+		_, err = io.ReadFull(r, header)
+		if err != nil {
+			// the end of the file, or a torn header
+			return nil
+		}
+		length := binary.BigEndian.Uint32(header[0:4])
+		abort := length&walAbortFlag != 0
+		length &^= walAbortFlag
+		crc := binary.BigEndian.Uint32(header[4:8])
+		if length > 1<<30 {
+			// a torn length
+			return nil
+		}
+		buf := make([]byte, length)
+		_, err = io.ReadFull(r, buf)
+		if err != nil {
+			return nil
+		}
+		if crc32.Update(crc32.ChecksumIEEE(header[8:]), crc32.IEEETable, buf) != crc {
+			return nil
+		}
+		err = cb(binary.BigEndian.Uint64(header[8:]), buf, abort)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// startFile starts a new file for the records past the last one.
+// Called with m held, or before the log is shared.
+func (w *writeAheadLog) startFile() error {
+	fileSeq := w.seq + 1
+	f, err := os.OpenFile(filepath.Join(w.path, walFileName(fileSeq)),
+		os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	w.f = f
+	w.size = 0
+	w.fileSeqs = append(w.fileSeqs, fileSeq)
+	return nil
+}
+
+// append writes the record buf to the log, without syncing it, and
+// returns its sequence number.
+func (w *writeAheadLog) append(buf []byte) (uint64, error) {
+	return w.appendFrame(buf, 0)
+}
+
+// abort writes an abort record for the record seq, whose batch failed to
+// be introduced, and syncs it along with the records before.
+func (w *writeAheadLog) abort(seq uint64) error {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, seq)
+	abortSeq, err := w.appendFrame(buf, walAbortFlag)
+	if err != nil {
+		return err
+	}
+	return w.sync(abortSeq)
+}
+
+func (w *writeAheadLog) appendFrame(buf []byte, flags uint32) (uint64, error) {
+	w.m.Lock()
+	defer w.m.Unlock()
+
+	if w.f == nil {
+		return 0, ErrClosed
+	}
+	if w.size >= WALFileSize {
+		// the records of the full file are synced once, so syncing the
+		// new file covers them too
+		err := w.f.Sync()
+		if err != nil {
+			return 0, err
+		}
+		storeMaxUint64(&w.synced, w.seq)
+		err = w.f.Close()
+		if err != nil {
+			return 0, err
+		}
+		err = w.startFile()
+		if err != nil {
+			w.f = nil
+			return 0, err
+		}
+	}
+
+	seq := w.seq + 1
+	frame := make([]byte, walHeaderLen+len(buf))
+	binary.BigEndian.PutUint32(frame[0:4], uint32(len(buf))|flags)
+	binary.BigEndian.PutUint64(frame[8:16], seq)
+	copy(frame[walHeaderLen:], buf)
+	binary.BigEndian.PutUint32(frame[4:8], crc32.ChecksumIEEE(frame[8:]))
+
+	n, err := w.f.Write(frame)
+	w.size += int64(n)
+	if err != nil {
+		return 0, err
+	}
+	w.seq = seq
+	return seq, nil
+}
+
+// sync makes the records up to seq durable, along with the others
+// appended meanwhile.
+func (w *writeAheadLog) sync(seq uint64) error {
+	if atomic.LoadUint64(&w.synced) >= seq {
+		return nil
+	}
+	w.syncLock.Lock()
+	defer w.syncLock.Unlock()
+	if atomic.LoadUint64(&w.synced) >= seq {
+		return nil
+	}
+
+	w.m.Lock()
+	f, last := w.f, w.seq
+	w.m.Unlock()
+	if f == nil {
+		return ErrClosed
+	}
+
+	err := f.Sync()
+	if errors.Is(err, os.ErrClosed) {
+		// the file was synced when it was closed, else the records it
+		// holds were all persisted by then
+		err = nil
+	}
+	if err != nil {
+		return err
+	}
+	storeMaxUint64(&w.synced, last)
+	return nil
+}
+
+// truncate removes the files holding only records up to seq, which are
+// persisted.
+func (w *writeAheadLog) truncate(seq uint64) error {
+	w.m.Lock()
+	defer w.m.Unlock()
+
+	if w.f == nil {
+		return nil
+	}
+	if w.seq <= seq && w.size > 0 {
+		// every record is persisted, start over with an empty file
+		err := w.f.Close()
+		if err != nil {
+			return err
+		}
+		storeMaxUint64(&w.synced, w.seq)
+		err = w.startFile()
+		if err != nil {
+			w.f = nil
+			return err
+		}
+	}
+
+	n := 0
+	for n < len(w.fileSeqs)-1 && w.fileSeqs[n+1] <= seq+1 {
+		err := os.Remove(filepath.Join(w.path, walFileName(w.fileSeqs[n])))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		n++
+	}
+	w.fileSeqs = w.fileSeqs[n:]
+	return nil
+}
+
+func (w *writeAheadLog) close() error {
+	w.m.Lock()
+	defer w.m.Unlock()
+
+	if w.f == nil {
+		return nil
+	}
+	err := w.f.Sync()
+	if cerr := w.f.Close(); err == nil {
+		err = cerr
+	}
+	w.f = nil
+	return err
+}
+
+func storeMaxUint64(addr *uint64, val uint64) {
+	for {
+		old := atomic.LoadUint64(addr)
+		if old >= val || atomic.CompareAndSwapUint64(addr, old, val) {
+			return
+		}
+	}
+}
+
+// openWAL opens the write-ahead log of the index, replaying the batches
+// it holds which are not persisted yet.  When the log is not enabled,
+// the batches left by a log enabled before are replayed and persisted,
+// then the log is removed.
+func (s *Scorch) openWAL() error {
+	path := filepath.Join(s.path, walDirName)
+	if !s.writeAheadLog {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			return nil
+		}
+	}
+
+	durability := DurabilityMemory
+	if !s.writeAheadLog {
+		durability = DurabilityPersisted
+	}
+	s.rootLock.RLock()
+	persistedSeq := s.walPersistedSeq
+	s.rootLock.RUnlock()
+
+	wal, err := openWriteAheadLog(path, persistedSeq,
+		func(seq uint64, buf []byte) error {
+			c, err := decodeWALRecord(buf, s.cipher)
+			if err != nil {
+				return fmt.Errorf("write-ahead log record %d: %v", seq, err)
+			}
+			c.walSeq = seq
+			c.durability = durability
+			atomic.AddUint64(&s.stats.TotWALReplayed, 1)
+			return s.commit(c, nil)
+		})
+	if err != nil {
+		return err
+	}
+
+	if !s.writeAheadLog {
+		err = wal.close()
+		if err != nil {
+			return err
+		}
+		return os.RemoveAll(path)
+	}
+	// the persister may already have persisted the records replayed
+	s.rootLock.Lock()
+	s.wal = wal
+	persistedSeq = s.walPersistedSeq
+	s.rootLock.Unlock()
+	return wal.truncate(persistedSeq)
+}
+
+// walSeqUpTo returns the sequence number of the last write-ahead log
+// record included in the snapshot of the given epoch.
+func (s *Scorch) walSeqUpTo(epoch uint64) uint64 {
+	s.rootLock.RLock()
+	defer s.rootLock.RUnlock()
+
+	rv := s.walPersistedSeq
+	for _, mark := range s.walMarks {
+		if mark.epoch > epoch {
+			break
+		}
+		rv = mark.seq
+	}
+	return rv
+}
+
+// walPersisted drops the write-ahead log records up to seq, now
+// persisted.
+func (s *Scorch) walPersisted(seq uint64) {
+	s.rootLock.Lock()
+	n := 0
+	for n < len(s.walMarks) && s.walMarks[n].seq <= seq {
+		n++
+	}
+	s.walMarks = s.walMarks[n:]
+	s.walPersistedSeq = seq
+	wal := s.wal
+	s.rootLock.Unlock()
+
+	if wal != nil {
+		err := wal.truncate(seq)
+		if err != nil {
+			s.fireAsyncError(fmt.Errorf("error truncating write-ahead log: %v", err))
+		}
+	}
+}
+
+// walMark records the epoch of the snapshot including a write-ahead log
+// record.
+type walMark struct {
+	epoch uint64
+	seq   uint64
+}
+
+func prepareBoltWALSeq(tx *bolt.Tx, epoch, seq uint64) error {
+	snapshots := tx.Bucket(boltSnapshotsBucket)
+	if snapshots == nil {
+		return nil
+	}
+	snapshot := snapshots.Bucket(encodeUvarintAscending(nil, epoch))
+	if snapshot == nil {
+		return nil
+	}
+	metaBucket := snapshot.Bucket(boltMetaDataKey)
+	if metaBucket == nil {
+		return nil
+	}
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, seq)
+	return metaBucket.Put(boltMetaDataWALSeqKey, buf)
+}
+
+func loadBoltWALSeq(snapshot *bolt.Bucket) uint64 {
+	metaBucket := snapshot.Bucket(boltMetaDataKey)
+	if metaBucket == nil {
+		return 0
+	}
+	buf := metaBucket.Get(boltMetaDataWALSeqKey)
+	if len(buf) != 8 {
+		return 0
+	}
+	return binary.BigEndian.Uint64(buf)
+}
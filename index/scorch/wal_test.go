@@ -0,0 +1,248 @@
+//  Copyright (c) 2024 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scorch
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/blevesearch/bleve/v2/document"
+	index "github.com/blevesearch/bleve_index_api"
+)
+
+func TestIndexWriteAheadLog(t *testing.T) {
+	cfg := CreateConfig("TestIndexWriteAheadLog")
+	err := InitTest(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := DestroyTest(cfg)
+		if err != nil {
+			t.Log(err)
+		}
+	}()
+	walPath := filepath.Join(cfg["path"].(string), walDirName)
+
+	analysisQueue := index.NewAnalysisQueue(1)
+	open := func(cfg map[string]interface{}) *Scorch {
+		idx, err := NewScorch(Name, cfg, analysisQueue)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = idx.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return idx.(*Scorch)
+	}
+	check := func(idx *Scorch) {
+		reader, err := idx.Reader()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() {
+			err := reader.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+		}()
+		count, err := reader.DocCount()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if count != 1 {
+			t.Errorf("expected 1 document, got %d", count)
+		}
+		tfr, err := reader.TermFieldReader([]byte("replayed"), "name", true, true, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tfr.Count() != 1 {
+			t.Errorf("expected 1 document with the term replayed, got %d", tfr.Count())
+		}
+		err = tfr.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		val, err := reader.GetInternal([]byte("k"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(val) != "v" {
+			t.Errorf("expected internal value v, got %q", val)
+		}
+	}
+
+	// open the index without its persister, so the batches are only in
+	// memory and in the log when it is closed, as if it had crashed
+	cfg["writeAheadLog"] = true
+	cfg["durability"] = "memory"
+	crashedIdx, err := NewScorch(Name, cfg, analysisQueue)
+	if err != nil {
+		t.Fatal(err)
+	}
+	crashed := crashedIdx.(*Scorch)
+	err = crashed.openBolt()
+	if err != nil {
+		t.Fatal(err)
+	}
+	crashed.asyncTasks.Add(1)
+	go crashed.introducerLoop()
+	err = crashed.openWAL()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"a", "b"} {
+		batch := index.NewBatch()
+		doc := document.NewDocument(id)
+		doc.AddField(document.NewTextFieldWithAnalyzer("name", []uint64{},
+			[]byte("replayed"), testAnalyzer))
+		batch.Update(doc)
+		err = crashed.Batch(batch)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	batch := index.NewBatch()
+	batch.Delete("a")
+	batch.SetInternal([]byte("k"), []byte("v"))
+	err = crashed.BatchWithDurability(batch, DurabilityFsync)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(crashed)
+	err = crashed.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a torn record ends the log
+	finfos, err := ioutil.ReadDir(walPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.OpenFile(filepath.Join(walPath, finfos[len(finfos)-1].Name()),
+		os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = f.Write([]byte{0, 0, 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	delete(cfg, "durability")
+	idx := open(cfg)
+	if n := atomic.LoadUint64(&idx.stats.TotWALReplayed); n != 3 {
+		t.Errorf("expected 3 batches replayed, got %d", n)
+	}
+	check(idx)
+
+	// once persisted, the records are dropped
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		finfos, err = ioutil.ReadDir(walPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(finfos) == 1 && finfos[0].Size() == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the log truncated, got %d files", len(finfos))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	err = idx.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the log is removed once disabled
+	delete(cfg, "writeAheadLog")
+	idx = open(cfg)
+	check(idx)
+	err = idx.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(walPath); !os.IsNotExist(err) {
+		t.Errorf("expected the log removed, got %v", err)
+	}
+}
+
+func TestWriteAheadLogAbort(t *testing.T) {
+	path, err := ioutil.TempDir("", "TestWriteAheadLogAbort")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.RemoveAll(path)
+	}()
+
+	var replayed []string
+	open := func() *writeAheadLog {
+		replayed = nil
+		wal, err := openWriteAheadLog(path, 0, func(seq uint64, buf []byte) error {
+			replayed = append(replayed, string(buf))
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return wal
+	}
+
+	wal := open()
+	for _, rec := range []string{"a", "b", "c"} {
+		_, err = wal.append([]byte(rec))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = wal.abort(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seq, err := wal.append([]byte("d"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if seq != 5 {
+		t.Errorf("expected the abort record to take sequence number 4, got %d next", seq)
+	}
+	err = wal.close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wal = open()
+	defer func() {
+		_ = wal.close()
+	}()
+	if !reflect.DeepEqual(replayed, []string{"a", "c", "d"}) {
+		t.Errorf("expected the aborted record skipped, got %v", replayed)
+	}
+}
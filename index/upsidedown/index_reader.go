@@ -181,6 +181,27 @@ func (i *IndexReader) GetInternal(key []byte) ([]byte, error) {
 	return i.kvreader.Get(internalRow.Key())
 }
 
+// VisitInternal visits each internal key and value, stopping at the first
+// error returned by the visitor.
+func (i *IndexReader) VisitInternal(visitor func(key, val []byte) error) (err error) {
+	it := i.kvreader.PrefixIterator([]byte{'i'})
+	defer func() {
+		if cerr := it.Close(); err == nil && cerr != nil {
+			err = cerr
+		}
+	}()
+	key, val, valid := it.Current()
+	for valid {
+		err = visitor(append([]byte(nil), key[1:]...), append([]byte(nil), val...))
+		if err != nil {
+			return
+		}
+		it.Next()
+		key, val, valid = it.Current()
+	}
+	return
+}
+
 func (i *IndexReader) DocCount() (uint64, error) {
 	return i.docCount, nil
 }
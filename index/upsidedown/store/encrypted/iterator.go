@@ -0,0 +1,74 @@
+//  Copyright (c) 2024 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package encrypted
+
+import store "github.com/blevesearch/upsidedown_store_api"
+
+// Iterator decrypts the values it iterates over.  A value which cannot be
+// decrypted, lacking its key or not authentic, ends the iteration.
+type Iterator struct {
+	s   *Store
+	o   store.KVIterator
+	err error
+}
+
+func (i *Iterator) Seek(x []byte) {
+	i.o.Seek(x)
+}
+
+func (i *Iterator) Next() {
+	i.o.Next()
+}
+
+func (i *Iterator) Current() ([]byte, []byte, bool) {
+	k, v, ok := i.o.Current()
+	if !ok {
+		return nil, nil, false
+	}
+	v, err := i.s.decrypt(v)
+	if err != nil {
+		i.err = err
+		return nil, nil, false
+	}
+	return k, v, true
+}
+
+func (i *Iterator) Key() []byte {
+	return i.o.Key()
+}
+
+func (i *Iterator) Value() []byte {
+	v, err := i.s.decrypt(i.o.Value())
+	if err != nil {
+		i.err = err
+		return nil
+	}
+	return v
+}
+
+func (i *Iterator) Valid() bool {
+	if i.err != nil {
+		return false
+	}
+	return i.o.Valid()
+}
+
+func (i *Iterator) Close() error {
+	err := i.o.Close()
+	if err == nil {
+		err = i.err
+	}
+	return err
+}
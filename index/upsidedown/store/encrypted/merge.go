@@ -0,0 +1,75 @@
+//  Copyright (c) 2024 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package encrypted
+
+import (
+	"github.com/blevesearch/bleve/v2/index/encryption"
+	store "github.com/blevesearch/upsidedown_store_api"
+)
+
+// mergeOperator merges the encrypted values stored by the underlying
+// store, decrypting them for the real merge operator, then encrypting
+// its result.
+type mergeOperator struct {
+	o      store.MergeOperator
+	cipher *encryption.Cipher
+}
+
+func (m *mergeOperator) decrypt(val []byte) ([]byte, bool) {
+	if !encryption.IsEncrypted(val) {
+		return val, true
+	}
+	val, err := m.cipher.Decrypt(val)
+	return val, err == nil
+}
+
+func (m *mergeOperator) encrypt(val []byte, ok bool) ([]byte, bool) {
+	if !ok || len(val) == 0 {
+		return val, ok
+	}
+	val, err := m.cipher.Encrypt(val)
+	return val, err == nil
+}
+
+func (m *mergeOperator) FullMerge(key, existingValue []byte, operands [][]byte) ([]byte, bool) {
+	existingValue, ok := m.decrypt(existingValue)
+	if !ok {
+		return nil, false
+	}
+	plainOperands := make([][]byte, len(operands))
+	for i, operand := range operands {
+		plainOperands[i], ok = m.decrypt(operand)
+		if !ok {
+			return nil, false
+		}
+	}
+	return m.encrypt(m.o.FullMerge(key, existingValue, plainOperands))
+}
+
+func (m *mergeOperator) PartialMerge(key, leftOperand, rightOperand []byte) ([]byte, bool) {
+	leftOperand, ok := m.decrypt(leftOperand)
+	if !ok {
+		return nil, false
+	}
+	rightOperand, ok = m.decrypt(rightOperand)
+	if !ok {
+		return nil, false
+	}
+	return m.encrypt(m.o.PartialMerge(key, leftOperand, rightOperand))
+}
+
+func (m *mergeOperator) Name() string {
+	return m.o.Name()
+}
@@ -0,0 +1,56 @@
+//  Copyright (c) 2024 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package encrypted
+
+import store "github.com/blevesearch/upsidedown_store_api"
+
+type Reader struct {
+	s *Store
+	o store.KVReader
+}
+
+func (r *Reader) Get(key []byte) ([]byte, error) {
+	v, err := r.o.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	return r.s.decrypt(v)
+}
+
+func (r *Reader) MultiGet(keys [][]byte) ([][]byte, error) {
+	vals, err := r.o.MultiGet(keys)
+	if err != nil {
+		return nil, err
+	}
+	for i, v := range vals {
+		vals[i], err = r.s.decrypt(v)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return vals, nil
+}
+
+func (r *Reader) PrefixIterator(prefix []byte) store.KVIterator {
+	return &Iterator{s: r.s, o: r.o.PrefixIterator(prefix)}
+}
+
+func (r *Reader) RangeIterator(start, end []byte) store.KVIterator {
+	return &Iterator{s: r.s, o: r.o.RangeIterator(start, end)}
+}
+
+func (r *Reader) Close() error {
+	return r.o.Close()
+}
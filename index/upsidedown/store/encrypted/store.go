@@ -0,0 +1,126 @@
+//  Copyright (c) 2024 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package encrypted provides a KVStore implementation that wraps another,
+// real KVStore implementation, encrypting the values it stores with
+// AES-GCM, using the keys of the key provider registered under the name
+// given by "encryptionKeyProvider".
+//
+// Keys are stored as they are, as the index relies on their order, so the
+// terms and document IDs making up the keys of an upsidedown index are
+// not encrypted.  Values are encrypted with the current key as they are
+// written; values written with a key since rotated out are read as long
+// as the provider keeps that key, and values written before the store was
+// wrapped are read as they are.
+package encrypted
+
+import (
+	"fmt"
+
+	"github.com/blevesearch/bleve/v2/index/encryption"
+	"github.com/blevesearch/bleve/v2/registry"
+	store "github.com/blevesearch/upsidedown_store_api"
+)
+
+const Name = "encrypted"
+
+type Store struct {
+	o      store.KVStore
+	cipher *encryption.Cipher
+}
+
+func New(mo store.MergeOperator, config map[string]interface{}) (store.KVStore, error) {
+
+	name, ok := config["kvStoreName_actual"].(string)
+	if !ok || name == "" {
+		return nil, fmt.Errorf("encrypted: missing kvStoreName_actual,"+
+			" config: %#v", config)
+	}
+
+	if name == Name {
+		return nil, fmt.Errorf("encrypted: circular kvStoreName_actual")
+	}
+
+	kpName, ok := config["encryptionKeyProvider"].(string)
+	if !ok || kpName == "" {
+		return nil, fmt.Errorf("encrypted: missing encryptionKeyProvider")
+	}
+	kp := encryption.KeyProviderByName(kpName)
+	if kp == nil {
+		return nil, fmt.Errorf("encrypted: no key provider registered,"+
+			" encryptionKeyProvider: %s", kpName)
+	}
+
+	ctr := registry.KVStoreConstructorByName(name)
+	if ctr == nil {
+		return nil, fmt.Errorf("encrypted: no kv store constructor,"+
+			" kvStoreName_actual: %s", name)
+	}
+
+	rv := &Store{
+		cipher: encryption.NewCipher(kp),
+	}
+
+	// the underlying store merges the values it stores, encrypted
+	if mo != nil {
+		mo = &mergeOperator{o: mo, cipher: rv.cipher}
+	}
+
+	kvs, err := ctr(mo, config)
+	if err != nil {
+		return nil, err
+	}
+	rv.o = kvs
+
+	return rv, nil
+}
+
+func init() {
+	registry.RegisterKVStore(Name, New)
+}
+
+func (s *Store) Close() error {
+	return s.o.Close()
+}
+
+func (s *Store) Reader() (store.KVReader, error) {
+	o, err := s.o.Reader()
+	if err != nil {
+		return nil, err
+	}
+	return &Reader{s: s, o: o}, nil
+}
+
+func (s *Store) Writer() (store.KVWriter, error) {
+	o, err := s.o.Writer()
+	if err != nil {
+		return nil, err
+	}
+	return &Writer{s: s, o: o}, nil
+}
+
+// encrypt returns val encrypted, empty values being stored as they are.
+func (s *Store) encrypt(val []byte) ([]byte, error) {
+	if len(val) == 0 {
+		return val, nil
+	}
+	return s.cipher.Encrypt(val)
+}
+
+func (s *Store) decrypt(val []byte) ([]byte, error) {
+	if !encryption.IsEncrypted(val) {
+		return val, nil
+	}
+	return s.cipher.Decrypt(val)
+}
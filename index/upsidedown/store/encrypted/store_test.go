@@ -0,0 +1,146 @@
+//  Copyright (c) 2024 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package encrypted
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/blevesearch/bleve/v2/index/encryption"
+	"github.com/blevesearch/bleve/v2/index/upsidedown/store/gtreap"
+	store "github.com/blevesearch/upsidedown_store_api"
+	"github.com/blevesearch/upsidedown_store_api/test"
+)
+
+func init() {
+	keyring := encryption.NewKeyring()
+	err := keyring.AddKey("test", bytes.Repeat([]byte{1}, 32), true)
+	if err != nil {
+		panic(err)
+	}
+	encryption.RegisterKeyProvider("test", keyring)
+}
+
+func open(t *testing.T, mo store.MergeOperator) store.KVStore {
+	rv, err := New(mo, map[string]interface{}{
+		"kvStoreName_actual":    gtreap.Name,
+		"encryptionKeyProvider": "test",
+		"path":                  "",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rv
+}
+
+func cleanup(t *testing.T, s store.KVStore) {
+	err := s.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEncryptedKVCrud(t *testing.T) {
+	s := open(t, nil)
+	defer cleanup(t, s)
+	test.CommonTestKVCrud(t, s)
+}
+
+func TestEncryptedReaderIsolation(t *testing.T) {
+	s := open(t, nil)
+	defer cleanup(t, s)
+	test.CommonTestReaderIsolation(t, s)
+}
+
+func TestEncryptedReaderOwnsGetBytes(t *testing.T) {
+	s := open(t, nil)
+	defer cleanup(t, s)
+	test.CommonTestReaderOwnsGetBytes(t, s)
+}
+
+func TestEncryptedWriterOwnsBytes(t *testing.T) {
+	s := open(t, nil)
+	defer cleanup(t, s)
+	test.CommonTestWriterOwnsBytes(t, s)
+}
+
+func TestEncryptedPrefixIterator(t *testing.T) {
+	s := open(t, nil)
+	defer cleanup(t, s)
+	test.CommonTestPrefixIterator(t, s)
+}
+
+func TestEncryptedPrefixIteratorSeek(t *testing.T) {
+	s := open(t, nil)
+	defer cleanup(t, s)
+	test.CommonTestPrefixIteratorSeek(t, s)
+}
+
+func TestEncryptedRangeIterator(t *testing.T) {
+	s := open(t, nil)
+	defer cleanup(t, s)
+	test.CommonTestRangeIterator(t, s)
+}
+
+func TestEncryptedRangeIteratorSeek(t *testing.T) {
+	s := open(t, nil)
+	defer cleanup(t, s)
+	test.CommonTestRangeIteratorSeek(t, s)
+}
+
+func TestEncryptedMerge(t *testing.T) {
+	s := open(t, &test.TestMergeCounter{})
+	defer cleanup(t, s)
+	test.CommonTestMerge(t, s)
+}
+
+func TestEncryptedValuesStored(t *testing.T) {
+	s := open(t, nil)
+	defer cleanup(t, s)
+
+	w, err := s.Writer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	batch := w.NewBatch()
+	batch.Set([]byte("k"), []byte("regulated data"))
+	err = w.ExecuteBatch(batch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = w.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the underlying store holds the value encrypted
+	r, err := s.(*Store).o.Reader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := r.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+	v, err := r.Get([]byte("k"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !encryption.IsEncrypted(v) || bytes.Contains(v, []byte("regulated")) {
+		t.Errorf("expected the value encrypted, got %q", v)
+	}
+}
@@ -431,18 +431,28 @@ func (i *indexAliasImpl) Swap(in, out []Index) {
 // could be slower in remote usages.
 func createChildSearchRequest(req *SearchRequest) *SearchRequest {
 	rv := SearchRequest{
-		Query:            req.Query,
-		Size:             req.Size + req.From,
-		From:             0,
-		Highlight:        req.Highlight,
-		Fields:           req.Fields,
-		Facets:           req.Facets,
-		Explain:          req.Explain,
-		Sort:             req.Sort.Copy(),
-		IncludeLocations: req.IncludeLocations,
-		Score:            req.Score,
-		SearchAfter:      req.SearchAfter,
-		SearchBefore:     req.SearchBefore,
+		Query:               req.Query,
+		Size:                req.Size + req.From,
+		From:                0,
+		Highlight:           req.Highlight,
+		Fields:              req.Fields,
+		Facets:              req.Facets,
+		Explain:             req.Explain,
+		Sort:                req.Sort.Copy(),
+		IncludeLocations:    req.IncludeLocations,
+		Score:               req.Score,
+		SearchAfter:         req.SearchAfter,
+		SearchBefore:        req.SearchBefore,
+		Collapse:            req.Collapse,
+		Rescore:             req.Rescore,
+		Features:            req.Features,
+		Fusion:              req.Fusion,
+		TrackTotalHits:      req.TrackTotalHits,
+		Parallelism:         req.Parallelism,
+		Profile:             req.Profile,
+		AllowPartialResults: req.AllowPartialResults,
+		Timeouts:            req.Timeouts,
+		PointInTime:         req.PointInTime,
 	}
 	return &rv
 }
@@ -455,7 +465,17 @@ type asyncSearchResult struct {
 
 // MultiSearch executes a SearchRequest across multiple Index objects,
 // then merges the results.  The indexes must honor any ctx deadline.
+// Hits are merged by raw score, unless the request specifies a
+// FusionRequest, in which case the ranked hits of each index are fused.
+// A point in time belongs to a single index, so requests searching one
+// fail with ErrorAliasPointInTime across multiple indexes.
 func MultiSearch(ctx context.Context, req *SearchRequest, indexes ...Index) (*SearchResult, error) {
+	if req.PointInTime != nil && len(indexes) > 1 {
+		return nil, ErrorAliasPointInTime
+	}
+	if req.Fusion != nil {
+		return fusionSearch(ctx, req, indexes...)
+	}
 
 	searchStart := time.Now()
 	asyncResults := make(chan *asyncSearchResult, len(indexes))
@@ -525,6 +545,12 @@ func MultiSearch(ctx context.Context, req *SearchRequest, indexes ...Index) (*Se
 		sortFunc(sorter)
 	}
 
+	// a group may have a head from more than one index,
+	// keep only the best one now that the hits are sorted
+	if req.Collapse != nil {
+		sr.Hits = collapseHits(sr.Hits)
+	}
+
 	// now skip over the correct From
 	if req.From > 0 && len(sr.Hits) > req.From {
 		sr.Hits = sr.Hits[req.From:]
@@ -573,6 +599,21 @@ func MultiSearch(ctx context.Context, req *SearchRequest, indexes ...Index) (*Se
 	return sr, nil
 }
 
+// collapseHits keeps only the first hit for each collapse
+// key, as reported by the collapsing collector.
+func collapseHits(hits search.DocumentMatchCollection) search.DocumentMatchCollection {
+	seen := make(map[string]struct{}, len(hits))
+	rv := hits[:0]
+	for _, hit := range hits {
+		if _, ok := seen[hit.CollapseKey]; ok {
+			continue
+		}
+		seen[hit.CollapseKey] = struct{}{}
+		rv = append(rv, hit)
+	}
+	return rv
+}
+
 func (i *indexAliasImpl) NewBatch() *Batch {
 	i.mutex.RLock()
 	defer i.mutex.RUnlock()
@@ -24,6 +24,7 @@ import (
 	"time"
 
 	"github.com/blevesearch/bleve/v2/document"
+	"github.com/blevesearch/bleve/v2/index/scorch"
 	"github.com/blevesearch/bleve/v2/index/upsidedown"
 	"github.com/blevesearch/bleve/v2/mapping"
 	"github.com/blevesearch/bleve/v2/registry"
@@ -31,6 +32,7 @@ import (
 	"github.com/blevesearch/bleve/v2/search/collector"
 	"github.com/blevesearch/bleve/v2/search/facet"
 	"github.com/blevesearch/bleve/v2/search/highlight"
+	"github.com/blevesearch/bleve/v2/search/query"
 	index "github.com/blevesearch/bleve_index_api"
 )
 
@@ -43,6 +45,12 @@ type indexImpl struct {
 	mutex sync.RWMutex
 	open  bool
 	stats *IndexStat
+
+	pitMutex sync.Mutex // Protects pits.
+	pits     map[string]*pointInTime
+
+	// config is the configuration the index type was opened with.
+	config map[string]interface{}
 }
 
 const storePath = "store"
@@ -100,6 +108,7 @@ func newIndexUsing(path string, mapping mapping.IndexMapping, indexType string,
 		return nil, ErrorUnknownIndexType
 	}
 
+	rv.config = kvconfig
 	rv.i, err = indexTypeConstructor(rv.meta.Storage, kvconfig, Config.analysisQueue)
 	if err != nil {
 		return nil, err
@@ -167,6 +176,7 @@ func openIndexUsing(path string, runtimeConfig map[string]interface{}) (rv *inde
 		return nil, ErrorUnknownIndexType
 	}
 
+	rv.config = storeConfig
 	rv.i, err = indexTypeConstructor(rv.meta.Storage, storeConfig, Config.analysisQueue)
 	if err != nil {
 		return nil, err
@@ -304,9 +314,34 @@ func (i *indexImpl) Batch(b *Batch) error {
 		return ErrorIndexClosed
 	}
 
+	if b.durability != DurabilityDefault {
+		if db, ok := i.i.(durableBatcher); ok {
+			return db.BatchWithDurability(b.internal,
+				scorchDurability(b.durability))
+		}
+	}
 	return i.i.Batch(b.internal)
 }
 
+// durableBatcher is implemented by the index types supporting durability
+// levels for each batch, such as scorch.
+type durableBatcher interface {
+	BatchWithDurability(batch *index.Batch, durability scorch.Durability) error
+}
+
+// scorchDurability maps the durability of a batch to the scorch one.
+func scorchDurability(d Durability) scorch.Durability {
+	switch d {
+	case DurabilityMemory:
+		return scorch.DurabilityMemory
+	case DurabilityPersisted:
+		return scorch.DurabilityPersisted
+	case DurabilityFsync:
+		return scorch.DurabilityFsync
+	}
+	return scorch.DurabilityDefault
+}
+
 // Document is used to find the values of all the
 // stored fields for a document in the index.  These
 // stored fields are put back into a Document object
@@ -431,6 +466,11 @@ func memNeededForSearch(req *SearchRequest,
 // SearchInContext executes a search request operation within the provided
 // Context. Returns a SearchResult object or an error.
 func (i *indexImpl) SearchInContext(ctx context.Context, req *SearchRequest) (sr *SearchResult, err error) {
+	if req.Fusion != nil {
+		// each of the fused queries is searched on its own
+		return fusionSearch(ctx, req, i)
+	}
+
 	i.mutex.RLock()
 	defer i.mutex.RUnlock()
 
@@ -448,67 +488,118 @@ func (i *indexImpl) SearchInContext(ctx context.Context, req *SearchRequest) (sr
 		req.SearchBefore = nil
 	}
 
-	var coll *collector.TopNCollector
-	if req.SearchAfter != nil {
-		coll = collector.NewTopNCollectorAfter(req.Size, req.Sort, req.SearchAfter)
+	// open a reader for this search, or use the pinned one
+	var indexReader index.IndexReader
+	closeReader := func() error { return indexReader.Close() }
+	if req.PointInTime != nil {
+		indexReader, closeReader, err = i.acquirePointInTime(req.PointInTime)
+		if err != nil {
+			return nil, err
+		}
 	} else {
-		coll = collector.NewTopNCollector(req.Size, req.From, req.Sort)
-	}
-
-	// open a reader for this search
-	indexReader, err := i.i.Reader()
-	if err != nil {
-		return nil, fmt.Errorf("error opening index reader %v", err)
+		indexReader, err = i.i.Reader()
+		if err != nil {
+			return nil, fmt.Errorf("error opening index reader %v", err)
+		}
 	}
 	defer func() {
-		if cerr := indexReader.Close(); err == nil && cerr != nil {
+		if cerr := closeReader(); err == nil && cerr != nil {
 			err = cerr
 		}
 	}()
 
-	searcher, err := req.Query.Searcher(indexReader, i.m, search.SearcherOptions{
-		Explain:            req.Explain,
-		IncludeTermVectors: req.IncludeLocations || req.Highlight != nil,
-		Score:              req.Score,
-	})
+	// a search split by groups of segments collects the top hits of
+	// each group, and pages through them once merged
+	var groups []index.IndexInternalID
+	if sr, ok := indexReader.(search.SegmentedReader); ok &&
+		req.Parallelism > 1 && req.Collapse == nil && !req.Profile {
+		groups = sr.SegmentGroups(req.Parallelism)
+	}
+	parallel := len(groups) > 1
+
+	// skipping matches is only allowed when they are not all counted,
+	// and would only go unnoticed in the top hits by descending score
+	var dynamicPruning bool
+	if req.TrackTotalHits != TrackTotalHitsExact && len(req.Facets) == 0 {
+		dynamicPruning = sortIsScoreDesc(req.Sort) && req.Collapse == nil
+	}
+
+	newCollector := func() *collector.TopNCollector {
+		var coll *collector.TopNCollector
+		if req.SearchAfter != nil {
+			coll = collector.NewTopNCollectorAfter(req.Size, req.Sort.Copy(), req.SearchAfter)
+		} else if req.Rescore != nil {
+			// collect the whole rescore window, paging happens after rescoring
+			coll = collector.NewTopNCollector(collectSizeForRescore(req), 0, req.Sort.Copy())
+		} else if parallel {
+			coll = collector.NewTopNCollector(req.Size+req.From, 0, req.Sort.Copy())
+		} else {
+			coll = collector.NewTopNCollector(req.Size, req.From, req.Sort)
+		}
+		if req.TrackTotalHits != TrackTotalHitsExact && len(req.Facets) == 0 {
+			threshold := 0
+			if req.TrackTotalHits > 0 {
+				threshold = req.TrackTotalHits
+			}
+			coll.SetTotalHitsThreshold(uint64(threshold))
+		}
+		if req.Facets != nil {
+			// the facets of groups of segments are only truncated
+			// once merged, a term may be in the top of no group
+			coll.SetFacetsBuilder(newFacetsBuilder(req, indexReader, i.m, !parallel))
+		}
+		if req.Collapse != nil {
+			coll.SetCollapse(req.Collapse.Field, req.Collapse.InnerHits)
+		}
+		coll.SetProfile(req.Profile)
+		coll.SetAllowPartialResults(req.AllowPartialResults)
+		if req.Timeouts != nil {
+			coll.SetFacetsTimeout(req.Timeouts.Facets)
+		}
+		return coll
+	}
+
+	plan, err := query.PlanQuery(req.Query, indexReader, i.m, req.Score != "none")
 	if err != nil {
 		return nil, err
 	}
-	defer func() {
-		if serr := searcher.Close(); err == nil && serr != nil {
-			err = serr
-		}
-	}()
 
-	if req.Facets != nil {
-		facetsBuilder := search.NewFacetsBuilder(indexReader)
-		for facetName, facetRequest := range req.Facets {
-			if facetRequest.NumericRanges != nil {
-				// build numeric range facet
-				facetBuilder := facet.NewNumericFacetBuilder(facetRequest.Field, facetRequest.Size)
-				for _, nr := range facetRequest.NumericRanges {
-					facetBuilder.AddRange(nr.Name, nr.Min, nr.Max)
-				}
-				facetsBuilder.Add(facetName, facetBuilder)
-			} else if facetRequest.DateTimeRanges != nil {
-				// build date range facet
-				facetBuilder := facet.NewDateTimeFacetBuilder(facetRequest.Field, facetRequest.Size)
-				dateTimeParser := i.m.DateTimeParserNamed("")
-				for _, dr := range facetRequest.DateTimeRanges {
-					start, end := dr.ParseDates(dateTimeParser)
-					facetBuilder.AddRange(dr.Name, start, end)
+	var profile *SearchProfile
+	newSearcher := func() (search.Searcher, error) {
+		options := search.SearcherOptions{
+			Explain:            req.Explain,
+			IncludeTermVectors: req.IncludeLocations || req.Highlight != nil,
+			Score:              req.Score,
+			DynamicPruning:     dynamicPruning,
+		}
+		if req.Profile {
+			s, sp, err := query.ProfiledSearcher(plan.Query, indexReader, i.m, options)
+			if err == nil {
+				profile = &SearchProfile{
+					Index:    i.name,
+					Searcher: sp,
 				}
-				facetsBuilder.Add(facetName, facetBuilder)
-			} else {
-				// build terms facet
-				facetBuilder := facet.NewTermsFacetBuilder(facetRequest.Field, facetRequest.Size)
-				facetsBuilder.Add(facetName, facetBuilder)
 			}
+			return s, err
 		}
-		coll.SetFacetsBuilder(facetsBuilder)
+		return plan.Query.Searcher(indexReader, i.m, options)
+	}
+
+	coll := newCollector()
+	searcher, err := newSearcher()
+	if err != nil {
+		return nil, err
 	}
+	defer func() {
+		if serr := searcher.Close(); err == nil && serr != nil {
+			err = serr
+		}
+	}()
 
 	memNeeded := memNeededForSearch(req, searcher, coll)
+	if parallel {
+		memNeeded *= uint64(len(groups))
+	}
 	if cb := ctx.Value(SearchQueryStartCallbackKey); cb != nil {
 		if cbF, ok := cb.(SearchQueryStartCallbackFn); ok {
 			err = cbF(memNeeded)
@@ -526,12 +617,66 @@ func (i *indexImpl) SearchInContext(ctx context.Context, req *SearchRequest) (sr
 		}
 	}
 
-	err = coll.Collect(ctx, searcher, indexReader)
+	collectCtx := ctx
+	if req.Timeouts != nil && req.Timeouts.Query > 0 {
+		var cancel context.CancelFunc
+		collectCtx, cancel = context.WithTimeout(ctx, req.Timeouts.Query)
+		defer cancel()
+	}
+
+	var collected searchCollector = coll
+	var partial *PartialStatus
+	if parallel {
+		var mc *mergedCollector
+		mc, err = collectSegmentGroups(collectCtx, req, indexReader, groups,
+			coll, searcher, newCollector, newSearcher)
+		if err == nil {
+			collected, partial = mc, mc.partial
+		}
+	} else {
+		err = coll.Collect(collectCtx, searcher, indexReader)
+		if err == nil {
+			partial = partialStatus(indexReader, nil, coll)
+		}
+	}
 	if err != nil {
 		return nil, err
 	}
+	if profile != nil {
+		profile.Collector = coll.Took()
+		profile.Facets = coll.FacetsTook()
+	}
+
+	hits := collected.Results()
+	maxScore := collected.MaxScore()
 
-	hits := coll.Results()
+	if req.Rescore != nil {
+		err = rescoreHits(ctx, req, indexReader, i.m, hits)
+		if err != nil {
+			return nil, err
+		}
+		maxScore = 0
+		for _, hit := range hits {
+			if hit.Score > maxScore {
+				maxScore = hit.Score
+			}
+		}
+		if len(hits) > req.From {
+			hits = hits[req.From:]
+		} else {
+			hits = search.DocumentMatchCollection{}
+		}
+		if len(hits) > req.Size {
+			hits = hits[:req.Size]
+		}
+	}
+
+	if len(req.Features) > 0 {
+		err = logFeatures(ctx, req.Features, indexReader, i.m, hits)
+		if err != nil {
+			return nil, err
+		}
+	}
 
 	var highlighter highlight.Highlighter
 
@@ -552,7 +697,27 @@ func (i *indexImpl) SearchInContext(ctx context.Context, req *SearchRequest) (sr
 		}
 	}
 
+	highlightCtx := ctx
+	if req.Timeouts != nil && req.Timeouts.Highlight > 0 {
+		var cancel context.CancelFunc
+		highlightCtx, cancel = context.WithTimeout(ctx, req.Timeouts.Highlight)
+		defer cancel()
+	}
+
+	highlightStart := time.Now()
 	for _, hit := range hits {
+		// the remaining hits are returned without their fields
+		if err = highlightCtx.Err(); err != nil {
+			if !req.AllowPartialResults {
+				return nil, err
+			}
+			err = nil
+			if partial == nil {
+				partial = &PartialStatus{}
+			}
+			partial.Phases = append(partial.Phases, SearchPhaseHighlight)
+			break
+		}
 		if i.name != "" {
 			hit.Index = i.name
 		}
@@ -560,6 +725,19 @@ func (i *indexImpl) SearchInContext(ctx context.Context, req *SearchRequest) (sr
 		if err != nil {
 			return nil, err
 		}
+		for _, innerHit := range hit.InnerHits {
+			if i.name != "" {
+				innerHit.Index = i.name
+			}
+			err = LoadAndHighlightFields(innerHit, req, i.name, indexReader, highlighter)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if profile != nil {
+		profile.Highlight = time.Since(highlightStart)
 	}
 
 	atomic.AddUint64(&i.stats.searches, 1)
@@ -582,18 +760,107 @@ func (i *indexImpl) SearchInContext(ctx context.Context, req *SearchRequest) (sr
 		req.SearchAfter = nil
 	}
 
-	return &SearchResult{
-		Status: &SearchStatus{
-			Total:      1,
-			Successful: 1,
-		},
-		Request:  req,
-		Hits:     hits,
-		Total:    coll.Total(),
-		MaxScore: coll.MaxScore(),
-		Took:     searchDuration,
-		Facets:   coll.FacetResults(),
-	}, nil
+	status := &SearchStatus{
+		Total:      1,
+		Successful: 1,
+	}
+	if partial != nil {
+		status.TimedOut = 1
+		status.Partial = map[string]*PartialStatus{i.name: partial}
+	}
+
+	rv := &SearchResult{
+		Status:            status,
+		Request:           req,
+		Hits:              hits,
+		Total:             collected.Total(),
+		TotalIsLowerBound: collected.TotalIsLowerBound(),
+		TotalGroups:       collected.TotalGroups(),
+		MaxScore:          maxScore,
+		Took:              searchDuration,
+	}
+	facetsStart := time.Now()
+	rv.Facets = collected.FacetResults()
+	if profile != nil {
+		profile.Facets += time.Since(facetsStart)
+		rv.Profile = profile
+	}
+	if req.Explain {
+		rv.Plan = plan
+	}
+	return rv, nil
+}
+
+// partialStatus describes why the hits collected by the collector,
+// until the end of its range, are partial, or returns nil when they
+// are not.
+func partialStatus(indexReader index.IndexReader, end index.IndexInternalID,
+	coll *collector.TopNCollector) *PartialStatus {
+	var rv *PartialStatus
+	if at := coll.TimedOutAt(); at != nil {
+		rv = &PartialStatus{
+			Phases: []string{SearchPhaseQuery},
+		}
+		// only the starts of the segments are needed
+		if ssr, ok := indexReader.(search.SortedSegmentsReader); ok {
+			starts, _ := ssr.SortedSegments(nil)
+			for x, start := range starts {
+				if x+1 < len(starts) && starts[x+1].Compare(start) == 0 {
+					continue // no documents
+				}
+				rv.Segments++
+				if (x+1 == len(starts) || starts[x+1].Compare(at) > 0) &&
+					(end == nil || start.Compare(end) < 0) {
+					rv.SegmentsTimedOut++
+				}
+			}
+		}
+	}
+	if coll.FacetsTimedOut() {
+		if rv == nil {
+			rv = &PartialStatus{}
+		}
+		rv.Phases = append(rv.Phases, SearchPhaseFacets)
+	}
+	return rv
+}
+
+// maxFacetSize is the size of facets which are not truncated
+const maxFacetSize = int(^uint(0) >> 1)
+
+// newFacetsBuilder builds the facets requested, truncated to their size
+// unless truncate is false.
+func newFacetsBuilder(req *SearchRequest, indexReader index.IndexReader,
+	m mapping.IndexMapping, truncate bool) *search.FacetsBuilder {
+	facetsBuilder := search.NewFacetsBuilder(indexReader)
+	for facetName, facetRequest := range req.Facets {
+		size := facetRequest.Size
+		if !truncate {
+			size = maxFacetSize
+		}
+		if facetRequest.NumericRanges != nil {
+			// build numeric range facet
+			facetBuilder := facet.NewNumericFacetBuilder(facetRequest.Field, size)
+			for _, nr := range facetRequest.NumericRanges {
+				facetBuilder.AddRange(nr.Name, nr.Min, nr.Max)
+			}
+			facetsBuilder.Add(facetName, facetBuilder)
+		} else if facetRequest.DateTimeRanges != nil {
+			// build date range facet
+			facetBuilder := facet.NewDateTimeFacetBuilder(facetRequest.Field, size)
+			dateTimeParser := m.DateTimeParserNamed("")
+			for _, dr := range facetRequest.DateTimeRanges {
+				start, end := dr.ParseDates(dateTimeParser)
+				facetBuilder.AddRange(dr.Name, start, end)
+			}
+			facetsBuilder.Add(facetName, facetBuilder)
+		} else {
+			// build terms facet
+			facetBuilder := facet.NewTermsFacetBuilder(facetRequest.Field, size)
+			facetsBuilder.Add(facetName, facetBuilder)
+		}
+	}
+	return facetsBuilder
 }
 
 func LoadAndHighlightFields(hit *search.DocumentMatch, req *SearchRequest,
@@ -780,7 +1047,11 @@ func (i *indexImpl) Close() error {
 	indexStats.UnRegister(i)
 
 	i.open = false
-	return i.i.Close()
+	err := i.closePointsInTime()
+	if cerr := i.i.Close(); cerr != nil {
+		return cerr
+	}
+	return err
 }
 
 func (i *indexImpl) Stats() *IndexStat {
@@ -24,11 +24,18 @@ type IndexStat struct {
 	searches   uint64
 	searchTime uint64
 	i          *indexImpl
+	// indexStatsMap returns the stats of the index in place of those of
+	// i, for the indexes made up of other indexes.
+	indexStatsMap func() map[string]interface{}
 }
 
 func (is *IndexStat) statsMap() map[string]interface{} {
 	m := map[string]interface{}{}
-	m["index"] = is.i.i.StatsMap()
+	if is.indexStatsMap != nil {
+		m["index"] = is.indexStatsMap()
+	} else {
+		m["index"] = is.i.i.StatsMap()
+	}
 	m["searches"] = atomic.LoadUint64(&is.searches)
 	m["search_time"] = atomic.LoadUint64(&is.searchTime)
 	return m
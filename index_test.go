@@ -15,9 +15,12 @@
 package bleve
 
 import (
+	"archive/tar"
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"math"
@@ -33,7 +36,9 @@ import (
 
 	"github.com/blevesearch/bleve/v2/analysis/analyzer/keyword"
 	"github.com/blevesearch/bleve/v2/document"
+	"github.com/blevesearch/bleve/v2/index/encryption"
 	"github.com/blevesearch/bleve/v2/index/upsidedown/store/boltdb"
+	"github.com/blevesearch/bleve/v2/index/upsidedown/store/encrypted"
 	"github.com/blevesearch/bleve/v2/index/upsidedown/store/null"
 	"github.com/blevesearch/bleve/v2/mapping"
 	"github.com/blevesearch/bleve/v2/search"
@@ -2261,3 +2266,850 @@ func TestIndexMappingDocValuesDynamic(t *testing.T) {
 		t.Fatalf("Expected DocValuesDynamic to remain false after the index mapping edit")
 	}
 }
+
+func TestBackupRestore(t *testing.T) {
+	tmpIndexPath := createTmpIndexPath(t)
+	defer cleanupTmpIndexPath(t, tmpIndexPath)
+	backupDir := createTmpIndexPath(t)
+	defer cleanupTmpIndexPath(t, backupDir)
+
+	idx, err := NewUsing(filepath.Join(tmpIndexPath, "index"), NewIndexMapping(),
+		scorch.Name, Config.DefaultKVStore, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := idx.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	for i := 0; i < 10; i++ {
+		err = idx.Index(strconv.Itoa(i), map[string]interface{}{"name": "backup"})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// keep indexing while the backups are taken
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 10; ; i++ {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			if err := idx.Index(strconv.Itoa(i), map[string]interface{}{"name": "backup"}); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+
+	bidx := idx.(BackupIndex)
+	backupPath := filepath.Join(backupDir, "backup")
+	err = bidx.Backup(backupPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = bidx.Backup(backupPath); err != ErrorIndexPathExists {
+		t.Errorf("expected ErrorIndexPathExists, got %v", err)
+	}
+	var archive bytes.Buffer
+	err = bidx.BackupTo(&archive)
+	close(done)
+	wg.Wait()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the root.bolt of the store is the last entry of the archive
+	var lastEntry string
+	tr := tar.NewReader(bytes.NewReader(archive.Bytes()))
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		lastEntry = hdr.Name
+	}
+	if lastEntry != "store/root.bolt" {
+		t.Errorf("expected store/root.bolt last in the archive, got %s", lastEntry)
+	}
+
+	restorePath := filepath.Join(backupDir, "restore")
+	err = Restore(&archive, restorePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{backupPath, restorePath} {
+		copied, err := Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		count, err := copied.DocCount()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if count < 10 {
+			t.Errorf("%s: expected at least 10 documents, got %d", path, count)
+		}
+		res, err := copied.Search(NewSearchRequest(NewMatchQuery("backup")))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Total != count {
+			t.Errorf("%s: expected %d hits, got %d", path, count, res.Total)
+		}
+		err = copied.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = Restore(strings.NewReader("not an archive"), filepath.Join(backupDir, "bad"))
+	if err == nil {
+		t.Error("expected error restoring an invalid archive")
+	}
+	if _, err = os.Stat(filepath.Join(backupDir, "bad")); !os.IsNotExist(err) {
+		t.Errorf("expected failed restore to be cleaned up, got %v", err)
+	}
+
+	udcPath := filepath.Join(tmpIndexPath, "udc")
+	udc, err := NewUsing(udcPath, NewIndexMapping(), upsidedown.Name, Config.DefaultKVStore, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := udc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+	if err = udc.(BackupIndex).Backup(filepath.Join(backupDir, "udc")); err != ErrorBackupNotSupported {
+		t.Errorf("expected ErrorBackupNotSupported, got %v", err)
+	}
+}
+
+func TestBackupIncremental(t *testing.T) {
+	tmpIndexPath := createTmpIndexPath(t)
+	defer cleanupTmpIndexPath(t, tmpIndexPath)
+	backupDir := createTmpIndexPath(t)
+	defer cleanupTmpIndexPath(t, backupDir)
+
+	idx, err := NewUsing(filepath.Join(tmpIndexPath, "index"), NewIndexMapping(),
+		scorch.Name, Config.DefaultKVStore, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := idx.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	setPath := filepath.Join(backupDir, "set")
+	var epochs []uint64
+	for i := 0; i < 2; i++ {
+		batch := idx.NewBatch()
+		for j := i * 5; j < (i+1)*5; j++ {
+			err = batch.Index(strconv.Itoa(j), map[string]interface{}{"name": "backup"})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		err = idx.Batch(batch)
+		if err != nil {
+			t.Fatal(err)
+		}
+		epoch, err := idx.(BackupIndex).BackupIncremental(setPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		epochs = append(epochs, epoch)
+	}
+
+	recorded, err := BackupEpochs(setPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(recorded, epochs) {
+		t.Errorf("expected epochs %v, got %v", epochs, recorded)
+	}
+
+	for i, epoch := range epochs {
+		restorePath := filepath.Join(backupDir, strconv.Itoa(i))
+		err = RestoreIncremental(setPath, epoch, restorePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		restored, err := Open(restorePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		count, err := restored.DocCount()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected := uint64(i+1) * 5; count != expected {
+			t.Errorf("epoch %d: expected %d documents, got %d", epoch, expected, count)
+		}
+		err = restored.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestFollower(t *testing.T) {
+	tmpIndexPath := createTmpIndexPath(t)
+	defer cleanupTmpIndexPath(t, tmpIndexPath)
+
+	leader, err := NewUsing(filepath.Join(tmpIndexPath, "leader"), NewIndexMapping(),
+		scorch.Name, Config.DefaultKVStore, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := leader.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	source, err := ReplicationSource(leader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	follower, err := NewFollower(filepath.Join(tmpIndexPath, "follower"), source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := follower.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	// waits for the follower to catch up with the leader
+	catchUp := func(expected uint64) {
+		deadline := time.Now().Add(10 * time.Second)
+		for {
+			err := follower.Sync()
+			if err != nil {
+				t.Fatal(err)
+			}
+			count, err := follower.Index().DocCount()
+			if err == nil && count == expected {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("follower did not catch up, expected %d docs, got %d (%v)",
+					expected, count, err)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	for i := 0; i < 3; i++ {
+		batch := leader.NewBatch()
+		for j := i * 10; j < (i+1)*10; j++ {
+			err = batch.Index(strconv.Itoa(j), map[string]interface{}{"name": "follow"})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		err = leader.Batch(batch)
+		if err != nil {
+			t.Fatal(err)
+		}
+		catchUp(uint64(i+1) * 10)
+	}
+
+	res, err := follower.Index().Search(NewSearchRequest(NewMatchQuery("follow")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Total != 30 {
+		t.Errorf("expected 30 hits on the follower, got %d", res.Total)
+	}
+	if follower.Epoch() == 0 {
+		t.Error("expected the follower epoch to be set")
+	}
+
+	err = follower.Index().Index("x", map[string]interface{}{"name": "follow"})
+	if err == nil {
+		t.Error("expected the follower to be read-only")
+	}
+
+	// the segments no longer used by the follower are removed
+	finfos, err := ioutil.ReadDir(filepath.Join(tmpIndexPath, "follower", storePath))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var zaps int
+	for _, finfo := range finfos {
+		if filepath.Ext(finfo.Name()) == ".zap" {
+			zaps++
+		}
+	}
+	r, err := source.LatestSnapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Epoch == follower.Epoch() && zaps != len(r.Segments) {
+		t.Errorf("expected %d segment files on the follower, got %d", len(r.Segments), zaps)
+	}
+}
+
+func TestChangeStream(t *testing.T) {
+	tmpIndexPath := createTmpIndexPath(t)
+	defer cleanupTmpIndexPath(t, tmpIndexPath)
+
+	idx, err := NewUsing(filepath.Join(tmpIndexPath, "index"), NewIndexMapping(),
+		scorch.Name, Config.DefaultKVStore, map[string]interface{}{
+			"changeStream": true,
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := idx.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	err = idx.Index("a", map[string]interface{}{"name": "changes"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = idx.Delete("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sub, err := idx.(ChangeStreamIndex).SubscribeChanges(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// the mapping stored when creating the index is the first change
+	var changes []*scorch.ChangeRecord
+	for len(changes) < 3 {
+		change, err := sub.Next(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		changes = append(changes, change)
+	}
+	if _, ok := changes[0].InternalSet[string(mappingInternalKey)]; !ok {
+		t.Errorf("expected the mapping stored first, got %+v", changes[0])
+	}
+	if !reflect.DeepEqual(changes[1].Indexed, []string{"a"}) {
+		t.Errorf("expected a indexed, got %+v", changes[1])
+	}
+	if !reflect.DeepEqual(changes[2].Deleted, []string{"a"}) {
+		t.Errorf("expected a deleted, got %+v", changes[2])
+	}
+
+	udc, err := NewUsing(filepath.Join(tmpIndexPath, "udc"), NewIndexMapping(),
+		upsidedown.Name, Config.DefaultKVStore, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := udc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+	_, err = udc.(ChangeStreamIndex).SubscribeChanges(0)
+	if err != ErrorChangeStreamNotSupported {
+		t.Errorf("expected ErrorChangeStreamNotSupported, got %v", err)
+	}
+}
+
+func TestSnapshotTags(t *testing.T) {
+	tmpIndexPath := createTmpIndexPath(t)
+	defer cleanupTmpIndexPath(t, tmpIndexPath)
+
+	idx, err := NewUsing(filepath.Join(tmpIndexPath, "index"), NewIndexMapping(),
+		scorch.Name, Config.DefaultKVStore, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := idx.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+	tagIndex := idx.(SnapshotTagIndex)
+
+	err = idx.Index("a", map[string]interface{}{"name": "tagged"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	epoch, err := tagIndex.TagSnapshot("before-b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = idx.Index("b", map[string]interface{}{"name": "tagged"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tags, err := tagIndex.SnapshotTags()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tags) != 1 || tags[0].Name != "before-b" || tags[0].Epoch != epoch {
+		t.Errorf("expected tag before-b at epoch %d, got %+v", epoch, tags)
+	}
+
+	err = tagIndex.RollbackToSnapshotTag("missing")
+	if err != ErrorSnapshotTagNotFound {
+		t.Errorf("expected ErrorSnapshotTagNotFound, got %v", err)
+	}
+	err = tagIndex.RollbackToSnapshotTag("before-b")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the index is reopened at the tagged snapshot, and keeps serving
+	count, err := idx.DocCount()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("expected 1 document after the rollback, got %d", count)
+	}
+	res, err := idx.Search(NewSearchRequest(NewMatchQuery("tagged")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Total != 1 || res.Hits[0].ID != "a" {
+		t.Errorf("expected only a to match, got %v", res.Hits)
+	}
+	err = idx.Index("c", map[string]interface{}{"name": "tagged"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = tagIndex.DeleteSnapshotTag("before-b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tagIndex.DeleteSnapshotTag("before-b")
+	if err != ErrorSnapshotTagNotFound {
+		t.Errorf("expected ErrorSnapshotTagNotFound, got %v", err)
+	}
+
+	udc, err := NewUsing(filepath.Join(tmpIndexPath, "udc"), NewIndexMapping(),
+		upsidedown.Name, Config.DefaultKVStore, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := udc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+	_, err = udc.(SnapshotTagIndex).TagSnapshot("tag")
+	if err != ErrorSnapshotTagsNotSupported {
+		t.Errorf("expected ErrorSnapshotTagsNotSupported, got %v", err)
+	}
+}
+
+func TestBatchDurability(t *testing.T) {
+	tmpIndexPath := createTmpIndexPath(t)
+	defer cleanupTmpIndexPath(t, tmpIndexPath)
+
+	config := map[string]interface{}{
+		"groupCommit":   true,
+		"writeAheadLog": true,
+	}
+	idx, err := NewUsing(tmpIndexPath, NewIndexMapping(), scorch.Name,
+		Config.DefaultKVStore, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	durabilities := []Durability{DurabilityMemory,
+		DurabilityPersisted, DurabilityFsync}
+	for i, durability := range durabilities {
+		batch := idx.NewBatch()
+		err = batch.Index(fmt.Sprintf("doc%d", i), map[string]interface{}{
+			"name": durability.String(),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		batch.SetDurability(durability)
+		err = idx.Batch(batch)
+		if err != nil {
+			t.Fatal(err)
+		}
+		batch.Reset()
+		if batch.Durability() != DurabilityDefault {
+			t.Errorf("expected the durability reset, got %v", batch.Durability())
+		}
+	}
+	err = idx.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	idx, err = OpenUsing(tmpIndexPath, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := idx.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+	count, err := idx.DocCount()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != uint64(len(durabilities)) {
+		t.Errorf("expected %d documents, got %d", len(durabilities), count)
+	}
+}
+
+func TestEncryptedIndex(t *testing.T) {
+	keyring := encryption.NewKeyring()
+	err := keyring.AddKey("k1", bytes.Repeat([]byte{1}, 32), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encryption.RegisterKeyProvider("TestEncryptedIndex", keyring)
+
+	for _, indexType := range []string{scorch.Name, upsidedown.Name} {
+		tmpIndexPath := createTmpIndexPath(t)
+		defer cleanupTmpIndexPath(t, tmpIndexPath)
+
+		kvstore := Config.DefaultKVStore
+		config := map[string]interface{}{
+			"encryptionKeyProvider": "TestEncryptedIndex",
+		}
+		if indexType == upsidedown.Name {
+			kvstore = encrypted.Name
+			config["kvStoreName_actual"] = boltdb.Name
+		}
+		idx, err := NewUsing(tmpIndexPath, NewIndexMapping(), indexType,
+			kvstore, config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = idx.Index("a", map[string]interface{}{"name": "confidential"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = idx.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// the key provider is named by the config kept with the index
+		idx, err = Open(tmpIndexPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req := NewSearchRequest(NewTermQuery("confidential"))
+		req.Fields = []string{"name"}
+		res, err := idx.Search(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Total != 1 || res.Hits[0].Fields["name"] != "confidential" {
+			t.Errorf("%s: expected document a found, got %v", indexType, res)
+		}
+		err = idx.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestVerifyAndRepairIndex(t *testing.T) {
+	tmpIndexPath := createTmpIndexPath(t)
+	defer cleanupTmpIndexPath(t, tmpIndexPath)
+
+	idx, err := NewUsing(tmpIndexPath, NewIndexMapping(), scorch.Name,
+		Config.DefaultKVStore, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	batch := idx.NewBatch()
+	for _, id := range []string{"a", "b", "c"} {
+		err = batch.Index(id, map[string]interface{}{
+			"name": "name " + id,
+			"meta": map[string]interface{}{
+				"tags": []interface{}{"tag", "tag" + id},
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = idx.Batch(batch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = idx.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := Verify(tmpIndexPath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Segments) == 0 || len(report.Problems) != 0 {
+		t.Fatalf("expected segments verified without problems, got %+v", report)
+	}
+	for _, name := range report.Segments {
+		segPath := filepath.Join(indexStorePath(tmpIndexPath), name)
+		buf, err := ioutil.ReadFile(segPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf[len(buf)-1] ^= 0xff
+		err = ioutil.WriteFile(segPath, buf, 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	report, err = Verify(tmpIndexPath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.CorruptSegments()) != len(report.Segments) {
+		t.Fatalf("expected segments %v corrupt, got %v",
+			report.Segments, report.Problems)
+	}
+
+	// the checksums are corrupt, not the documents, which are indexed
+	// again from their stored fields
+	repair, err := Repair(tmpIndexPath, nil, report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(repair.Recovered) != 3 || repair.Lost != 0 {
+		t.Fatalf("expected 3 documents recovered, got %+v", repair)
+	}
+	// the files of the dropped segments are removed once indexed again
+	for _, name := range repair.Dropped {
+		segPath := filepath.Join(indexStorePath(tmpIndexPath), name)
+		if _, err := os.Stat(segPath + ".dropped"); !os.IsNotExist(err) {
+			t.Errorf("expected segment %s removed, got %v", name, err)
+		}
+	}
+	idx, err = Open(tmpIndexPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := idx.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+	count, err := idx.DocCount()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 3 {
+		t.Errorf("expected 3 documents, got %d", count)
+	}
+	q := NewTermQuery("tagb")
+	q.SetField("meta.tags")
+	req := NewSearchRequest(q)
+	req.Fields = []string{"name"}
+	res, err := idx.Search(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Total != 1 || res.Hits[0].ID != "b" ||
+		res.Hits[0].Fields["name"] != "name b" {
+		t.Errorf("expected document b found by its tag, got %v", res)
+	}
+}
+
+func TestMigrateToScorch(t *testing.T) {
+	tmpIndexPath := createTmpIndexPath(t)
+	defer cleanupTmpIndexPath(t, tmpIndexPath)
+	defer cleanupTmpIndexPath(t, tmpIndexPath+".upsidedown")
+
+	m := NewIndexMapping()
+	secret := NewTextFieldMapping()
+	secret.Store = false
+	m.DefaultMapping.AddFieldMappingsAt("secret", secret)
+	// notes are only stored by the documents of the default type
+	private := NewDocumentMapping()
+	private.AddFieldMappingsAt("notes", secret)
+	m.AddDocumentMapping("private", private)
+	idx, err := NewUsing(tmpIndexPath, m, upsidedown.Name, boltdb.Name, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	batch := idx.NewBatch()
+	for _, id := range []string{"a", "b", "c"} {
+		data := map[string]interface{}{
+			"name":   "name " + id,
+			"secret": "secret",
+			"notes":  "notes " + id,
+		}
+		if id == "c" {
+			data["_type"] = "private"
+			delete(data, "secret")
+		}
+		err = batch.Index(id, data)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	batch.SetInternal([]byte("k"), []byte("v"))
+	err = idx.Batch(batch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = idx.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := MigrateToScorch(tmpIndexPath, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &MigrateReport{
+		Documents:          3,
+		InternalKeys:       1,
+		UnstoredFields:     []string{"secret"},
+		PartlyStoredFields: map[string]int{"notes": 1},
+		Backup:             tmpIndexPath + ".upsidedown",
+	}
+	if !reflect.DeepEqual(report, expected) {
+		t.Errorf("expected report %+v, got %+v", expected, report)
+	}
+
+	idx, err = Open(tmpIndexPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := idx.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+	if idx.(*indexImpl).meta.IndexType != scorch.Name {
+		t.Errorf("expected a scorch index, got %s", idx.(*indexImpl).meta.IndexType)
+	}
+	count, err := idx.DocCount()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 3 {
+		t.Errorf("expected 3 documents, got %d", count)
+	}
+	val, err := idx.GetInternal([]byte("k"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(val) != "v" {
+		t.Errorf("expected internal value v, got %q", val)
+	}
+	// the fields not stored are lost, from the documents not storing them
+	for _, test := range []struct {
+		field, text string
+		hits        uint64
+	}{
+		{field: "name", text: "b", hits: 1},
+		{field: "secret", text: "secret", hits: 0},
+		{field: "notes", text: "notes", hits: 2},
+	} {
+		q := NewMatchQuery(test.text)
+		q.SetField(test.field)
+		res, err := idx.Search(NewSearchRequest(q))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Total != test.hits {
+			t.Errorf("expected %d hits on %s, got %d", test.hits, test.field,
+				res.Total)
+		}
+	}
+
+	// the index is no longer upsidedown
+	_, err = MigrateToScorch(tmpIndexPath, "", nil)
+	if err != ErrorMigrateNotSupported {
+		t.Errorf("expected ErrorMigrateNotSupported, got %v", err)
+	}
+}
+
+func TestMigrateToScorchTypeNotStored(t *testing.T) {
+	tmpIndexPath := createTmpIndexPath(t)
+	defer cleanupTmpIndexPath(t, tmpIndexPath)
+
+	// without the type field stored, the documents would lose their type
+	m := NewIndexMapping()
+	m.StoreDynamic = false
+	m.AddDocumentMapping("private", NewDocumentMapping())
+	idx, err := NewUsing(tmpIndexPath, m, upsidedown.Name, boltdb.Name, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = idx.Index("a", map[string]interface{}{
+		"_type": "private",
+		"name":  "name a",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = idx.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = MigrateToScorch(tmpIndexPath, "", nil)
+	if err != ErrorMigrateTypeNotStored {
+		t.Fatalf("expected ErrorMigrateTypeNotStored, got %v", err)
+	}
+	for _, path := range []string{tmpIndexPath + ".scorch", tmpIndexPath + ".upsidedown"} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("expected no %s, got %v", path, err)
+		}
+	}
+	idx, err = Open(tmpIndexPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if idx.(*indexImpl).meta.IndexType != upsidedown.Name {
+		t.Errorf("expected the upsidedown index kept, got %s",
+			idx.(*indexImpl).meta.IndexType)
+	}
+	err = idx.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
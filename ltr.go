@@ -0,0 +1,159 @@
+//  Copyright (c) 2021 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bleve
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/blevesearch/bleve/v2/mapping"
+	"github.com/blevesearch/bleve/v2/search"
+	"github.com/blevesearch/bleve/v2/search/query"
+	index "github.com/blevesearch/bleve_index_api"
+)
+
+// A FeatureRequest describes a named feature for
+// learning-to-rank.  The value of the feature for a
+// search hit is the score of Query for that hit, or
+// 0 if Query does not match it.
+type FeatureRequest struct {
+	Name  string      `json:"name"`
+	Query query.Query `json:"query"`
+}
+
+// NewFeatureRequest creates a FeatureRequest with the
+// specified name, valued by the score of the query.
+func NewFeatureRequest(name string, q query.Query) *FeatureRequest {
+	return &FeatureRequest{
+		Name:  name,
+		Query: q,
+	}
+}
+
+// UnmarshalJSON deserializes a JSON representation of
+// a FeatureRequest
+func (fr *FeatureRequest) UnmarshalJSON(input []byte) error {
+	var temp struct {
+		Name string          `json:"name"`
+		Q    json.RawMessage `json:"query"`
+	}
+
+	err := json.Unmarshal(input, &temp)
+	if err != nil {
+		return err
+	}
+
+	fr.Name = temp.Name
+	fr.Query, err = query.ParseQuery(temp.Q)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// FeaturesRequest groups together all the
+// FeatureRequest objects for a single query.
+type FeaturesRequest []*FeatureRequest
+
+func (fr FeaturesRequest) Validate() error {
+	names := make(map[string]struct{}, len(fr))
+	for _, f := range fr {
+		if f.Name == "" {
+			return fmt.Errorf("feature must specify a name")
+		}
+		if _, ok := names[f.Name]; ok {
+			return fmt.Errorf("features contains duplicate name '%s'", f.Name)
+		}
+		names[f.Name] = struct{}{}
+		if f.Query == nil {
+			return fmt.Errorf("feature '%s' must specify a query", f.Name)
+		}
+		if srq, ok := f.Query.(query.ValidatableQuery); ok {
+			err := srq.Validate()
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// logFeatures computes the value of each requested feature for the
+// hits, recording them in the Features of each hit.  Hits which
+// already had their features computed are left untouched.
+func logFeatures(ctx context.Context, features FeaturesRequest,
+	r index.IndexReader, m mapping.IndexMapping,
+	hits search.DocumentMatchCollection) error {
+	pending := make(search.DocumentMatchCollection, 0, len(hits))
+	for _, hit := range hits {
+		if hit.Features == nil {
+			hit.Features = make(map[string]float64, len(features))
+			pending = append(pending, hit)
+		}
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+
+	for _, f := range features {
+		name := f.Name
+		err := visitQueryMatches(ctx, f.Query, r, m, search.SearcherOptions{},
+			pending, func(hit, match *search.DocumentMatch) {
+				var value float64
+				if match != nil {
+					value = match.Score
+				}
+				hit.Features[name] = value
+			})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// rescoreHitsWithModel scores the hits with the ltr model named by the
+// rescore request, from the values of the features of the search request.
+func rescoreHitsWithModel(ctx context.Context, req *SearchRequest,
+	r index.IndexReader, m mapping.IndexMapping,
+	hits search.DocumentMatchCollection) error {
+	model, err := Config.Cache.LTRModelNamed(req.Rescore.Model)
+	if err != nil {
+		return err
+	}
+
+	err = logFeatures(ctx, req.Features, r, m, hits)
+	if err != nil {
+		return err
+	}
+
+	for _, hit := range hits {
+		modelScore := model.Score(hit.Features)
+		var modelExpl *search.Explanation
+		if req.Explain {
+			modelExpl = &search.Explanation{
+				Value:   modelScore,
+				Message: fmt.Sprintf("ltr model '%s'", req.Rescore.Model),
+			}
+		}
+		req.Rescore.updateHit(hit, req.Rescore.combine(hit.Score, modelScore),
+			req.Explain, modelExpl)
+	}
+
+	return nil
+}
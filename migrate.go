@@ -0,0 +1,258 @@
+//  Copyright (c) 2024 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bleve
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/blevesearch/bleve/v2/document"
+	"github.com/blevesearch/bleve/v2/index/scorch"
+	"github.com/blevesearch/bleve/v2/index/upsidedown"
+	"github.com/blevesearch/bleve/v2/mapping"
+	index "github.com/blevesearch/bleve_index_api"
+)
+
+// MigrateReport is the outcome of migrating an index to scorch.
+type MigrateReport struct {
+	Documents    int `json:"documents"`
+	InternalKeys int `json:"internal_keys"`
+	// UnstoredFields are the fields indexed, but never stored, so their
+	// values are missing from the documents migrated.
+	UnstoredFields []string `json:"unstored_fields,omitempty"`
+	// PartlyStoredFields are the fields stored by some of the documents
+	// indexing them only, with the number of documents indexing them
+	// without storing them, whose values are missing once migrated.
+	PartlyStoredFields map[string]int `json:"partly_stored_fields,omitempty"`
+	// Backup is where the upsidedown index is kept when migrated in
+	// place.
+	Backup string `json:"backup,omitempty"`
+}
+
+// internalVisitor is an index reader able to visit its internal keys.
+type internalVisitor interface {
+	VisitInternal(visitor func(key, val []byte) error) error
+}
+
+// MigrateToScorch rebuilds the upsidedown index at path, which must not
+// be open, as a scorch index at newPath with the same mapping, from the
+// stored fields of its documents and its internal keys.  The fields not
+// stored cannot be rebuilt, and are reported.  When newPath is empty, the
+// index is migrated in place: the scorch index takes its path once
+// complete, the upsidedown index being kept at path + ".upsidedown".  The
+// config is the one the scorch index is created with.  With type
+// mappings, the documents are only mapped to their type again when the
+// type field is stored, ErrorMigrateTypeNotStored is returned if some
+// document indexes it without storing it.  The type of the documents
+// typed by a Classifier is not indexed, they get the default mapping.
+func MigrateToScorch(path, newPath string, config map[string]interface{}) (
+	rv *MigrateReport, err error) {
+	meta, err := openIndexMeta(path)
+	if err != nil {
+		return nil, err
+	}
+	if meta.IndexType != "" && meta.IndexType != upsidedown.Name {
+		return nil, ErrorMigrateNotSupported
+	}
+
+	rv = &MigrateReport{}
+	inPlace := newPath == ""
+	if inPlace {
+		newPath = path + ".scorch"
+		rv.Backup = path + ".upsidedown"
+		if _, err := os.Stat(rv.Backup); err == nil {
+			return nil, fmt.Errorf("backup path %s already exists", rv.Backup)
+		}
+	}
+
+	src, err := OpenUsing(path, map[string]interface{}{"read_only": true})
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if cerr := src.Close(); err == nil && cerr != nil {
+			err = cerr
+		}
+	}()
+	dst, err := NewUsing(newPath, src.Mapping(), scorch.Name,
+		Config.DefaultKVStore, config)
+	if err != nil {
+		return nil, err
+	}
+	err = migrateIndex(src, dst, rv)
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.RemoveAll(newPath)
+		return nil, err
+	}
+
+	if inPlace {
+		err = os.Rename(path, rv.Backup)
+		if err != nil {
+			return nil, err
+		}
+		err = os.Rename(newPath, path)
+		if err != nil {
+			// the upsidedown index is left where it was found
+			if rerr := os.Rename(rv.Backup, path); rerr != nil {
+				return nil, fmt.Errorf("%v, and restoring %s from %s failed: %v",
+					err, path, rv.Backup, rerr)
+			}
+			return nil, err
+		}
+	}
+	return rv, nil
+}
+
+func migrateIndex(src, dst Index, rv *MigrateReport) (err error) {
+	i, err := src.Advanced()
+	if err != nil {
+		return err
+	}
+	reader, err := i.Reader()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := reader.Close(); err == nil && cerr != nil {
+			err = cerr
+		}
+	}()
+
+	batch := dst.NewBatch()
+	iv, ok := reader.(internalVisitor)
+	if !ok {
+		return ErrorMigrateNotSupported
+	}
+	err = iv.VisitInternal(func(key, val []byte) error {
+		// the mapping is written by the scorch index itself
+		if string(key) == string(mappingInternalKey) {
+			return nil
+		}
+		batch.SetInternal(key, val)
+		rv.InternalKeys++
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// the fields each document indexes without storing them are found
+	// from the terms it indexes, as visited in the back index
+	fields, err := reader.Fields()
+	if err != nil {
+		return err
+	}
+	dvr, err := reader.DocValueReader(fields)
+	if err != nil {
+		return err
+	}
+	present := map[string]int{}
+	unstored := map[string]int{}
+	docIndexed := map[string]struct{}{}
+
+	// the documents are mapped to their type from their stored fields
+	var typeField string
+	if im, ok := src.Mapping().(*mapping.IndexMappingImpl); ok &&
+		len(im.TypeMapping) > 0 {
+		typeField = im.TypeField
+	}
+
+	dr, err := reader.DocIDReaderAll()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := dr.Close(); err == nil && cerr != nil {
+			err = cerr
+		}
+	}()
+	id, err := dr.Next()
+	for err == nil && id != nil {
+		var externalID string
+		externalID, err = reader.ExternalID(id)
+		if err != nil {
+			return err
+		}
+		var d index.Document
+		d, err = reader.Document(externalID)
+		if err != nil {
+			return err
+		}
+		doc, ok := d.(*document.Document)
+		if !ok || doc == nil {
+			return fmt.Errorf("document %s: unexpected type %T", externalID, d)
+		}
+		for k := range docIndexed {
+			delete(docIndexed, k)
+		}
+		err = dvr.VisitDocValues(id, func(field string, term []byte) {
+			docIndexed[field] = struct{}{}
+		})
+		if err != nil {
+			return err
+		}
+		for _, field := range doc.Fields {
+			delete(docIndexed, field.Name())
+			present[field.Name()]++
+		}
+		if _, ok := docIndexed[typeField]; ok && typeField != "" {
+			return ErrorMigrateTypeNotStored
+		}
+		for field := range docIndexed {
+			present[field]++
+			unstored[field]++
+		}
+		err = batch.Index(externalID, storedFieldsData(doc))
+		if err != nil {
+			return err
+		}
+		rv.Documents++
+		if batch.Size() >= 1000 {
+			err = dst.Batch(batch)
+			if err != nil {
+				return err
+			}
+			batch.Reset()
+		}
+		id, err = dr.Next()
+	}
+	if err != nil {
+		return err
+	}
+	err = dst.Batch(batch)
+	if err != nil {
+		return err
+	}
+
+	for field, n := range unstored {
+		if field == "_all" || field == "_id" {
+			continue
+		}
+		if n == present[field] {
+			rv.UnstoredFields = append(rv.UnstoredFields, field)
+		} else {
+			if rv.PartlyStoredFields == nil {
+				rv.PartlyStoredFields = map[string]int{}
+			}
+			rv.PartlyStoredFields[field] = n
+		}
+	}
+	sort.Strings(rv.UnstoredFields)
+	return nil
+}
@@ -0,0 +1,164 @@
+//  Copyright (c) 2021 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bleve
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/blevesearch/bleve/v2/search"
+	"github.com/blevesearch/bleve/v2/search/collector"
+	index "github.com/blevesearch/bleve_index_api"
+)
+
+// searchCollector is what the results of a search are read from once
+// its hits were collected.
+type searchCollector interface {
+	Results() search.DocumentMatchCollection
+	Total() uint64
+	TotalIsLowerBound() bool
+	TotalGroups() uint64
+	MaxScore() float64
+	FacetResults() search.FacetResults
+}
+
+// mergedCollector holds the merged results of the collectors of
+// several groups of segments.
+type mergedCollector struct {
+	hits              search.DocumentMatchCollection
+	total             uint64
+	totalIsLowerBound bool
+	maxScore          float64
+	facets            search.FacetResults
+	partial           *PartialStatus
+}
+
+func (mc *mergedCollector) Results() search.DocumentMatchCollection { return mc.hits }
+
+func (mc *mergedCollector) Total() uint64 { return mc.total }
+
+func (mc *mergedCollector) TotalIsLowerBound() bool { return mc.totalIsLowerBound }
+
+func (mc *mergedCollector) TotalGroups() uint64 { return 0 }
+
+func (mc *mergedCollector) MaxScore() float64 { return mc.maxScore }
+
+func (mc *mergedCollector) FacetResults() search.FacetResults { return mc.facets }
+
+// collectSegmentGroups collects the hits of each group of segments,
+// starting at the provided internal IDs, on its own goroutine.  The
+// first group uses the provided collector and searcher, the others
+// get new ones.  The top hits of the groups are then merged, ordered
+// as a single collector would have ordered them, and paged through.
+// Facets of the groups, which the collectors build untruncated, are
+// merged like those of the indexes of an alias and only then truncated,
+// and the partial statuses of the groups are merged too.
+func collectSegmentGroups(ctx context.Context, req *SearchRequest,
+	indexReader index.IndexReader, groups []index.IndexInternalID,
+	coll *collector.TopNCollector, searcher search.Searcher,
+	newCollector func() *collector.TopNCollector,
+	newSearcher func() (search.Searcher, error)) (rv *mergedCollector, err error) {
+	colls := make([]*collector.TopNCollector, len(groups))
+	searchers := make([]search.Searcher, len(groups))
+	colls[0], searchers[0] = coll, searcher
+	defer func() {
+		for _, s := range searchers[1:] {
+			if s != nil {
+				if serr := s.Close(); err == nil && serr != nil {
+					err = serr
+				}
+			}
+		}
+	}()
+	for g := 1; g < len(groups); g++ {
+		colls[g] = newCollector()
+		searchers[g], err = newSearcher()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	errs := make([]error, len(groups))
+	var wg sync.WaitGroup
+	for g := range groups {
+		var end index.IndexInternalID
+		if g+1 < len(groups) {
+			end = groups[g+1]
+		}
+		colls[g].SetRange(groups[g], end)
+
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			errs[g] = colls[g].Collect(ctx, searchers[g], indexReader)
+		}(g)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	mc := &mergedCollector{}
+	for g, c := range colls {
+		// hit numbers break ties, number them as if collected in turn
+		for _, hit := range c.Results() {
+			hit.HitNumber += mc.total
+			mc.hits = append(mc.hits, hit)
+		}
+		mc.total += c.Total()
+		mc.totalIsLowerBound = mc.totalIsLowerBound || c.TotalIsLowerBound()
+		if c.MaxScore() > mc.maxScore {
+			mc.maxScore = c.MaxScore()
+		}
+		if mc.facets == nil {
+			mc.facets = c.FacetResults()
+		} else {
+			mc.facets.Merge(c.FacetResults())
+		}
+		var end index.IndexInternalID
+		if g+1 < len(groups) {
+			end = groups[g+1]
+		}
+		mc.partial = mc.partial.merge(partialStatus(indexReader, end, c))
+	}
+	for name, fr := range req.Facets {
+		mc.facets.Fixup(name, fr.Size)
+	}
+
+	sort.Sort(newSearchHitSorter(req.Sort, mc.hits))
+
+	// the rescore window is paged through once rescored
+	if req.Rescore == nil {
+		from := req.From
+		if req.SearchAfter != nil {
+			from = 0
+		}
+		if len(mc.hits) > from {
+			mc.hits = mc.hits[from:]
+		} else {
+			mc.hits = search.DocumentMatchCollection{}
+		}
+		if len(mc.hits) > req.Size {
+			mc.hits = mc.hits[:req.Size]
+		}
+	} else if size := collectSizeForRescore(req); len(mc.hits) > size {
+		mc.hits = mc.hits[:size]
+	}
+
+	return mc, nil
+}
@@ -0,0 +1,178 @@
+//  Copyright (c) 2021 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bleve
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	index "github.com/blevesearch/bleve_index_api"
+)
+
+// PointInTimeIndex is an Index able to pin its current contents, so that
+// successive searches, such as the pages of a deep paging, see the same
+// documents while indexing goes on.
+type PointInTimeIndex interface {
+	Index
+
+	// OpenPointInTime pins the current contents of the index, which are
+	// searched by the requests referencing the returned ID.  The point in
+	// time is closed once it was not searched for keepAlive.
+	OpenPointInTime(keepAlive time.Duration) (string, error)
+	// ClosePointInTime releases the contents pinned by the point in time.
+	ClosePointInTime(id string) error
+}
+
+// refCountedReader is implemented by index readers which can be shared
+// by concurrent searches, each holding its own reference, such as the
+// snapshots of scorch.  A snapshot only becomes eligible for removal
+// once its last reference is released.
+type refCountedReader interface {
+	index.IndexReader
+	AddRef()
+	DecRef() error
+}
+
+type pointInTime struct {
+	reader    index.IndexReader
+	keepAlive time.Duration
+	timer     *time.Timer
+
+	// m serializes the searches of readers which are not reference
+	// counted, and their closing
+	m      sync.Mutex
+	closed bool
+}
+
+func newPointInTimeID() (string, error) {
+	var id [16]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id[:]), nil
+}
+
+func (i *indexImpl) OpenPointInTime(keepAlive time.Duration) (string, error) {
+	if keepAlive <= 0 {
+		return "", fmt.Errorf("point in time keep alive must be positive")
+	}
+
+	i.mutex.RLock()
+	defer i.mutex.RUnlock()
+
+	if !i.open {
+		return "", ErrorIndexClosed
+	}
+
+	id, err := newPointInTimeID()
+	if err != nil {
+		return "", err
+	}
+	reader, err := i.i.Reader()
+	if err != nil {
+		return "", fmt.Errorf("error opening index reader %v", err)
+	}
+
+	pit := &pointInTime{
+		reader:    reader,
+		keepAlive: keepAlive,
+	}
+	i.pitMutex.Lock()
+	if i.pits == nil {
+		i.pits = make(map[string]*pointInTime)
+	}
+	i.pits[id] = pit
+	pit.timer = time.AfterFunc(keepAlive, func() {
+		_ = i.ClosePointInTime(id)
+	})
+	i.pitMutex.Unlock()
+
+	return id, nil
+}
+
+func (i *indexImpl) ClosePointInTime(id string) error {
+	i.pitMutex.Lock()
+	pit := i.pits[id]
+	delete(i.pits, id)
+	i.pitMutex.Unlock()
+
+	if pit == nil {
+		return ErrorPointInTimeNotFound
+	}
+	pit.timer.Stop()
+
+	// wait for the search holding the reader, unless it is shared
+	pit.m.Lock()
+	defer pit.m.Unlock()
+	pit.closed = true
+	return pit.reader.Close()
+}
+
+// acquirePointInTime returns the reader pinned by the point in time of
+// the request, and the function releasing it once searched.  Using the
+// point in time extends it by its keep alive, which the request may
+// change.
+func (i *indexImpl) acquirePointInTime(req *PointInTimeRequest) (
+	index.IndexReader, func() error, error) {
+	i.pitMutex.Lock()
+	pit := i.pits[req.ID]
+	if pit == nil {
+		i.pitMutex.Unlock()
+		return nil, nil, ErrorPointInTimeNotFound
+	}
+	if req.KeepAlive > 0 {
+		pit.keepAlive = req.KeepAlive
+	}
+	pit.timer.Reset(pit.keepAlive)
+	if rcr, ok := pit.reader.(refCountedReader); ok {
+		// referenced before the point in time can be closed
+		rcr.AddRef()
+		i.pitMutex.Unlock()
+		return rcr, rcr.DecRef, nil
+	}
+	i.pitMutex.Unlock()
+
+	pit.m.Lock()
+	if pit.closed {
+		pit.m.Unlock()
+		return nil, nil, ErrorPointInTimeNotFound
+	}
+	return pit.reader, func() error {
+		pit.m.Unlock()
+		return nil
+	}, nil
+}
+
+// closePointsInTime closes the points in time of the index.
+func (i *indexImpl) closePointsInTime() error {
+	i.pitMutex.Lock()
+	ids := make([]string, 0, len(i.pits))
+	for id := range i.pits {
+		ids = append(ids, id)
+	}
+	i.pitMutex.Unlock()
+
+	var rv error
+	for _, id := range ids {
+		if err := i.ClosePointInTime(id); err != nil &&
+			err != ErrorPointInTimeNotFound && rv == nil {
+			rv = err
+		}
+	}
+	return rv
+}
@@ -166,6 +166,14 @@ func NewPhraseQuery(terms []string, field string) *query.PhraseQuery {
 	return query.NewPhraseQuery(terms, field)
 }
 
+// NewPinnedQuery creates a new Query returning the
+// documents with the specified ids first, in the order
+// specified, followed by the documents matching the
+// organic query.
+func NewPinnedQuery(organic query.Query, ids []string) *query.PinnedQuery {
+	return query.NewPinnedQuery(organic, ids)
+}
+
 // NewPrefixQuery creates a new Query which finds
 // documents containing terms that start with the
 // specified prefix.
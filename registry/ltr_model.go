@@ -0,0 +1,89 @@
+//  Copyright (c) 2021 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package registry
+
+import (
+	"fmt"
+
+	"github.com/blevesearch/bleve/v2/search/ltr"
+)
+
+func RegisterLTRModel(name string, constructor LTRModelConstructor) {
+	_, exists := ltrModels[name]
+	if exists {
+		panic(fmt.Errorf("attempted to register duplicate ltr model named '%s'", name))
+	}
+	ltrModels[name] = constructor
+}
+
+type LTRModelConstructor func(config map[string]interface{}, cache *Cache) (ltr.Model, error)
+type LTRModelRegistry map[string]LTRModelConstructor
+
+type LTRModelCache struct {
+	*ConcurrentCache
+}
+
+func NewLTRModelCache() *LTRModelCache {
+	return &LTRModelCache{
+		NewConcurrentCache(),
+	}
+}
+
+func LTRModelBuild(name string, config map[string]interface{}, cache *Cache) (interface{}, error) {
+	cons, registered := ltrModels[name]
+	if !registered {
+		return nil, fmt.Errorf("no ltr model with name or type '%s' registered", name)
+	}
+	model, err := cons(config, cache)
+	if err != nil {
+		return nil, fmt.Errorf("error building ltr model: %v", err)
+	}
+	return model, nil
+}
+
+func (c *LTRModelCache) LTRModelNamed(name string, cache *Cache) (ltr.Model, error) {
+	item, err := c.ItemNamed(name, cache, LTRModelBuild)
+	if err != nil {
+		return nil, err
+	}
+	return item.(ltr.Model), nil
+}
+
+func (c *LTRModelCache) DefineLTRModel(name string, typ string, config map[string]interface{}, cache *Cache) (ltr.Model, error) {
+	item, err := c.DefineItem(name, typ, config, cache, LTRModelBuild)
+	if err != nil {
+		if err == ErrAlreadyDefined {
+			return nil, fmt.Errorf("ltr model named '%s' already defined", name)
+		}
+		return nil, err
+	}
+	return item.(ltr.Model), nil
+}
+
+func LTRModelTypesAndInstances() ([]string, []string) {
+	emptyConfig := map[string]interface{}{}
+	emptyCache := NewCache()
+	var types []string
+	var instances []string
+	for name, cons := range ltrModels {
+		_, err := cons(emptyConfig, emptyCache)
+		if err == nil {
+			instances = append(instances, name)
+		} else {
+			types = append(types, name)
+		}
+	}
+	return types, instances
+}
@@ -19,6 +19,7 @@ import (
 
 	"github.com/blevesearch/bleve/v2/analysis"
 	"github.com/blevesearch/bleve/v2/search/highlight"
+	"github.com/blevesearch/bleve/v2/search/ltr"
 )
 
 var stores = make(KVStoreRegistry, 0)
@@ -37,6 +38,9 @@ var tokenFilters = make(TokenFilterRegistry, 0)
 var analyzers = make(AnalyzerRegistry, 0)
 var dateTimeParsers = make(DateTimeParserRegistry, 0)
 
+// learning-to-rank
+var ltrModels = make(LTRModelRegistry, 0)
+
 type Cache struct {
 	CharFilters        *CharFilterCache
 	Tokenizers         *TokenizerCache
@@ -47,6 +51,7 @@ type Cache struct {
 	FragmentFormatters *FragmentFormatterCache
 	Fragmenters        *FragmenterCache
 	Highlighters       *HighlighterCache
+	LTRModels          *LTRModelCache
 }
 
 func NewCache() *Cache {
@@ -60,6 +65,7 @@ func NewCache() *Cache {
 		FragmentFormatters: NewFragmentFormatterCache(),
 		Fragmenters:        NewFragmenterCache(),
 		Highlighters:       NewHighlighterCache(),
+		LTRModels:          NewLTRModelCache(),
 	}
 }
 
@@ -182,3 +188,15 @@ func (c *Cache) DefineHighlighter(name string, config map[string]interface{}) (h
 	}
 	return c.Highlighters.DefineHighlighter(name, typ, config, c)
 }
+
+func (c *Cache) LTRModelNamed(name string) (ltr.Model, error) {
+	return c.LTRModels.LTRModelNamed(name, c)
+}
+
+func (c *Cache) DefineLTRModel(name string, config map[string]interface{}) (ltr.Model, error) {
+	typ, err := typeFromConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	return c.LTRModels.DefineLTRModel(name, typ, config, c)
+}
@@ -0,0 +1,185 @@
+//  Copyright (c) 2024 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bleve
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/blevesearch/bleve/v2/index/scorch"
+)
+
+// Follower is a read-only replica of a leader scorch index, kept in a
+// directory of its own.  Each Sync copies the segment files of the
+// latest snapshot persisted by the leader which the follower misses,
+// and applies its root.  Searches are served by Index at the follower's
+// own pace, while the leader keeps indexing.
+type Follower struct {
+	path   string
+	source scorch.ReplicationSource
+	alias  IndexAlias
+
+	notifyCh chan struct{}
+
+	m     sync.Mutex // Serializes syncs, protects below.
+	index Index
+	epoch uint64
+}
+
+// ReplicationSource returns the source through which followers tail the
+// given index, which must be a scorch index.
+func ReplicationSource(i Index) (scorch.ReplicationSource, error) {
+	ii, err := i.Advanced()
+	if err != nil {
+		return nil, err
+	}
+	rv, ok := ii.(scorch.ReplicationSource)
+	if !ok {
+		return nil, fmt.Errorf("replication: index type %T is not supported", ii)
+	}
+	return rv, nil
+}
+
+// NewFollower creates a follower of source in path, or resumes the one
+// already there, and brings it up to date.
+func NewFollower(path string, source scorch.ReplicationSource) (*Follower, error) {
+	_, err := openIndexMeta(path)
+	if err == ErrorIndexPathDoesNotExist {
+		err = newIndexMeta(scorch.Name, Config.DefaultKVStore, nil).Save(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rv := &Follower{
+		path:     path,
+		source:   source,
+		alias:    NewIndexAlias(),
+		notifyCh: make(chan struct{}, 1),
+	}
+	err = rv.Sync()
+	if err != nil {
+		return nil, err
+	}
+	return rv, nil
+}
+
+// Index returns the read-only index serving the searches of the
+// follower, which always searches the latest snapshot applied.  It holds
+// no index until the leader has persisted a snapshot.
+func (f *Follower) Index() IndexAlias {
+	return f.alias
+}
+
+// Epoch returns the epoch of the latest leader snapshot applied.
+func (f *Follower) Epoch() uint64 {
+	f.m.Lock()
+	defer f.m.Unlock()
+	return f.epoch
+}
+
+// Sync applies the latest snapshot persisted by the leader, if it is
+// newer than the one the follower serves.  The searches in flight on the
+// previous snapshot complete before its segment files are removed.
+func (f *Follower) Sync() error {
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	snapshot, err := scorch.Replicate(f.source, indexStorePath(f.path), f.epoch)
+	if err != nil || snapshot == nil {
+		return err
+	}
+
+	index, err := OpenUsing(f.path, map[string]interface{}{
+		"read_only": true,
+	})
+	if err != nil {
+		return err
+	}
+
+	var out []Index
+	if f.index != nil {
+		out = append(out, f.index)
+	}
+	f.alias.Swap([]Index{index}, out)
+	prev := f.index
+	f.index = index
+	f.epoch = snapshot.Epoch
+
+	if prev != nil {
+		err = prev.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return scorch.PruneReplica(indexStorePath(f.path), snapshot)
+}
+
+// Notify requests a Sync from Run, without waiting for it.
+func (f *Follower) Notify() {
+	select {
+	case f.notifyCh <- struct{}{}:
+	default:
+	}
+}
+
+// OnEvent notifies the follower each time the leader persists, it can
+// be registered in scorch.RegistryEventCallbacks for a leader in the
+// same process.
+func (f *Follower) OnEvent(e scorch.Event) {
+	if e.Kind == scorch.EventKindPersisterProgress {
+		f.Notify()
+	}
+}
+
+// Run syncs the follower when notified, and at least every interval if
+// it is positive, until ctx is done.  Sync errors are logged, the next
+// sync retrying with the snapshot the leader persisted by then.
+func (f *Follower) Run(ctx context.Context, interval time.Duration) error {
+	var tickCh <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tickCh = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-f.notifyCh:
+		case <-tickCh:
+		}
+		if err := f.Sync(); err != nil {
+			logger.Printf("follower %s: sync error: %v", f.path, err)
+		}
+	}
+}
+
+// Close closes the index of the follower.
+func (f *Follower) Close() error {
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	if f.index == nil {
+		return nil
+	}
+	f.alias.Remove(f.index)
+	err := f.index.Close()
+	f.index = nil
+	return err
+}
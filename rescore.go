@@ -0,0 +1,323 @@
+//  Copyright (c) 2021 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bleve
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/blevesearch/bleve/v2/mapping"
+	"github.com/blevesearch/bleve/v2/search"
+	"github.com/blevesearch/bleve/v2/search/query"
+	index "github.com/blevesearch/bleve_index_api"
+)
+
+const (
+	RescoreModeTotal    = "total"
+	RescoreModeMultiply = "multiply"
+	RescoreModeAvg      = "avg"
+	RescoreModeMax      = "max"
+	RescoreModeMin      = "min"
+)
+
+// DefaultRescoreWindowSize is the number of top hits rescored
+// when a RescoreRequest does not specify a window size.
+var DefaultRescoreWindowSize = 10
+
+// A RescoreRequest describes a second, typically more
+// expensive, query used to re-score the top WindowSize
+// hits of the main query.  The score of each hit in the
+// window is combined with the score of the rescore query
+// as described by ScoreMode, after weighting the two with
+// QueryWeight and RescoreQueryWeight respectively.  Hits
+// not matching the rescore query keep their weighted
+// original score.
+// Instead of a query, Model may name a registered
+// learning-to-rank model, which then scores the hits from
+// the features of the search request.
+type RescoreRequest struct {
+	Query              query.Query `json:"query,omitempty"`
+	Model              string      `json:"model,omitempty"`
+	WindowSize         int         `json:"window_size"`
+	QueryWeight        float64     `json:"query_weight"`
+	RescoreQueryWeight float64     `json:"rescore_query_weight"`
+	ScoreMode          string      `json:"score_mode,omitempty"`
+}
+
+// NewRescoreRequest creates a RescoreRequest re-scoring
+// the top windowSize hits with the provided query, using
+// the default weights of 1 and the total score mode.
+func NewRescoreRequest(q query.Query, windowSize int) *RescoreRequest {
+	return &RescoreRequest{
+		Query:              q,
+		WindowSize:         windowSize,
+		QueryWeight:        1,
+		RescoreQueryWeight: 1,
+		ScoreMode:          RescoreModeTotal,
+	}
+}
+
+// NewModelRescoreRequest creates a RescoreRequest re-scoring
+// the top windowSize hits with the named ltr model, using
+// the default weights of 1 and the total score mode.
+func NewModelRescoreRequest(model string, windowSize int) *RescoreRequest {
+	return &RescoreRequest{
+		Model:              model,
+		WindowSize:         windowSize,
+		QueryWeight:        1,
+		RescoreQueryWeight: 1,
+		ScoreMode:          RescoreModeTotal,
+	}
+}
+
+func (r *RescoreRequest) Validate() error {
+	if r.Query == nil && r.Model == "" {
+		return fmt.Errorf("rescore must specify a query or a model")
+	}
+	if r.Query != nil && r.Model != "" {
+		return fmt.Errorf("rescore cannot specify both a query and a model")
+	}
+	if srq, ok := r.Query.(query.ValidatableQuery); ok {
+		err := srq.Validate()
+		if err != nil {
+			return err
+		}
+	}
+	if r.WindowSize < 0 {
+		return fmt.Errorf("rescore window size must not be negative")
+	}
+	switch r.ScoreMode {
+	case "", RescoreModeTotal, RescoreModeMultiply, RescoreModeAvg,
+		RescoreModeMax, RescoreModeMin:
+	default:
+		return fmt.Errorf("unknown rescore score mode '%s'", r.ScoreMode)
+	}
+	return nil
+}
+
+// UnmarshalJSON deserializes a JSON representation of
+// a RescoreRequest
+func (r *RescoreRequest) UnmarshalJSON(input []byte) error {
+	var temp struct {
+		Q                  json.RawMessage `json:"query"`
+		Model              string          `json:"model"`
+		WindowSize         *int            `json:"window_size"`
+		QueryWeight        *float64        `json:"query_weight"`
+		RescoreQueryWeight *float64        `json:"rescore_query_weight"`
+		ScoreMode          string          `json:"score_mode"`
+	}
+
+	err := json.Unmarshal(input, &temp)
+	if err != nil {
+		return err
+	}
+
+	r.WindowSize = DefaultRescoreWindowSize
+	if temp.WindowSize != nil {
+		r.WindowSize = *temp.WindowSize
+	}
+	r.QueryWeight = 1
+	if temp.QueryWeight != nil {
+		r.QueryWeight = *temp.QueryWeight
+	}
+	r.RescoreQueryWeight = 1
+	if temp.RescoreQueryWeight != nil {
+		r.RescoreQueryWeight = *temp.RescoreQueryWeight
+	}
+	r.ScoreMode = temp.ScoreMode
+	r.Model = temp.Model
+	if temp.Q != nil {
+		r.Query, err = query.ParseQuery(temp.Q)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *RescoreRequest) combine(score float64, rescore float64) float64 {
+	score *= r.QueryWeight
+	rescore *= r.RescoreQueryWeight
+	switch r.ScoreMode {
+	case RescoreModeMultiply:
+		return score * rescore
+	case RescoreModeAvg:
+		return (score + rescore) / 2
+	case RescoreModeMax:
+		if rescore > score {
+			return rescore
+		}
+		return score
+	case RescoreModeMin:
+		if rescore < score {
+			return rescore
+		}
+		return score
+	}
+	return score + rescore
+}
+
+// sortIsScoreDesc returns true if the sort order only
+// orders hits by descending score
+func sortIsScoreDesc(so search.SortOrder) bool {
+	if len(so) != 1 {
+		return false
+	}
+	ss, ok := so[0].(*search.SortScore)
+	return ok && ss.Desc
+}
+
+// collectSizeForRescore returns the number of top hits which must be
+// collected, so that the complete rescore window is available.
+func collectSizeForRescore(req *SearchRequest) int {
+	rv := req.Size + req.From
+	if req.Rescore.WindowSize > rv {
+		rv = req.Rescore.WindowSize
+	}
+	return rv
+}
+
+// rescoreHits re-scores the hits within the rescore window using the
+// rescore query or model, and re-sorts the window by the new scores.
+// Hits outside of the window are left as they are, following the window.
+func rescoreHits(ctx context.Context, req *SearchRequest,
+	r index.IndexReader, m mapping.IndexMapping,
+	hits search.DocumentMatchCollection) error {
+	window := hits
+	if len(window) > req.Rescore.WindowSize {
+		window = window[:req.Rescore.WindowSize]
+	}
+	if len(window) == 0 {
+		return nil
+	}
+
+	var err error
+	if req.Rescore.Model != "" {
+		err = rescoreHitsWithModel(ctx, req, r, m, window)
+	} else {
+		err = visitQueryMatches(ctx, req.Rescore.Query, r, m,
+			search.SearcherOptions{
+				Explain: req.Explain,
+				Score:   req.Score,
+			}, window, func(hit, match *search.DocumentMatch) {
+				newScore := hit.Score * req.Rescore.QueryWeight
+				var rescoreExpl *search.Explanation
+				if match != nil {
+					newScore = req.Rescore.combine(hit.Score, match.Score)
+					rescoreExpl = match.Expl
+				}
+				req.Rescore.updateHit(hit, newScore, req.Explain, rescoreExpl)
+			})
+	}
+	if err != nil {
+		return err
+	}
+
+	sort.SliceStable(window, func(i, j int) bool {
+		return window[i].Score > window[j].Score
+	})
+
+	return nil
+}
+
+func (r *RescoreRequest) updateHit(hit *search.DocumentMatch, newScore float64,
+	explain bool, rescoreExpl *search.Explanation) {
+	if explain {
+		children := []*search.Explanation{hit.Expl}
+		if rescoreExpl != nil {
+			children = append(children, rescoreExpl)
+		}
+		hit.Expl = &search.Explanation{
+			Value: newScore,
+			Message: fmt.Sprintf("rescore %s, with query weight %f and rescore query weight %f",
+				r.scoreMode(), r.QueryWeight, r.RescoreQueryWeight),
+			Children: children,
+		}
+	}
+	hit.Score = newScore
+}
+
+// visitQueryMatches runs the query over the provided hits only.  The
+// visitor is invoked with each hit, along with the match of the query
+// for that hit, or nil if the query does not match it.
+func visitQueryMatches(ctx context.Context, q query.Query,
+	r index.IndexReader, m mapping.IndexMapping, options search.SearcherOptions,
+	hits search.DocumentMatchCollection,
+	visitor func(hit, match *search.DocumentMatch)) (err error) {
+	searcher, err := q.Searcher(r, m, options)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if serr := searcher.Close(); err == nil && serr != nil {
+			err = serr
+		}
+	}()
+
+	// visit the hits in index order, so the searcher only moves forward
+	byID := make(search.DocumentMatchCollection, len(hits))
+	copy(byID, hits)
+	sort.Slice(byID, func(i, j int) bool {
+		return byID[i].IndexInternalID.Compare(byID[j].IndexInternalID) < 0
+	})
+
+	sctx := &search.SearchContext{
+		DocumentMatchPool: search.NewDocumentMatchPool(searcher.DocumentMatchPoolSize()+1, 0),
+		IndexReader:       r,
+	}
+	var next *search.DocumentMatch
+	// once the searcher has returned nil it must not be advanced again,
+	// not every searcher tolerates Advance after it is exhausted
+	var exhausted bool
+	for _, hit := range byID {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		if !exhausted && (next == nil || next.IndexInternalID.Compare(hit.IndexInternalID) < 0) {
+			if next != nil {
+				sctx.DocumentMatchPool.Put(next)
+			}
+			next, err = searcher.Advance(sctx, hit.IndexInternalID)
+			if err != nil {
+				return err
+			}
+			exhausted = next == nil
+		}
+
+		if next != nil && next.IndexInternalID.Equals(hit.IndexInternalID) {
+			visitor(hit, next)
+		} else {
+			visitor(hit, nil)
+		}
+	}
+	if next != nil {
+		sctx.DocumentMatchPool.Put(next)
+	}
+
+	return nil
+}
+
+func (r *RescoreRequest) scoreMode() string {
+	if r.ScoreMode == "" {
+		return RescoreModeTotal
+	}
+	return r.ScoreMode
+}
@@ -0,0 +1,276 @@
+//  Copyright (c) 2021 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bleve
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/blevesearch/bleve/v2/search"
+	"github.com/blevesearch/bleve/v2/search/query"
+	index "github.com/blevesearch/bleve_index_api"
+)
+
+// ScanIndex is an Index able to return every document matching a query,
+// such as for exports or reindexing, without the cost of paging through
+// the top hits of a search.
+type ScanIndex interface {
+	Index
+
+	// Scan returns an iterator over the documents matching the query
+	// of the request, which must be closed once done with.
+	Scan(ctx context.Context, req *ScanRequest) (*ScanIterator, error)
+}
+
+// A ScanRequest describes the documents returned by a scan.
+// Query selects the documents, which are not scored.
+// Fields describes a list of field values which should be retrieved
+// for the documents, provided they were stored while indexing.
+// PointInTime scans the contents pinned by a point in time of the
+// index, instead of its current contents.
+type ScanRequest struct {
+	Query       query.Query         `json:"query"`
+	Fields      []string            `json:"fields,omitempty"`
+	PointInTime *PointInTimeRequest `json:"pit,omitempty"`
+}
+
+func (r *ScanRequest) Validate() error {
+	if r.Query == nil {
+		return fmt.Errorf("scan must specify a query")
+	}
+	if srq, ok := r.Query.(query.ValidatableQuery); ok {
+		err := srq.Validate()
+		if err != nil {
+			return err
+		}
+	}
+	if r.PointInTime != nil {
+		return r.PointInTime.Validate()
+	}
+	return nil
+}
+
+// UnmarshalJSON deserializes a JSON representation of a ScanRequest
+func (r *ScanRequest) UnmarshalJSON(input []byte) error {
+	var temp struct {
+		Q           json.RawMessage     `json:"query"`
+		Fields      []string            `json:"fields"`
+		PointInTime *PointInTimeRequest `json:"pit"`
+	}
+
+	err := json.Unmarshal(input, &temp)
+	if err != nil {
+		return err
+	}
+
+	r.Fields = temp.Fields
+	r.PointInTime = temp.PointInTime
+	r.Query, err = query.ParseQuery(temp.Q)
+	return err
+}
+
+// ScanIterator iterates over the documents matching the query of a
+// scan, in index order.  When scanning several indexes, those of each
+// index are returned in turn.
+type ScanIterator struct {
+	ctx   context.Context
+	scans []*indexScan
+}
+
+// indexScan is the scan of a single index.
+type indexScan struct {
+	name     string
+	reader   index.IndexReader
+	release  func() error
+	searcher search.Searcher
+	sctx     *search.SearchContext
+	// the request the fields of the documents are loaded for
+	fieldsReq *SearchRequest
+}
+
+// Next returns the next matching document, or nil once all of them
+// were returned.  The document belongs to the caller.
+func (it *ScanIterator) Next() (*search.DocumentMatch, error) {
+	for len(it.scans) > 0 {
+		if err := it.ctx.Err(); err != nil {
+			return nil, err
+		}
+		s := it.scans[0]
+		next, err := s.searcher.Next(s.sctx)
+		if err != nil {
+			return nil, err
+		}
+		if next == nil {
+			it.scans = it.scans[1:]
+			if err = s.close(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		next.ID, err = s.reader.ExternalID(next.IndexInternalID)
+		if err != nil {
+			return nil, err
+		}
+		if s.name != "" {
+			next.Index = s.name
+		}
+		err = LoadAndHighlightFields(next, s.fieldsReq, s.name, s.reader, nil)
+		if err != nil {
+			return nil, err
+		}
+		return next, nil
+	}
+	return nil, nil
+}
+
+// Close releases the readers of the indexes which were not fully
+// scanned.
+func (it *ScanIterator) Close() error {
+	var rv error
+	for _, s := range it.scans {
+		if err := s.close(); err != nil && rv == nil {
+			rv = err
+		}
+	}
+	it.scans = nil
+	return rv
+}
+
+func (s *indexScan) close() error {
+	err := s.searcher.Close()
+	if rerr := s.release(); err == nil {
+		err = rerr
+	}
+	return err
+}
+
+func (i *indexImpl) Scan(ctx context.Context, req *ScanRequest) (*ScanIterator, error) {
+	s, err := i.openScan(req)
+	if err != nil {
+		return nil, err
+	}
+	return &ScanIterator{
+		ctx:   ctx,
+		scans: []*indexScan{s},
+	}, nil
+}
+
+func (i *indexImpl) openScan(req *ScanRequest) (s *indexScan, err error) {
+	if err = req.Validate(); err != nil {
+		return nil, err
+	}
+
+	i.mutex.RLock()
+	defer i.mutex.RUnlock()
+
+	if !i.open {
+		return nil, ErrorIndexClosed
+	}
+
+	// open a reader for this scan, or use the pinned one
+	var indexReader index.IndexReader
+	release := func() error { return indexReader.Close() }
+	if req.PointInTime != nil {
+		indexReader, release, err = i.acquirePointInTime(req.PointInTime)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		indexReader, err = i.i.Reader()
+		if err != nil {
+			return nil, fmt.Errorf("error opening index reader %v", err)
+		}
+	}
+	defer func() {
+		if err != nil {
+			_ = release()
+		}
+	}()
+
+	plan, err := query.PlanQuery(req.Query, indexReader, i.m, false)
+	if err != nil {
+		return nil, err
+	}
+	searcher, err := plan.Query.Searcher(indexReader, i.m, search.SearcherOptions{
+		Score: "none",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &indexScan{
+		name:     i.name,
+		reader:   indexReader,
+		release:  release,
+		searcher: searcher,
+		sctx: &search.SearchContext{
+			DocumentMatchPool: search.NewDocumentMatchPool(searcher.DocumentMatchPoolSize(), 0),
+			IndexReader:       indexReader,
+		},
+		fieldsReq: &SearchRequest{
+			Fields: req.Fields,
+		},
+	}, nil
+}
+
+// scanOpener is implemented by the indexes which an alias can scan.
+type scanOpener interface {
+	openScan(req *ScanRequest) (*indexScan, error)
+}
+
+// Scan returns the documents of each index of the alias in turn, as
+// pinned when the scan starts.  A point in time belongs to a single
+// index, so it can only be scanned through an alias to that index.
+func (i *indexAliasImpl) Scan(ctx context.Context, req *ScanRequest) (*ScanIterator, error) {
+	i.mutex.RLock()
+	defer i.mutex.RUnlock()
+
+	if !i.open {
+		return nil, ErrorIndexClosed
+	}
+
+	if req.PointInTime != nil && len(i.indexes) > 1 {
+		return nil, ErrorAliasPointInTime
+	}
+
+	rv := &ScanIterator{
+		ctx: ctx,
+	}
+	for _, in := range i.indexes {
+		var s *indexScan
+		var err error
+		switch in := in.(type) {
+		case scanOpener:
+			s, err = in.openScan(req)
+		case *indexAliasImpl:
+			var it *ScanIterator
+			it, err = in.Scan(ctx, req)
+			if err == nil {
+				rv.scans = append(rv.scans, it.scans...)
+				continue
+			}
+		default:
+			err = fmt.Errorf("index '%s' does not support scans", in.Name())
+		}
+		if err != nil {
+			_ = rv.Close()
+			return nil, err
+		}
+		rv.scans = append(rv.scans, s)
+	}
+	return rv, nil
+}
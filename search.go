@@ -248,6 +248,185 @@ func (h *HighlightRequest) AddField(field string) {
 	h.Fields = append(h.Fields, field)
 }
 
+// CollapseRequest describes how search hits should be
+// collapsed, so that only the best hit for each distinct
+// value of Field is returned.  Field must be indexed
+// with doc values, and is expected to hold a single
+// keyword value per document.
+// InnerHits optionally retains the next best hits of
+// each group alongside the group's best hit.
+type CollapseRequest struct {
+	Field     string `json:"field"`
+	InnerHits int    `json:"inner_hits,omitempty"`
+}
+
+// NewCollapseRequest creates a CollapseRequest on the
+// specified field, retaining the specified number of
+// inner hits for each group.
+func NewCollapseRequest(field string, innerHits int) *CollapseRequest {
+	return &CollapseRequest{
+		Field:     field,
+		InnerHits: innerHits,
+	}
+}
+
+func (cr *CollapseRequest) Validate() error {
+	if cr.Field == "" {
+		return fmt.Errorf("collapse must specify a field")
+	}
+	if cr.InnerHits < 0 {
+		return fmt.Errorf("collapse inner hits must not be negative")
+	}
+	return nil
+}
+
+// PointInTimeRequest references the point in time of an index, opened
+// by OpenPointInTime, whose pinned contents are searched.  A positive
+// KeepAlive replaces the keep alive of the point in time.
+type PointInTimeRequest struct {
+	ID        string        `json:"id"`
+	KeepAlive time.Duration `json:"keep_alive,omitempty"`
+}
+
+func (pr *PointInTimeRequest) Validate() error {
+	if pr.ID == "" {
+		return fmt.Errorf("point in time must specify an id")
+	}
+	if pr.KeepAlive < 0 {
+		return fmt.Errorf("point in time keep alive must not be negative")
+	}
+	return nil
+}
+
+// MarshalJSON writes the keep alive as a duration string, such as "5m".
+func (pr *PointInTimeRequest) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		ID        string `json:"id"`
+		KeepAlive string `json:"keep_alive,omitempty"`
+	}{
+		ID:        pr.ID,
+		KeepAlive: durationString(pr.KeepAlive),
+	})
+}
+
+// UnmarshalJSON reads the keep alive as a duration string, such as "5m",
+// or as a number of nanoseconds.
+func (pr *PointInTimeRequest) UnmarshalJSON(input []byte) error {
+	var temp struct {
+		ID        string          `json:"id"`
+		KeepAlive json.RawMessage `json:"keep_alive"`
+	}
+	err := json.Unmarshal(input, &temp)
+	if err != nil {
+		return err
+	}
+	pr.ID = temp.ID
+	pr.KeepAlive, err = parseJSONDuration(temp.KeepAlive)
+	if err != nil {
+		return fmt.Errorf("point in time keep alive: %v", err)
+	}
+	return nil
+}
+
+// SearchTimeouts describes the time budgets of the phases of a
+// search, a budget of 0 meaning no limit besides the deadline of
+// the context of the search.
+// Query bounds the time spent collecting the hits.
+// Facets bounds the time spent visiting the doc values of the
+// hits for the facets, while collecting them.
+// Highlight bounds the time spent loading the fields of the hits
+// and highlighting them.
+type SearchTimeouts struct {
+	Query     time.Duration `json:"query,omitempty"`
+	Facets    time.Duration `json:"facets,omitempty"`
+	Highlight time.Duration `json:"highlight,omitempty"`
+}
+
+func (st *SearchTimeouts) Validate() error {
+	if st.Query < 0 || st.Facets < 0 || st.Highlight < 0 {
+		return fmt.Errorf("timeouts must not be negative")
+	}
+	return nil
+}
+
+// MarshalJSON writes the timeouts as duration strings, such as "500ms".
+func (st *SearchTimeouts) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Query     string `json:"query,omitempty"`
+		Facets    string `json:"facets,omitempty"`
+		Highlight string `json:"highlight,omitempty"`
+	}{
+		Query:     durationString(st.Query),
+		Facets:    durationString(st.Facets),
+		Highlight: durationString(st.Highlight),
+	})
+}
+
+// UnmarshalJSON reads the timeouts as duration strings, such as "500ms",
+// or as numbers of nanoseconds.
+func (st *SearchTimeouts) UnmarshalJSON(input []byte) error {
+	var temp struct {
+		Query     json.RawMessage `json:"query"`
+		Facets    json.RawMessage `json:"facets"`
+		Highlight json.RawMessage `json:"highlight"`
+	}
+	err := json.Unmarshal(input, &temp)
+	if err != nil {
+		return err
+	}
+	for _, d := range []struct {
+		name  string
+		input json.RawMessage
+		rv    *time.Duration
+	}{
+		{"query", temp.Query, &st.Query},
+		{"facets", temp.Facets, &st.Facets},
+		{"highlight", temp.Highlight, &st.Highlight},
+	} {
+		*d.rv, err = parseJSONDuration(d.input)
+		if err != nil {
+			return fmt.Errorf("timeouts %s: %v", d.name, err)
+		}
+	}
+	return nil
+}
+
+// durationString returns the duration as parsed by time.ParseDuration,
+// or the empty string for no duration.
+func durationString(d time.Duration) string {
+	if d == 0 {
+		return ""
+	}
+	return d.String()
+}
+
+// parseJSONDuration parses a JSON duration string, such as "500ms", or
+// a JSON number of nanoseconds.  A missing or null duration is 0.
+func parseJSONDuration(input json.RawMessage) (time.Duration, error) {
+	if len(input) == 0 || string(input) == "null" {
+		return 0, nil
+	}
+	var str string
+	if err := json.Unmarshal(input, &str); err == nil {
+		return time.ParseDuration(str)
+	}
+	var nanos int64
+	err := json.Unmarshal(input, &nanos)
+	if err != nil {
+		return 0, fmt.Errorf("duration must be a string, such as \"500ms\"")
+	}
+	return time.Duration(nanos), nil
+}
+
+const (
+	// TrackTotalHitsExact counts every matching document,
+	// it is the default.
+	TrackTotalHitsExact = 0
+	// TrackTotalHitsOff only counts the matching documents
+	// visited while finding the top hits.
+	TrackTotalHitsOff = -1
+)
+
 // A SearchRequest describes all the parameters
 // needed to search the index.
 // Query is required.
@@ -266,21 +445,56 @@ func (h *HighlightRequest) AddField(field string) {
 // SearchAfter supports deep paging by providing a minimum sort key
 // SearchBefore supports deep paging by providing a maximum sort key
 // sortFunc specifies the sort implementation to use for sorting results.
+// Collapse optionally collapses the results to the best hit for each
+// distinct value of a field.
+// Rescore optionally re-scores the top hits with a second query.
+// Features describes learning-to-rank features whose values should be
+// computed for each result, and which ltr model rescoring relies on.
+// Fusion optionally merges the ranked results of several queries, or of
+// several indexes, by rank or normalized score instead of raw score.
+// TrackTotalHits controls how precisely matching documents are counted,
+// either exactly (TrackTotalHitsExact), only as far as needed to find
+// the top hits (TrackTotalHitsOff), or exactly up to the given number.
+// When not counted exactly, documents which cannot enter the top hits
+// may be skipped, and the total of the result is a lower bound.
+// Parallelism, when above 1, splits the search of an index made of
+// segments into up to that many groups of segments, which are searched
+// concurrently and whose results are merged.  Searches collapsing their
+// results are not split.
+// Profile triggers inclusion of the cost of each searcher of the query,
+// and of the collecting, faceting and highlighting of the results.
+// Profiled searches are not split by Parallelism.
+// AllowPartialResults returns the results found so far, instead of an
+// error, once the deadline of the context of the search passes, or a
+// phase runs out of the time budget set by Timeouts.  The status of the
+// result then lists the indexes, and their segments, which timed out.
+// PointInTime searches the contents pinned by a point in time of the
+// index, instead of its current contents.
 //
 // A special field named "*" can be used to return all fields.
 type SearchRequest struct {
-	Query            query.Query       `json:"query"`
-	Size             int               `json:"size"`
-	From             int               `json:"from"`
-	Highlight        *HighlightRequest `json:"highlight"`
-	Fields           []string          `json:"fields"`
-	Facets           FacetsRequest     `json:"facets"`
-	Explain          bool              `json:"explain"`
-	Sort             search.SortOrder  `json:"sort"`
-	IncludeLocations bool              `json:"includeLocations"`
-	Score            string            `json:"score,omitempty"`
-	SearchAfter      []string          `json:"search_after"`
-	SearchBefore     []string          `json:"search_before"`
+	Query               query.Query         `json:"query"`
+	Size                int                 `json:"size"`
+	From                int                 `json:"from"`
+	Highlight           *HighlightRequest   `json:"highlight"`
+	Fields              []string            `json:"fields"`
+	Facets              FacetsRequest       `json:"facets"`
+	Explain             bool                `json:"explain"`
+	Sort                search.SortOrder    `json:"sort"`
+	IncludeLocations    bool                `json:"includeLocations"`
+	Score               string              `json:"score,omitempty"`
+	SearchAfter         []string            `json:"search_after"`
+	SearchBefore        []string            `json:"search_before"`
+	Collapse            *CollapseRequest    `json:"collapse,omitempty"`
+	Rescore             *RescoreRequest     `json:"rescore,omitempty"`
+	Features            FeaturesRequest     `json:"features,omitempty"`
+	Fusion              *FusionRequest      `json:"fusion,omitempty"`
+	TrackTotalHits      int                 `json:"track_total_hits,omitempty"`
+	Parallelism         int                 `json:"parallelism,omitempty"`
+	Profile             bool                `json:"profile,omitempty"`
+	AllowPartialResults bool                `json:"allow_partial_results,omitempty"`
+	Timeouts            *SearchTimeouts     `json:"timeouts,omitempty"`
+	PointInTime         *PointInTimeRequest `json:"pit,omitempty"`
 
 	sortFunc func(sort.Interface)
 }
@@ -314,6 +528,77 @@ func (r *SearchRequest) Validate() error {
 		}
 	}
 
+	if r.Collapse != nil {
+		err := r.Collapse.Validate()
+		if err != nil {
+			return err
+		}
+	}
+
+	if r.Rescore != nil {
+		err := r.Rescore.Validate()
+		if err != nil {
+			return err
+		}
+		if !sortIsScoreDesc(r.Sort) {
+			return fmt.Errorf("rescore can only be used when sorting by descending score")
+		}
+		if r.SearchAfter != nil || r.SearchBefore != nil {
+			return fmt.Errorf("cannot use rescore with search after or search before")
+		}
+		if r.Collapse != nil {
+			return fmt.Errorf("cannot use rescore with collapse")
+		}
+		if r.Rescore.Model != "" && len(r.Features) == 0 {
+			return fmt.Errorf("rescore with a model requires features")
+		}
+	}
+
+	if r.Fusion != nil {
+		err := r.Fusion.Validate()
+		if err != nil {
+			return err
+		}
+		if !sortIsScoreDesc(r.Sort) {
+			return fmt.Errorf("fusion can only be used when sorting by descending score")
+		}
+		if r.SearchAfter != nil || r.SearchBefore != nil {
+			return fmt.Errorf("cannot use fusion with search after or search before")
+		}
+		if r.Collapse != nil || r.Rescore != nil {
+			return fmt.Errorf("cannot use fusion with collapse or rescore")
+		}
+	}
+
+	if r.TrackTotalHits < TrackTotalHitsOff {
+		return fmt.Errorf("invalid track total hits %d", r.TrackTotalHits)
+	}
+
+	if r.Parallelism < 0 {
+		return fmt.Errorf("invalid parallelism %d", r.Parallelism)
+	}
+
+	if r.Timeouts != nil {
+		err := r.Timeouts.Validate()
+		if err != nil {
+			return err
+		}
+	}
+
+	if r.PointInTime != nil {
+		err := r.PointInTime.Validate()
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(r.Features) > 0 {
+		err := r.Features.Validate()
+		if err != nil {
+			return err
+		}
+	}
+
 	return r.Facets.Validate()
 }
 
@@ -325,6 +610,11 @@ func (r *SearchRequest) AddFacet(facetName string, f *FacetRequest) {
 	r.Facets[facetName] = f
 }
 
+// AddFeature adds a learning-to-rank FeatureRequest to this SearchRequest
+func (r *SearchRequest) AddFeature(f *FeatureRequest) {
+	r.Features = append(r.Features, f)
+}
+
 // SortBy changes the request to use the requested sort order
 // this form uses the simplified syntax with an array of strings
 // each string can either be a field name
@@ -356,18 +646,28 @@ func (r *SearchRequest) SetSearchBefore(before []string) {
 // a SearchRequest
 func (r *SearchRequest) UnmarshalJSON(input []byte) error {
 	var temp struct {
-		Q                json.RawMessage   `json:"query"`
-		Size             *int              `json:"size"`
-		From             int               `json:"from"`
-		Highlight        *HighlightRequest `json:"highlight"`
-		Fields           []string          `json:"fields"`
-		Facets           FacetsRequest     `json:"facets"`
-		Explain          bool              `json:"explain"`
-		Sort             []json.RawMessage `json:"sort"`
-		IncludeLocations bool              `json:"includeLocations"`
-		Score            string            `json:"score"`
-		SearchAfter      []string          `json:"search_after"`
-		SearchBefore     []string          `json:"search_before"`
+		Q                   json.RawMessage     `json:"query"`
+		Size                *int                `json:"size"`
+		From                int                 `json:"from"`
+		Highlight           *HighlightRequest   `json:"highlight"`
+		Fields              []string            `json:"fields"`
+		Facets              FacetsRequest       `json:"facets"`
+		Explain             bool                `json:"explain"`
+		Sort                []json.RawMessage   `json:"sort"`
+		IncludeLocations    bool                `json:"includeLocations"`
+		Score               string              `json:"score"`
+		SearchAfter         []string            `json:"search_after"`
+		SearchBefore        []string            `json:"search_before"`
+		Collapse            *CollapseRequest    `json:"collapse"`
+		Rescore             *RescoreRequest     `json:"rescore"`
+		Features            FeaturesRequest     `json:"features"`
+		Fusion              *FusionRequest      `json:"fusion"`
+		TrackTotalHits      json.RawMessage     `json:"track_total_hits"`
+		Parallelism         int                 `json:"parallelism"`
+		Profile             bool                `json:"profile"`
+		AllowPartialResults bool                `json:"allow_partial_results"`
+		Timeouts            *SearchTimeouts     `json:"timeouts"`
+		PointInTime         *PointInTimeRequest `json:"pit"`
 	}
 
 	err := json.Unmarshal(input, &temp)
@@ -397,6 +697,19 @@ func (r *SearchRequest) UnmarshalJSON(input []byte) error {
 	r.Score = temp.Score
 	r.SearchAfter = temp.SearchAfter
 	r.SearchBefore = temp.SearchBefore
+	r.Collapse = temp.Collapse
+	r.Rescore = temp.Rescore
+	r.Features = temp.Features
+	r.Fusion = temp.Fusion
+	r.Parallelism = temp.Parallelism
+	r.Profile = temp.Profile
+	r.AllowPartialResults = temp.AllowPartialResults
+	r.Timeouts = temp.Timeouts
+	r.PointInTime = temp.PointInTime
+	r.TrackTotalHits, err = parseTrackTotalHits(temp.TrackTotalHits)
+	if err != nil {
+		return err
+	}
 	r.Query, err = query.ParseQuery(temp.Q)
 	if err != nil {
 		return err
@@ -413,6 +726,27 @@ func (r *SearchRequest) UnmarshalJSON(input []byte) error {
 
 }
 
+// parseTrackTotalHits accepts either a boolean, true tracking
+// the total exactly and false not tracking it, or a number.
+func parseTrackTotalHits(input json.RawMessage) (int, error) {
+	if input == nil {
+		return TrackTotalHitsExact, nil
+	}
+	var track bool
+	if err := json.Unmarshal(input, &track); err == nil {
+		if track {
+			return TrackTotalHitsExact, nil
+		}
+		return TrackTotalHitsOff, nil
+	}
+	var rv int
+	err := json.Unmarshal(input, &rv)
+	if err != nil {
+		return 0, fmt.Errorf("track_total_hits must be a boolean or a number")
+	}
+	return rv, nil
+}
+
 // NewSearchRequest creates a new SearchRequest
 // for the Query, using default values for all
 // other search parameters.
@@ -461,11 +795,60 @@ func (iem IndexErrMap) UnmarshalJSON(data []byte) error {
 // SearchStatus is a secion in the SearchResult reporting how many
 // underlying indexes were queried, how many were successful/failed
 // and a map of any errors that were encountered
+// TimedOut counts the successful indexes whose results are partial,
+// which Partial describes by index name.
 type SearchStatus struct {
-	Total      int         `json:"total"`
-	Failed     int         `json:"failed"`
-	Successful int         `json:"successful"`
-	Errors     IndexErrMap `json:"errors,omitempty"`
+	Total      int                       `json:"total"`
+	Failed     int                       `json:"failed"`
+	Successful int                       `json:"successful"`
+	TimedOut   int                       `json:"timed_out,omitempty"`
+	Errors     IndexErrMap               `json:"errors,omitempty"`
+	Partial    map[string]*PartialStatus `json:"partial,omitempty"`
+}
+
+// Phases of a search which may run out of time.
+const (
+	SearchPhaseQuery     = "query"
+	SearchPhaseFacets    = "facets"
+	SearchPhaseHighlight = "highlight"
+)
+
+// PartialStatus describes why the results of an index are partial.
+// Phases lists the phases which ran out of time.
+// SegmentsTimedOut is the number of segments of the index which were
+// not fully searched, out of Segments, for indexes made of segments.
+type PartialStatus struct {
+	Phases           []string `json:"phases"`
+	SegmentsTimedOut int      `json:"segments_timed_out,omitempty"`
+	Segments         int      `json:"segments,omitempty"`
+}
+
+// merge returns the status of the results of both parts of the same
+// index, either of which may be nil.
+func (ps *PartialStatus) merge(other *PartialStatus) *PartialStatus {
+	if other == nil {
+		return ps
+	}
+	if ps == nil {
+		return other
+	}
+	for _, phase := range other.Phases {
+		found := false
+		for _, p := range ps.Phases {
+			if p == phase {
+				found = true
+				break
+			}
+		}
+		if !found {
+			ps.Phases = append(ps.Phases, phase)
+		}
+	}
+	ps.SegmentsTimedOut += other.SegmentsTimedOut
+	if other.Segments > ps.Segments {
+		ps.Segments = other.Segments
+	}
+	return ps
 }
 
 // Merge will merge together multiple SearchStatuses during a MultiSearch
@@ -473,6 +856,15 @@ func (ss *SearchStatus) Merge(other *SearchStatus) {
 	ss.Total += other.Total
 	ss.Failed += other.Failed
 	ss.Successful += other.Successful
+	ss.TimedOut += other.TimedOut
+	if len(other.Partial) > 0 {
+		if ss.Partial == nil {
+			ss.Partial = make(map[string]*PartialStatus)
+		}
+		for otherIndex, otherPartial := range other.Partial {
+			ss.Partial[otherIndex] = otherPartial
+		}
+	}
 	if len(other.Errors) > 0 {
 		if ss.Errors == nil {
 			ss.Errors = make(map[string]error)
@@ -485,14 +877,67 @@ func (ss *SearchStatus) Merge(other *SearchStatus) {
 
 // A SearchResult describes the results of executing
 // a SearchRequest.
+// TotalGroups is only set when the hits were collapsed,
+// and reports the number of distinct groups matched.
+// When searching across multiple indexes, a group present
+// in several indexes is counted once per index.
+// TotalIsLowerBound is set when matching documents were not
+// all counted, as allowed by the TrackTotalHits of the request.
+// Plan is only set when the request asks for explanations, and
+// describes how the query was rewritten before being searched.
+// Profile is only set when the request asks for profiling.
 type SearchResult struct {
-	Status   *SearchStatus                  `json:"status"`
-	Request  *SearchRequest                 `json:"request"`
-	Hits     search.DocumentMatchCollection `json:"hits"`
-	Total    uint64                         `json:"total_hits"`
-	MaxScore float64                        `json:"max_score"`
-	Took     time.Duration                  `json:"took"`
-	Facets   search.FacetResults            `json:"facets"`
+	Status            *SearchStatus                  `json:"status"`
+	Request           *SearchRequest                 `json:"request"`
+	Hits              search.DocumentMatchCollection `json:"hits"`
+	Total             uint64                         `json:"total_hits"`
+	TotalIsLowerBound bool                           `json:"total_is_lower_bound,omitempty"`
+	TotalGroups       uint64                         `json:"total_groups,omitempty"`
+	MaxScore          float64                        `json:"max_score"`
+	Took              time.Duration                  `json:"took"`
+	Facets            search.FacetResults            `json:"facets"`
+	Plan              *query.Plan                    `json:"plan,omitempty"`
+	Profile           *SearchProfile                 `json:"profile,omitempty"`
+}
+
+// A SearchProfile describes where the time of a search went.
+// Searcher is the profile of the searcher of the query, whose
+// children are the searchers of its clauses.
+// Collector is the time spent collecting the hits, including the
+// time spent in the searchers and in the facets.
+// Facets is the time spent building the facets.
+// Highlight is the time spent loading the fields of the hits and
+// highlighting them.
+// When searching across multiple indexes, Indexes holds the
+// profile of each index, named by Index.
+type SearchProfile struct {
+	Index     string                  `json:"index,omitempty"`
+	Searcher  *search.SearcherProfile `json:"searcher,omitempty"`
+	Collector time.Duration           `json:"collector,omitempty"`
+	Facets    time.Duration           `json:"facets,omitempty"`
+	Highlight time.Duration           `json:"highlight,omitempty"`
+	Indexes   []*SearchProfile        `json:"indexes,omitempty"`
+}
+
+// merge returns the profile of the results of both profiles, either
+// of which may be nil.
+func (sp *SearchProfile) merge(other *SearchProfile) *SearchProfile {
+	if other == nil {
+		return sp
+	}
+	if sp == nil {
+		return other
+	}
+	rv := sp
+	if len(sp.Indexes) == 0 {
+		rv = &SearchProfile{Indexes: []*SearchProfile{sp}}
+	}
+	if len(other.Indexes) == 0 {
+		rv.Indexes = append(rv.Indexes, other)
+	} else {
+		rv.Indexes = append(rv.Indexes, other.Indexes...)
+	}
+	return rv
 }
 
 func (sr *SearchResult) Size() int {
@@ -559,9 +1004,12 @@ func (sr *SearchResult) Merge(other *SearchResult) {
 	sr.Status.Merge(other.Status)
 	sr.Hits = append(sr.Hits, other.Hits...)
 	sr.Total += other.Total
+	sr.TotalIsLowerBound = sr.TotalIsLowerBound || other.TotalIsLowerBound
+	sr.TotalGroups += other.TotalGroups
 	if other.MaxScore > sr.MaxScore {
 		sr.MaxScore = other.MaxScore
 	}
+	sr.Profile = sr.Profile.merge(other.Profile)
 	if sr.Facets == nil && len(other.Facets) != 0 {
 		sr.Facets = other.Facets
 		return
@@ -0,0 +1,188 @@
+//  Copyright (c) 2021 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"container/heap"
+	"sort"
+
+	"github.com/blevesearch/bleve/v2/search"
+)
+
+type collapseGroup struct {
+	key   string
+	hits  search.DocumentMatchCollection
+	index int
+}
+
+// collectStoreCollapse keeps only the best hits for each distinct
+// value of the collapse field, reported as the CollapseKey of the group
+// head.  Only the best size groups are retained, in a heap ordered on
+// their heads, and the keys of the other groups are only remembered to
+// count them.  Group heads are only ordered at the end, which keeps
+// paging over groups consistent with the sort order.
+type collectStoreCollapse struct {
+	groups    map[string]*collapseGroup
+	heap      []*collapseGroup
+	seen      map[string]struct{}
+	compare   collectorCompare
+	groupSize int
+	size      int
+	keyFn     func() string
+}
+
+func newStoreCollapse(innerHits int, compare collectorCompare,
+	keyFn func() string) *collectStoreCollapse {
+	groupSize := 1
+	if innerHits > 0 {
+		groupSize += innerHits
+	}
+	return &collectStoreCollapse{
+		groups:    make(map[string]*collapseGroup),
+		seen:      make(map[string]struct{}),
+		compare:   compare,
+		groupSize: groupSize,
+		keyFn:     keyFn,
+	}
+}
+
+// AddNotExceedingSize adds the document to its group, and returns the
+// hit no longer retained, if any, so that it can be reused.  It is
+// either the document itself, a hit pushed out of its group, or the
+// head of the group pushed out of the best size groups, with the rest
+// of that group as its InnerHits.
+func (c *collectStoreCollapse) AddNotExceedingSize(doc *search.DocumentMatch,
+	size int) *search.DocumentMatch {
+	c.size = size
+
+	key := c.keyFn()
+	g, ok := c.groups[key]
+	if !ok {
+		c.seen[key] = struct{}{}
+		if size <= 0 {
+			return doc
+		}
+		var removed *search.DocumentMatch
+		if len(c.heap) >= size {
+			worst := c.heap[0]
+			if c.compare(doc, worst.hits[0]) >= 0 {
+				return doc
+			}
+			heap.Pop(c)
+			delete(c.groups, worst.key)
+			removed = worst.hits[0]
+			removed.InnerHits = worst.hits[1:]
+		}
+		g = &collapseGroup{
+			key:  key,
+			hits: make(search.DocumentMatchCollection, 0, c.groupSize),
+		}
+		g.hits = append(g.hits, doc)
+		c.groups[key] = g
+		heap.Push(c, g)
+		return removed
+	}
+
+	// insertion sort, groups are expected to stay small
+	pos := len(g.hits)
+	for pos > 0 && c.compare(doc, g.hits[pos-1]) < 0 {
+		pos--
+	}
+	if pos >= c.groupSize {
+		return doc
+	}
+	var removed *search.DocumentMatch
+	if len(g.hits) == c.groupSize {
+		removed = g.hits[len(g.hits)-1]
+		g.hits = g.hits[:len(g.hits)-1]
+	}
+	g.hits = append(g.hits, nil)
+	copy(g.hits[pos+1:], g.hits[pos:])
+	g.hits[pos] = doc
+	if pos == 0 {
+		heap.Fix(c, g.index)
+	}
+	return removed
+}
+
+// Groups returns the number of distinct groups seen so far.
+func (c *collectStoreCollapse) Groups() int {
+	return len(c.seen)
+}
+
+func (c *collectStoreCollapse) Final(skip int, fixup collectorFixup) (search.DocumentMatchCollection, error) {
+	heads := make(search.DocumentMatchCollection, 0, len(c.heap))
+	for _, g := range c.heap {
+		head := g.hits[0]
+		head.CollapseKey = g.key
+		if len(g.hits) > 1 {
+			head.InnerHits = g.hits[1:]
+		}
+		heads = append(heads, head)
+	}
+	sort.Slice(heads, func(i, j int) bool {
+		return c.compare(heads[i], heads[j]) < 0
+	})
+
+	if skip >= len(heads) {
+		return make(search.DocumentMatchCollection, 0), nil
+	}
+	heads = heads[skip:]
+	if c.size-skip >= 0 && len(heads) > c.size-skip {
+		heads = heads[:c.size-skip]
+	}
+
+	for _, head := range heads {
+		for _, hit := range head.InnerHits {
+			err := fixup(hit)
+			if err != nil {
+				return nil, err
+			}
+		}
+		err := fixup(head)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return heads, nil
+}
+
+// heap interface implementation, the group with the worst head on top
+
+func (c *collectStoreCollapse) Len() int {
+	return len(c.heap)
+}
+
+func (c *collectStoreCollapse) Less(i, j int) bool {
+	return c.compare(c.heap[i].hits[0], c.heap[j].hits[0]) > 0
+}
+
+func (c *collectStoreCollapse) Swap(i, j int) {
+	c.heap[i], c.heap[j] = c.heap[j], c.heap[i]
+	c.heap[i].index = i
+	c.heap[j].index = j
+}
+
+func (c *collectStoreCollapse) Push(x interface{}) {
+	g := x.(*collapseGroup)
+	g.index = len(c.heap)
+	c.heap = append(c.heap, g)
+}
+
+func (c *collectStoreCollapse) Pop() interface{} {
+	var rv *collapseGroup
+	rv, c.heap = c.heap[len(c.heap)-1], c.heap[:len(c.heap)-1]
+	return rv
+}
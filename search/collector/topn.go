@@ -59,6 +59,9 @@ type TopNCollector struct {
 	sort          search.SortOrder
 	results       search.DocumentMatchCollection
 	facetsBuilder *search.FacetsBuilder
+	profile       bool
+	facetsTook    time.Duration
+	facetsTimeout time.Duration
 
 	store collectorStore
 
@@ -71,6 +74,23 @@ type TopNCollector struct {
 	updateFieldVisitor        index.DocValueVisitor
 	dvReader                  index.DocValueReader
 	searchAfter               *search.DocumentMatch
+	competitiveSearcher       search.CompetitiveSearcher
+
+	pruning           bool
+	pruneAfter        uint64
+	totalIsLowerBound bool
+	segmentHits       int
+
+	rangeStart index.IndexInternalID
+	rangeEnd   index.IndexInternalID
+
+	allowPartialResults bool
+	timedOutAt          index.IndexInternalID
+
+	collapseField string
+	collapseKey   []byte
+	collapseFound bool
+	collapseStore *collectStoreCollapse
 }
 
 // CheckDoneEvery controls how frequently we check the context deadline
@@ -154,6 +174,14 @@ func (hc *TopNCollector) Size() int {
 	return sizeInBytes
 }
 
+// SetRange restricts the collection to the documents with an internal
+// ID from start, inclusive, to end, exclusive.  A nil start or end
+// leaves the range open on that side.
+func (hc *TopNCollector) SetRange(start, end index.IndexInternalID) {
+	hc.rangeStart = start
+	hc.rangeEnd = end
+}
+
 // Collect goes to the index to find the matching documents
 func (hc *TopNCollector) Collect(ctx context.Context, searcher search.Searcher, reader index.IndexReader) error {
 	startTime := time.Now()
@@ -178,10 +206,17 @@ func (hc *TopNCollector) Collect(ctx context.Context, searcher search.Searcher,
 		return err
 	}
 
+	hc.timedOutAt = nil
 	hc.updateFieldVisitor = func(field string, term []byte) {
-		if hc.facetsBuilder != nil {
+		if hc.facetsBuilder != nil && !hc.facetsTimedOut() {
 			hc.facetsBuilder.UpdateVisitor(field, term)
 		}
+		if hc.collapseStore != nil && !hc.collapseFound &&
+			field == hc.collapseField {
+			// only the first value of the collapse field is used
+			hc.collapseKey = append(hc.collapseKey[:0], term...)
+			hc.collapseFound = true
+		}
 		hc.sort.UpdateVisitor(field, term)
 	}
 
@@ -198,19 +233,68 @@ func (hc *TopNCollector) Collect(ctx context.Context, searcher search.Searcher,
 
 	hc.needDocIds = hc.needDocIds || loadID
 
+	// with the index sorted as requested, each segment only contributes
+	// its first hits
+	var segmentStarts []index.IndexInternalID
+	var segmentSorted []bool
+	if ssr, ok := reader.(search.SortedSegmentsReader); ok && hc.pruning &&
+		hc.facetsBuilder == nil && hc.collapseStore == nil &&
+		hc.size+hc.skip > 0 && ctx.Value(search.MakeDocumentMatchHandlerKey) == nil {
+		segmentStarts, segmentSorted = ssr.SortedSegments(hc.sort)
+	}
+	segment := 0
+	hc.segmentHits = 0
+
+	// when ordering by descending score alone, a searcher able to skip
+	// non-competitive documents is told the lowest competitive score
+	hc.competitiveSearcher = nil
+	if cs, ok := searcher.(search.CompetitiveSearcher); ok && hc.pruning &&
+		hc.facetsBuilder == nil && len(hc.sort) == 1 &&
+		hc.cachedScoring[0] && hc.cachedDesc[0] {
+		hc.competitiveSearcher = cs
+	}
+
 	select {
 	case <-ctx.Done():
-		return ctx.Err()
+		if !hc.allowPartialResults {
+			return ctx.Err()
+		}
+		hc.timedOutAt = append(index.IndexInternalID{}, hc.rangeStart...)
+		hc.totalIsLowerBound = true
 	default:
-		next, err = searcher.Next(searchContext)
+		if hc.rangeStart != nil {
+			next, err = searcher.Advance(searchContext, hc.rangeStart)
+		} else {
+			next, err = searcher.Next(searchContext)
+		}
 	}
 	for err == nil && next != nil {
+		if hc.rangeEnd != nil && next.IndexInternalID.Compare(hc.rangeEnd) >= 0 {
+			searchContext.DocumentMatchPool.Put(next)
+			break
+		}
+
 		if hc.total%CheckDoneEvery == 0 {
 			select {
 			case <-ctx.Done():
-				return ctx.Err()
+				if !hc.allowPartialResults {
+					return ctx.Err()
+				}
+				// keep the hits collected so far
+				hc.timedOutAt = append(index.IndexInternalID{}, next.IndexInternalID...)
+				hc.totalIsLowerBound = true
+				searchContext.DocumentMatchPool.Put(next)
 			default:
 			}
+			if hc.timedOutAt != nil {
+				break
+			}
+		}
+
+		for segment+1 < len(segmentStarts) &&
+			next.IndexInternalID.Compare(segmentStarts[segment+1]) >= 0 {
+			segment++
+			hc.segmentHits = 0
 		}
 
 		err = hc.prepareDocumentMatch(searchContext, reader, next)
@@ -223,14 +307,32 @@ func (hc *TopNCollector) Collect(ctx context.Context, searcher search.Searcher,
 			break
 		}
 
+		// without any hits to find, stop once enough were counted
+		if hc.pruning && hc.size+hc.skip == 0 && hc.facetsBuilder == nil &&
+			hc.total >= hc.pruneAfter {
+			hc.totalIsLowerBound = true
+			break
+		}
+
+		// the remaining hits of a sorted segment sort after its first
+		// hits, skip to the next segment once enough were found
+		if len(segmentSorted) > 0 && segmentSorted[segment] &&
+			hc.segmentHits >= hc.size+hc.skip && hc.total >= hc.pruneAfter {
+			hc.totalIsLowerBound = true
+			if segment+1 == len(segmentStarts) {
+				break
+			}
+			next, err = searcher.Advance(searchContext, segmentStarts[segment+1])
+			continue
+		}
+
 		next, err = searcher.Next(searchContext)
 	}
 
 	// help finalize/flush the results in case
 	// of custom document match handlers.
-	err = dmHandler(nil)
-	if err != nil {
-		return err
+	if herr := dmHandler(nil); err == nil {
+		err = herr
 	}
 
 	// compute search duration
@@ -308,9 +410,13 @@ func MakeTopNDocumentMatchHandler(
 				}
 			}
 
+			hc.segmentHits++
+
 			// optimization, we track lowest sorting hit already removed from heap
 			// with this one comparison, we can avoid all heap operations if
 			// this hit would have been added and then immediately removed
+			// (a collapsing store never sets it, since a worse hit may
+			// still be retained in the group of a better one)
 			if hc.lowestMatchOutsideResults != nil {
 				cmp := hc.sort.Compare(hc.cachedScoring, hc.cachedDesc, d,
 					hc.lowestMatchOutsideResults)
@@ -322,7 +428,12 @@ func MakeTopNDocumentMatchHandler(
 			}
 
 			removed := hc.store.AddNotExceedingSize(d, hc.size+hc.skip)
-			if removed != nil {
+			if removed != nil && hc.collapseStore != nil {
+				for _, hit := range removed.InnerHits {
+					ctx.DocumentMatchPool.Put(hit)
+				}
+				ctx.DocumentMatchPool.Put(removed)
+			} else if removed != nil {
 				if hc.lowestMatchOutsideResults == nil {
 					hc.lowestMatchOutsideResults = removed
 				} else {
@@ -334,6 +445,11 @@ func MakeTopNDocumentMatchHandler(
 						ctx.DocumentMatchPool.Put(tmp)
 					}
 				}
+				if hc.competitiveSearcher != nil && hc.total >= hc.pruneAfter {
+					hc.competitiveSearcher.SetMinCompetitiveScore(
+						hc.lowestMatchOutsideResults.Score)
+					hc.totalIsLowerBound = true
+				}
 			}
 			return nil
 		}, false, nil
@@ -344,24 +460,98 @@ func MakeTopNDocumentMatchHandler(
 // visitFieldTerms is responsible for visiting the field terms of the
 // search hit, and passing visited terms to the sort and facet builder
 func (hc *TopNCollector) visitFieldTerms(reader index.IndexReader, d *search.DocumentMatch) error {
-	if hc.facetsBuilder != nil {
+	facets := hc.facetsBuilder != nil && !hc.facetsTimedOut()
+	var start time.Time
+	if facets {
+		if hc.profile || hc.facetsTimeout > 0 {
+			start = time.Now()
+		}
 		hc.facetsBuilder.StartDoc()
 	}
+	if hc.collapseStore != nil {
+		hc.collapseKey = hc.collapseKey[:0]
+		hc.collapseFound = false
+	}
 
 	err := hc.dvReader.VisitDocValues(d.IndexInternalID, hc.updateFieldVisitor)
-	if hc.facetsBuilder != nil {
+	if facets {
 		hc.facetsBuilder.EndDoc()
+		if !start.IsZero() {
+			hc.facetsTook += time.Since(start)
+		}
+		if err == nil && hc.facetsTimedOut() && !hc.allowPartialResults {
+			err = context.DeadlineExceeded
+		}
 	}
 
 	return err
 }
 
+// facetsTimedOut tells whether the time budget of the facets was spent,
+// past which they are no longer built.
+func (hc *TopNCollector) facetsTimedOut() bool {
+	return hc.facetsTimeout > 0 && hc.facetsTook > hc.facetsTimeout
+}
+
 // SetFacetsBuilder registers a facet builder for this collector
 func (hc *TopNCollector) SetFacetsBuilder(facetsBuilder *search.FacetsBuilder) {
 	hc.facetsBuilder = facetsBuilder
 	hc.neededFields = append(hc.neededFields, hc.facetsBuilder.RequiredFields()...)
 }
 
+// SetProfile makes the collector measure the time spent visiting the
+// doc values of the hits for the facets, reported by FacetsTook.
+func (hc *TopNCollector) SetProfile(profile bool) {
+	hc.profile = profile
+}
+
+// SetAllowPartialResults makes Collect keep the hits collected so far,
+// instead of failing, when its context is done or the time budget of
+// the facets is spent.  The total is then a lower bound.
+func (hc *TopNCollector) SetAllowPartialResults(allow bool) {
+	hc.allowPartialResults = allow
+}
+
+// SetFacetsTimeout sets the time budget of the facets, spent visiting
+// the doc values of the hits.  Past the budget, Collect fails unless
+// partial results are allowed, in which case the facets only count
+// the hits visited so far.  A budget of 0 means no limit.
+func (hc *TopNCollector) SetFacetsTimeout(timeout time.Duration) {
+	hc.facetsTimeout = timeout
+}
+
+// SetTotalHitsThreshold stops the exact counting of matching documents
+// once the threshold is reached.  Past the threshold, searchers able to
+// skip documents which cannot enter the top hits are allowed to, and
+// when no hits are requested, collecting stops.  Facets require every
+// match, so nothing is skipped when computing them.
+func (hc *TopNCollector) SetTotalHitsThreshold(threshold uint64) {
+	hc.pruning = true
+	hc.pruneAfter = threshold
+}
+
+// SetCollapse collapses the collected hits on the provided field, so that
+// only the best hit for each distinct value of the field is returned.
+// Up to innerHits additional hits from each group are retained, and made
+// available through the InnerHits of the returned group heads, whose
+// CollapseKey is the value of the field.  The field is read through doc
+// values, and hits without a value for the field are
+// collapsed into a single group.  Only the best size+skip groups are
+// retained while collecting, so the inner hits of a group which only
+// became competitive after being pushed out do not include the hits
+// seen before.  It must be called before Collect.
+func (hc *TopNCollector) SetCollapse(field string, innerHits int) {
+	hc.collapseField = field
+	hc.collapseStore = newStoreCollapse(innerHits,
+		func(i, j *search.DocumentMatch) int {
+			return hc.sort.Compare(hc.cachedScoring, hc.cachedDesc, i, j)
+		}, func() string {
+			return string(hc.collapseKey)
+		})
+	hc.store = hc.collapseStore
+	hc.neededFields = append(hc.neededFields, field)
+}
+
 // finalizeResults starts with the heap containing the final top size+skip
 // it now throws away the results to be skipped
 // and does final doc id lookup (if necessary)
@@ -393,6 +583,21 @@ func (hc *TopNCollector) Total() uint64 {
 	return hc.total
 }
 
+// TotalIsLowerBound returns true when some matching
+// documents may have been skipped instead of counted
+func (hc *TopNCollector) TotalIsLowerBound() bool {
+	return hc.totalIsLowerBound
+}
+
+// TotalGroups returns the number of distinct groups seen when collapsing,
+// or 0 if the hits were not collapsed
+func (hc *TopNCollector) TotalGroups() uint64 {
+	if hc.collapseStore != nil {
+		return uint64(hc.collapseStore.Groups())
+	}
+	return 0
+}
+
 // MaxScore returns the maximum score seen across all the hits
 func (hc *TopNCollector) MaxScore() float64 {
 	return hc.maxScore
@@ -403,6 +608,26 @@ func (hc *TopNCollector) Took() time.Duration {
 	return hc.took
 }
 
+// TimedOutAt returns the internal ID of the first document which was
+// not collected, when collecting stopped once its context was done.
+// It is empty when no document was collected, and nil when collecting
+// did not stop early.
+func (hc *TopNCollector) TimedOutAt() index.IndexInternalID {
+	return hc.timedOutAt
+}
+
+// FacetsTimedOut returns true when the facets were only built from
+// some of the hits, as their time budget was spent.
+func (hc *TopNCollector) FacetsTimedOut() bool {
+	return hc.facetsBuilder != nil && hc.facetsTimedOut()
+}
+
+// FacetsTook returns the time spent visiting the doc values of the
+// hits for the facets, when profiled
+func (hc *TopNCollector) FacetsTook() time.Duration {
+	return hc.facetsTook
+}
+
 // FacetResults returns the computed facets results
 func (hc *TopNCollector) FacetResults() search.FacetResults {
 	if hc.facetsBuilder != nil {
@@ -724,6 +724,71 @@ func TestCollectorChaining(t *testing.T) {
 	}
 }
 
+func TestCollapseStoreKeepsBestGroups(t *testing.T) {
+	var key string
+	store := newStoreCollapse(1, func(i, j *search.DocumentMatch) int {
+		// descending score
+		if i.Score > j.Score {
+			return -1
+		} else if i.Score < j.Score {
+			return 1
+		}
+		return 0
+	}, func() string {
+		return key
+	})
+
+	add := func(k string, score float64) *search.DocumentMatch {
+		key = k
+		return store.AddNotExceedingSize(&search.DocumentMatch{
+			ID:    k + "-" + string(rune('0'+int(score))),
+			Score: score,
+		}, 2)
+	}
+
+	if removed := add("a", 1); removed != nil {
+		t.Fatalf("expected nothing removed, got %s", removed.ID)
+	}
+	if removed := add("b", 2); removed != nil {
+		t.Fatalf("expected nothing removed, got %s", removed.ID)
+	}
+	// a third group worse than the others is not retained
+	if removed := add("c", 0); removed == nil || removed.ID != "c-0" {
+		t.Fatalf("expected c-0 rejected, got %v", removed)
+	}
+	// a second hit of a makes it a group of two
+	if removed := add("a", 3); removed != nil {
+		t.Fatalf("expected nothing removed, got %s", removed.ID)
+	}
+	// a worse third hit of a is rejected from its group
+	if removed := add("a", 0); removed == nil || removed.ID != "a-0" {
+		t.Fatalf("expected a-0 rejected, got %v", removed)
+	}
+	// a better group pushes out b, the group with the worst head
+	if removed := add("d", 4); removed == nil || removed.ID != "b-2" ||
+		len(removed.InnerHits) != 0 {
+		t.Fatalf("expected b-2 pushed out, got %v", removed)
+	}
+	// a better group pushes out a along with its inner hit
+	if removed := add("e", 5); removed == nil || removed.ID != "a-3" ||
+		len(removed.InnerHits) != 1 || removed.InnerHits[0].ID != "a-1" {
+		t.Fatalf("expected a-3 and a-1 pushed out, got %v", removed)
+	}
+
+	if store.Groups() != 5 {
+		t.Errorf("expected 5 groups seen, got %d", store.Groups())
+	}
+	results, err := store.Final(0, func(*search.DocumentMatch) error {
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 || results[0].ID != "e-5" || results[1].ID != "d-4" {
+		t.Fatalf("expected e-5 and d-4, got %v", results)
+	}
+}
+
 func BenchmarkTop10of0Scores(b *testing.B) {
 	benchHelper(0, func() search.Collector {
 		return NewTopNCollector(10, 0, search.SortOrder{&search.SortScore{Desc: true}})
@@ -0,0 +1,25 @@
+//  Copyright (c) 2021 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package ltr defines the models used for learning-to-rank
+// rescoring.  A model computes the score of a search hit from
+// the values of its named features, which are in turn the scores
+// of the feature queries of the search request.
+package ltr
+
+// Model scores a search hit from the values of its features.
+// Features which did not match the hit have a value of 0.
+type Model interface {
+	Score(features map[string]float64) float64
+}
@@ -0,0 +1,87 @@
+//  Copyright (c) 2021 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package linear
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/blevesearch/bleve/v2/registry"
+	"github.com/blevesearch/bleve/v2/search/ltr"
+)
+
+const Name = "linear"
+
+type featureWeight struct {
+	name   string
+	weight float64
+}
+
+// Model scores a hit as the weighted sum of its
+// features, plus a constant bias.  The weights are summed in the order
+// of the feature names, so that a hit always gets the same score.
+type Model struct {
+	weights []featureWeight
+	bias    float64
+}
+
+func NewModel(weights map[string]float64, bias float64) *Model {
+	rv := &Model{
+		weights: make([]featureWeight, 0, len(weights)),
+		bias:    bias,
+	}
+	for name, weight := range weights {
+		rv.weights = append(rv.weights, featureWeight{name: name, weight: weight})
+	}
+	sort.Slice(rv.weights, func(i, j int) bool {
+		return rv.weights[i].name < rv.weights[j].name
+	})
+	return rv
+}
+
+func (m *Model) Score(features map[string]float64) float64 {
+	rv := m.bias
+	for _, fw := range m.weights {
+		rv += fw.weight * features[fw.name]
+	}
+	return rv
+}
+
+func Constructor(config map[string]interface{}, cache *registry.Cache) (ltr.Model, error) {
+	weightsVal, ok := config["weights"].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("must specify weights")
+	}
+	weights := make(map[string]float64, len(weightsVal))
+	for name, val := range weightsVal {
+		weight, ok := val.(float64)
+		if !ok {
+			return nil, fmt.Errorf("weight of feature '%s' must be a number", name)
+		}
+		weights[name] = weight
+	}
+	var bias float64
+	if biasVal, ok := config["bias"]; ok {
+		bias, ok = biasVal.(float64)
+		if !ok {
+			return nil, fmt.Errorf("bias must be a number")
+		}
+	}
+	return NewModel(weights, bias), nil
+}
+
+func init() {
+	registry.RegisterLTRModel(Name, Constructor)
+}
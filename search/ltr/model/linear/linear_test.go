@@ -0,0 +1,97 @@
+//  Copyright (c) 2021 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package linear
+
+import (
+	"testing"
+
+	"github.com/blevesearch/bleve/v2/registry"
+)
+
+func TestLinearModel(t *testing.T) {
+	config := map[string]interface{}{
+		"type": Name,
+		"weights": map[string]interface{}{
+			"title": 2.0,
+			"body":  0.5,
+		},
+		"bias": 1.0,
+	}
+
+	cache := registry.NewCache()
+	model, err := cache.DefineLTRModel("ranker", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		features map[string]float64
+		expected float64
+	}{
+		{
+			features: map[string]float64{},
+			expected: 1,
+		},
+		{
+			features: map[string]float64{"title": 1.5},
+			expected: 4,
+		},
+		{
+			features: map[string]float64{"title": 1.5, "body": 4, "other": 10},
+			expected: 6,
+		},
+	}
+
+	for _, test := range tests {
+		actual := model.Score(test.features)
+		if actual != test.expected {
+			t.Errorf("expected %f for %v, got %f", test.expected, test.features, actual)
+		}
+	}
+}
+
+func TestLinearModelInvalid(t *testing.T) {
+	tests := []map[string]interface{}{
+		{},
+		{"weights": map[string]interface{}{"title": "2"}},
+		{"weights": map[string]interface{}{"title": 2.0}, "bias": "1"},
+	}
+	for _, config := range tests {
+		_, err := Constructor(config, registry.NewCache())
+		if err == nil {
+			t.Errorf("expected error for config %v", config)
+		}
+	}
+}
+
+func TestLinearModelSumsInNameOrder(t *testing.T) {
+	// floating point addition is not associative, so summing these in
+	// another order gives another score
+	model := NewModel(map[string]float64{
+		"a": 1e16,
+		"b": 1,
+		"c": -1e16,
+		"d": 1,
+	}, 0)
+	features := map[string]float64{"a": 1, "b": 1, "c": 1, "d": 1}
+	big, one := 1e16, 1.0
+	expected := ((big + one) - big) + one
+	for i := 0; i < 100; i++ {
+		actual := model.Score(features)
+		if actual != expected {
+			t.Fatalf("expected %f, got %f", expected, actual)
+		}
+	}
+}
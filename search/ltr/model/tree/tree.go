@@ -0,0 +1,137 @@
+//  Copyright (c) 2021 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tree
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/blevesearch/bleve/v2/registry"
+	"github.com/blevesearch/bleve/v2/search/ltr"
+)
+
+const Name = "tree_ensemble"
+
+// Node is either a split or a leaf of a regression tree.  Hits
+// with a feature value less than Threshold follow Left, others
+// follow Right.  Leaves have no children, and contribute Value.
+type Node struct {
+	Feature   string  `json:"feature,omitempty"`
+	Threshold float64 `json:"threshold,omitempty"`
+	Left      *Node   `json:"left,omitempty"`
+	Right     *Node   `json:"right,omitempty"`
+	Value     float64 `json:"value,omitempty"`
+}
+
+func (n *Node) isLeaf() bool {
+	return n.Left == nil && n.Right == nil
+}
+
+func (n *Node) validate() error {
+	if n.isLeaf() {
+		return nil
+	}
+	if n.Left == nil || n.Right == nil {
+		return fmt.Errorf("split on feature '%s' must have both left and right", n.Feature)
+	}
+	if n.Feature == "" {
+		return fmt.Errorf("split must specify a feature")
+	}
+	err := n.Left.validate()
+	if err != nil {
+		return err
+	}
+	return n.Right.validate()
+}
+
+func (n *Node) eval(features map[string]float64) float64 {
+	for !n.isLeaf() {
+		if features[n.Feature] < n.Threshold {
+			n = n.Left
+		} else {
+			n = n.Right
+		}
+	}
+	return n.Value
+}
+
+// Tree is a single weighted regression tree of the ensemble.
+// Trees without a weight have a weight of 1, an explicit
+// weight of 0 disables the tree.
+type Tree struct {
+	Weight *float64 `json:"weight,omitempty"`
+	Root   *Node    `json:"root"`
+}
+
+func (t *Tree) weight() float64 {
+	if t.Weight == nil {
+		return 1
+	}
+	return *t.Weight
+}
+
+// Model scores a hit as the base score plus the weighted
+// sum of the leaves reached in each of its trees, as
+// produced by gradient-boosted tree learners.
+type Model struct {
+	BaseScore float64 `json:"base_score"`
+	Trees     []*Tree `json:"trees"`
+}
+
+func (m *Model) Score(features map[string]float64) float64 {
+	rv := m.BaseScore
+	for _, t := range m.Trees {
+		rv += t.weight() * t.Root.eval(features)
+	}
+	return rv
+}
+
+func (m *Model) Validate() error {
+	for i, t := range m.Trees {
+		if t.Root == nil {
+			return fmt.Errorf("tree %d must specify a root", i)
+		}
+		err := t.Root.validate()
+		if err != nil {
+			return fmt.Errorf("tree %d: %v", i, err)
+		}
+	}
+	return nil
+}
+
+func Constructor(config map[string]interface{}, cache *registry.Cache) (ltr.Model, error) {
+	if _, ok := config["trees"]; !ok {
+		return nil, fmt.Errorf("must specify trees")
+	}
+	// trees are arbitrarily nested, so decode the config as a whole
+	buf, err := json.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+	var rv Model
+	err = json.Unmarshal(buf, &rv)
+	if err != nil {
+		return nil, err
+	}
+	err = rv.Validate()
+	if err != nil {
+		return nil, err
+	}
+	return &rv, nil
+}
+
+func init() {
+	registry.RegisterLTRModel(Name, Constructor)
+}
@@ -0,0 +1,106 @@
+//  Copyright (c) 2021 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tree
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/blevesearch/bleve/v2/registry"
+)
+
+func TestTreeEnsembleModel(t *testing.T) {
+	modelJSON := `{
+		"type": "tree_ensemble",
+		"base_score": 0.5,
+		"trees": [
+			{
+				"weight": 2,
+				"root": {
+					"feature": "title",
+					"threshold": 1,
+					"left": {"value": 0},
+					"right": {
+						"feature": "body",
+						"threshold": 0.5,
+						"left": {"value": 1},
+						"right": {"value": 3}
+					}
+				}
+			},
+			{
+				"root": {"value": 0.25}
+			},
+			{
+				"weight": 0,
+				"root": {"value": 100}
+			}
+		]
+	}`
+	var config map[string]interface{}
+	err := json.Unmarshal([]byte(modelJSON), &config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cache := registry.NewCache()
+	model, err := cache.DefineLTRModel("ranker", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		features map[string]float64
+		expected float64
+	}{
+		{
+			features: map[string]float64{},
+			expected: 0.75,
+		},
+		{
+			features: map[string]float64{"title": 1.5},
+			expected: 2.75,
+		},
+		{
+			features: map[string]float64{"title": 1.5, "body": 0.5},
+			expected: 6.75,
+		},
+	}
+
+	for _, test := range tests {
+		actual := model.Score(test.features)
+		if actual != test.expected {
+			t.Errorf("expected %f for %v, got %f", test.expected, test.features, actual)
+		}
+	}
+}
+
+func TestTreeEnsembleModelInvalid(t *testing.T) {
+	config := map[string]interface{}{
+		"type": Name,
+		"trees": []interface{}{
+			map[string]interface{}{
+				"root": map[string]interface{}{
+					"feature": "title",
+					"left":    map[string]interface{}{"value": 1.0},
+				},
+			},
+		},
+	}
+	_, err := Constructor(config, registry.NewCache())
+	if err == nil {
+		t.Errorf("expected error for split without right branch")
+	}
+}
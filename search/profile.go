@@ -0,0 +1,52 @@
+//  Copyright (c) 2014 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package search
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// SearcherProfile is the cost of one node of a tree of searchers, as
+// measured when the search is profiled.  Times include the time spent
+// in the children of the node, while calls, postings and documents
+// only count those of the node itself.
+type SearcherProfile struct {
+	// Query is the type of the query the searcher was built for.
+	Query string `json:"query"`
+	// Searcher is the type of the searcher.
+	Searcher string `json:"searcher"`
+	// BuildTime is the time spent building the searcher.
+	BuildTime time.Duration `json:"build_time"`
+	// Time is the time spent in the Next and Advance calls.
+	Time         time.Duration `json:"time"`
+	NextCalls    uint64        `json:"next_calls"`
+	AdvanceCalls uint64        `json:"advance_calls"`
+	// PostingsRead is the number of postings read from the term
+	// dictionaries of the index by the searcher.
+	PostingsRead uint64 `json:"postings_read"`
+	// DocsScored is the number of documents returned by the searcher.
+	DocsScored uint64             `json:"docs_scored"`
+	Children   []*SearcherProfile `json:"children,omitempty"`
+}
+
+func (p *SearcherProfile) String() string {
+	js, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return fmt.Sprintf("error serializing profile to json: %v", err)
+	}
+	return string(js)
+}
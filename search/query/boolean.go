@@ -117,7 +117,11 @@ func (q *BooleanQuery) Searcher(i index.IndexReader, m mapping.IndexMapping, opt
 	var err error
 	var mustNotSearcher search.Searcher
 	if q.MustNot != nil {
-		mustNotSearcher, err = q.MustNot.Searcher(i, m, options)
+		// the scores of the excluded documents are never needed
+		mustNotOptions := options
+		mustNotOptions.Score = "none"
+		mustNotOptions.IncludeTermVectors = false
+		mustNotSearcher, err = clauseSearcher(q.MustNot, i, m, mustNotOptions)
 		if err != nil {
 			return nil, err
 		}
@@ -129,7 +133,7 @@ func (q *BooleanQuery) Searcher(i index.IndexReader, m mapping.IndexMapping, opt
 
 	var mustSearcher search.Searcher
 	if q.Must != nil {
-		mustSearcher, err = q.Must.Searcher(i, m, options)
+		mustSearcher, err = clauseSearcher(q.Must, i, m, options)
 		if err != nil {
 			return nil, err
 		}
@@ -141,7 +145,7 @@ func (q *BooleanQuery) Searcher(i index.IndexReader, m mapping.IndexMapping, opt
 
 	var shouldSearcher search.Searcher
 	if q.Should != nil {
-		shouldSearcher, err = q.Should.Searcher(i, m, options)
+		shouldSearcher, err = clauseSearcher(q.Should, i, m, options)
 		if err != nil {
 			return nil, err
 		}
@@ -55,7 +55,7 @@ func (q *ConjunctionQuery) AddQuery(aq ...Query) {
 func (q *ConjunctionQuery) Searcher(i index.IndexReader, m mapping.IndexMapping, options search.SearcherOptions) (search.Searcher, error) {
 	ss := make([]search.Searcher, 0, len(q.Conjuncts))
 	for _, conjunct := range q.Conjuncts {
-		sr, err := conjunct.Searcher(i, m, options)
+		sr, err := clauseSearcher(conjunct, i, m, options)
 		if err != nil {
 			for _, searcher := range ss {
 				if searcher != nil {
@@ -0,0 +1,91 @@
+//  Copyright (c) 2021 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package query
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/blevesearch/bleve/v2/mapping"
+	"github.com/blevesearch/bleve/v2/search"
+	"github.com/blevesearch/bleve/v2/search/searcher"
+	index "github.com/blevesearch/bleve_index_api"
+)
+
+type ConstantScoreQuery struct {
+	Filter   Query  `json:"constant_score"`
+	BoostVal *Boost `json:"boost,omitempty"`
+}
+
+// NewConstantScoreQuery creates a new Query matching the documents
+// of the filter query, which is searched without scoring, all with
+// the same score.
+func NewConstantScoreQuery(filter Query) *ConstantScoreQuery {
+	return &ConstantScoreQuery{
+		Filter: filter,
+	}
+}
+
+func (q *ConstantScoreQuery) SetBoost(b float64) {
+	boost := Boost(b)
+	q.BoostVal = &boost
+}
+
+func (q *ConstantScoreQuery) Boost() float64 {
+	return q.BoostVal.Value()
+}
+
+func (q *ConstantScoreQuery) Searcher(i index.IndexReader, m mapping.IndexMapping, options search.SearcherOptions) (search.Searcher, error) {
+	filterOptions := options
+	filterOptions.Score = "none"
+	filterOptions.Explain = false
+	filterOptions.IncludeTermVectors = false
+	filterOptions.DynamicPruning = false
+	filter, err := clauseSearcher(q.Filter, i, m, filterOptions)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := filter.(*searcher.MatchNoneSearcher); ok {
+		return filter, nil
+	}
+	return searcher.NewConstantScoreSearcher(filter, q.BoostVal.Value(), options), nil
+}
+
+func (q *ConstantScoreQuery) Validate() error {
+	if q.Filter == nil {
+		return fmt.Errorf("constant score query must specify a filter query")
+	}
+	if q, ok := q.Filter.(ValidatableQuery); ok {
+		return q.Validate()
+	}
+	return nil
+}
+
+func (q *ConstantScoreQuery) UnmarshalJSON(data []byte) error {
+	tmp := struct {
+		Filter json.RawMessage `json:"constant_score"`
+		Boost  *Boost          `json:"boost,omitempty"`
+	}{}
+	err := json.Unmarshal(data, &tmp)
+	if err != nil {
+		return err
+	}
+	q.Filter, err = ParseQuery(tmp.Filter)
+	if err != nil {
+		return err
+	}
+	q.BoostVal = tmp.Boost
+	return nil
+}
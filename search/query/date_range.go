@@ -144,7 +144,10 @@ func (q *DateRangeQuery) Searcher(i index.IndexReader, m mapping.IndexMapping, o
 		field = m.DefaultSearchField()
 	}
 
-	return searcher.NewNumericRangeSearcher(i, min, max, q.InclusiveStart, q.InclusiveEnd, field, q.BoostVal.Value(), options)
+	key := numericRangeFilterKey(field, min, max, q.InclusiveStart, q.InclusiveEnd)
+	return searcher.NewFilterCacheSearcher(i, key, func() (search.Searcher, error) {
+		return searcher.NewNumericRangeSearcher(i, min, max, q.InclusiveStart, q.InclusiveEnd, field, q.BoostVal.Value(), options)
+	}, options)
 }
 
 func (q *DateRangeQuery) parseEndpoints() (*float64, *float64, error) {
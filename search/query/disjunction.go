@@ -62,7 +62,7 @@ func (q *DisjunctionQuery) Searcher(i index.IndexReader, m mapping.IndexMapping,
 	options search.SearcherOptions) (search.Searcher, error) {
 	ss := make([]search.Searcher, 0, len(q.Disjuncts))
 	for _, disjunct := range q.Disjuncts {
-		sr, err := disjunct.Searcher(i, m, options)
+		sr, err := clauseSearcher(disjunct, i, m, options)
 		if err != nil {
 			for _, searcher := range ss {
 				if searcher != nil {
@@ -62,6 +62,15 @@ func (q *GeoBoundingBoxQuery) Searcher(i index.IndexReader, m mapping.IndexMappi
 		field = m.DefaultSearchField()
 	}
 
+	key := fmt.Sprintf("geo_bounding_box:%q:%g:%g:%g:%g", field,
+		q.TopLeft[0], q.TopLeft[1], q.BottomRight[0], q.BottomRight[1])
+	return searcher.NewFilterCacheSearcher(i, key, func() (search.Searcher, error) {
+		return q.searcher(i, field, options)
+	}, options)
+}
+
+func (q *GeoBoundingBoxQuery) searcher(i index.IndexReader, field string,
+	options search.SearcherOptions) (search.Searcher, error) {
 	if q.BottomRight[0] < q.TopLeft[0] {
 		// cross date line, rewrite as two parts
 
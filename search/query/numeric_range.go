@@ -16,6 +16,7 @@ package query
 
 import (
 	"fmt"
+	"strconv"
 
 	"github.com/blevesearch/bleve/v2/mapping"
 	"github.com/blevesearch/bleve/v2/search"
@@ -76,7 +77,32 @@ func (q *NumericRangeQuery) Searcher(i index.IndexReader, m mapping.IndexMapping
 	if q.FieldVal == "" {
 		field = m.DefaultSearchField()
 	}
-	return searcher.NewNumericRangeSearcher(i, q.Min, q.Max, q.InclusiveMin, q.InclusiveMax, field, q.BoostVal.Value(), options)
+	key := numericRangeFilterKey(field, q.Min, q.Max, q.InclusiveMin, q.InclusiveMax)
+	return searcher.NewFilterCacheSearcher(i, key, func() (search.Searcher, error) {
+		return searcher.NewNumericRangeSearcher(i, q.Min, q.Max, q.InclusiveMin, q.InclusiveMax, field, q.BoostVal.Value(), options)
+	}, options)
+}
+
+// numericRangeFilterKey identifies a numeric range in the filter cache
+// of the index, date ranges being numeric ranges of nanoseconds.
+func numericRangeFilterKey(field string, min, max *float64,
+	inclusiveMin, inclusiveMax *bool) string {
+	key := fmt.Sprintf("numeric_range:%q", field)
+	for _, v := range []*float64{min, max} {
+		if v == nil {
+			key += ":*"
+		} else {
+			key += ":" + strconv.FormatFloat(*v, 'g', -1, 64)
+		}
+	}
+	for _, b := range []*bool{inclusiveMin, inclusiveMax} {
+		if b == nil {
+			key += ":*"
+		} else {
+			key += ":" + strconv.FormatBool(*b)
+		}
+	}
+	return key
 }
 
 func (q *NumericRangeQuery) Validate() error {
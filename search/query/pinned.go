@@ -0,0 +1,102 @@
+//  Copyright (c) 2021 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package query
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/blevesearch/bleve/v2/mapping"
+	"github.com/blevesearch/bleve/v2/search"
+	"github.com/blevesearch/bleve/v2/search/searcher"
+	index "github.com/blevesearch/bleve_index_api"
+)
+
+type PinnedQuery struct {
+	Organic     Query    `json:"organic"`
+	IDs         []string `json:"ids"`
+	ExcludedIDs []string `json:"excluded_ids,omitempty"`
+	BoostVal    *Boost   `json:"boost,omitempty"`
+}
+
+// NewPinnedQuery creates a new Query returning the documents with the
+// specified ids first, in the order specified, followed by the documents
+// matching the organic query.  Organic scores are mapped below those of
+// the pinned documents, keeping their relative order.
+func NewPinnedQuery(organic Query, ids []string) *PinnedQuery {
+	return &PinnedQuery{
+		Organic: organic,
+		IDs:     ids,
+	}
+}
+
+// SetExcludedIDs sets the ids of documents which must never be returned,
+// whether pinned or matching the organic query.
+func (q *PinnedQuery) SetExcludedIDs(ids []string) {
+	q.ExcludedIDs = ids
+}
+
+func (q *PinnedQuery) SetBoost(b float64) {
+	boost := Boost(b)
+	q.BoostVal = &boost
+}
+
+func (q *PinnedQuery) Boost() float64 {
+	return q.BoostVal.Value()
+}
+
+func (q *PinnedQuery) Searcher(i index.IndexReader, m mapping.IndexMapping, options search.SearcherOptions) (search.Searcher, error) {
+	organic, err := clauseSearcher(q.Organic, i, m, options)
+	if err != nil {
+		return nil, err
+	}
+	rv, err := searcher.NewPinnedSearcher(i, organic, q.IDs, q.ExcludedIDs, q.BoostVal.Value(), options)
+	if err != nil {
+		_ = organic.Close()
+		return nil, err
+	}
+	return rv, nil
+}
+
+func (q *PinnedQuery) Validate() error {
+	if q.Organic == nil {
+		return fmt.Errorf("pinned query must specify an organic query")
+	}
+	if q, ok := q.Organic.(ValidatableQuery); ok {
+		return q.Validate()
+	}
+	return nil
+}
+
+func (q *PinnedQuery) UnmarshalJSON(data []byte) error {
+	tmp := struct {
+		Organic     json.RawMessage `json:"organic"`
+		IDs         []string        `json:"ids"`
+		ExcludedIDs []string        `json:"excluded_ids"`
+		Boost       *Boost          `json:"boost,omitempty"`
+	}{}
+	err := json.Unmarshal(data, &tmp)
+	if err != nil {
+		return err
+	}
+	q.Organic, err = ParseQuery(tmp.Organic)
+	if err != nil {
+		return err
+	}
+	q.IDs = tmp.IDs
+	q.ExcludedIDs = tmp.ExcludedIDs
+	q.BoostVal = tmp.Boost
+	return nil
+}
@@ -0,0 +1,350 @@
+//  Copyright (c) 2021 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package query
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+
+	"github.com/blevesearch/bleve/v2/mapping"
+	index "github.com/blevesearch/bleve_index_api"
+)
+
+// unknownCost is the estimated number of matches of queries whose
+// matches are not estimated.
+const unknownCost = math.MaxUint64
+
+// Plan is a query rewritten by the planner into an equivalent query
+// which is cheaper to search, along with the rewrites applied.
+type Plan struct {
+	Query    Query    `json:"query"`
+	Rewrites []string `json:"rewrites,omitempty"`
+}
+
+// PlanQuery rewrites the query before its searcher is built:
+//   - match none clauses are removed, or make up the whole query
+//   - nested conjunctions are folded into their parent
+//   - conjunctions are ordered by estimated number of matches, from
+//     the doc frequencies of terms in the dictionaries of the index
+//   - conjunctions, disjunctions and booleans of a single clause are
+//     replaced by the clause
+//   - the clauses of constant score queries, and excluded clauses of
+//     booleans, are planned as non-scoring filters, which allows
+//     nested disjunctions to be folded into their parent as well
+//
+// Rewrites keep the documents matched and, when scoring, their scores.
+// The provided query is not modified.
+func PlanQuery(q Query, i index.IndexReader, m mapping.IndexMapping,
+	scoring bool) (*Plan, error) {
+	p := &planner{
+		i: i,
+		m: m,
+	}
+	rv, err := p.plan(q, planContext{scoring: scoring})
+	if err != nil {
+		return nil, err
+	}
+	return &Plan{
+		Query:    rv,
+		Rewrites: p.rewrites,
+	}, nil
+}
+
+type planner struct {
+	i        index.IndexReader
+	m        mapping.IndexMapping
+	rewrites []string
+}
+
+func (p *planner) rewrite(format string, args ...interface{}) {
+	p.rewrites = append(p.rewrites, fmt.Sprintf(format, args...))
+}
+
+// planContext describes where a query is searched.  When scoring is
+// false, the scores of the query are not needed.  When noneIgnored is
+// true, a match none searcher for the query is ignored by its parent,
+// instead of matching no document, as is the case of boolean clauses.
+// There, a clause may only be rewritten into a query which could have
+// a match none searcher when the clause itself could.
+type planContext struct {
+	scoring     bool
+	noneIgnored bool
+}
+
+func isMatchNone(q Query) bool {
+	_, ok := q.(*MatchNoneQuery)
+	return ok
+}
+
+func (p *planner) plan(q Query, ctx planContext) (Query, error) {
+	switch q := q.(type) {
+	case *QueryStringQuery:
+		parsed, err := parseQuerySyntax(q.Query)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse '%s': %s", q.Query, err)
+		}
+		return p.plan(parsed, ctx)
+	case *ConjunctionQuery:
+		return p.planConjunction(q, ctx)
+	case *DisjunctionQuery:
+		return p.planDisjunction(q, ctx)
+	case *BooleanQuery:
+		return p.planBoolean(q, ctx)
+	case *ConstantScoreQuery:
+		// the constant score searcher returns a match none filter as is
+		filter, err := p.plan(q.Filter, planContext{noneIgnored: ctx.noneIgnored})
+		if err != nil {
+			return nil, err
+		}
+		if isMatchNone(filter) {
+			return filter, nil
+		}
+		p.rewrite("constant_score: clauses searched as non-scoring filters")
+		return &ConstantScoreQuery{Filter: filter, BoostVal: q.BoostVal}, nil
+	case *PinnedQuery:
+		organic, err := p.plan(q.Organic, planContext{scoring: ctx.scoring})
+		if err != nil {
+			return nil, err
+		}
+		rv := *q
+		rv.Organic = organic
+		return &rv, nil
+	default:
+		return q, nil
+	}
+}
+
+func (p *planner) planConjunction(q *ConjunctionQuery, ctx planContext) (Query, error) {
+	childCtx := planContext{scoring: ctx.scoring, noneIgnored: q.queryStringMode}
+	children := make([]Query, 0, len(q.Conjuncts))
+	for _, conjunct := range q.Conjuncts {
+		child, err := p.plan(conjunct, childCtx)
+		if err != nil {
+			return nil, err
+		}
+		if isMatchNone(child) {
+			if q.queryStringMode {
+				p.rewrite("conjunction: removed match_none clause")
+				continue
+			}
+			p.rewrite("conjunction: match_none clause matches no document")
+			return NewMatchNoneQuery(), nil
+		}
+		if cq, ok := child.(*ConjunctionQuery); ok &&
+			cq.queryStringMode == q.queryStringMode {
+			p.rewrite("conjunction: folded nested conjunction")
+			children = append(children, cq.Conjuncts...)
+			continue
+		}
+		children = append(children, child)
+	}
+
+	if len(children) == 0 {
+		p.rewrite("conjunction: no clause matches no document")
+		return NewMatchNoneQuery(), nil
+	}
+	if len(children) == 1 && (q.queryStringMode || !ctx.noneIgnored) {
+		p.rewrite("conjunction: single clause searched on its own")
+		return children[0], nil
+	}
+
+	byCost := &queriesByCost{
+		queries: children,
+		costs:   make([]uint64, len(children)),
+	}
+	for x, child := range children {
+		byCost.costs[x] = p.cost(child)
+	}
+	if !sort.IsSorted(byCost) {
+		sort.Stable(byCost)
+		p.rewrite("conjunction: ordered by estimated doc frequency")
+	}
+
+	return &ConjunctionQuery{
+		Conjuncts:       children,
+		BoostVal:        q.BoostVal,
+		queryStringMode: q.queryStringMode,
+	}, nil
+}
+
+func (p *planner) planDisjunction(q *DisjunctionQuery, ctx planContext) (Query, error) {
+	childCtx := planContext{scoring: ctx.scoring, noneIgnored: q.queryStringMode}
+	children := make([]Query, 0, len(q.Disjuncts))
+	for _, disjunct := range q.Disjuncts {
+		child, err := p.plan(disjunct, childCtx)
+		if err != nil {
+			return nil, err
+		}
+		// without scoring, the clauses no longer count for coordination
+		if isMatchNone(child) && (q.queryStringMode || !ctx.scoring) {
+			p.rewrite("disjunction: removed match_none clause")
+			continue
+		}
+		if dq, ok := child.(*DisjunctionQuery); ok && !ctx.scoring &&
+			dq.queryStringMode == q.queryStringMode && q.Min <= 1 && dq.Min <= 1 {
+			p.rewrite("disjunction: folded nested disjunction")
+			children = append(children, dq.Disjuncts...)
+			continue
+		}
+		children = append(children, child)
+	}
+
+	if len(children) == 0 || int(q.Min) > len(children) {
+		p.rewrite("disjunction: too few clauses match no document")
+		return NewMatchNoneQuery(), nil
+	}
+	if len(children) == 1 && q.Min <= 1 && (q.queryStringMode || !ctx.noneIgnored) {
+		p.rewrite("disjunction: single clause searched on its own")
+		return children[0], nil
+	}
+
+	return &DisjunctionQuery{
+		Disjuncts:       children,
+		BoostVal:        q.BoostVal,
+		Min:             q.Min,
+		queryStringMode: q.queryStringMode,
+	}, nil
+}
+
+func (p *planner) planBoolean(q *BooleanQuery, ctx planContext) (Query, error) {
+	// match none clauses are ignored by boolean searchers
+	planClause := func(clause Query, scoring bool) (Query, error) {
+		if clause == nil {
+			return nil, nil
+		}
+		rv, err := p.plan(clause, planContext{scoring: scoring, noneIgnored: true})
+		if err != nil {
+			return nil, err
+		}
+		if isMatchNone(rv) {
+			p.rewrite("boolean: removed match_none clause")
+			return nil, nil
+		}
+		return rv, nil
+	}
+
+	must, err := planClause(q.Must, ctx.scoring)
+	if err != nil {
+		return nil, err
+	}
+	should, err := planClause(q.Should, ctx.scoring)
+	if err != nil {
+		return nil, err
+	}
+	// the scores of the excluded documents are never needed
+	mustNot, err := planClause(q.MustNot, false)
+	if err != nil {
+		return nil, err
+	}
+
+	if must == nil && should == nil && mustNot == nil {
+		p.rewrite("boolean: no clause matches no document")
+		return NewMatchNoneQuery(), nil
+	}
+	if must == nil && mustNot == nil {
+		p.rewrite("boolean: single should clause searched on its own")
+		return should, nil
+	}
+	if should == nil && mustNot == nil {
+		p.rewrite("boolean: single must clause searched on its own")
+		return must, nil
+	}
+
+	// the minimum of should clauses must still be satisfied, as set on
+	// the should searcher
+	if should != nil && reflect.TypeOf(should) != reflect.TypeOf(q.Should) {
+		var min float64
+		if dq, ok := q.Should.(*DisjunctionQuery); ok {
+			min = dq.Min
+		}
+		should = &DisjunctionQuery{
+			Disjuncts:       []Query{should},
+			Min:             min,
+			queryStringMode: q.queryStringMode,
+		}
+	}
+
+	return &BooleanQuery{
+		Must:            must,
+		Should:          should,
+		MustNot:         mustNot,
+		BoostVal:        q.BoostVal,
+		queryStringMode: q.queryStringMode,
+	}, nil
+}
+
+// cost estimates the number of documents matched by the planned query.
+func (p *planner) cost(q Query) uint64 {
+	rv := uint64(unknownCost)
+	switch q := q.(type) {
+	case *MatchNoneQuery:
+		rv = 0
+	case *MatchAllQuery:
+		if count, err := p.i.DocCount(); err == nil {
+			rv = count
+		}
+	case *TermQuery:
+		field := q.FieldVal
+		if field == "" {
+			field = p.m.DefaultSearchField()
+		}
+		tfr, err := p.i.TermFieldReader([]byte(q.Term), field, false, false, false)
+		if err == nil {
+			rv = tfr.Count()
+			_ = tfr.Close()
+		}
+	case *ConjunctionQuery:
+		for _, conjunct := range q.Conjuncts {
+			if cost := p.cost(conjunct); cost < rv {
+				rv = cost
+			}
+		}
+	case *DisjunctionQuery:
+		rv = 0
+		for _, disjunct := range q.Disjuncts {
+			cost := p.cost(disjunct)
+			if cost > unknownCost-rv {
+				rv = unknownCost
+				break
+			}
+			rv += cost
+		}
+	case *BooleanQuery:
+		if q.Must != nil {
+			rv = p.cost(q.Must)
+		} else if q.Should != nil {
+			rv = p.cost(q.Should)
+		}
+	case *ConstantScoreQuery:
+		rv = p.cost(q.Filter)
+	}
+	return rv
+}
+
+type queriesByCost struct {
+	queries []Query
+	costs   []uint64
+}
+
+func (q *queriesByCost) Len() int { return len(q.queries) }
+
+func (q *queriesByCost) Less(i, j int) bool { return q.costs[i] < q.costs[j] }
+
+func (q *queriesByCost) Swap(i, j int) {
+	q.queries[i], q.queries[j] = q.queries[j], q.queries[i]
+	q.costs[i], q.costs[j] = q.costs[j], q.costs[i]
+}
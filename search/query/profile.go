@@ -0,0 +1,69 @@
+//  Copyright (c) 2014 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package query
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/blevesearch/bleve/v2/mapping"
+	"github.com/blevesearch/bleve/v2/search"
+	"github.com/blevesearch/bleve/v2/search/searcher"
+	index "github.com/blevesearch/bleve_index_api"
+)
+
+// ProfiledSearcher builds the searcher of the query, along with its
+// profile.  The searchers of the clauses of the query are profiled as
+// the children of the returned profile.
+func ProfiledSearcher(q Query, i index.IndexReader, m mapping.IndexMapping,
+	options search.SearcherOptions) (search.Searcher, *search.SearcherProfile, error) {
+	profile := &search.SearcherProfile{
+		Query: typeName(q),
+	}
+	options.Profile = profile
+	start := time.Now()
+	s, err := q.Searcher(i, m, options)
+	profile.BuildTime = time.Since(start)
+	if err != nil {
+		return nil, nil, err
+	}
+	profile.Searcher = typeName(s)
+	// match none searchers are told apart by their type
+	if _, ok := s.(*searcher.MatchNoneSearcher); ok {
+		return s, profile, nil
+	}
+	return searcher.NewProfileSearcher(s, profile), profile, nil
+}
+
+// clauseSearcher builds the searcher of a clause of a query, which is
+// profiled as a child of the query when the search is profiled.
+func clauseSearcher(q Query, i index.IndexReader, m mapping.IndexMapping,
+	options search.SearcherOptions) (search.Searcher, error) {
+	parent := options.Profile
+	if parent == nil {
+		return q.Searcher(i, m, options)
+	}
+	s, profile, err := ProfiledSearcher(q, i, m, options)
+	if err != nil {
+		return nil, err
+	}
+	parent.Children = append(parent.Children, profile)
+	return s, nil
+}
+
+func typeName(v interface{}) string {
+	return strings.TrimPrefix(fmt.Sprintf("%T", v), "*")
+}
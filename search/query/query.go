@@ -236,6 +236,24 @@ func ParseQuery(input []byte) (Query, error) {
 		}
 		return &rv, nil
 	}
+	_, hasOrganic := tmp["organic"]
+	if hasOrganic {
+		var rv PinnedQuery
+		err := json.Unmarshal(input, &rv)
+		if err != nil {
+			return nil, err
+		}
+		return &rv, nil
+	}
+	_, hasConstantScore := tmp["constant_score"]
+	if hasConstantScore {
+		var rv ConstantScoreQuery
+		err := json.Unmarshal(input, &rv)
+		if err != nil {
+			return nil, err
+		}
+		return &rv, nil
+	}
 	_, hasDocIds := tmp["ids"]
 	if hasDocIds {
 		var rv DocIDQuery
@@ -326,6 +344,20 @@ func expandQuery(m mapping.IndexMapping, query Query) (Query, error) {
 			}
 			q.Disjuncts = children
 			return q, nil
+		case *PinnedQuery:
+			var err error
+			q.Organic, err = expand(q.Organic)
+			if err != nil {
+				return nil, err
+			}
+			return q, nil
+		case *ConstantScoreQuery:
+			var err error
+			q.Filter, err = expand(q.Filter)
+			if err != nil {
+				return nil, err
+			}
+			return q, nil
 		case *BooleanQuery:
 			var err error
 			q.Must, err = expand(q.Must)
@@ -52,7 +52,7 @@ func (q *QueryStringQuery) Searcher(i index.IndexReader, m mapping.IndexMapping,
 	if err != nil {
 		return nil, err
 	}
-	return newQuery.Searcher(i, m, options)
+	return clauseSearcher(newQuery, i, m, options)
 }
 
 func (q *QueryStringQuery) Validate() error {
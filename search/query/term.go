@@ -15,6 +15,8 @@
 package query
 
 import (
+	"fmt"
+
 	"github.com/blevesearch/bleve/v2/mapping"
 	"github.com/blevesearch/bleve/v2/search"
 	"github.com/blevesearch/bleve/v2/search/searcher"
@@ -57,5 +59,8 @@ func (q *TermQuery) Searcher(i index.IndexReader, m mapping.IndexMapping, option
 	if q.FieldVal == "" {
 		field = m.DefaultSearchField()
 	}
-	return searcher.NewTermSearcher(i, q.Term, field, q.BoostVal.Value(), options)
+	key := fmt.Sprintf("term:%q:%q", field, q.Term)
+	return searcher.NewFilterCacheSearcher(i, key, func() (search.Searcher, error) {
+		return searcher.NewTermSearcher(i, q.Term, field, q.BoostVal.Value(), options)
+	}, options)
 }
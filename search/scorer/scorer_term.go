@@ -89,6 +89,17 @@ func (s *TermQueryScorer) Weight() float64 {
 	return sum * sum
 }
 
+// MaxScore returns an upper bound of the score of any match.  As the
+// term frequency of a match never exceeds the length of its field,
+// sqrt(tf) * fieldNorm is at most 1, leaving idf * queryWeight, with
+// some headroom for the precision of stored norms.
+func (s *TermQueryScorer) MaxScore() float64 {
+	if !s.includeScore {
+		return 0
+	}
+	return s.idf * math.Abs(s.queryWeight) * (1 + 1e-6)
+}
+
 func (s *TermQueryScorer) SetQueryNorm(qnorm float64) {
 	s.queryNorm = qnorm
 
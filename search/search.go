@@ -158,6 +158,18 @@ type DocumentMatch struct {
 	// fields as float64s and date fields as time.RFC3339 formatted strings.
 	Fields map[string]interface{} `json:"fields,omitempty"`
 
+	// InnerHits contains the next best hits sharing this hit's value
+	// of the collapse field, when collapsing was requested.
+	InnerHits DocumentMatchCollection `json:"inner_hits,omitempty"`
+
+	// CollapseKey is the value of the collapse field grouping this hit,
+	// as indexed, when collapsing was requested.
+	CollapseKey string `json:"collapse_key,omitempty"`
+
+	// Features contains the values of the learning-to-rank
+	// features listed in SearchRequest.Features.
+	Features map[string]float64 `json:"features,omitempty"`
+
 	// used to maintain natural index order
 	HitNumber uint64 `json:"-"`
 
@@ -250,6 +262,17 @@ func (dm *DocumentMatch) Size() int {
 			size.SizeOfPtr
 	}
 
+	for _, entry := range dm.InnerHits {
+		sizeInBytes += size.SizeOfPtr + entry.Size()
+	}
+
+	sizeInBytes += len(dm.CollapseKey)
+
+	for k := range dm.Features {
+		sizeInBytes += size.SizeOfString + len(k) +
+			size.SizeOfFloat64
+	}
+
 	return sizeInBytes
 }
 
@@ -349,10 +372,63 @@ type Searcher interface {
 	DocumentMatchPoolSize() int
 }
 
+// MaxScorer is implemented by searchers able to bound
+// the score of any document they return.
+type MaxScorer interface {
+	MaxScore() float64
+}
+
+// CompetitiveSearcher is implemented by searchers able to
+// skip the documents which cannot score above a minimum
+// competitive score.  The collector raises the minimum as
+// its top hits improve.
+type CompetitiveSearcher interface {
+	SetMinCompetitiveScore(score float64)
+}
+
+// SortedSegmentsReader is implemented by index readers made of
+// segments, some of which may hold their documents in the order of
+// a sort configured for the index.  It returns the internal ID of
+// the first document of each segment, and whether the segment holds
+// its documents in the provided sort order.
+type SortedSegmentsReader interface {
+	SortedSegments(so SortOrder) (starts []index.IndexInternalID, sorted []bool)
+}
+
+// SegmentedReader is implemented by index readers made of segments,
+// which can be searched concurrently by groups of segments.  It splits
+// the segments into at most n groups of contiguous segments, holding
+// about as many documents each, and returns the internal ID of the
+// first document of each group.
+type SegmentedReader interface {
+	SegmentGroups(n int) []index.IndexInternalID
+}
+
+// FilterCacheReader is implemented by index readers which cache, per
+// immutable segment, the documents matched by non-scoring clauses such
+// as term filters and ranges.  FilterDocIDReader returns a reader of
+// the documents matching the clause identified by the key, and their
+// number.  The matches of the segments which are not cached yet are
+// listed with the searcher built by newSearcher.
+type FilterCacheReader interface {
+	FilterCacheEnabled() bool
+	FilterDocIDReader(key string, newSearcher func() (Searcher, error)) (
+		index.DocIDReader, uint64, error)
+}
+
 type SearcherOptions struct {
 	Explain            bool
 	IncludeTermVectors bool
 	Score              string
+
+	// DynamicPruning allows searchers to skip documents which
+	// cannot enter the top hits, in which case the count of
+	// matching documents is only a lower bound.
+	DynamicPruning bool
+
+	// Profile, when set, is the profile of the searcher being built,
+	// which its children are added to, and its postings counted in.
+	Profile *SearcherProfile
 }
 
 // SearchContext represents the context around a single search
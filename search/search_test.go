@@ -74,3 +74,19 @@ func TestLocationsDedupe(t *testing.T) {
 		}
 	}
 }
+
+func TestSortFieldCopyDoesNotShareBuffers(t *testing.T) {
+	sf := &SortField{Field: "f"}
+	sf.UpdateVisitor("f", []byte("warm"))
+	sf.Value(nil)
+
+	cp := sf.Copy().(*SortField)
+	cp.UpdateVisitor("f", []byte("a"))
+	sf.UpdateVisitor("f", []byte("b"))
+	if v := cp.Value(nil); v != "a" {
+		t.Errorf("expected copy to sort by a, got %s", v)
+	}
+	if v := sf.Value(nil); v != "b" {
+		t.Errorf("expected original to sort by b, got %s", v)
+	}
+}
@@ -0,0 +1,107 @@
+//  Copyright (c) 2021 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package searcher
+
+import (
+	"reflect"
+
+	"github.com/blevesearch/bleve/v2/search"
+	"github.com/blevesearch/bleve/v2/search/scorer"
+	"github.com/blevesearch/bleve/v2/size"
+	index "github.com/blevesearch/bleve_index_api"
+)
+
+var reflectStaticSizeConstantScoreSearcher int
+
+func init() {
+	var css ConstantScoreSearcher
+	reflectStaticSizeConstantScoreSearcher = int(reflect.TypeOf(css).Size())
+}
+
+// ConstantScoreSearcher returns the matches of a non-scoring filter,
+// all with the same score, that of the boost once normalized.
+type ConstantScoreSearcher struct {
+	filter search.Searcher
+	scorer *scorer.ConstantScorer
+}
+
+// NewConstantScoreSearcher wraps a filter searcher, which should be
+// built without scoring.
+func NewConstantScoreSearcher(filter search.Searcher, boost float64,
+	options search.SearcherOptions) *ConstantScoreSearcher {
+	return &ConstantScoreSearcher{
+		filter: filter,
+		scorer: scorer.NewConstantScorer(1.0, boost, options),
+	}
+}
+
+func (s *ConstantScoreSearcher) Size() int {
+	return reflectStaticSizeConstantScoreSearcher + size.SizeOfPtr +
+		s.filter.Size() +
+		s.scorer.Size()
+}
+
+func (s *ConstantScoreSearcher) score(ctx *search.SearchContext,
+	dm *search.DocumentMatch) *search.DocumentMatch {
+	if dm == nil {
+		return nil
+	}
+	cs := s.scorer.Score(ctx, dm.IndexInternalID)
+	dm.Score, dm.Expl = cs.Score, cs.Expl
+	// the internal id belongs to the filter match
+	cs.IndexInternalID = nil
+	ctx.DocumentMatchPool.Put(cs)
+	return dm
+}
+
+func (s *ConstantScoreSearcher) Next(ctx *search.SearchContext) (*search.DocumentMatch, error) {
+	dm, err := s.filter.Next(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return s.score(ctx, dm), nil
+}
+
+func (s *ConstantScoreSearcher) Advance(ctx *search.SearchContext, ID index.IndexInternalID) (*search.DocumentMatch, error) {
+	dm, err := s.filter.Advance(ctx, ID)
+	if err != nil {
+		return nil, err
+	}
+	return s.score(ctx, dm), nil
+}
+
+func (s *ConstantScoreSearcher) Count() uint64 {
+	return s.filter.Count()
+}
+
+func (s *ConstantScoreSearcher) Weight() float64 {
+	return s.scorer.Weight()
+}
+
+func (s *ConstantScoreSearcher) SetQueryNorm(qnorm float64) {
+	s.scorer.SetQueryNorm(qnorm)
+}
+
+func (s *ConstantScoreSearcher) Close() error {
+	return s.filter.Close()
+}
+
+func (s *ConstantScoreSearcher) Min() int {
+	return 0
+}
+
+func (s *ConstantScoreSearcher) DocumentMatchPoolSize() int {
+	return s.filter.DocumentMatchPoolSize() + 1
+}
@@ -56,6 +56,13 @@ func newDisjunctionSearcher(indexReader index.IndexReader,
 		}
 	}
 
+	// when allowed to skip non-competitive documents, and able
+	// to bound the score of each clause, use WAND
+	if optionsDisjunctionWAND(qsearchers, min, options) {
+		return newDisjunctionWANDSearcher(indexReader, qsearchers, min, options,
+			limit)
+	}
+
 	if len(qsearchers) > DisjunctionHeapTakeover {
 		return newDisjunctionHeapSearcher(indexReader, qsearchers, min, options,
 			limit)
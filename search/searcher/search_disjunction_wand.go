@@ -0,0 +1,357 @@
+//  Copyright (c) 2021 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package searcher
+
+import (
+	"math"
+	"reflect"
+	"sort"
+
+	"github.com/blevesearch/bleve/v2/search"
+	"github.com/blevesearch/bleve/v2/search/scorer"
+	"github.com/blevesearch/bleve/v2/size"
+	index "github.com/blevesearch/bleve_index_api"
+)
+
+var reflectStaticSizeDisjunctionWANDSearcher int
+var reflectStaticSizeWANDCurr int
+
+func init() {
+	var dws DisjunctionWANDSearcher
+	reflectStaticSizeDisjunctionWANDSearcher = int(reflect.TypeOf(dws).Size())
+
+	var wc wandCurr
+	reflectStaticSizeWANDCurr = int(reflect.TypeOf(wc).Size())
+}
+
+type wandCurr struct {
+	searcher search.Searcher
+	curr     *search.DocumentMatch
+	maxScore float64
+}
+
+// DisjunctionWANDSearcher is a disjunction searcher implementing the
+// WAND (weak AND) algorithm.  Once the collector sets a minimum
+// competitive score, documents whose matching clauses cannot add
+// up to more than that score, according to the score upper bound
+// of each clause, are skipped without being scored.  All of its
+// clauses must implement search.MaxScorer.
+type DisjunctionWANDSearcher struct {
+	indexReader index.IndexReader
+
+	numSearchers int
+	scorer       *scorer.DisjunctionQueryScorer
+	min          int
+	queryNorm    float64
+	initialized  bool
+	searchers    []search.Searcher
+	currs        []*wandCurr
+	minScore     float64
+
+	matching []*search.DocumentMatch
+}
+
+func optionsDisjunctionWAND(qsearchers []search.Searcher, min float64,
+	options search.SearcherOptions) bool {
+	if !options.DynamicPruning || options.Score == "none" ||
+		min > 1 || len(qsearchers) < 2 {
+		return false
+	}
+	for _, searcher := range qsearchers {
+		if _, ok := searcher.(search.MaxScorer); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func newDisjunctionWANDSearcher(indexReader index.IndexReader,
+	searchers []search.Searcher, min float64, options search.SearcherOptions,
+	limit bool) (*DisjunctionWANDSearcher, error) {
+	if limit && tooManyClauses(len(searchers)) {
+		return nil, tooManyClausesErr("", len(searchers))
+	}
+
+	rv := DisjunctionWANDSearcher{
+		indexReader:  indexReader,
+		searchers:    searchers,
+		numSearchers: len(searchers),
+		scorer:       scorer.NewDisjunctionQueryScorer(options),
+		min:          int(min),
+		currs:        make([]*wandCurr, 0, len(searchers)),
+		minScore:     math.Inf(-1),
+		matching:     make([]*search.DocumentMatch, len(searchers)),
+	}
+	rv.computeQueryNorm()
+	return &rv, nil
+}
+
+func (s *DisjunctionWANDSearcher) Size() int {
+	sizeInBytes := reflectStaticSizeDisjunctionWANDSearcher + size.SizeOfPtr +
+		s.scorer.Size()
+
+	for _, entry := range s.searchers {
+		sizeInBytes += entry.Size()
+	}
+
+	for _, entry := range s.currs {
+		if entry.curr != nil {
+			sizeInBytes += entry.curr.Size()
+		}
+	}
+
+	// for currs, just use static size * len
+	// since searchers already counted above
+	sizeInBytes += len(s.currs) * reflectStaticSizeWANDCurr
+
+	return sizeInBytes
+}
+
+func (s *DisjunctionWANDSearcher) computeQueryNorm() {
+	// first calculate sum of squared weights
+	sumOfSquaredWeights := 0.0
+	for _, searcher := range s.searchers {
+		sumOfSquaredWeights += searcher.Weight()
+	}
+	// now compute query norm from this
+	s.queryNorm = 1.0 / math.Sqrt(sumOfSquaredWeights)
+	// finally tell all the downstream searchers the norm
+	for _, searcher := range s.searchers {
+		searcher.SetQueryNorm(s.queryNorm)
+	}
+}
+
+func (s *DisjunctionWANDSearcher) initSearchers(ctx *search.SearchContext) error {
+	// alloc a single block of wandCurrs
+	block := make([]wandCurr, len(s.searchers))
+
+	// get all searchers pointing at their first match
+	for i, searcher := range s.searchers {
+		curr, err := searcher.Next(ctx)
+		if err != nil {
+			return err
+		}
+		if curr != nil {
+			block[i].searcher = searcher
+			block[i].curr = curr
+			s.currs = append(s.currs, &block[i])
+		}
+	}
+	s.updateMaxScores()
+	s.sortCurrs()
+
+	s.initialized = true
+	return nil
+}
+
+// updateMaxScores refreshes the score bounds of the clauses, which
+// depend on the query norm.
+func (s *DisjunctionWANDSearcher) updateMaxScores() {
+	for _, c := range s.currs {
+		c.maxScore = c.searcher.(search.MaxScorer).MaxScore()
+	}
+}
+
+func (s *DisjunctionWANDSearcher) sortCurrs() {
+	sort.Slice(s.currs, func(i, j int) bool {
+		return s.currs[i].curr.IndexInternalID.Compare(s.currs[j].curr.IndexInternalID) < 0
+	})
+}
+
+// findPivot returns the position of the first clause, in document
+// order, at which the sum of the score bounds of the clauses exceeds
+// the minimum competitive score, or -1 when no document can compete.
+func (s *DisjunctionWANDSearcher) findPivot() int {
+	var sum float64
+	for i, c := range s.currs {
+		sum += c.maxScore
+		if sum > s.minScore {
+			return i
+		}
+	}
+	return -1
+}
+
+// moveCurrs moves the first n clauses forward, either to their next
+// match or, when a target is specified, to their first match at or
+// after the target.  The match keep is not returned to the pool.
+func (s *DisjunctionWANDSearcher) moveCurrs(ctx *search.SearchContext, n int,
+	target index.IndexInternalID, keep *search.DocumentMatch) error {
+	for i := 0; i < n; i++ {
+		c := s.currs[i]
+		if c.curr != keep {
+			ctx.DocumentMatchPool.Put(c.curr)
+		}
+		var err error
+		if target == nil {
+			c.curr, err = c.searcher.Next(ctx)
+		} else {
+			c.curr, err = c.searcher.Advance(ctx, target)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	// drop the exhausted clauses
+	currs := s.currs[:0]
+	for _, c := range s.currs {
+		if c.curr != nil {
+			currs = append(currs, c)
+		}
+	}
+	s.currs = currs
+	s.sortCurrs()
+	return nil
+}
+
+func (s *DisjunctionWANDSearcher) Next(ctx *search.SearchContext) (
+	*search.DocumentMatch, error) {
+	if !s.initialized {
+		err := s.initSearchers(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for len(s.currs) > 0 {
+		pivot := s.findPivot()
+		if pivot < 0 {
+			// nothing left can compete
+			for _, c := range s.currs {
+				ctx.DocumentMatchPool.Put(c.curr)
+			}
+			s.currs = s.currs[:0]
+			return nil, nil
+		}
+		pivotID := s.currs[pivot].curr.IndexInternalID
+
+		if s.currs[0].curr.IndexInternalID.Equals(pivotID) {
+			// all the clauses up to the pivot are on the pivot document
+			matching := s.matching[:0]
+			n := 0
+			for n < len(s.currs) && s.currs[n].curr.IndexInternalID.Equals(pivotID) {
+				matching = append(matching, s.currs[n].curr)
+				n++
+			}
+			rv := s.scorer.Score(ctx, matching, len(matching), s.numSearchers)
+			s.matching = matching
+
+			err := s.moveCurrs(ctx, n, nil, rv)
+			if err != nil {
+				return nil, err
+			}
+			return rv, nil
+		}
+
+		// documents before the pivot cannot compete, skip the lagging
+		// clauses ahead to the pivot document
+		n := 0
+		for n < pivot && s.currs[n].curr.IndexInternalID.Compare(pivotID) < 0 {
+			n++
+		}
+		// the pivot clause is not moved, so pivotID remains valid
+		err := s.moveCurrs(ctx, n, pivotID, nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return nil, nil
+}
+
+func (s *DisjunctionWANDSearcher) Advance(ctx *search.SearchContext,
+	ID index.IndexInternalID) (*search.DocumentMatch, error) {
+	if !s.initialized {
+		err := s.initSearchers(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	n := 0
+	for n < len(s.currs) && s.currs[n].curr.IndexInternalID.Compare(ID) < 0 {
+		n++
+	}
+	err := s.moveCurrs(ctx, n, ID, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.Next(ctx)
+}
+
+// SetMinCompetitiveScore sets the score which a document must exceed
+// to be returned.  Documents scoring at most this score may still be
+// returned, but those which cannot exceed it are skipped.
+func (s *DisjunctionWANDSearcher) SetMinCompetitiveScore(score float64) {
+	if score > s.minScore {
+		s.minScore = score
+	}
+}
+
+func (s *DisjunctionWANDSearcher) MaxScore() float64 {
+	var rv float64
+	for _, searcher := range s.searchers {
+		rv += searcher.(search.MaxScorer).MaxScore()
+	}
+	return rv
+}
+
+func (s *DisjunctionWANDSearcher) Weight() float64 {
+	var rv float64
+	for _, searcher := range s.searchers {
+		rv += searcher.Weight()
+	}
+	return rv
+}
+
+func (s *DisjunctionWANDSearcher) SetQueryNorm(qnorm float64) {
+	for _, searcher := range s.searchers {
+		searcher.SetQueryNorm(qnorm)
+	}
+	s.updateMaxScores()
+}
+
+func (s *DisjunctionWANDSearcher) Count() uint64 {
+	// for now return a worst case
+	var sum uint64
+	for _, searcher := range s.searchers {
+		sum += searcher.Count()
+	}
+	return sum
+}
+
+func (s *DisjunctionWANDSearcher) Close() (rv error) {
+	for _, searcher := range s.searchers {
+		err := searcher.Close()
+		if err != nil && rv == nil {
+			rv = err
+		}
+	}
+	return rv
+}
+
+func (s *DisjunctionWANDSearcher) Min() int {
+	return s.min
+}
+
+func (s *DisjunctionWANDSearcher) DocumentMatchPoolSize() int {
+	rv := len(s.searchers)
+	for _, s := range s.searchers {
+		rv += s.DocumentMatchPoolSize()
+	}
+	return rv
+}
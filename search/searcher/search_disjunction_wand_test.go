@@ -0,0 +1,154 @@
+//  Copyright (c) 2021 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package searcher
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/blevesearch/bleve/v2/document"
+	"github.com/blevesearch/bleve/v2/index/scorch"
+	"github.com/blevesearch/bleve/v2/index/upsidedown"
+	"github.com/blevesearch/bleve/v2/index/upsidedown/store/gtreap"
+	"github.com/blevesearch/bleve/v2/search"
+	"github.com/blevesearch/bleve/v2/search/collector"
+	index "github.com/blevesearch/bleve_index_api"
+)
+
+func initWANDDocs(t *testing.T, i index.Index) {
+	err := i.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	batch := index.NewBatch()
+	for n := 0; n < 500; n++ {
+		words := []string{"common"}
+		if n%5 == 0 {
+			words = append(words, "medium")
+		}
+		if n%50 == 0 {
+			words = append(words, "rare", "rare")
+		}
+		for f := 0; f < n%7; f++ {
+			words = append(words, "filler")
+		}
+		batch.Update(document.NewDocument(fmt.Sprintf("%03d", n)).
+			AddField(document.NewTextFieldWithAnalyzer("desc", []uint64{},
+				[]byte(strings.Join(words, " ")), testAnalyzer)))
+	}
+	err = i.Batch(batch)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func collectWAND(t *testing.T, r index.IndexReader, size int,
+	options search.SearcherOptions) (*collector.TopNCollector, search.Searcher) {
+	var searchers []search.Searcher
+	for _, term := range []string{"common", "medium", "rare"} {
+		ts, err := NewTermSearcher(r, term, "desc", 1.0, options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		searchers = append(searchers, ts)
+	}
+	ds, err := NewDisjunctionSearcher(r, searchers, 0, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	coll := collector.NewTopNCollector(size, 0, search.SortOrder{&search.SortScore{Desc: true}})
+	if options.DynamicPruning {
+		coll.SetTotalHitsThreshold(0)
+	}
+	err = coll.Collect(context.Background(), ds, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return coll, ds
+}
+
+func TestDisjunctionWANDSearch(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "scorchWAND")
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+
+	analysisQueue := index.NewAnalysisQueue(1)
+	upsidedownIndex, err := upsidedown.NewUpsideDownCouch(gtreap.Name,
+		map[string]interface{}{"path": ""}, analysisQueue)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scorchIndex, err := scorch.NewScorch(scorch.Name,
+		map[string]interface{}{"path": dir}, analysisQueue)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, i := range []index.Index{upsidedownIndex, scorchIndex} {
+		initWANDDocs(t, i)
+		r, err := i.Reader()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, size := range []int{1, 10, 25, 200} {
+			exhaustive, _ := collectWAND(t, r, size, search.SearcherOptions{})
+			pruned, ds := collectWAND(t, r, size, search.SearcherOptions{DynamicPruning: true})
+			if _, ok := ds.(*DisjunctionWANDSearcher); !ok {
+				t.Fatalf("expected wand searcher, got %T", ds)
+			}
+
+			if exhaustive.Total() != 500 {
+				t.Errorf("expected exhaustive total 500, got %d", exhaustive.Total())
+			}
+			if exhaustive.TotalIsLowerBound() {
+				t.Errorf("size %d: expected exact total", size)
+			}
+			if size < 100 && (pruned.Total() >= exhaustive.Total() || !pruned.TotalIsLowerBound()) {
+				t.Errorf("size %d: expected documents to be skipped, total %d", size, pruned.Total())
+			}
+			if pruned.MaxScore() != exhaustive.MaxScore() {
+				t.Errorf("size %d: expected max score %f, got %f", size,
+					exhaustive.MaxScore(), pruned.MaxScore())
+			}
+
+			expected, actual := exhaustive.Results(), pruned.Results()
+			if len(expected) != len(actual) {
+				t.Fatalf("size %d: expected %d hits, got %d", size, len(expected), len(actual))
+			}
+			for n := range expected {
+				if !expected[n].IndexInternalID.Equals(actual[n].IndexInternalID) ||
+					!scoresCloseEnough(expected[n].Score, actual[n].Score) {
+					t.Errorf("size %d: hit %d expected %s, got %s", size, n,
+						expected[n], actual[n])
+				}
+			}
+		}
+
+		err = r.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = i.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
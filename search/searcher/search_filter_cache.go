@@ -0,0 +1,109 @@
+//  Copyright (c) 2021 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package searcher
+
+import (
+	"reflect"
+
+	"github.com/blevesearch/bleve/v2/search"
+	"github.com/blevesearch/bleve/v2/search/scorer"
+	"github.com/blevesearch/bleve/v2/size"
+	index "github.com/blevesearch/bleve_index_api"
+)
+
+var reflectStaticSizeFilterCacheSearcher int
+
+func init() {
+	var fcs FilterCacheSearcher
+	reflectStaticSizeFilterCacheSearcher = int(reflect.TypeOf(fcs).Size())
+}
+
+// FilterCacheSearcher returns the documents matching a non-scoring
+// clause from the filter cache of the index reader.
+type FilterCacheSearcher struct {
+	reader index.DocIDReader
+	scorer *scorer.ConstantScorer
+	count  uint64
+}
+
+// NewFilterCacheSearcher returns a searcher for the clause identified
+// by the key, whose matches are cached by the index reader when scores
+// and term vectors are not needed.  Otherwise, or when the reader does
+// not cache filters, the searcher built by newSearcher is returned.
+func NewFilterCacheSearcher(indexReader index.IndexReader, key string,
+	newSearcher func() (search.Searcher, error),
+	options search.SearcherOptions) (search.Searcher, error) {
+	fcr, ok := indexReader.(search.FilterCacheReader)
+	if !ok || !fcr.FilterCacheEnabled() ||
+		options.Score != "none" || options.IncludeTermVectors {
+		return newSearcher()
+	}
+
+	reader, count, err := fcr.FilterDocIDReader(key, newSearcher)
+	if err != nil {
+		return nil, err
+	}
+	return &FilterCacheSearcher{
+		reader: reader,
+		scorer: scorer.NewConstantScorer(0, 1.0, options),
+		count:  count,
+	}, nil
+}
+
+func (s *FilterCacheSearcher) Size() int {
+	return reflectStaticSizeFilterCacheSearcher + size.SizeOfPtr +
+		s.reader.Size() +
+		s.scorer.Size()
+}
+
+func (s *FilterCacheSearcher) Count() uint64 {
+	return s.count
+}
+
+func (s *FilterCacheSearcher) Weight() float64 {
+	return s.scorer.Weight()
+}
+
+func (s *FilterCacheSearcher) SetQueryNorm(qnorm float64) {
+	s.scorer.SetQueryNorm(qnorm)
+}
+
+func (s *FilterCacheSearcher) Next(ctx *search.SearchContext) (*search.DocumentMatch, error) {
+	id, err := s.reader.Next()
+	if err != nil || id == nil {
+		return nil, err
+	}
+	return s.scorer.Score(ctx, id), nil
+}
+
+func (s *FilterCacheSearcher) Advance(ctx *search.SearchContext, ID index.IndexInternalID) (*search.DocumentMatch, error) {
+	id, err := s.reader.Advance(ID)
+	if err != nil || id == nil {
+		return nil, err
+	}
+	return s.scorer.Score(ctx, id), nil
+}
+
+func (s *FilterCacheSearcher) Close() error {
+	return s.reader.Close()
+}
+
+func (s *FilterCacheSearcher) Min() int {
+	return 0
+}
+
+func (s *FilterCacheSearcher) DocumentMatchPoolSize() int {
+	return 1
+}
@@ -0,0 +1,289 @@
+//  Copyright (c) 2021 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package searcher
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/blevesearch/bleve/v2/search"
+	"github.com/blevesearch/bleve/v2/size"
+	index "github.com/blevesearch/bleve_index_api"
+)
+
+var reflectStaticSizePinnedSearcher int
+
+func init() {
+	var ps PinnedSearcher
+	reflectStaticSizePinnedSearcher = int(reflect.TypeOf(ps).Size())
+}
+
+// PinnedSearcher returns the matches of an organic searcher, along with
+// a list of pinned documents which score above any organic match, in
+// the order they were pinned.  Organic scores s are mapped to s/(1+s),
+// keeping their order while bringing them below 1, and the pinned
+// document at offset p of the n requested ids scores n-p+1, whether
+// or not the documents pinned before it exist, so that the scores of
+// pinned documents from different indexes compare.  Both are then
+// multiplied by the boost.  Excluded documents are never
+// returned.
+type PinnedSearcher struct {
+	organic   search.Searcher
+	pinnedIDs []index.IndexInternalID
+	pinnedPos map[string]int
+	numIDs    int
+	excluded  map[string]struct{}
+	boost     float64
+	options   search.SearcherOptions
+
+	initialized      bool
+	currPinned       int
+	currOrganic      *search.DocumentMatch
+	organicExhausted bool
+}
+
+func NewPinnedSearcher(indexReader index.IndexReader, organic search.Searcher,
+	ids []string, excludedIDs []string, boost float64,
+	options search.SearcherOptions) (*PinnedSearcher, error) {
+	excluded := make(map[string]struct{}, len(excludedIDs))
+	err := visitInternalIDs(indexReader, excludedIDs, func(id index.IndexInternalID) error {
+		excluded[string(id)] = struct{}{}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	externalPos := make(map[string]int, len(ids))
+	for i, id := range ids {
+		if _, ok := externalPos[id]; !ok {
+			externalPos[id] = i
+		}
+	}
+	pinnedPos := make(map[string]int, len(ids))
+	pinnedIDs := make([]index.IndexInternalID, 0, len(ids))
+	err = visitInternalIDs(indexReader, ids, func(id index.IndexInternalID) error {
+		if _, ok := excluded[string(id)]; ok {
+			return nil
+		}
+		externalID, err := indexReader.ExternalID(id)
+		if err != nil {
+			return err
+		}
+		pinnedPos[string(id)] = externalPos[externalID]
+		pinnedIDs = append(pinnedIDs, append(index.IndexInternalID(nil), id...))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(pinnedIDs, func(i, j int) bool {
+		return pinnedIDs[i].Compare(pinnedIDs[j]) < 0
+	})
+
+	return &PinnedSearcher{
+		organic:   organic,
+		pinnedIDs: pinnedIDs,
+		pinnedPos: pinnedPos,
+		numIDs:    len(ids),
+		excluded:  excluded,
+		boost:     boost,
+		options:   options,
+	}, nil
+}
+
+func visitInternalIDs(indexReader index.IndexReader, ids []string,
+	visitor func(id index.IndexInternalID) error) (err error) {
+	if len(ids) == 0 {
+		return nil
+	}
+	reader, err := indexReader.DocIDReaderOnly(ids)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := reader.Close(); err == nil && cerr != nil {
+			err = cerr
+		}
+	}()
+	id, err := reader.Next()
+	for err == nil && id != nil {
+		err = visitor(id)
+		if err != nil {
+			return err
+		}
+		id, err = reader.Next()
+	}
+	return err
+}
+
+func (s *PinnedSearcher) Size() int {
+	sizeInBytes := reflectStaticSizePinnedSearcher + size.SizeOfPtr +
+		s.organic.Size()
+
+	for _, id := range s.pinnedIDs {
+		sizeInBytes += size.SizeOfSlice + len(id) +
+			size.SizeOfString + len(id) + size.SizeOfInt
+	}
+
+	for k := range s.excluded {
+		sizeInBytes += size.SizeOfString + len(k)
+	}
+
+	if s.currOrganic != nil {
+		sizeInBytes += s.currOrganic.Size()
+	}
+
+	return sizeInBytes
+}
+
+func (s *PinnedSearcher) initSearchers(ctx *search.SearchContext) error {
+	var err error
+	s.currOrganic, err = s.organic.Next(ctx)
+	if err != nil {
+		return err
+	}
+	s.organicExhausted = s.currOrganic == nil
+	s.initialized = true
+	return nil
+}
+
+func (s *PinnedSearcher) Next(ctx *search.SearchContext) (*search.DocumentMatch, error) {
+	if !s.initialized {
+		err := s.initSearchers(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for {
+		var pinnedID index.IndexInternalID
+		if s.currPinned < len(s.pinnedIDs) {
+			pinnedID = s.pinnedIDs[s.currPinned]
+		}
+		if pinnedID == nil && s.currOrganic == nil {
+			return nil, nil
+		}
+
+		var rv *search.DocumentMatch
+		var err error
+		if pinnedID != nil && (s.currOrganic == nil ||
+			pinnedID.Compare(s.currOrganic.IndexInternalID) < 0) {
+			// pinned only
+			rv = ctx.DocumentMatchPool.Get()
+			rv.IndexInternalID = append(rv.IndexInternalID[:0], pinnedID...)
+			s.currPinned++
+			s.scorePinned(rv)
+			return rv, nil
+		}
+
+		rv = s.currOrganic
+		s.currOrganic, err = s.organic.Next(ctx)
+		if err != nil {
+			return nil, err
+		}
+		s.organicExhausted = s.currOrganic == nil
+
+		if pinnedID != nil && pinnedID.Equals(rv.IndexInternalID) {
+			// pinned and organic, keep the organic match for its locations
+			s.currPinned++
+			s.scorePinned(rv)
+			return rv, nil
+		}
+
+		if _, ok := s.excluded[string(rv.IndexInternalID)]; ok {
+			ctx.DocumentMatchPool.Put(rv)
+			continue
+		}
+
+		s.scoreOrganic(rv)
+		return rv, nil
+	}
+}
+
+func (s *PinnedSearcher) scorePinned(dm *search.DocumentMatch) {
+	pos := s.pinnedPos[string(dm.IndexInternalID)]
+	dm.Score = float64(s.numIDs-pos+1) * s.boost
+	if s.options.Explain {
+		dm.Expl = &search.Explanation{
+			Value:   dm.Score,
+			Message: fmt.Sprintf("pinned at position %d, with boost %f", pos+1, s.boost),
+		}
+	}
+}
+
+func (s *PinnedSearcher) scoreOrganic(dm *search.DocumentMatch) {
+	score := dm.Score / (1 + dm.Score) * s.boost
+	if s.options.Explain {
+		dm.Expl = &search.Explanation{
+			Value:    score,
+			Message:  fmt.Sprintf("organic score, mapped by s/(1+s), with boost %f", s.boost),
+			Children: []*search.Explanation{dm.Expl},
+		}
+	}
+	dm.Score = score
+}
+
+func (s *PinnedSearcher) Advance(ctx *search.SearchContext, ID index.IndexInternalID) (*search.DocumentMatch, error) {
+	if !s.initialized {
+		err := s.initSearchers(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for s.currPinned < len(s.pinnedIDs) &&
+		s.pinnedIDs[s.currPinned].Compare(ID) < 0 {
+		s.currPinned++
+	}
+
+	if !s.organicExhausted && s.currOrganic != nil &&
+		s.currOrganic.IndexInternalID.Compare(ID) < 0 {
+		ctx.DocumentMatchPool.Put(s.currOrganic)
+		var err error
+		s.currOrganic, err = s.organic.Advance(ctx, ID)
+		if err != nil {
+			return nil, err
+		}
+		s.organicExhausted = s.currOrganic == nil
+	}
+
+	return s.Next(ctx)
+}
+
+func (s *PinnedSearcher) Count() uint64 {
+	return s.organic.Count() + uint64(len(s.pinnedIDs))
+}
+
+func (s *PinnedSearcher) Weight() float64 {
+	return s.organic.Weight()
+}
+
+func (s *PinnedSearcher) SetQueryNorm(qnorm float64) {
+	s.organic.SetQueryNorm(qnorm)
+}
+
+func (s *PinnedSearcher) Close() error {
+	return s.organic.Close()
+}
+
+func (s *PinnedSearcher) Min() int {
+	return 0
+}
+
+func (s *PinnedSearcher) DocumentMatchPoolSize() int {
+	return s.organic.DocumentMatchPoolSize() + 1
+}
@@ -0,0 +1,137 @@
+//  Copyright (c) 2014 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package searcher
+
+import (
+	"reflect"
+	"time"
+
+	"github.com/blevesearch/bleve/v2/search"
+	"github.com/blevesearch/bleve/v2/size"
+	index "github.com/blevesearch/bleve_index_api"
+)
+
+var reflectStaticSizeProfileSearcher int
+
+func init() {
+	var ps ProfileSearcher
+	reflectStaticSizeProfileSearcher = int(reflect.TypeOf(ps).Size())
+}
+
+// ProfileSearcher records the calls made to a searcher, and the time
+// spent in them, in its profile.
+type ProfileSearcher struct {
+	searcher search.Searcher
+	profile  *search.SearcherProfile
+}
+
+// NewProfileSearcher returns a searcher profiling the provided one.
+// Searchers able to bound their scores, and to skip non-competitive
+// documents, are still seen as such.
+func NewProfileSearcher(s search.Searcher,
+	profile *search.SearcherProfile) search.Searcher {
+	rv := &ProfileSearcher{
+		searcher: s,
+		profile:  profile,
+	}
+	if _, ok := s.(search.MaxScorer); ok {
+		if _, ok := s.(search.CompetitiveSearcher); ok {
+			return &competitiveProfileSearcher{rv}
+		}
+		return &maxScoreProfileSearcher{rv}
+	}
+	return rv
+}
+
+func (s *ProfileSearcher) Size() int {
+	return reflectStaticSizeProfileSearcher + size.SizeOfPtr +
+		s.searcher.Size()
+}
+
+func (s *ProfileSearcher) Count() uint64 {
+	return s.searcher.Count()
+}
+
+func (s *ProfileSearcher) Weight() float64 {
+	return s.searcher.Weight()
+}
+
+func (s *ProfileSearcher) SetQueryNorm(qnorm float64) {
+	s.searcher.SetQueryNorm(qnorm)
+}
+
+func (s *ProfileSearcher) Next(ctx *search.SearchContext) (*search.DocumentMatch, error) {
+	start := time.Now()
+	rv, err := s.searcher.Next(ctx)
+	s.profile.Time += time.Since(start)
+	s.profile.NextCalls++
+	if rv != nil {
+		s.profile.DocsScored++
+	}
+	return rv, err
+}
+
+func (s *ProfileSearcher) Advance(ctx *search.SearchContext, ID index.IndexInternalID) (*search.DocumentMatch, error) {
+	start := time.Now()
+	rv, err := s.searcher.Advance(ctx, ID)
+	s.profile.Time += time.Since(start)
+	s.profile.AdvanceCalls++
+	if rv != nil {
+		s.profile.DocsScored++
+	}
+	return rv, err
+}
+
+func (s *ProfileSearcher) Close() error {
+	return s.searcher.Close()
+}
+
+func (s *ProfileSearcher) Min() int {
+	return s.searcher.Min()
+}
+
+func (s *ProfileSearcher) DocumentMatchPoolSize() int {
+	return s.searcher.DocumentMatchPoolSize()
+}
+
+// Optimize lets the profiled searcher be optimized along with the
+// other clauses of a disjunction or conjunction.
+func (s *ProfileSearcher) Optimize(kind string, octx index.OptimizableContext) (
+	index.OptimizableContext, error) {
+	if o, ok := s.searcher.(index.Optimizable); ok {
+		return o.Optimize(kind, octx)
+	}
+	return nil, nil
+}
+
+type maxScoreProfileSearcher struct {
+	*ProfileSearcher
+}
+
+func (s *maxScoreProfileSearcher) MaxScore() float64 {
+	return s.searcher.(search.MaxScorer).MaxScore()
+}
+
+type competitiveProfileSearcher struct {
+	*ProfileSearcher
+}
+
+func (s *competitiveProfileSearcher) MaxScore() float64 {
+	return s.searcher.(search.MaxScorer).MaxScore()
+}
+
+func (s *competitiveProfileSearcher) SetMinCompetitiveScore(score float64) {
+	s.searcher.(search.CompetitiveSearcher).SetMinCompetitiveScore(score)
+}
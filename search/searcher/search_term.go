@@ -35,6 +35,7 @@ type TermSearcher struct {
 	reader      index.TermFieldReader
 	scorer      *scorer.TermQueryScorer
 	tfd         index.TermFieldDoc
+	profile     *search.SearcherProfile
 }
 
 func NewTermSearcher(indexReader index.IndexReader, term string, field string, boost float64, options search.SearcherOptions) (*TermSearcher, error) {
@@ -62,6 +63,7 @@ func newTermSearcherFromReader(indexReader index.IndexReader, reader index.TermF
 		indexReader: indexReader,
 		reader:      reader,
 		scorer:      scorer,
+		profile:     options.Profile,
 	}, nil
 }
 
@@ -80,6 +82,10 @@ func (s *TermSearcher) Weight() float64 {
 	return s.scorer.Weight()
 }
 
+func (s *TermSearcher) MaxScore() float64 {
+	return s.scorer.MaxScore()
+}
+
 func (s *TermSearcher) SetQueryNorm(qnorm float64) {
 	s.scorer.SetQueryNorm(qnorm)
 }
@@ -94,6 +100,10 @@ func (s *TermSearcher) Next(ctx *search.SearchContext) (*search.DocumentMatch, e
 		return nil, nil
 	}
 
+	if s.profile != nil {
+		s.profile.PostingsRead++
+	}
+
 	// score match
 	docMatch := s.scorer.Score(ctx, termMatch)
 	// return doc match
@@ -111,6 +121,10 @@ func (s *TermSearcher) Advance(ctx *search.SearchContext, ID index.IndexInternal
 		return nil, nil
 	}
 
+	if s.profile != nil {
+		s.profile.PostingsRead++
+	}
+
 	// score match
 	docMatch := s.scorer.Score(ctx, termMatch)
 
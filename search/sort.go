@@ -500,8 +500,13 @@ func (s *SortField) MarshalJSON() ([]byte, error) {
 	return json.Marshal(sfm)
 }
 
+// Copy returns a copy of the sort field, which does not share the
+// buffers used to visit the terms of each document, so that the copy
+// can be used concurrently.
 func (s *SortField) Copy() SearchSort {
 	rv := *s
+	rv.values = nil
+	rv.tmp = nil
 	return &rv
 }
 
@@ -732,6 +737,7 @@ func (s *SortGeoDistance) MarshalJSON() ([]byte, error) {
 
 func (s *SortGeoDistance) Copy() SearchSort {
 	rv := *s
+	rv.values = nil
 	return &rv
 }
 
@@ -15,12 +15,15 @@
 package bleve
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	index "github.com/blevesearch/bleve_index_api"
 	"reflect"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -39,8 +42,10 @@ import (
 	"github.com/blevesearch/bleve/v2/index/upsidedown"
 	"github.com/blevesearch/bleve/v2/mapping"
 	"github.com/blevesearch/bleve/v2/search"
+	"github.com/blevesearch/bleve/v2/search/collector"
 	"github.com/blevesearch/bleve/v2/search/highlight/highlighter/ansi"
 	"github.com/blevesearch/bleve/v2/search/highlight/highlighter/html"
+	"github.com/blevesearch/bleve/v2/search/ltr/model/linear"
 	"github.com/blevesearch/bleve/v2/search/query"
 )
 
@@ -1810,3 +1815,1614 @@ func TestAnalyzerInheritance(t *testing.T) {
 		})
 	}
 }
+
+func TestSearchCollapse(t *testing.T) {
+	familyMapping := NewTextFieldMapping()
+	familyMapping.Analyzer = keyword.Name
+	docMapping := NewDocumentMapping()
+	docMapping.AddFieldMappingsAt("family", familyMapping)
+	docMapping.AddFieldMappingsAt("rank", NewNumericFieldMapping())
+	idxMapping := NewIndexMapping()
+	idxMapping.DefaultMapping = docMapping
+
+	tmpIndexPath := createTmpIndexPath(t)
+	defer cleanupTmpIndexPath(t, tmpIndexPath)
+
+	idx, err := NewUsing(tmpIndexPath, idxMapping, scorch.Name, Config.DefaultKVStore, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := idx.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	docs := map[string]map[string]interface{}{
+		"a1": {"family": "a", "rank": 1},
+		"a2": {"family": "a", "rank": 2},
+		"a3": {"family": "a", "rank": 3},
+		"b1": {"family": "b", "rank": 4},
+		"b2": {"family": "b", "rank": 5},
+		"c1": {"family": "c", "rank": 6},
+	}
+	for id, doc := range docs {
+		if err = idx.Index(id, doc); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	req := NewSearchRequestOptions(NewMatchAllQuery(), 2, 0, false)
+	req.SortBy([]string{"rank"})
+	req.Collapse = NewCollapseRequest("family", 1)
+	res, err := idx.Search(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Total != 6 {
+		t.Errorf("expected 6 total hits, got %d", res.Total)
+	}
+	if res.TotalGroups != 3 {
+		t.Errorf("expected 3 total groups, got %d", res.TotalGroups)
+	}
+	if len(res.Hits) != 2 {
+		t.Fatalf("expected 2 hits, got %d", len(res.Hits))
+	}
+	if res.Hits[0].ID != "a1" || res.Hits[1].ID != "b1" {
+		t.Errorf("expected hits a1, b1, got %s, %s", res.Hits[0].ID, res.Hits[1].ID)
+	}
+	if len(res.Hits[0].InnerHits) != 1 || res.Hits[0].InnerHits[0].ID != "a2" {
+		t.Errorf("expected inner hit a2, got %v", res.Hits[0].InnerHits)
+	}
+	if res.Hits[0].CollapseKey != "a" {
+		t.Errorf("expected collapse key a, got %q", res.Hits[0].CollapseKey)
+	}
+
+	// the next page of groups
+	req.From = 2
+	res, err = idx.Search(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Hits) != 1 || res.Hits[0].ID != "c1" {
+		t.Fatalf("expected single hit c1, got %v", res.Hits)
+	}
+	if len(res.Hits[0].InnerHits) != 0 {
+		t.Errorf("expected no inner hits, got %v", res.Hits[0].InnerHits)
+	}
+
+	// collapsing across indexes keeps the best hit of each group, the
+	// collapse field being loaded as any other
+	req.From = 0
+	req.Fields = []string{"family"}
+	res, err = MultiSearch(context.Background(), req, idx, idx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Hits) != 2 || res.Hits[0].ID != "a1" || res.Hits[1].ID != "b1" {
+		t.Fatalf("expected hits a1, b1, got %v", res.Hits)
+	}
+	if res.Hits[0].Fields["family"] != "a" {
+		t.Errorf("expected stored family a, got %v", res.Hits[0].Fields["family"])
+	}
+}
+
+func TestSearchRescore(t *testing.T) {
+	tmpIndexPath := createTmpIndexPath(t)
+	defer cleanupTmpIndexPath(t, tmpIndexPath)
+
+	idx, err := NewUsing(tmpIndexPath, NewIndexMapping(), scorch.Name, Config.DefaultKVStore, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := idx.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	docs := map[string]string{
+		"1": "quick brown fox quick quick",
+		"2": "the brown quick fox",
+		"3": "brown fox jumps over quick dog",
+		"4": "lazy dog",
+	}
+	// index in id order, so doc 1 has the lowest internal id
+	for _, id := range []string{"1", "2", "3", "4"} {
+		if err = idx.Index(id, map[string]interface{}{"body": docs[id]}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	q := NewMatchQuery("quick fox")
+	q.SetField("body")
+	req := NewSearchRequest(q)
+	res, err := idx.Search(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Total != 3 || res.Hits[0].ID != "1" {
+		t.Fatalf("expected doc 1 first out of 3, got %v", res.Hits)
+	}
+
+	pq := NewMatchPhraseQuery("brown quick fox")
+	pq.SetField("body")
+	req.Rescore = NewRescoreRequest(pq, 10)
+	req.Rescore.RescoreQueryWeight = 10
+	req.Explain = true
+	if err = req.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	res, err = MultiSearch(context.Background(), req, idx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Total != 3 || len(res.Hits) != 3 {
+		t.Fatalf("expected 3 hits, got %v", res.Hits)
+	}
+	if res.Hits[0].ID != "2" {
+		t.Errorf("expected phrase match doc 2 first, got %s", res.Hits[0].ID)
+	}
+	if res.MaxScore != res.Hits[0].Score {
+		t.Errorf("expected max score %f, got %f", res.Hits[0].Score, res.MaxScore)
+	}
+	if len(res.Hits[0].Expl.Children) != 2 {
+		t.Errorf("expected rescore explanation, got %v", res.Hits[0].Expl)
+	}
+
+	// the rescore searcher runs out after doc 1, the remaining hits in
+	// the window keep their original scores
+	eq := NewMatchPhraseQuery("quick quick")
+	eq.SetField("body")
+	exhaustedReq := NewSearchRequest(q)
+	exhaustedReq.Rescore = NewRescoreRequest(eq, 10)
+	exhaustedReq.Rescore.RescoreQueryWeight = 10
+	res, err = idx.Search(exhaustedReq)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Hits) != 3 || res.Hits[0].ID != "1" {
+		t.Fatalf("expected doc 1 first out of 3, got %v", res.Hits)
+	}
+
+	// paging only returns hits from the rescored window
+	req.Size = 1
+	req.From = 1
+	res, err = idx.Search(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Hits) != 1 || res.Hits[0].ID != "1" {
+		t.Fatalf("expected doc 1 second, got %v", res.Hits)
+	}
+
+	req.SortBy([]string{"_id"})
+	if err = req.Validate(); err == nil {
+		t.Errorf("expected rescore sorted by id to be invalid")
+	}
+
+	var jsonReq SearchRequest
+	err = json.Unmarshal([]byte(`{"query":{"match_all":{}},"rescore":{"query":{"match":"fox"}}}`), &jsonReq)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if jsonReq.Rescore.WindowSize != DefaultRescoreWindowSize ||
+		jsonReq.Rescore.QueryWeight != 1 || jsonReq.Rescore.RescoreQueryWeight != 1 {
+		t.Errorf("unexpected rescore defaults %+v", jsonReq.Rescore)
+	}
+}
+
+func TestSearchLTRFeaturesAndModelRescore(t *testing.T) {
+	tmpIndexPath := createTmpIndexPath(t)
+	defer cleanupTmpIndexPath(t, tmpIndexPath)
+
+	idx, err := NewUsing(tmpIndexPath, NewIndexMapping(), scorch.Name, Config.DefaultKVStore, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := idx.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	docs := map[string]map[string]interface{}{
+		"1": {"title": "bleve search", "body": "indexing text"},
+		"2": {"title": "text indexing", "body": "bleve search library"},
+		"3": {"title": "unrelated", "body": "search"},
+	}
+	for id, doc := range docs {
+		if err = idx.Index(id, doc); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	titleQuery := NewMatchQuery("bleve")
+	titleQuery.SetField("title")
+	bodyQuery := NewMatchQuery("bleve")
+	bodyQuery.SetField("body")
+
+	q := NewMatchQuery("search")
+	req := NewSearchRequest(q)
+	req.AddFeature(NewFeatureRequest("title_bleve", titleQuery))
+	req.AddFeature(NewFeatureRequest("body_bleve", bodyQuery))
+	res, err := idx.Search(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Hits) != 3 {
+		t.Fatalf("expected 3 hits, got %d", len(res.Hits))
+	}
+	for _, hit := range res.Hits {
+		if len(hit.Features) != 2 {
+			t.Fatalf("expected 2 features for hit %s, got %v", hit.ID, hit.Features)
+		}
+		switch hit.ID {
+		case "1":
+			if hit.Features["title_bleve"] <= 0 || hit.Features["body_bleve"] != 0 {
+				t.Errorf("unexpected features for hit 1: %v", hit.Features)
+			}
+		case "2":
+			if hit.Features["title_bleve"] != 0 || hit.Features["body_bleve"] <= 0 {
+				t.Errorf("unexpected features for hit 2: %v", hit.Features)
+			}
+		case "3":
+			if hit.Features["title_bleve"] != 0 || hit.Features["body_bleve"] != 0 {
+				t.Errorf("unexpected features for hit 3: %v", hit.Features)
+			}
+		}
+	}
+
+	_, err = Config.Cache.DefineLTRModel("test_body_ranker", map[string]interface{}{
+		"type": linear.Name,
+		"weights": map[string]interface{}{
+			"title_bleve": 0.0,
+			"body_bleve":  100.0,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Rescore = NewModelRescoreRequest("test_body_ranker", 10)
+	req.Rescore.QueryWeight = 0
+	if err = req.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	res, err = idx.Search(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Hits[0].ID != "2" {
+		t.Errorf("expected model to rank hit 2 first, got %s", res.Hits[0].ID)
+	}
+	if res.Hits[0].Score != 100*res.Hits[0].Features["body_bleve"] {
+		t.Errorf("expected model score, got %f", res.Hits[0].Score)
+	}
+
+	req.Features = nil
+	if err = req.Validate(); err == nil {
+		t.Errorf("expected model rescore without features to be invalid")
+	}
+}
+
+func TestSearchFusion(t *testing.T) {
+	newIndex := func(name string, docs map[string]map[string]interface{}) Index {
+		idx, err := NewMemOnly(NewIndexMapping())
+		if err != nil {
+			t.Fatal(err)
+		}
+		idx.SetName(name)
+		for id, doc := range docs {
+			if err = idx.Index(id, doc); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return idx
+	}
+
+	// documents of index a score much higher than those of index b
+	idxA := newIndex("a", map[string]map[string]interface{}{
+		"a1": {"title": "bleve bleve", "tags": "go"},
+		"a2": {"title": "bleve text", "tags": "search"},
+		"a3": {"title": "bleve text search indexing", "tags": "search"},
+	})
+	defer func() {
+		_ = idxA.Close()
+	}()
+	idxB := newIndex("b", map[string]map[string]interface{}{
+		"b1": {"title": "bleve is a text search and indexing library", "tags": "go"},
+		"b2": {"title": "a library for text search and indexing, in go, named bleve"},
+	})
+	defer func() {
+		_ = idxB.Close()
+	}()
+
+	q := NewMatchQuery("bleve")
+	q.SetField("title")
+	req := NewSearchRequestOptions(q, 2, 0, false)
+	res, err := MultiSearch(context.Background(), req, idxA, idxB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Hits[0].Index != "a" || res.Hits[1].Index != "a" {
+		t.Fatalf("expected raw scores to favor index a, got %v", res.Hits)
+	}
+
+	req.Fusion = NewFusionRequest(FusionMethodRRF)
+	if err = req.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	res, err = MultiSearch(context.Background(), req, idxA, idxB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Total != 5 {
+		t.Errorf("expected 5 total hits, got %d", res.Total)
+	}
+	if len(res.Hits) != 2 {
+		t.Fatalf("expected 2 hits, got %d", len(res.Hits))
+	}
+	ids := map[string]bool{res.Hits[0].ID: true, res.Hits[1].ID: true}
+	if !ids["a1"] || !ids["b1"] {
+		t.Errorf("expected the best hit of each index, got %v", res.Hits)
+	}
+	expectedScore := 1 / float64(DefaultFusionRankConstant+1)
+	if res.Hits[0].Score != expectedScore {
+		t.Errorf("expected score %f, got %f", expectedScore, res.Hits[0].Score)
+	}
+
+	// fuse a second query on another field within a single index
+	tq := NewMatchQuery("search")
+	tq.SetField("tags")
+	req = NewSearchRequestOptions(q, 3, 0, false)
+	req.Fusion = NewFusionRequest(FusionMethodMinMax, tq)
+	req.AddFacet("tags", NewFacetRequest("tags", 10))
+	res, err = idxA.Search(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Total != 3 || len(res.Hits) != 3 {
+		t.Fatalf("expected 3 hits, got %v", res.Hits)
+	}
+	// a2 is second for title, and tied first for tags
+	if res.Hits[0].ID != "a2" || res.Hits[0].Score <= 1 {
+		t.Errorf("expected a2 first with fused score above 1, got %v", res.Hits)
+	}
+	if res.Facets["tags"].Total != 3 {
+		t.Errorf("expected facet over all 3 hits, got %d", res.Facets["tags"].Total)
+	}
+
+	var jsonReq SearchRequest
+	err = json.Unmarshal([]byte(`{"query":{"match":"bleve"},"fusion":{"method":"z_score","queries":[{"match":"go"}]}}`), &jsonReq)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if jsonReq.Fusion.Method != FusionMethodZScore || len(jsonReq.Fusion.Queries) != 1 {
+		t.Errorf("unexpected fusion request %+v", jsonReq.Fusion)
+	}
+}
+
+func TestPinnedQuery(t *testing.T) {
+	idx, err := NewMemOnly(NewIndexMapping())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := idx.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	docs := map[string]string{
+		"1": "red shoes",
+		"2": "red red shoes",
+		"3": "blue shoes",
+		"4": "red hat",
+		"5": "green hat",
+	}
+	for id, body := range docs {
+		if err = idx.Index(id, map[string]interface{}{"body": body}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	organic := NewMatchQuery("red")
+	organic.SetField("body")
+	q := NewPinnedQuery(organic, []string{"5", "missing", "4", "3"})
+	q.SetExcludedIDs([]string{"3", "1"})
+	req := NewSearchRequestOptions(q, 10, 0, true)
+	req.AddFacet("body", NewFacetRequest("body", 10))
+	res, err := idx.Search(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedIDs := []string{"5", "4", "2"}
+	if res.Total != uint64(len(expectedIDs)) {
+		t.Errorf("expected %d total hits, got %d", len(expectedIDs), res.Total)
+	}
+	if len(res.Hits) != len(expectedIDs) {
+		t.Fatalf("expected %d hits, got %v", len(expectedIDs), res.Hits)
+	}
+	for i, id := range expectedIDs {
+		if res.Hits[i].ID != id {
+			t.Errorf("expected hit %d to be %s, got %s", i, id, res.Hits[i].ID)
+		}
+	}
+	// pinned scores follow the offsets in the requested ids, including
+	// the ones which do not exist, so that they compare across indexes
+	if res.Hits[0].Score != 5 || res.Hits[1].Score != 3 {
+		t.Errorf("expected pinned scores 5 and 3, got %f and %f",
+			res.Hits[0].Score, res.Hits[1].Score)
+	}
+	if res.Hits[2].Score >= 1 {
+		t.Errorf("expected organic score below 1, got %f", res.Hits[2].Score)
+	}
+	for _, term := range res.Facets["body"].Terms {
+		if term.Term == "blue" {
+			t.Errorf("expected excluded document not to be faceted")
+		}
+	}
+
+	// the boost scales both pinned and organic scores
+	unboosted := res.Hits
+	q.SetBoost(2)
+	res, err = idx.Search(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Hits) != len(unboosted) {
+		t.Fatalf("expected %d boosted hits, got %v", len(unboosted), res.Hits)
+	}
+	for i, hit := range res.Hits {
+		if hit.ID != unboosted[i].ID || hit.Score != 2*unboosted[i].Score {
+			t.Errorf("expected hit %s scored %f, got %s scored %f",
+				unboosted[i].ID, 2*unboosted[i].Score, hit.ID, hit.Score)
+		}
+	}
+
+	req.From = 1
+	req.Size = 1
+	res, err = idx.Search(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Hits) != 1 || res.Hits[0].ID != "4" {
+		t.Fatalf("expected second page to hold 4, got %v", res.Hits)
+	}
+
+	var jsonQuery query.PinnedQuery
+	err = json.Unmarshal([]byte(`{"organic":{"match":"red"},"ids":["5"],"excluded_ids":["1"]}`), &jsonQuery)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := query.ParseQuery([]byte(`{"organic":{"match":"red"},"ids":["5"]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := parsed.(*query.PinnedQuery); !ok {
+		t.Errorf("expected pinned query, got %T", parsed)
+	}
+}
+
+func TestSearchTrackTotalHits(t *testing.T) {
+	idx, err := NewMemOnly(NewIndexMapping())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := idx.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	batch := idx.NewBatch()
+	for n := 0; n < 300; n++ {
+		body := "common"
+		if n%10 == 0 {
+			body += " medium"
+		}
+		if n%100 == 0 {
+			body += " rare rare"
+		}
+		err = batch.Index(fmt.Sprintf("%03d", n), map[string]interface{}{"body": body})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = idx.Batch(batch); err != nil {
+		t.Fatal(err)
+	}
+
+	q := NewMatchQuery("common medium rare")
+	q.SetField("body")
+	req := NewSearchRequest(q)
+	exact, err := idx.Search(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exact.Total != 300 || exact.TotalIsLowerBound {
+		t.Fatalf("expected exact total of 300, got %d", exact.Total)
+	}
+
+	checkHits := func(res *SearchResult) {
+		if len(res.Hits) != len(exact.Hits) {
+			t.Fatalf("expected %d hits, got %d", len(exact.Hits), len(res.Hits))
+		}
+		for i, hit := range res.Hits {
+			if hit.ID != exact.Hits[i].ID || hit.Score != exact.Hits[i].Score {
+				t.Errorf("expected hit %d to be %v, got %v", i, exact.Hits[i], hit)
+			}
+		}
+	}
+
+	req.TrackTotalHits = TrackTotalHitsOff
+	res, err := idx.Search(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.TotalIsLowerBound || res.Total >= exact.Total {
+		t.Errorf("expected a lower bound total, got %d", res.Total)
+	}
+	checkHits(res)
+
+	req.TrackTotalHits = 200
+	res, err = idx.Search(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.TotalIsLowerBound || res.Total < 200 || res.Total >= exact.Total {
+		t.Errorf("expected a lower bound total of at least 200, got %d", res.Total)
+	}
+	checkHits(res)
+
+	// facets need every match
+	req.AddFacet("body", NewFacetRequest("body", 10))
+	res, err = idx.Search(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.TotalIsLowerBound || res.Total != exact.Total {
+		t.Errorf("expected exact total with facets, got %d", res.Total)
+	}
+
+	req = NewSearchRequestOptions(q, 0, 0, false)
+	req.TrackTotalHits = 50
+	res, err = idx.Search(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.TotalIsLowerBound || res.Total != 50 {
+		t.Errorf("expected counting to stop at 50, got %d", res.Total)
+	}
+
+	for input, expected := range map[string]int{
+		`{"query":{"match_all":{}}}`:                          TrackTotalHitsExact,
+		`{"query":{"match_all":{}},"track_total_hits":true}`:  TrackTotalHitsExact,
+		`{"query":{"match_all":{}},"track_total_hits":false}`: TrackTotalHitsOff,
+		`{"query":{"match_all":{}},"track_total_hits":1000}`:  1000,
+	} {
+		var sr SearchRequest
+		err = json.Unmarshal([]byte(input), &sr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sr.TrackTotalHits != expected {
+			t.Errorf("expected %d for %s, got %d", expected, input, sr.TrackTotalHits)
+		}
+	}
+}
+
+func TestSearchIndexSort(t *testing.T) {
+	tmpIndexPath := createTmpIndexPath(t)
+	defer cleanupTmpIndexPath(t, tmpIndexPath)
+
+	idx, err := NewUsing(tmpIndexPath, NewIndexMapping(), scorch.Name, scorch.Name,
+		map[string]interface{}{"indexSort": "-n"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// each batch makes up a segment, sorted by descending n
+	for b := 0; b < 5; b++ {
+		batch := idx.NewBatch()
+		for n := b * 10; n < b*10+10; n++ {
+			err = batch.Index(fmt.Sprintf("doc%d", n), map[string]interface{}{"n": n})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err = idx.Batch(batch); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	check := func(idx Index) {
+		req := NewSearchRequestOptions(NewMatchAllQuery(), 3, 1, false)
+		req.SortBy([]string{"-n"})
+		exact, err := idx.Search(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if exact.Total != 50 || exact.TotalIsLowerBound {
+			t.Fatalf("expected exact total of 50, got %d", exact.Total)
+		}
+
+		req.TrackTotalHits = TrackTotalHitsOff
+		res, err := idx.Search(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !res.TotalIsLowerBound || res.Total >= exact.Total {
+			t.Errorf("expected segments to terminate early, got total %d", res.Total)
+		}
+		expectedIDs := []string{"doc48", "doc47", "doc46"}
+		if len(res.Hits) != len(expectedIDs) {
+			t.Fatalf("expected %d hits, got %v", len(expectedIDs), res.Hits)
+		}
+		for i, id := range expectedIDs {
+			if res.Hits[i].ID != id || exact.Hits[i].ID != id {
+				t.Errorf("expected hit %d to be %s, got %s and %s", i, id,
+					res.Hits[i].ID, exact.Hits[i].ID)
+			}
+		}
+
+		// other sort orders visit every match
+		req.SortBy([]string{"n"})
+		res, err = idx.Search(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.TotalIsLowerBound || res.Total != exact.Total {
+			t.Errorf("expected exact total for another sort, got %d", res.Total)
+		}
+		if len(res.Hits) != 3 || res.Hits[0].ID != "doc1" {
+			t.Errorf("expected hits from doc1, got %v", res.Hits)
+		}
+	}
+
+	check(idx)
+
+	// the sort of the segments survives reopening the index
+	if err = idx.Close(); err != nil {
+		t.Fatal(err)
+	}
+	idx, err = Open(tmpIndexPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := idx.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+	check(idx)
+}
+
+func TestSearchParallelism(t *testing.T) {
+	tmpIndexPath := createTmpIndexPath(t)
+	defer cleanupTmpIndexPath(t, tmpIndexPath)
+
+	// keep the segments apart
+	defer func(min int) {
+		scorch.DefaultMinSegmentsForInMemoryMerge = min
+	}(scorch.DefaultMinSegmentsForInMemoryMerge)
+	scorch.DefaultMinSegmentsForInMemoryMerge = 100
+	idx, err := NewUsing(tmpIndexPath, NewIndexMapping(), scorch.Name, scorch.Name,
+		map[string]interface{}{
+			"scorchMergePlanOptions": map[string]interface{}{
+				"maxSegmentsPerTier": 100,
+				"floorSegmentSize":   1,
+			},
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err = idx.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	// each batch makes up a segment
+	for b := 0; b < 6; b++ {
+		batch := idx.NewBatch()
+		for n := b * 20; n < b*20+20; n++ {
+			words := []string{"common"}
+			for w := 0; w < n%4; w++ {
+				words = append(words, "repeated")
+			}
+			// shared is the top tag overall, but not in any segment
+			tag := "shared"
+			if n%20 < 11 {
+				tag = fmt.Sprintf("b%d", b)
+			}
+			err = batch.Index(fmt.Sprintf("doc%03d", n), map[string]interface{}{
+				"n":        n,
+				"desc":     strings.Join(words, " "),
+				"category": fmt.Sprintf("c%d", n%3),
+				"tag":      tag,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err = idx.Batch(batch); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []func() *SearchRequest{
+		func() *SearchRequest {
+			return NewSearchRequestOptions(NewMatchQuery("common repeated"), 15, 5, false)
+		},
+		func() *SearchRequest {
+			req := NewSearchRequestOptions(NewMatchAllQuery(), 10, 0, false)
+			req.SortBy([]string{"-category", "n"})
+			req.AddFacet("categories", NewFacetRequest("category", 5))
+			return req
+		},
+		func() *SearchRequest {
+			req := NewSearchRequestOptions(NewMatchQuery("repeated"), 7, 0, false)
+			req.SortBy([]string{"_id"})
+			req.SearchAfter = []string{"doc050"}
+			return req
+		},
+		func() *SearchRequest {
+			req := NewSearchRequestOptions(NewMatchAllQuery(), 5, 0, false)
+			req.AddFacet("tags", NewFacetRequest("tag", 1))
+			return req
+		},
+	}
+
+	for i, test := range tests {
+		serial, err := idx.Search(test())
+		if err != nil {
+			t.Fatal(err)
+		}
+		req := test()
+		req.Parallelism = 4
+		parallel, err := idx.Search(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if serial.Total != parallel.Total || serial.MaxScore != parallel.MaxScore {
+			t.Errorf("test %d: expected total %d and max score %f, got %d and %f", i,
+				serial.Total, serial.MaxScore, parallel.Total, parallel.MaxScore)
+		}
+		if len(serial.Hits) == 0 || len(serial.Hits) != len(parallel.Hits) {
+			t.Fatalf("test %d: expected %d hits, got %d", i, len(serial.Hits), len(parallel.Hits))
+		}
+		for h := range serial.Hits {
+			if serial.Hits[h].ID != parallel.Hits[h].ID ||
+				serial.Hits[h].Score != parallel.Hits[h].Score {
+				t.Errorf("test %d: hit %d expected %s, got %s", i, h,
+					serial.Hits[h], parallel.Hits[h])
+			}
+		}
+		if !reflect.DeepEqual(serial.Facets, parallel.Facets) {
+			t.Errorf("test %d: expected facets %v, got %v", i, serial.Facets, parallel.Facets)
+		}
+	}
+}
+
+func TestSearchFilterCache(t *testing.T) {
+	tmpIndexPath := createTmpIndexPath(t)
+	defer cleanupTmpIndexPath(t, tmpIndexPath)
+
+	idx, err := NewUsing(tmpIndexPath, NewIndexMapping(), scorch.Name, scorch.Name, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err = idx.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	for b := 0; b < 3; b++ {
+		batch := idx.NewBatch()
+		for n := b * 10; n < b*10+10; n++ {
+			err = batch.Index(fmt.Sprintf("doc%02d", n), map[string]interface{}{
+				"n":     n,
+				"color": []string{"red", "blue"}[n%2],
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err = idx.Batch(batch); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stat := func(name string) uint64 {
+		return idx.StatsMap()["index"].(map[string]interface{})[name].(uint64)
+	}
+
+	min, max := 5.0, 25.0
+	color := NewTermQuery("red")
+	color.SetField("color")
+	n := NewNumericRangeQuery(&min, &max)
+	n.SetField("n")
+	search := func(score string) []string {
+		req := NewSearchRequestOptions(NewConjunctionQuery(color, n), 100, 0, false)
+		req.SortBy([]string{"_id"})
+		req.Score = score
+		res, err := idx.Search(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ids []string
+		for _, hit := range res.Hits {
+			ids = append(ids, hit.ID)
+		}
+		return ids
+	}
+
+	expected := search("")
+	if len(expected) != 10 {
+		t.Fatalf("expected 10 hits, got %v", expected)
+	}
+	if stat("TotFilterCacheMisses") != 0 {
+		t.Errorf("expected scoring searches not to use the cache")
+	}
+
+	for i := 0; i < 2; i++ {
+		if ids := search("none"); !reflect.DeepEqual(ids, expected) {
+			t.Errorf("expected %v, got %v", expected, ids)
+		}
+	}
+	if stat("TotFilterCacheHits") == 0 || stat("CurFilterCacheBytes") == 0 {
+		t.Errorf("expected the filters to be cached, got %d hits",
+			stat("TotFilterCacheHits"))
+	}
+
+	// cached filters do not return deleted documents
+	err = idx.Delete("doc06")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids := search("none"); !reflect.DeepEqual(ids, expected[1:]) {
+		t.Errorf("expected %v, got %v", expected[1:], ids)
+	}
+}
+
+func TestSearchQueryPlan(t *testing.T) {
+	idx, err := NewMemOnly(NewIndexMapping())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err = idx.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	batch := idx.NewBatch()
+	for n := 0; n < 10; n++ {
+		tags := []string{"common"}
+		if n == 3 {
+			tags = append(tags, "rare")
+		}
+		if n%2 == 0 {
+			tags = append(tags, "even")
+		}
+		err = batch.Index(fmt.Sprintf("doc%d", n), map[string]interface{}{
+			"tags": tags,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = idx.Batch(batch); err != nil {
+		t.Fatal(err)
+	}
+
+	term := func(tag string) *query.TermQuery {
+		tq := NewTermQuery(tag)
+		tq.SetField("tags")
+		return tq
+	}
+
+	// nested conjunctions are folded and ordered by doc frequency
+	q := NewConjunctionQuery(term("common"),
+		NewConjunctionQuery(term("even"), NewDisjunctionQuery(term("rare"))))
+	req := NewSearchRequest(q)
+	req.Explain = true
+	res, err := idx.Search(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Total != 0 {
+		t.Errorf("expected no hits, got %d", res.Total)
+	}
+	if res.Plan == nil {
+		t.Fatal("expected plan with explanations")
+	}
+	cq, ok := res.Plan.Query.(*query.ConjunctionQuery)
+	if !ok || len(cq.Conjuncts) != 3 {
+		t.Fatalf("expected folded conjunction, got %#v", res.Plan.Query)
+	}
+	var terms []string
+	for _, conjunct := range cq.Conjuncts {
+		terms = append(terms, conjunct.(*query.TermQuery).Term)
+	}
+	if !reflect.DeepEqual(terms, []string{"rare", "even", "common"}) {
+		t.Errorf("expected conjuncts ordered by doc frequency, got %v", terms)
+	}
+	expectedRewrites := []string{
+		"disjunction: single clause searched on its own",
+		"conjunction: ordered by estimated doc frequency",
+		"conjunction: folded nested conjunction",
+		"conjunction: ordered by estimated doc frequency",
+	}
+	if !reflect.DeepEqual(res.Plan.Rewrites, expectedRewrites) {
+		t.Errorf("expected rewrites %v, got %v", expectedRewrites, res.Plan.Rewrites)
+	}
+
+	req.Explain = false
+	res, err = idx.Search(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Plan != nil {
+		t.Errorf("expected no plan without explanations")
+	}
+
+	// constant score queries score all their matches the same
+	csq := query.NewConstantScoreQuery(NewDisjunctionQuery(term("even"), term("rare")))
+	bq := NewBooleanQuery()
+	bq.AddShould(csq)
+	bq.AddMustNot(NewMatchNoneQuery())
+	req = NewSearchRequest(bq)
+	req.Explain = true
+	res, err = idx.Search(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Total != 6 {
+		t.Errorf("expected 6 hits, got %d", res.Total)
+	}
+	for _, hit := range res.Hits {
+		if hit.Score != res.Hits[0].Score {
+			t.Errorf("expected score %f for %s, got %f", res.Hits[0].Score, hit.ID, hit.Score)
+		}
+	}
+	expectedRewrites = []string{
+		"constant_score: clauses searched as non-scoring filters",
+		"disjunction: removed match_none clause",
+		"disjunction: too few clauses match no document",
+		"boolean: removed match_none clause",
+		"boolean: single should clause searched on its own",
+	}
+	if !reflect.DeepEqual(res.Plan.Rewrites, expectedRewrites) {
+		t.Errorf("expected rewrites %v, got %v", expectedRewrites, res.Plan.Rewrites)
+	}
+}
+
+func TestSearchProfile(t *testing.T) {
+	idx, err := NewMemOnly(NewIndexMapping())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err = idx.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	batch := idx.NewBatch()
+	for n := 0; n < 10; n++ {
+		tags := []string{"common"}
+		if n%3 == 0 {
+			tags = append(tags, "third")
+		}
+		err = batch.Index(fmt.Sprintf("doc%d", n), map[string]interface{}{
+			"tags": tags,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = idx.Batch(batch); err != nil {
+		t.Fatal(err)
+	}
+
+	term := func(tag string) *query.TermQuery {
+		tq := NewTermQuery(tag)
+		tq.SetField("tags")
+		return tq
+	}
+
+	req := NewSearchRequest(NewConjunctionQuery(term("common"), term("third")))
+	req.AddFacet("tags", NewFacetRequest("tags", 2))
+	req.Highlight = NewHighlight()
+	res, err := idx.Search(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Profile != nil {
+		t.Fatal("expected no profile unless asked for")
+	}
+
+	req.Profile = true
+	res, err = idx.Search(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Total != 4 {
+		t.Fatalf("expected 4 hits, got %d", res.Total)
+	}
+	profile := res.Profile
+	if profile == nil || profile.Searcher == nil {
+		t.Fatal("expected profile")
+	}
+	if profile.Collector <= 0 || profile.Facets <= 0 || profile.Highlight <= 0 {
+		t.Errorf("expected phase timings, got %+v", profile)
+	}
+
+	root := profile.Searcher
+	if root.Query != "query.ConjunctionQuery" ||
+		root.Searcher != "searcher.ConjunctionSearcher" {
+		t.Errorf("unexpected root %s %s", root.Query, root.Searcher)
+	}
+	if root.DocsScored != 4 || root.NextCalls != 5 || root.Time <= 0 ||
+		root.BuildTime <= 0 {
+		t.Errorf("unexpected root profile %+v", root)
+	}
+	if len(root.Children) != 2 {
+		t.Fatalf("expected 2 children, got %d", len(root.Children))
+	}
+	var postings uint64
+	for _, child := range root.Children {
+		if child.Query != "query.TermQuery" ||
+			child.Searcher != "searcher.TermSearcher" {
+			t.Errorf("unexpected child %s %s", child.Query, child.Searcher)
+		}
+		if child.NextCalls+child.AdvanceCalls == 0 {
+			t.Errorf("expected calls to child %+v", child)
+		}
+		postings += child.PostingsRead
+	}
+	if postings == 0 || postings > 14 {
+		t.Errorf("expected at most 14 postings read, got %d", postings)
+	}
+
+	// profiles of the indexes of an alias are kept side by side
+	idx2, err := NewMemOnly(NewIndexMapping())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err = idx2.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+	idx.SetName("one")
+	idx2.SetName("two")
+	res, err = NewIndexAlias(idx, idx2).Search(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Profile == nil || len(res.Profile.Indexes) != 2 {
+		t.Fatalf("expected the profiles of both indexes, got %+v", res.Profile)
+	}
+	names := []string{res.Profile.Indexes[0].Index, res.Profile.Indexes[1].Index}
+	sort.Strings(names)
+	if !reflect.DeepEqual(names, []string{"one", "two"}) {
+		t.Errorf("expected profiles named after the indexes, got %v", names)
+	}
+}
+
+// doneAfterContext is done once Done was called more than after times.
+type doneAfterContext struct {
+	context.Context
+	after int
+	calls int
+	done  chan struct{}
+}
+
+func newDoneAfterContext(after int) *doneAfterContext {
+	return &doneAfterContext{
+		Context: context.Background(),
+		after:   after,
+		done:    make(chan struct{}),
+	}
+}
+
+func (c *doneAfterContext) Done() <-chan struct{} {
+	c.calls++
+	if c.calls > c.after {
+		select {
+		case <-c.done:
+		default:
+			close(c.done)
+		}
+	}
+	return c.done
+}
+
+func (c *doneAfterContext) Err() error {
+	select {
+	case <-c.done:
+		return context.DeadlineExceeded
+	default:
+		return nil
+	}
+}
+
+func TestSearchPartialResults(t *testing.T) {
+	tmpIndexPath := createTmpIndexPath(t)
+	defer cleanupTmpIndexPath(t, tmpIndexPath)
+
+	idx, err := NewUsing(tmpIndexPath, NewIndexMapping(), scorch.Name, scorch.Name, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err = idx.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+	idx.SetName("partial")
+
+	for b := 0; b < 3; b++ {
+		batch := idx.NewBatch()
+		for n := b * 1000; n < b*1000+1000; n++ {
+			err = batch.Index(fmt.Sprintf("doc%04d", n), map[string]interface{}{
+				"body": "hello world",
+				"tag":  []string{"even", "odd"}[n%2],
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err = idx.Batch(batch); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	req := NewSearchRequest(NewMatchQuery("hello"))
+	if _, err = idx.SearchInContext(cancelled, req); err != context.Canceled {
+		t.Fatalf("expected context canceled, got %v", err)
+	}
+
+	req.AllowPartialResults = true
+	res, err := idx.SearchInContext(cancelled, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Total != 0 || !res.TotalIsLowerBound || res.Status.TimedOut != 1 {
+		t.Errorf("expected no hits from a timed out index, got %d, status %+v",
+			res.Total, res.Status)
+	}
+	partial := res.Status.Partial["partial"]
+	if partial == nil || !reflect.DeepEqual(partial.Phases, []string{SearchPhaseQuery}) ||
+		partial.Segments == 0 || partial.SegmentsTimedOut != partial.Segments {
+		t.Errorf("expected all segments timed out, got %+v", partial)
+	}
+
+	// the deadline passes once 1024 hits were collected, the hits are
+	// then returned without their stored fields
+	req.Fields = []string{"tag"}
+	res, err = idx.SearchInContext(newDoneAfterContext(2), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Total != collector.CheckDoneEvery || len(res.Hits) != 10 {
+		t.Errorf("expected %d hits counted, 10 returned, got %d, %d",
+			collector.CheckDoneEvery, res.Total, len(res.Hits))
+	}
+	for _, hit := range res.Hits {
+		if hit.Fields != nil {
+			t.Errorf("expected no fields loaded for %s", hit.ID)
+		}
+	}
+	partial = res.Status.Partial["partial"]
+	if partial == nil ||
+		!reflect.DeepEqual(partial.Phases, []string{SearchPhaseQuery, SearchPhaseHighlight}) ||
+		partial.SegmentsTimedOut == 0 || partial.SegmentsTimedOut > partial.Segments {
+		t.Errorf("expected query and highlight timed out, got %+v", partial)
+	}
+
+	// facets only count the hits visited within their budget
+	req = NewSearchRequest(NewMatchQuery("hello"))
+	req.AddFacet("tag", NewFacetRequest("tag", 2))
+	req.Timeouts = &SearchTimeouts{Facets: time.Nanosecond}
+	if _, err = idx.Search(req); err != context.DeadlineExceeded {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+	req.AllowPartialResults = true
+	res, err = idx.Search(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Total != 3000 || res.Facets["tag"].Total >= 3000 {
+		t.Errorf("expected all hits counted, only some faceted, got %d, %d",
+			res.Total, res.Facets["tag"].Total)
+	}
+	partial = res.Status.Partial["partial"]
+	if partial == nil || !reflect.DeepEqual(partial.Phases, []string{SearchPhaseFacets}) {
+		t.Errorf("expected facets timed out, got %+v", partial)
+	}
+
+	// the statuses of the indexes of an alias are merged
+	other, err := NewMemOnly(NewIndexMapping())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err = other.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+	other.SetName("other")
+	req = NewSearchRequest(NewMatchQuery("hello"))
+	req.AllowPartialResults = true
+	res, err = NewIndexAlias(idx, other).SearchInContext(cancelled, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Status.Successful != 2 || res.Status.TimedOut != 2 ||
+		len(res.Status.Partial) != 2 {
+		t.Errorf("expected both indexes timed out, got %+v", res.Status)
+	}
+}
+
+func TestSearchTimeoutsJSON(t *testing.T) {
+	var req SearchRequest
+	err := json.Unmarshal([]byte(`{"query":{"match_all":{}},`+
+		`"timeouts":{"query":"1.5s","facets":500000000,"highlight":null}}`), &req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &SearchTimeouts{Query: 1500 * time.Millisecond, Facets: 500 * time.Millisecond}
+	if !reflect.DeepEqual(req.Timeouts, expected) {
+		t.Errorf("expected timeouts %+v, got %+v", expected, req.Timeouts)
+	}
+
+	buf, err := json.Marshal(req.Timeouts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != `{"query":"1.5s","facets":"500ms"}` {
+		t.Errorf("expected timeouts as duration strings, got %s", buf)
+	}
+
+	err = json.Unmarshal([]byte(`{"query":{"match_all":{}},"timeouts":{"query":"soon"}}`), &req)
+	if err == nil {
+		t.Errorf("expected error parsing invalid timeout")
+	}
+}
+
+func TestPointInTimeRequestJSON(t *testing.T) {
+	var req SearchRequest
+	err := json.Unmarshal([]byte(`{"query":{"match_all":{}},"pit":{"id":"abc","keep_alive":"5m"}}`), &req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &PointInTimeRequest{ID: "abc", KeepAlive: 5 * time.Minute}
+	if !reflect.DeepEqual(req.PointInTime, expected) {
+		t.Errorf("expected point in time %+v, got %+v", expected, req.PointInTime)
+	}
+
+	buf, err := json.Marshal(req.PointInTime)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != `{"id":"abc","keep_alive":"5m0s"}` {
+		t.Errorf("expected keep alive as a duration string, got %s", buf)
+	}
+
+	err = json.Unmarshal([]byte(`{"id":"abc","keep_alive":"forever"}`), &PointInTimeRequest{})
+	if err == nil {
+		t.Errorf("expected error parsing invalid keep alive")
+	}
+}
+
+func TestSearchPointInTime(t *testing.T) {
+	tmpIndexPath := createTmpIndexPath(t)
+	defer cleanupTmpIndexPath(t, tmpIndexPath)
+
+	idx, err := NewUsing(tmpIndexPath, NewIndexMapping(), scorch.Name, scorch.Name, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err = idx.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	batch := idx.NewBatch()
+	for n := 0; n < 20; n++ {
+		err = batch.Index(fmt.Sprintf("doc%02d", n), map[string]interface{}{
+			"body": "hello",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = idx.Batch(batch); err != nil {
+		t.Fatal(err)
+	}
+
+	pitIdx := idx.(PointInTimeIndex)
+	id, err := pitIdx.OpenPointInTime(time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	search := func(pit *PointInTimeRequest, after []string) *SearchResult {
+		req := NewSearchRequestOptions(NewMatchQuery("hello"), 5, 0, false)
+		req.SortBy([]string{"_id"})
+		req.SearchAfter = after
+		req.PointInTime = pit
+		res, err := idx.Search(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+
+	res := search(&PointInTimeRequest{ID: id}, nil)
+	last := res.Hits[len(res.Hits)-1].ID
+	if res.Total != 20 || last != "doc04" {
+		t.Fatalf("expected 20 hits up to doc04, got %d up to %s", res.Total, last)
+	}
+
+	// documents moving between pages are not seen by the point in time
+	err = idx.Delete("doc02")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = idx.Index("doc045", map[string]interface{}{"body": "hello"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res = search(&PointInTimeRequest{ID: id, KeepAlive: time.Minute}, []string{last})
+	if res.Total != 20 || res.Hits[0].ID != "doc05" {
+		t.Errorf("expected the pinned page to start at doc05, got %d from %s",
+			res.Total, res.Hits[0].ID)
+	}
+	res = search(nil, []string{last})
+	if res.Total != 20 || res.Hits[0].ID != "doc045" {
+		t.Errorf("expected the current page to start at doc045, got %d from %s",
+			res.Total, res.Hits[0].ID)
+	}
+
+	// a point in time belongs to a single index of an alias
+	other, err := NewMemOnly(NewIndexMapping())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err = other.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+	pitReq := NewSearchRequest(NewMatchQuery("hello"))
+	pitReq.PointInTime = &PointInTimeRequest{ID: id}
+	res, err = NewIndexAlias(idx).Search(pitReq)
+	if err != nil || res.Total != 20 {
+		t.Errorf("expected 20 pinned hits through the alias, got %v, %v", res, err)
+	}
+	if _, err = NewIndexAlias(idx, other).Search(pitReq); err != ErrorAliasPointInTime {
+		t.Errorf("expected alias point in time error, got %v", err)
+	}
+	_, err = NewIndexAlias(idx, other).Scan(context.Background(),
+		&ScanRequest{Query: NewMatchAllQuery(), PointInTime: pitReq.PointInTime})
+	if err != ErrorAliasPointInTime {
+		t.Errorf("expected alias point in time scan error, got %v", err)
+	}
+
+	err = pitIdx.ClosePointInTime(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := NewSearchRequest(NewMatchQuery("hello"))
+	req.PointInTime = &PointInTimeRequest{ID: id}
+	if _, err = idx.Search(req); err != ErrorPointInTimeNotFound {
+		t.Errorf("expected closed point in time not found, got %v", err)
+	}
+	if err = pitIdx.ClosePointInTime(id); err != ErrorPointInTimeNotFound {
+		t.Errorf("expected closed point in time not found, got %v", err)
+	}
+
+	// points in time expire once not searched for their keep alive
+	id, err = pitIdx.OpenPointInTime(10 * time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	req.PointInTime = &PointInTimeRequest{ID: id}
+	if _, err = idx.Search(req); err != ErrorPointInTimeNotFound {
+		t.Errorf("expected expired point in time not found, got %v", err)
+	}
+
+	// the points in time still open are closed with the index
+	_, err = pitIdx.OpenPointInTime(time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSearchPointInTimeNotRefCounted(t *testing.T) {
+	idx, err := NewMemOnly(NewIndexMapping())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err = idx.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	err = idx.Index("a", map[string]interface{}{"body": "hello"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := idx.(PointInTimeIndex).OpenPointInTime(time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = idx.Index("b", map[string]interface{}{"body": "hello"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the searches of the pinned reader are serialized
+	req := NewSearchRequest(NewMatchQuery("hello"))
+	req.PointInTime = &PointInTimeRequest{ID: id}
+	var wg sync.WaitGroup
+	errs := make(chan error, 4)
+	for n := 0; n < 4; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res, err := idx.Search(req)
+			if err == nil && res.Total != 1 {
+				err = fmt.Errorf("expected 1 pinned hit, got %d", res.Total)
+			}
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestScan(t *testing.T) {
+	indexes := make([]Index, 2)
+	for x := range indexes {
+		idx, err := NewMemOnly(NewIndexMapping())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() {
+			err = idx.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+		}()
+		idx.SetName(fmt.Sprintf("idx%d", x))
+
+		batch := idx.NewBatch()
+		for n := 0; n < 30; n++ {
+			err = batch.Index(fmt.Sprintf("doc%d-%02d", x, n), map[string]interface{}{
+				"n":   n,
+				"tag": []string{"even", "odd"}[n%2],
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err = idx.Batch(batch); err != nil {
+			t.Fatal(err)
+		}
+		indexes[x] = idx
+	}
+
+	tq := NewTermQuery("even")
+	tq.SetField("tag")
+	scan := func(idx Index, req *ScanRequest) []string {
+		it, err := idx.(ScanIndex).Scan(context.Background(), req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() {
+			err = it.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+		}()
+		var rv []string
+		for {
+			doc, err := it.Next()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if doc == nil {
+				return rv
+			}
+			if doc.Score != 0 {
+				t.Errorf("expected no score for %s, got %f", doc.ID, doc.Score)
+			}
+			if req.Fields != nil && doc.Fields["n"] == nil {
+				t.Errorf("expected field loaded for %s", doc.ID)
+			}
+			rv = append(rv, doc.Index+"/"+doc.ID)
+		}
+	}
+
+	ids := scan(indexes[0], &ScanRequest{Query: tq, Fields: []string{"n"}})
+	if len(ids) != 15 {
+		t.Fatalf("expected 15 documents scanned, got %d", len(ids))
+	}
+	for x, id := range ids {
+		if expected := fmt.Sprintf("idx0/doc0-%02d", 2*x); id != expected {
+			t.Errorf("expected %s scanned in index order, got %s", expected, id)
+		}
+	}
+
+	// the indexes of an alias are scanned in turn
+	ids = scan(NewIndexAlias(indexes...), &ScanRequest{Query: tq})
+	if len(ids) != 30 || ids[0] != "idx0/doc0-00" || ids[15] != "idx1/doc1-00" {
+		t.Errorf("expected both indexes scanned in turn, got %v", ids)
+	}
+
+	// the pinned contents of a point in time are scanned
+	id, err := indexes[0].(PointInTimeIndex).OpenPointInTime(time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = indexes[0].Delete("doc0-00"); err != nil {
+		t.Fatal(err)
+	}
+	ids = scan(indexes[0], &ScanRequest{Query: tq, PointInTime: &PointInTimeRequest{ID: id}})
+	if len(ids) != 15 {
+		t.Errorf("expected 15 pinned documents scanned, got %d", len(ids))
+	}
+	if ids = scan(indexes[0], &ScanRequest{Query: tq}); len(ids) != 14 {
+		t.Errorf("expected 14 documents scanned, got %d", len(ids))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	it, err := indexes[1].(ScanIndex).Scan(ctx, &ScanRequest{Query: tq})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	if _, err = it.Next(); err != context.Canceled {
+		t.Errorf("expected context canceled, got %v", err)
+	}
+	if err = it.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,145 @@
+//  Copyright (c) 2024 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bleve
+
+import (
+	"github.com/blevesearch/bleve/v2/index/scorch"
+	"github.com/blevesearch/bleve/v2/registry"
+)
+
+// SnapshotTagIndex is an Index able to tag its persisted snapshots,
+// keeping them as restore points whatever its cleanup policy, and to
+// roll back to them.
+type SnapshotTagIndex interface {
+	Index
+
+	// TagSnapshot tags the latest persisted snapshot with name, and
+	// returns its epoch.
+	TagSnapshot(name string) (uint64, error)
+	// SnapshotTags returns the snapshot tags, by name.
+	SnapshotTags() ([]*scorch.SnapshotTag, error)
+	// DeleteSnapshotTag deletes the named snapshot tag.
+	DeleteSnapshotTag(name string) error
+	// RollbackToSnapshotTag brings the index back to the snapshot of
+	// the named tag, discarding the younger ones.  The index is closed
+	// for the rollback and reopened, its points in time are closed.
+	RollbackToSnapshotTag(name string) error
+}
+
+// snapshotTagger is implemented by the index types supporting snapshot
+// tags, such as scorch.
+type snapshotTagger interface {
+	TagSnapshot(name string) (uint64, error)
+	SnapshotTags() ([]*scorch.SnapshotTag, error)
+	DeleteSnapshotTag(name string) error
+}
+
+func (i *indexImpl) snapshotTagger() (snapshotTagger, error) {
+	i.mutex.RLock()
+	defer i.mutex.RUnlock()
+
+	if !i.open {
+		return nil, ErrorIndexClosed
+	}
+	st, ok := i.i.(snapshotTagger)
+	if !ok || i.path == "" {
+		return nil, ErrorSnapshotTagsNotSupported
+	}
+	return st, nil
+}
+
+func (i *indexImpl) TagSnapshot(name string) (uint64, error) {
+	st, err := i.snapshotTagger()
+	if err != nil {
+		return 0, err
+	}
+	return st.TagSnapshot(name)
+}
+
+func (i *indexImpl) SnapshotTags() ([]*scorch.SnapshotTag, error) {
+	st, err := i.snapshotTagger()
+	if err != nil {
+		return nil, err
+	}
+	return st.SnapshotTags()
+}
+
+func (i *indexImpl) DeleteSnapshotTag(name string) error {
+	st, err := i.snapshotTagger()
+	if err != nil {
+		return err
+	}
+	err = st.DeleteSnapshotTag(name)
+	if err == scorch.ErrSnapshotTagNotFound {
+		return ErrorSnapshotTagNotFound
+	}
+	return err
+}
+
+func (i *indexImpl) RollbackToSnapshotTag(name string) error {
+	st, err := i.snapshotTagger()
+	if err != nil {
+		return err
+	}
+	tags, err := st.SnapshotTags()
+	if err != nil {
+		return err
+	}
+	var found bool
+	for _, tag := range tags {
+		found = found || tag.Name == name
+	}
+	if !found {
+		return ErrorSnapshotTagNotFound
+	}
+
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	if !i.open {
+		return ErrorIndexClosed
+	}
+
+	// the rollback rewrites the root of the closed index, the index is
+	// then reopened even if it failed, to keep serving
+	err = i.closePointsInTime()
+	if cerr := i.i.Close(); cerr != nil {
+		i.open = false
+		return cerr
+	}
+	rerr := scorch.RollbackToTag(indexStorePath(i.path), name)
+
+	config := make(map[string]interface{}, len(i.config))
+	for k, v := range i.config {
+		config[k] = v
+	}
+	config["create_if_missing"] = false
+	config["error_if_exists"] = false
+	ii, oerr := registry.IndexTypeConstructorByName(i.meta.IndexType)(
+		i.meta.Storage, config, Config.analysisQueue)
+	if oerr == nil {
+		oerr = ii.Open()
+	}
+	if oerr != nil {
+		i.open = false
+		return oerr
+	}
+	i.i = ii
+
+	if rerr != nil {
+		return rerr
+	}
+	return err
+}
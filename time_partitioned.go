@@ -0,0 +1,891 @@
+//  Copyright (c) 2024 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bleve
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/blevesearch/bleve/v2/document"
+	"github.com/blevesearch/bleve/v2/index/scorch"
+	"github.com/blevesearch/bleve/v2/mapping"
+	"github.com/blevesearch/bleve/v2/search/query"
+	index "github.com/blevesearch/bleve_index_api"
+)
+
+// TimePartitionedIndexType is the index type of time partitioned indexes,
+// as recorded in their index meta.
+const TimePartitionedIndexType = "time_partitioned"
+
+// timePartitionLayout names the partitions after their start time.
+const timePartitionLayout = "20060102T150405Z"
+
+const timePartitionedMappingFilename = "mapping.json"
+const timePartitionedInternalFilename = "internal.json"
+
+// TimePartitionRetentionInterval is how often the partitions past their
+// retention are dropped.
+var TimePartitionRetentionInterval = time.Minute
+
+// TimePartitionConfig configures a time partitioned index.
+type TimePartitionConfig struct {
+	// Field is the datetime field routing the documents to partitions.
+	Field string
+	// Period is the span of time of each partition, starting at
+	// multiples of Period since the zero time, in UTC.  A whole number
+	// of seconds.
+	Period time.Duration
+	// Retention is how long a partition is kept once its period is over,
+	// forever if 0.
+	Retention time.Duration
+	// KVConfig is the config the scorch index of each partition is
+	// created with.
+	KVConfig map[string]interface{}
+}
+
+func (c *TimePartitionConfig) validate() error {
+	if c.Field == "" {
+		return fmt.Errorf("time partition field required")
+	}
+	if c.Period < time.Second || c.Period%time.Second != 0 {
+		return fmt.Errorf("time partition period %s invalid, must be a"+
+			" whole number of seconds", c.Period)
+	}
+	if c.Retention < 0 {
+		return fmt.Errorf("time partition retention %s negative", c.Retention)
+	}
+	return nil
+}
+
+// metaConfig returns the config as recorded in the index meta, with the
+// durations as strings to keep their precision.
+func (c *TimePartitionConfig) metaConfig() map[string]interface{} {
+	rv := map[string]interface{}{
+		"field":     c.Field,
+		"period":    c.Period.String(),
+		"retention": c.Retention.String(),
+	}
+	if c.KVConfig != nil {
+		rv["kvconfig"] = c.KVConfig
+	}
+	return rv
+}
+
+func parseTimePartitionConfig(m map[string]interface{}) (
+	*TimePartitionConfig, error) {
+	rv := &TimePartitionConfig{}
+	rv.Field, _ = m["field"].(string)
+	for k, d := range map[string]*time.Duration{
+		"period":    &rv.Period,
+		"retention": &rv.Retention,
+	} {
+		s, _ := m[k].(string)
+		v, err := time.ParseDuration(s)
+		if err != nil {
+			return nil, fmt.Errorf("time partition %s: %v", k, err)
+		}
+		*d = v
+	}
+	rv.KVConfig, _ = m["kvconfig"].(map[string]interface{})
+	return rv, rv.validate()
+}
+
+// TimePartition is a partition of a time partitioned index, holding the
+// documents from Start included to End excluded.
+type TimePartition struct {
+	Name  string    `json:"name"`
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// TimePartitionedIndex is an Index routing its documents by the value of
+// a datetime field into partitions, each a scorch index spanning a period
+// of time, under its directory.  Searches only go to the partitions
+// overlapping the date range of their query on that field, if any.  Once
+// past their retention, whole partitions are dropped, in the background.
+//
+// Deletes go to every partition, as the partition of a document is only
+// known from its content.  For the same reason, a document indexed is
+// deleted from every other partition, so that one indexed again with
+// another time moves to the partition of its new time.
+type TimePartitionedIndex interface {
+	Index
+
+	// Partitions returns the partitions, oldest first.
+	Partitions() []*TimePartition
+	// DropExpiredPartitions drops the partitions past their retention at
+	// now, returning their names.
+	DropExpiredPartitions(now time.Time) ([]string, error)
+}
+
+type timePartition struct {
+	TimePartition
+	index Index
+}
+
+type timePartitionedIndex struct {
+	path          string
+	name          string
+	config        *TimePartitionConfig
+	mapping       mapping.IndexMapping
+	runtimeConfig map[string]interface{}
+	alias         *indexAliasImpl
+	closeCh       chan struct{}
+	stats         *IndexStat
+
+	mutex      sync.RWMutex // Protects the fields that follow.
+	open       bool
+	partitions []*timePartition // Oldest first.
+	internal   map[string][]byte
+}
+
+// NewTimePartitioned creates a time partitioned index at path, which must
+// not exist, partitioning the documents mapped by mapping as configured.
+// It is opened again with Open.
+func NewTimePartitioned(path string, mapping mapping.IndexMapping,
+	config TimePartitionConfig) (TimePartitionedIndex, error) {
+	err := config.validate()
+	if err != nil {
+		return nil, err
+	}
+	err = mapping.Validate()
+	if err != nil {
+		return nil, err
+	}
+	mappingBytes, err := json.Marshal(mapping)
+	if err != nil {
+		return nil, err
+	}
+	err = newIndexMeta(TimePartitionedIndexType, "",
+		config.metaConfig()).Save(path)
+	if err != nil {
+		return nil, err
+	}
+	err = ioutil.WriteFile(filepath.Join(path, timePartitionedMappingFilename),
+		mappingBytes, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return newTimePartitionedIndex(path, &config, mapping, nil, nil)
+}
+
+// openTimePartitioned opens the time partitioned index at path, the
+// runtimeConfig applying to each partition.
+func openTimePartitioned(path string, runtimeConfig map[string]interface{}) (
+	rv *timePartitionedIndex, err error) {
+	meta, err := openIndexMeta(path)
+	if err != nil {
+		return nil, err
+	}
+	config, err := parseTimePartitionConfig(meta.Config)
+	if err != nil {
+		return nil, err
+	}
+	mappingBytes, err := ioutil.ReadFile(
+		filepath.Join(path, timePartitionedMappingFilename))
+	if err != nil {
+		return nil, err
+	}
+	var im *mapping.IndexMappingImpl
+	err = json.Unmarshal(mappingBytes, &im)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing mapping JSON: %v\nmapping contents:\n%s", err, string(mappingBytes))
+	}
+
+	var internal []*timePartitionedInternal
+	internalBytes, err := ioutil.ReadFile(
+		filepath.Join(path, timePartitionedInternalFilename))
+	if err == nil {
+		err = json.Unmarshal(internalBytes, &internal)
+	} else if os.IsNotExist(err) {
+		err = nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	finfos, err := ioutil.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+	var partitions []*timePartition
+	defer func() {
+		if err != nil {
+			for _, p := range partitions {
+				_ = p.index.Close()
+			}
+		}
+	}()
+	for _, finfo := range finfos {
+		start, perr := time.Parse(timePartitionLayout, finfo.Name())
+		if perr != nil || !finfo.IsDir() {
+			continue
+		}
+		var idx Index
+		idx, err = OpenUsing(filepath.Join(path, finfo.Name()), runtimeConfig)
+		if err != nil {
+			return nil, err
+		}
+		partitions = append(partitions, &timePartition{
+			TimePartition: TimePartition{
+				Name:  finfo.Name(),
+				Start: start,
+				End:   start.Add(config.Period),
+			},
+			index: idx,
+		})
+	}
+	return newTimePartitionedIndex(path, config, im, runtimeConfig,
+		partitions, internal...)
+}
+
+func newTimePartitionedIndex(path string, config *TimePartitionConfig,
+	mapping mapping.IndexMapping, runtimeConfig map[string]interface{},
+	partitions []*timePartition, internal ...*timePartitionedInternal) (
+	*timePartitionedIndex, error) {
+	rv := &timePartitionedIndex{
+		path:          path,
+		name:          path,
+		config:        config,
+		mapping:       mapping,
+		runtimeConfig: runtimeConfig,
+		alias:         NewIndexAlias(),
+		closeCh:       make(chan struct{}),
+		open:          true,
+		partitions:    partitions,
+		internal:      map[string][]byte{},
+	}
+	rv.stats = &IndexStat{indexStatsMap: rv.partitionsStatsMap}
+	for _, p := range partitions {
+		rv.alias.Add(p.index)
+	}
+	for _, kv := range internal {
+		rv.internal[string(kv.Key)] = kv.Val
+	}
+
+	readOnly, _ := runtimeConfig["read_only"].(bool)
+	if config.Retention > 0 && !readOnly {
+		_, err := rv.DropExpiredPartitions(time.Now())
+		if err != nil {
+			_ = rv.Close()
+			return nil, err
+		}
+		go rv.retentionLoop()
+	}
+	return rv, nil
+}
+
+func (i *timePartitionedIndex) retentionLoop() {
+	ticker := time.NewTicker(TimePartitionRetentionInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-i.closeCh:
+			return
+		case now := <-ticker.C:
+			_, err := i.DropExpiredPartitions(now)
+			if err != nil && err != ErrorIndexClosed {
+				logger.Printf("time partitioned index %s: retention error: %v",
+					i.path, err)
+			}
+		}
+	}
+}
+
+func (i *timePartitionedIndex) expired(start, now time.Time) bool {
+	return i.config.Retention > 0 &&
+		!start.Add(i.config.Period+i.config.Retention).After(now)
+}
+
+func (i *timePartitionedIndex) DropExpiredPartitions(now time.Time) (
+	[]string, error) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	if !i.open {
+		return nil, ErrorIndexClosed
+	}
+
+	var rv []string
+	for len(i.partitions) > 0 && i.expired(i.partitions[0].Start, now) {
+		p := i.partitions[0]
+		err := p.index.Close()
+		if err != nil {
+			return rv, err
+		}
+		i.alias.Remove(p.index)
+		i.partitions = i.partitions[1:]
+		rv = append(rv, p.Name)
+		err = os.RemoveAll(filepath.Join(i.path, p.Name))
+		if err != nil {
+			return rv, err
+		}
+	}
+	return rv, nil
+}
+
+func (i *timePartitionedIndex) Partitions() []*TimePartition {
+	i.mutex.RLock()
+	defer i.mutex.RUnlock()
+
+	rv := make([]*TimePartition, 0, len(i.partitions))
+	for _, p := range i.partitions {
+		tp := p.TimePartition
+		rv = append(rv, &tp)
+	}
+	return rv
+}
+
+// partition returns the partition starting at start, or nil.
+func (i *timePartitionedIndex) partition(start time.Time) *timePartition {
+	n := sort.Search(len(i.partitions), func(n int) bool {
+		return !i.partitions[n].Start.Before(start)
+	})
+	if n < len(i.partitions) && i.partitions[n].Start.Equal(start) {
+		return i.partitions[n]
+	}
+	return nil
+}
+
+// createPartitions creates the partitions starting at starts missing.
+func (i *timePartitionedIndex) createPartitions(starts []time.Time) error {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	if !i.open {
+		return ErrorIndexClosed
+	}
+
+	for _, start := range starts {
+		if i.partition(start) != nil {
+			continue
+		}
+		name := start.Format(timePartitionLayout)
+		kvconfig := make(map[string]interface{}, len(i.config.KVConfig))
+		for k, v := range i.config.KVConfig {
+			kvconfig[k] = v
+		}
+		idx, err := NewUsing(filepath.Join(i.path, name), i.mapping,
+			scorch.Name, Config.DefaultKVStore, kvconfig)
+		if err != nil {
+			return err
+		}
+		i.partitions = append(i.partitions, &timePartition{
+			TimePartition: TimePartition{
+				Name:  name,
+				Start: start,
+				End:   start.Add(i.config.Period),
+			},
+			index: idx,
+		})
+		sort.Slice(i.partitions, func(a, b int) bool {
+			return i.partitions[a].Start.Before(i.partitions[b].Start)
+		})
+		i.alias.Add(idx)
+	}
+	return nil
+}
+
+// documentTime returns the time of doc, the first value of its datetime
+// field.
+func (i *timePartitionedIndex) documentTime(doc index.Document) (
+	time.Time, error) {
+	if d, ok := doc.(*document.Document); ok {
+		for _, field := range d.Fields {
+			if field, ok := field.(*document.DateTimeField); ok &&
+				field.Name() == i.config.Field {
+				return field.DateTime()
+			}
+		}
+	}
+	return time.Time{}, fmt.Errorf("document %s: no datetime field %s",
+		doc.ID(), i.config.Field)
+}
+
+func (i *timePartitionedIndex) Index(id string, data interface{}) error {
+	b := i.NewBatch()
+	err := b.Index(id, data)
+	if err != nil {
+		return err
+	}
+	return i.Batch(b)
+}
+
+func (i *timePartitionedIndex) Delete(id string) error {
+	b := i.NewBatch()
+	b.Delete(id)
+	return i.Batch(b)
+}
+
+func (i *timePartitionedIndex) NewBatch() *Batch {
+	return &Batch{
+		index:    i,
+		internal: index.NewBatch(),
+	}
+}
+
+// Batch routes the documents of b to their partitions, creating those
+// missing, and deletes them from the other partitions.  The deletes go to
+// every partition.  Documents whose partition is past its retention are
+// dropped, and so deleted from every partition.
+//
+// Batch is not atomic across partitions, each partition applying its
+// part of b in turn.  The documents of b are validated and the missing
+// partitions created before anything is applied, but should a partition
+// then fail to apply its part, the partitions before it keep theirs.  As
+// the operations of a batch are idempotent, b can be applied again.
+func (i *timePartitionedIndex) Batch(b *Batch) error {
+	now := time.Now()
+	docs := map[int64][]index.Document{} // Keyed by partition start.
+	indexed := map[string]int64{}        // Partition start by document.
+	var starts []time.Time
+	var deletes []string
+	for id, doc := range b.internal.IndexOps {
+		if doc == nil {
+			deletes = append(deletes, id)
+			continue
+		}
+		t, err := i.documentTime(doc)
+		if err != nil {
+			return err
+		}
+		start := t.UTC().Truncate(i.config.Period)
+		if i.expired(start, now) {
+			deletes = append(deletes, id)
+			continue
+		}
+		if _, ok := docs[start.Unix()]; !ok {
+			starts = append(starts, start)
+		}
+		docs[start.Unix()] = append(docs[start.Unix()], doc)
+		indexed[id] = start.Unix()
+	}
+
+	if len(starts) > 0 {
+		err := i.createPartitions(starts)
+		if err != nil {
+			return err
+		}
+	}
+	if len(b.internal.InternalOps) > 0 {
+		err := i.updateInternal(b.internal.InternalOps)
+		if err != nil {
+			return err
+		}
+	}
+
+	i.mutex.RLock()
+	defer i.mutex.RUnlock()
+
+	if !i.open {
+		return ErrorIndexClosed
+	}
+
+	// partitions dropped since they were created only had expired
+	// documents
+	for _, p := range i.partitions {
+		if len(indexed) == 0 && len(deletes) == 0 {
+			break
+		}
+		pb := p.index.NewBatch()
+		pb.SetDurability(b.durability)
+		for _, doc := range docs[p.Start.Unix()] {
+			pb.internal.Update(doc)
+		}
+		for id, start := range indexed {
+			if start != p.Start.Unix() {
+				pb.Delete(id)
+			}
+		}
+		for _, id := range deletes {
+			pb.Delete(id)
+		}
+		err := p.index.Batch(pb)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (i *timePartitionedIndex) Document(id string) (index.Document, error) {
+	i.mutex.RLock()
+	defer i.mutex.RUnlock()
+
+	if !i.open {
+		return nil, ErrorIndexClosed
+	}
+
+	// the latest partitions are the likeliest to hold the document
+	for n := len(i.partitions) - 1; n >= 0; n-- {
+		doc, err := i.partitions[n].index.Document(id)
+		if err != nil || doc != nil {
+			return doc, err
+		}
+	}
+	return nil, nil
+}
+
+func (i *timePartitionedIndex) DocCount() (uint64, error) {
+	i.mutex.RLock()
+	defer i.mutex.RUnlock()
+
+	if !i.open {
+		return 0, ErrorIndexClosed
+	}
+	return i.alias.DocCount()
+}
+
+func (i *timePartitionedIndex) Search(req *SearchRequest) (*SearchResult, error) {
+	return i.SearchInContext(context.Background(), req)
+}
+
+// SearchInContext searches the partitions overlapping the date range of
+// the query on the partition field.
+func (i *timePartitionedIndex) SearchInContext(ctx context.Context,
+	req *SearchRequest) (*SearchResult, error) {
+	i.mutex.RLock()
+	defer i.mutex.RUnlock()
+
+	if !i.open {
+		return nil, ErrorIndexClosed
+	}
+
+	r := queryTimeRange(req.Query, i.config.Field)
+	var indexes []Index
+	for _, p := range i.partitions {
+		if r.overlaps(p.Start, p.End) {
+			indexes = append(indexes, p.index)
+		}
+	}
+
+	searchStart := time.Now()
+	defer func() {
+		atomic.AddUint64(&i.stats.searches, 1)
+		atomic.AddUint64(&i.stats.searchTime, uint64(time.Since(searchStart)))
+	}()
+
+	// short circuit the simple case
+	if len(indexes) == 1 {
+		return indexes[0].SearchInContext(ctx, req)
+	}
+	return MultiSearch(ctx, req, indexes...)
+}
+
+// timeRange is a range of time, unbounded on the sides left zero.
+type timeRange struct {
+	start, end time.Time
+}
+
+func (r timeRange) intersect(o timeRange) timeRange {
+	if o.start.After(r.start) {
+		r.start = o.start
+	}
+	if !o.end.IsZero() && (r.end.IsZero() || o.end.Before(r.end)) {
+		r.end = o.end
+	}
+	return r
+}
+
+func (r timeRange) union(o timeRange) timeRange {
+	if o.start.IsZero() || o.start.Before(r.start) {
+		r.start = o.start
+	}
+	if r.end.IsZero() || o.end.IsZero() {
+		r.end = time.Time{}
+	} else if o.end.After(r.end) {
+		r.end = o.end
+	}
+	return r
+}
+
+// overlaps returns whether the range overlaps the span of time from start
+// included to end excluded.
+func (r timeRange) overlaps(start, end time.Time) bool {
+	return (r.end.IsZero() || !start.After(r.end)) &&
+		(r.start.IsZero() || end.After(r.start))
+}
+
+// queryTimeRange returns the range of time the documents matching q must
+// be in, going by the date range queries on field that q requires.
+func queryTimeRange(q query.Query, field string) timeRange {
+	switch q := q.(type) {
+	case *query.DateRangeQuery:
+		if q.FieldVal == field {
+			return timeRange{start: q.Start.Time, end: q.End.Time}
+		}
+	case *query.ConjunctionQuery:
+		var rv timeRange
+		for _, conjunct := range q.Conjuncts {
+			rv = rv.intersect(queryTimeRange(conjunct, field))
+		}
+		return rv
+	case *query.DisjunctionQuery:
+		if len(q.Disjuncts) == 0 {
+			break
+		}
+		rv := queryTimeRange(q.Disjuncts[0], field)
+		for _, disjunct := range q.Disjuncts[1:] {
+			rv = rv.union(queryTimeRange(disjunct, field))
+		}
+		return rv
+	case *query.BooleanQuery:
+		if q.Must != nil {
+			return queryTimeRange(q.Must, field)
+		}
+	}
+	return timeRange{}
+}
+
+func (i *timePartitionedIndex) Fields() ([]string, error) {
+	i.mutex.RLock()
+	defer i.mutex.RUnlock()
+
+	if !i.open {
+		return nil, ErrorIndexClosed
+	}
+
+	seen := map[string]struct{}{}
+	var rv []string
+	for _, p := range i.partitions {
+		fields, err := p.index.Fields()
+		if err != nil {
+			return nil, err
+		}
+		for _, field := range fields {
+			if _, ok := seen[field]; !ok {
+				seen[field] = struct{}{}
+				rv = append(rv, field)
+			}
+		}
+	}
+	sort.Strings(rv)
+	return rv, nil
+}
+
+func (i *timePartitionedIndex) FieldDict(field string) (index.FieldDict, error) {
+	return i.fieldDict(func(idx Index) (index.FieldDict, error) {
+		return idx.FieldDict(field)
+	})
+}
+
+func (i *timePartitionedIndex) FieldDictRange(field string, startTerm []byte,
+	endTerm []byte) (index.FieldDict, error) {
+	return i.fieldDict(func(idx Index) (index.FieldDict, error) {
+		return idx.FieldDictRange(field, startTerm, endTerm)
+	})
+}
+
+func (i *timePartitionedIndex) FieldDictPrefix(field string,
+	termPrefix []byte) (index.FieldDict, error) {
+	return i.fieldDict(func(idx Index) (index.FieldDict, error) {
+		return idx.FieldDictPrefix(field, termPrefix)
+	})
+}
+
+// fieldDict merges the field dictionaries of the partitions, in memory.
+func (i *timePartitionedIndex) fieldDict(
+	fieldDict func(Index) (index.FieldDict, error)) (index.FieldDict, error) {
+	i.mutex.RLock()
+	defer i.mutex.RUnlock()
+
+	if !i.open {
+		return nil, ErrorIndexClosed
+	}
+
+	counts := map[string]uint64{}
+	for _, p := range i.partitions {
+		d, err := fieldDict(p.index)
+		if err != nil {
+			return nil, err
+		}
+		entry, err := d.Next()
+		for err == nil && entry != nil {
+			counts[entry.Term] += entry.Count
+			entry, err = d.Next()
+		}
+		if cerr := d.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	rv := &timePartitionedFieldDict{
+		entries: make([]*index.DictEntry, 0, len(counts)),
+	}
+	for term, count := range counts {
+		rv.entries = append(rv.entries, &index.DictEntry{Term: term, Count: count})
+	}
+	sort.Slice(rv.entries, func(a, b int) bool {
+		return rv.entries[a].Term < rv.entries[b].Term
+	})
+	return rv, nil
+}
+
+type timePartitionedFieldDict struct {
+	entries []*index.DictEntry
+}
+
+func (d *timePartitionedFieldDict) Next() (*index.DictEntry, error) {
+	if len(d.entries) == 0 {
+		return nil, nil
+	}
+	rv := d.entries[0]
+	d.entries = d.entries[1:]
+	return rv, nil
+}
+
+func (d *timePartitionedFieldDict) Close() error {
+	return nil
+}
+
+func (i *timePartitionedIndex) Close() error {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	if !i.open {
+		return nil
+	}
+	i.open = false
+	close(i.closeCh)
+
+	var err error
+	for _, p := range i.partitions {
+		if cerr := p.index.Close(); err == nil {
+			err = cerr
+		}
+	}
+	i.partitions = nil
+	if cerr := i.alias.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func (i *timePartitionedIndex) Mapping() mapping.IndexMapping {
+	return i.mapping
+}
+
+// Stats returns the search stats of the index, along with the stats of
+// its partitions.
+func (i *timePartitionedIndex) Stats() *IndexStat {
+	return i.stats
+}
+
+func (i *timePartitionedIndex) StatsMap() map[string]interface{} {
+	return i.stats.statsMap()
+}
+
+func (i *timePartitionedIndex) partitionsStatsMap() map[string]interface{} {
+	i.mutex.RLock()
+	defer i.mutex.RUnlock()
+
+	if !i.open {
+		return nil
+	}
+
+	partitions := make(map[string]interface{}, len(i.partitions))
+	for _, p := range i.partitions {
+		partitions[p.Name] = p.index.StatsMap()
+	}
+	return map[string]interface{}{
+		"partitions": partitions,
+	}
+}
+
+// timePartitionedInternal is an internal key and value, as saved.
+type timePartitionedInternal struct {
+	Key []byte `json:"key"`
+	Val []byte `json:"val"`
+}
+
+// updateInternal applies the internal operations, a nil value deleting
+// the key, and saves the internal values, which are kept along with the
+// partitions rather than in any of them.
+func (i *timePartitionedIndex) updateInternal(ops map[string][]byte) error {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	if !i.open {
+		return ErrorIndexClosed
+	}
+
+	for k, v := range ops {
+		if v == nil {
+			delete(i.internal, k)
+		} else {
+			i.internal[k] = append([]byte(nil), v...)
+		}
+	}
+
+	internal := make([]*timePartitionedInternal, 0, len(i.internal))
+	for k, v := range i.internal {
+		internal = append(internal, &timePartitionedInternal{
+			Key: []byte(k),
+			Val: v,
+		})
+	}
+	buf, err := json.Marshal(internal)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(i.path, timePartitionedInternalFilename)
+	err = ioutil.WriteFile(path+".tmp", buf, 0600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+func (i *timePartitionedIndex) GetInternal(key []byte) ([]byte, error) {
+	i.mutex.RLock()
+	defer i.mutex.RUnlock()
+
+	if !i.open {
+		return nil, ErrorIndexClosed
+	}
+	return i.internal[string(key)], nil
+}
+
+func (i *timePartitionedIndex) SetInternal(key, val []byte) error {
+	return i.updateInternal(map[string][]byte{string(key): val})
+}
+
+func (i *timePartitionedIndex) DeleteInternal(key []byte) error {
+	return i.updateInternal(map[string][]byte{string(key): nil})
+}
+
+// Advanced returns ErrorAliasMulti, each partition being an index.
+func (i *timePartitionedIndex) Advanced() (index.Index, error) {
+	return nil, ErrorAliasMulti
+}
+
+func (i *timePartitionedIndex) Name() string {
+	return i.name
+}
+
+func (i *timePartitionedIndex) SetName(name string) {
+	i.name = name
+}
@@ -0,0 +1,241 @@
+//  Copyright (c) 2024 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bleve
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/blevesearch/bleve/v2/search/query"
+)
+
+func TestTimePartitionedIndex(t *testing.T) {
+	tmpIndexPath := createTmpIndexPath(t)
+	defer cleanupTmpIndexPath(t, tmpIndexPath)
+
+	day := 24 * time.Hour
+	today := time.Now().UTC().Truncate(day)
+	idx, err := NewTimePartitioned(tmpIndexPath, NewIndexMapping(),
+		TimePartitionConfig{Field: "ts", Period: day, Retention: 2 * day})
+	if err != nil {
+		t.Fatal(err)
+	}
+	batch := idx.NewBatch()
+	for id, ts := range map[string]time.Time{
+		"expired":   today.Add(-5 * day),
+		"yesterday": today.Add(-day + time.Hour),
+		"today":     today.Add(time.Hour),
+	} {
+		err = batch.Index(id, map[string]interface{}{
+			"ts":   ts.Format(time.RFC3339),
+			"body": "log line",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = idx.Batch(batch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = idx.Index("untimed", map[string]interface{}{"body": "log line"})
+	if err == nil {
+		t.Errorf("expected an error indexing a document without time")
+	}
+	err = idx.SetInternal([]byte("k"), []byte("v"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = idx.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	i, err := Open(tmpIndexPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx = i.(TimePartitionedIndex)
+	defer func() {
+		err := idx.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	// the expired document is dropped
+	var starts []time.Time
+	for _, p := range idx.Partitions() {
+		starts = append(starts, p.Start)
+	}
+	if !reflect.DeepEqual(starts, []time.Time{today.Add(-day), today}) {
+		t.Errorf("expected partitions of yesterday and today, got %v", starts)
+	}
+	count, err := idx.DocCount()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Errorf("expected 2 documents, got %d", count)
+	}
+	val, err := idx.GetInternal([]byte("k"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(val) != "v" {
+		t.Errorf("expected internal value v, got %q", val)
+	}
+
+	search := func(q query.Query) []string {
+		res, err := idx.Search(NewSearchRequest(q))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ids []string
+		for _, hit := range res.Hits {
+			ids = append(ids, hit.ID)
+		}
+		return ids
+	}
+	body := NewMatchQuery("log")
+	body.SetField("body")
+	if ids := search(body); len(ids) != 2 {
+		t.Errorf("expected 2 hits, got %v", ids)
+	}
+	ts := NewDateRangeQuery(today, today.Add(day))
+	ts.SetField("ts")
+	if ids := search(NewConjunctionQuery(body, ts)); !reflect.DeepEqual(ids,
+		[]string{"today"}) {
+		t.Errorf("expected today's document, got %v", ids)
+	}
+
+	// the stats count the searches, along with the stats of the partitions
+	stats := idx.StatsMap()
+	if stats["searches"] != uint64(2) {
+		t.Errorf("expected 2 searches, got %v", stats["searches"])
+	}
+	partitions, _ := stats["index"].(map[string]interface{})["partitions"].(map[string]interface{})
+	if len(partitions) != 2 {
+		t.Errorf("expected the stats of 2 partitions, got %v", stats["index"])
+	}
+	if _, err = json.Marshal(idx.Stats()); err != nil {
+		t.Errorf("expected stats to marshal, got %v", err)
+	}
+
+	err = idx.Delete("today")
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, err := idx.Document("today")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc != nil {
+		t.Errorf("expected document today deleted")
+	}
+
+	// a document indexed again with another time moves partition
+	err = idx.Index("yesterday", map[string]interface{}{
+		"ts":   today.Add(2 * time.Hour).Format(time.RFC3339),
+		"body": "log line",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	count, err = idx.DocCount()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("expected 1 document, got %d", count)
+	}
+	if ids := search(NewConjunctionQuery(body, ts)); !reflect.DeepEqual(ids,
+		[]string{"yesterday"}) {
+		t.Errorf("expected the moved document today, got %v", ids)
+	}
+
+	// yesterday's partition expires two days after its end
+	dropped, err := idx.DropExpiredPartitions(today.Add(2 * day))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(dropped, []string{today.Add(-day).Format(timePartitionLayout)}) {
+		t.Errorf("expected yesterday's partition dropped, got %v", dropped)
+	}
+	count, err = idx.DocCount()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("expected the moved document kept, got %d", count)
+	}
+}
+
+func TestQueryTimeRange(t *testing.T) {
+	t1 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	t2 := t1.Add(time.Hour)
+	t3 := t2.Add(time.Hour)
+	dateRange := func(field string, start, end time.Time) query.Query {
+		q := NewDateRangeQuery(start, end)
+		q.SetField(field)
+		return q
+	}
+	term := NewTermQuery("x")
+
+	for _, test := range []struct {
+		q        query.Query
+		expected timeRange
+	}{
+		{q: term},
+		{q: dateRange("other", t1, t2)},
+		{q: dateRange("ts", t1, t2), expected: timeRange{t1, t2}},
+		{
+			q:        NewConjunctionQuery(term, dateRange("ts", t1, t3), dateRange("ts", t2, time.Time{})),
+			expected: timeRange{t2, t3},
+		},
+		{
+			q:        NewDisjunctionQuery(dateRange("ts", t1, t2), dateRange("ts", t2, t3)),
+			expected: timeRange{t1, t3},
+		},
+		{q: NewDisjunctionQuery(dateRange("ts", t1, t2), term)},
+		{
+			q:        query.NewBooleanQuery([]query.Query{dateRange("ts", t1, t2)}, []query.Query{term}, nil),
+			expected: timeRange{t1, t2},
+		},
+	} {
+		if got := queryTimeRange(test.q, "ts"); got != test.expected {
+			t.Errorf("expected %v for %#v, got %v", test.expected, test.q, got)
+		}
+	}
+
+	// a range overlaps the partitions holding its bounds
+	r := timeRange{t1, t2}
+	for _, test := range []struct {
+		start, end time.Time
+		expected   bool
+	}{
+		{start: t1.Add(-time.Hour), end: t1, expected: false},
+		{start: t1, end: t2, expected: true},
+		{start: t2, end: t3, expected: true},
+		{start: t3, end: t3.Add(time.Hour), expected: false},
+	} {
+		if got := r.overlaps(test.start, test.end); got != test.expected {
+			t.Errorf("expected overlap of %v with [%v, %v) %t, got %t",
+				r, test.start, test.end, test.expected, got)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+//  Copyright (c) 2024 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bleve
+
+import (
+	"strings"
+
+	"github.com/blevesearch/bleve/v2/document"
+	"github.com/blevesearch/bleve/v2/index/scorch"
+)
+
+// verifyConfig returns the config to read the scorch index at path with,
+// while it is not open, merging the runtimeConfig as when opening it.
+func verifyConfig(path string, runtimeConfig map[string]interface{}) (
+	map[string]interface{}, error) {
+	meta, err := openIndexMeta(path)
+	if err != nil {
+		return nil, err
+	}
+	if meta.IndexType != scorch.Name {
+		return nil, ErrorVerifyNotSupported
+	}
+	rv := map[string]interface{}{}
+	for k, v := range meta.Config {
+		rv[k] = v
+	}
+	for k, v := range runtimeConfig {
+		rv[k] = v
+	}
+	return rv, nil
+}
+
+// Verify checks the index at path, which must not be open, for
+// corruption, reporting the corrupt segments.  The runtimeConfig is the
+// one the index is opened with, providing the settings needed to read
+// it.  Only scorch indexes can be verified.
+func Verify(path string, runtimeConfig map[string]interface{}) (
+	*scorch.VerifyReport, error) {
+	config, err := verifyConfig(path, runtimeConfig)
+	if err != nil {
+		return nil, err
+	}
+	return scorch.Verify(indexStorePath(path), config)
+}
+
+// Repair drops the corrupt segments of report, as returned by Verify,
+// from the index at path, which must not be open.  Their documents are
+// then indexed again from their stored fields, where these can still be
+// read and the documents are not indexed elsewhere, so they come back
+// with the fields stored only.  The files of the dropped segments are
+// only removed once that succeeded, they are otherwise left in the
+// index directory with the .dropped extension.
+func Repair(path string, runtimeConfig map[string]interface{},
+	report *scorch.VerifyReport) (*scorch.RepairReport, error) {
+	config, err := verifyConfig(path, runtimeConfig)
+	if err != nil {
+		return nil, err
+	}
+	rv, err := scorch.Repair(indexStorePath(path), config, report)
+	if err != nil {
+		return nil, err
+	}
+	if len(rv.Recovered) > 0 {
+		err = indexRecovered(path, runtimeConfig, rv.Recovered)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = scorch.RemoveDroppedSegments(indexStorePath(path), rv)
+	if err != nil {
+		return nil, err
+	}
+	return rv, nil
+}
+
+// indexRecovered indexes the recovered documents again, unless they are
+// indexed elsewhere.
+func indexRecovered(path string, runtimeConfig map[string]interface{},
+	recovered []*document.Document) (err error) {
+	idx, err := OpenUsing(path, runtimeConfig)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := idx.Close(); err == nil {
+			err = cerr
+		}
+	}()
+	batch := idx.NewBatch()
+	for _, doc := range recovered {
+		existing, err := idx.Document(doc.ID())
+		if err != nil {
+			return err
+		}
+		if existing != nil {
+			continue
+		}
+		err = batch.Index(doc.ID(), storedFieldsData(doc))
+		if err != nil {
+			return err
+		}
+		if batch.Size() >= 1000 {
+			err = idx.Batch(batch)
+			if err != nil {
+				return err
+			}
+			batch.Reset()
+		}
+	}
+	return idx.Batch(batch)
+}
+
+// storedFieldsData rebuilds the data of a document from its stored
+// fields, to index it again.  Field names are split on dots into nested
+// objects, and the values of array fields are gathered in order, without
+// their nesting.
+func storedFieldsData(doc *document.Document) map[string]interface{} {
+	rv := map[string]interface{}{}
+	for _, field := range doc.Fields {
+		var value interface{}
+		var err error
+		switch field := field.(type) {
+		case *document.TextField:
+			value = field.Text()
+		case *document.NumericField:
+			value, err = field.Number()
+		case *document.DateTimeField:
+			value, err = field.DateTime()
+		case *document.BooleanField:
+			value, err = field.Boolean()
+		case *document.GeoPointField:
+			var lon, lat float64
+			lon, err = field.Lon()
+			if err == nil {
+				lat, err = field.Lat()
+			}
+			value = map[string]interface{}{"lon": lon, "lat": lat}
+		default:
+			continue
+		}
+		if err != nil {
+			continue
+		}
+
+		path := strings.Split(field.Name(), ".")
+		m := rv
+		for _, name := range path[:len(path)-1] {
+			next, ok := m[name].(map[string]interface{})
+			if !ok {
+				next = map[string]interface{}{}
+				m[name] = next
+			}
+			m = next
+		}
+		name := path[len(path)-1]
+		if len(field.ArrayPositions()) > 0 {
+			values, _ := m[name].([]interface{})
+			m[name] = append(values, value)
+		} else {
+			m[name] = value
+		}
+	}
+	return rv
+}